@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	alertHistory      = 200
+	alertTick         = 250 * time.Millisecond
+	alertQueue        = 100
+	webhookTimeout    = 5 * time.Second
+	alertDrainTimeout = 3 * time.Second
+	defaultErrorClear = 10.0
+)
+
+// AlertsConfig is the alerts section of the config file.
+type AlertsConfig struct {
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Rules    []AlertRule     `yaml:"rules"`
+}
+
+// WebhookConfig is a notification target. Format "slack" posts
+// {"text": ...} for Slack/Teams/Mattermost incoming webhooks; the default
+// posts the AlertEvent as JSON.
+type WebhookConfig struct {
+	Name   string `yaml:"name"`
+	URL    string `yaml:"url"`
+	Format string `yaml:"format"`
+}
+
+// AlertRule is one alert condition.
+//
+//   - above/below: Signal is beyond Threshold for ForS seconds; it resolves
+//     once the value is back past Threshold by Hysteresis.
+//   - stale: Signal has not been updated for StaleS seconds.
+//   - error: an error frame was seen; it resolves after ClearS seconds
+//     without error frames.
+//   - e2e: a protected frame (Frame, or any when empty) failed its counter
+//     or CRC check; it resolves after ClearS seconds without failures.
+type AlertRule struct {
+	Name       string   `yaml:"name" json:"name"`
+	Kind       string   `yaml:"kind" json:"kind"`
+	Signal     string   `yaml:"signal" json:"signal,omitempty"`
+	Frame      string   `yaml:"frame" json:"frame,omitempty"`
+	Threshold  float64  `yaml:"threshold" json:"threshold,omitempty"`
+	Hysteresis float64  `yaml:"hysteresis" json:"hysteresis,omitempty"`
+	ForS       float64  `yaml:"for_s" json:"for_s,omitempty"`
+	StaleS     float64  `yaml:"stale_s" json:"stale_s,omitempty"`
+	ClearS     float64  `yaml:"clear_s" json:"clear_s,omitempty"`
+	Severity   string   `yaml:"severity" json:"severity"`
+	Webhooks   []string `yaml:"webhooks" json:"webhooks,omitempty"`
+}
+
+type AlertEvent struct {
+	TS       time.Time `json:"ts"`
+	Rule     string    `json:"rule"`
+	Severity string    `json:"severity"`
+	State    string    `json:"state"` // firing | resolved
+	Message  string    `json:"message"`
+	Value    *float64  `json:"value,omitempty"`
+}
+
+type ActiveAlert struct {
+	Rule     string    `json:"rule"`
+	Severity string    `json:"severity"`
+	Since    time.Time `json:"since"`
+	Message  string    `json:"message"`
+}
+
+type AlertsSnapshot struct {
+	Rules   []AlertRule   `json:"rules"`
+	Active  []ActiveAlert `json:"active"`
+	History []AlertEvent  `json:"history"`
+}
+
+type alertState struct {
+	rule    AlertRule
+	firing  bool
+	since   time.Time // firing since
+	pending time.Time // condition true since, zero if not
+	last    time.Time // last signal update / error frame
+	value   float64
+	message string
+}
+
+type webhookJob struct {
+	hook WebhookConfig
+	ev   AlertEvent
+}
+
+// AlertEngine evaluates alert rules against decoded signals and error
+// frames and notifies webhooks when alerts fire or resolve. It works on
+// wall-clock time, since alerting is about the live bus.
+type AlertEngine struct {
+	mu       sync.Mutex
+	states   []*alertState
+	bySignal map[string][]*alertState
+	hooks    map[string]WebhookConfig
+	history  []AlertEvent
+	queue    chan webhookJob
+	client   *http.Client
+
+	// OnEvent, if set, is called with every firing and resolved event,
+	// under the engine's lock.
+	OnEvent func(AlertEvent)
+}
+
+func NewAlertEngine(cfg AlertsConfig) (*AlertEngine, error) {
+	a := &AlertEngine{
+		bySignal: make(map[string][]*alertState),
+		hooks:    make(map[string]WebhookConfig),
+		queue:    make(chan webhookJob, alertQueue),
+		client:   &http.Client{Timeout: webhookTimeout},
+	}
+	for _, h := range cfg.Webhooks {
+		if h.Name == "" || h.URL == "" {
+			return nil, errors.New("alert webhooks need a name and url")
+		}
+		a.hooks[h.Name] = h
+	}
+
+	now := time.Now()
+	for _, r := range cfg.Rules {
+		if r.Name == "" {
+			return nil, errors.New("alert rules need a name")
+		}
+		switch r.Kind {
+		case "above", "below":
+			if r.Signal == "" {
+				return nil, fmt.Errorf("alert %s: signal is required", r.Name)
+			}
+			if r.Hysteresis < 0 {
+				return nil, fmt.Errorf("alert %s: hysteresis must not be negative", r.Name)
+			}
+		case "stale":
+			if r.Signal == "" || r.StaleS <= 0 {
+				return nil, fmt.Errorf("alert %s: signal and stale_s are required", r.Name)
+			}
+		case "error", "e2e":
+			if r.ClearS <= 0 {
+				r.ClearS = defaultErrorClear
+			}
+		default:
+			return nil, fmt.Errorf("alert %s: unknown kind %q (want above, below, stale, error or e2e)", r.Name, r.Kind)
+		}
+		if r.Severity == "" {
+			r.Severity = "warning"
+		}
+		for _, name := range r.Webhooks {
+			if _, ok := a.hooks[name]; !ok {
+				return nil, fmt.Errorf("alert %s: unknown webhook %q", r.Name, name)
+			}
+		}
+
+		// stale rules count from startup, so a signal that never shows up
+		// still alerts
+		st := &alertState{rule: r, last: now}
+		a.states = append(a.states, st)
+		if r.Signal != "" {
+			a.bySignal[r.Signal] = append(a.bySignal[r.Signal], st)
+		}
+	}
+	return a, nil
+}
+
+// ObserveSignal evaluates the rules watching frame.name (rules may name
+// either "name" or "FRAME.name").
+func (a *AlertEngine) ObserveSignal(frame, name string, v float64) {
+	if len(a.bySignal) == 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for _, key := range [2]string{name, frame + "." + name} {
+		for _, st := range a.bySignal[key] {
+			st.last = now
+			st.value = v
+			a.evalSignal(st, now)
+		}
+	}
+}
+
+func (a *AlertEngine) ObserveError(detail string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for _, st := range a.states {
+		if st.rule.Kind != "error" {
+			continue
+		}
+		st.last = now
+		if !st.firing {
+			a.transition(st, true, now, "error frame: "+detail, nil)
+		}
+	}
+}
+
+// ObserveE2E fires the e2e rules watching frame after a failed check.
+func (a *AlertEngine) ObserveE2E(frame, result string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for _, st := range a.states {
+		if st.rule.Kind != "e2e" || (st.rule.Frame != "" && st.rule.Frame != frame) {
+			continue
+		}
+		st.last = now
+		if !st.firing {
+			a.transition(st, true, now, fmt.Sprintf("%s: e2e %s", frame, result), nil)
+		}
+	}
+}
+
+// evalSignal applies one above/below/stale rule. a.mu must be held.
+func (a *AlertEngine) evalSignal(st *alertState, now time.Time) {
+	r := st.rule
+	switch r.Kind {
+	case "stale":
+		if st.firing {
+			a.transition(st, false, now, fmt.Sprintf("%s updating again", r.Signal), &st.value)
+		}
+		return
+	case "above", "below":
+	default:
+		return
+	}
+
+	var trip, clear bool
+	if r.Kind == "above" {
+		trip, clear = st.value > r.Threshold, st.value < r.Threshold-r.Hysteresis
+	} else {
+		trip, clear = st.value < r.Threshold, st.value > r.Threshold+r.Hysteresis
+	}
+
+	if st.firing {
+		if clear {
+			back := "below"
+			if r.Kind == "below" {
+				back = "above"
+			}
+			a.transition(st, false, now, fmt.Sprintf("%s = %g back %s %g", r.Signal, st.value, back, r.Threshold), &st.value)
+		}
+		return
+	}
+	if !trip {
+		st.pending = time.Time{}
+		return
+	}
+	if st.pending.IsZero() {
+		st.pending = now
+	}
+	if now.Sub(st.pending) >= secs(r.ForS) {
+		a.transition(st, true, now, fmt.Sprintf("%s = %g %s %g", r.Signal, st.value, r.Kind, r.Threshold), &st.value)
+	}
+}
+
+// tick handles the time-based conditions: hold times without new samples,
+// stale signals and error alerts clearing. a.mu must be held.
+func (a *AlertEngine) tick(now time.Time) {
+	for _, st := range a.states {
+		r := st.rule
+		switch r.Kind {
+		case "above", "below":
+			if !st.firing && !st.pending.IsZero() {
+				a.evalSignal(st, now)
+			}
+		case "stale":
+			if !st.firing && now.Sub(st.last) >= secs(r.StaleS) {
+				a.transition(st, true, now, fmt.Sprintf("%s not updated for %gs", r.Signal, r.StaleS), nil)
+			}
+		case "error":
+			if st.firing && now.Sub(st.last) >= secs(r.ClearS) {
+				a.transition(st, false, now, fmt.Sprintf("no error frames for %gs", r.ClearS), nil)
+			}
+		case "e2e":
+			if st.firing && now.Sub(st.last) >= secs(r.ClearS) {
+				a.transition(st, false, now, fmt.Sprintf("no e2e failures for %gs", r.ClearS), nil)
+			}
+		}
+	}
+}
+
+// transition records a firing/resolved edge and queues notifications.
+// a.mu must be held.
+func (a *AlertEngine) transition(st *alertState, firing bool, now time.Time, msg string, value *float64) {
+	st.firing = firing
+	st.pending = time.Time{}
+	st.message = msg
+	if firing {
+		st.since = now
+	}
+	ev := AlertEvent{TS: now, Rule: st.rule.Name, Severity: st.rule.Severity, State: "resolved", Message: msg}
+	if firing {
+		ev.State = "firing"
+	}
+	if value != nil {
+		v := clampFinite(*value)
+		ev.Value = &v
+	}
+	level := slog.LevelInfo
+	if firing {
+		level = slog.LevelWarn
+	}
+	slog.Log(context.Background(), level, "alert "+ev.State, "rule", ev.Rule, "severity", ev.Severity, "message", msg)
+
+	a.history = append(a.history, ev)
+	if a.OnEvent != nil {
+		a.OnEvent(ev)
+	}
+	if len(a.history) > alertHistory {
+		a.history = a.history[len(a.history)-alertHistory:]
+	}
+	for _, name := range st.rule.Webhooks {
+		select {
+		case a.queue <- webhookJob{hook: a.hooks[name], ev: ev}:
+		default:
+			slog.Warn("alert webhook queue full, dropping notification", "rule", ev.Rule, "webhook", name)
+		}
+	}
+}
+
+// Run evaluates time-based conditions and delivers webhooks until ctx is
+// cancelled.
+func (a *AlertEngine) Run(ctx context.Context) {
+	// Deliveries outlive ctx by alertDrainTimeout, so the notification in
+	// flight and those still queued at shutdown are not lost.
+	sendCtx, stopSend := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopSend()
+	context.AfterFunc(ctx, func() { time.AfterFunc(alertDrainTimeout, stopSend) })
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				a.drain(sendCtx)
+				return
+			case job := <-a.queue:
+				if err := a.deliver(sendCtx, job); err != nil {
+					slog.Error("alert webhook failed", "rule", job.ev.Rule, "webhook", job.hook.Name, "err", err)
+				}
+			}
+		}
+	}()
+
+	t := time.NewTicker(alertTick)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			a.mu.Lock()
+			a.tick(now)
+			a.mu.Unlock()
+		}
+	}
+}
+
+// drain delivers the notifications still queued at shutdown until ctx
+// ends.
+func (a *AlertEngine) drain(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			slog.Warn("alert notifications dropped at shutdown", "count", len(a.queue))
+			return
+		}
+		select {
+		case job := <-a.queue:
+			if err := a.deliver(ctx, job); err != nil {
+				slog.Error("alert webhook failed", "rule", job.ev.Rule, "webhook", job.hook.Name, "err", err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (a *AlertEngine) deliver(ctx context.Context, job webhookJob) error {
+	var body any = job.ev
+	if job.hook.Format == "slack" {
+		icon := ":rotating_light:"
+		if job.ev.State == "resolved" {
+			icon = ":white_check_mark:"
+		}
+		body = map[string]string{"text": fmt.Sprintf("%s [%s] %s %s: %s", icon, job.ev.Severity, job.ev.Rule, job.ev.State, job.ev.Message)}
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.hook.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return nil
+}
+
+func (a *AlertEngine) Snapshot() AlertsSnapshot {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	snap := AlertsSnapshot{Rules: []AlertRule{}, Active: []ActiveAlert{}}
+	for _, st := range a.states {
+		snap.Rules = append(snap.Rules, st.rule)
+		if st.firing {
+			snap.Active = append(snap.Active, ActiveAlert{Rule: st.rule.Name, Severity: st.rule.Severity, Since: st.since, Message: st.message})
+		}
+	}
+	sort.Slice(snap.Active, func(i, j int) bool { return snap.Active[i].Since.Before(snap.Active[j].Since) })
+	snap.History = make([]AlertEvent, len(a.history))
+	copy(snap.History, a.history)
+	return snap
+}
+
+func secs(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
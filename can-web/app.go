@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+// App bundles the long-lived subsystems shared by the CAN reader, the web
+// server and the terminal dashboard. Every bus the server reads has an App
+// of its own; see Buses.
+type App struct {
+	Iface        string
+	Source       string
+	Conn         *ConnState
+	Store        *Store
+	StoreSync    *StoreSync
+	Deadband     *Deadband
+	Decoder      *Decoder
+	Stats        *BusStats
+	Errors       *ErrorMonitor
+	Profiles     *Profiles
+	Recorder     *Recorder
+	Markers      *MarkerLog
+	Dashboards   *Dashboards
+	Sessions     *Sessions
+	Unknown      *UnknownInventory
+	Clock        *Clock
+	DecodeErrors *DecodeErrors
+	DLC          *DLCMonitor
+	Frames       *FrameCache
+	SignalStats  *SignalStats
+	E2E          *E2EMonitor
+	Heat         *PayloadAnalyzer
+	Triggers     *Triggers
+	Alerts       *AlertEngine
+	History      *HistoryStore // nil when disabled
+	Sinks        *Sinks
+	Gateway      *Gateway       // nil when disabled
+	Replay       *ReplayControl // nil unless the source is a replay
+	Tx           Transmitter
+	TxGuard      *TxGuard
+	UDS          *UDSClient
+	Generator    *Generator
+	Sequencer    *Sequencer
+	Control      *ControlAPI
+	Audit        *AuditLog
+	Telemetry    *Telemetry // nil when disabled; started by serve
+	Auth         *Auth
+
+	// Buses are all buses this server reads, the first one first. Each
+	// has its own map, store, statistics and analysers; everything else,
+	// from history and alerts to control and TX, is the first bus's.
+	Buses []*App
+
+	// OnFrame, if set, is called for every data frame after it has been
+	// stored; def is nil for unmapped IDs.
+	OnFrame func(f can.Frame, def *FrameDef, ts time.Time)
+}
+
+func NewApp(cfg Config) (*App, error) {
+	if err := checkBuses(cfg); err != nil {
+		return nil, err
+	}
+
+	var service []AuthUserConfig
+	if cfg.Control.Token != "" {
+		service = append(service, AuthUserConfig{Name: "control", Role: "operator", Token: cfg.Control.Token})
+	}
+	auth, err := NewAuth(cfg.Auth.Users, service...)
+	if err != nil {
+		return nil, err
+	}
+
+	audit, err := NewAuditLog(cfg.Audit)
+	if err != nil {
+		return nil, err
+	}
+
+	dashboards, err := NewDashboards(cfg.Dashboards)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := NewSessions(cfg.Sessions)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts, err := NewAlertEngine(cfg.Alerts)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := NewHistoryStore(cfg.History, cfg.Iface)
+	if err != nil {
+		return nil, err
+	}
+
+	sinks, err := NewSinks(cfg.Sinks, cfg.Iface)
+	if err != nil {
+		return nil, err
+	}
+
+	gateway, err := NewGateway(cfg.Gateway, cfg.Iface, cfg.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	app := &App{
+		Source:     cfg.Source,
+		Recorder:   NewRecorder(cfg.Record.Dir),
+		Markers:    NewMarkerLog(500),
+		Dashboards: dashboards,
+		Sessions:   sessions,
+		Clock:      NewClock(),
+		Triggers:   NewTriggers(),
+		Alerts:     alerts,
+		History:    history,
+		Sinks:      sinks,
+		Gateway:    gateway,
+		Control:    NewControlAPI(),
+		Audit:      audit,
+		Auth:       auth,
+	}
+	if err := app.setBus(cfg, cfg.Iface); err != nil {
+		return nil, err
+	}
+	if cfg.Source == "replay" {
+		app.Replay = NewReplayControl(cfg.Replay.Speed, cfg.Replay.Loop)
+	}
+	app.Control.Audit = audit
+	if app.Tx, err = NewTransmitter(cfg, app); err != nil {
+		return nil, err
+	}
+	if app.TxGuard, err = NewTxGuard(cfg.Tx, cfg.Source); err != nil {
+		return nil, err
+	}
+	if app.UDS, err = NewUDSClient(app, cfg.UDS); err != nil {
+		return nil, err
+	}
+	if app.Generator, err = NewGenerator(app, cfg.Generator); err != nil {
+		return nil, err
+	}
+	app.Sequencer = NewSequencer(app, cfg.Sequences)
+	for _, tc := range cfg.Triggers {
+		if err := app.Triggers.Arm(tc); err != nil {
+			return nil, fmt.Errorf("trigger %q: %w", tc.Name, err)
+		}
+	}
+	registerControlActions(app)
+	registerSendAction(app)
+	registerTxGuardActions(app)
+	registerInterfaceAction(app, cfg.Interfaces.Manage)
+	registerReplayActions(app)
+	registerUDSActions(app)
+	registerTesterPresentAction(app)
+	registerGeneratorActions(app)
+	registerSequenceActions(app)
+	registerDashboardActions(app)
+	registerClockActions(app)
+	registerSessionActions(app)
+	alerts.OnEvent = sessions.ObserveAlert
+
+	app.Buses = []*App{app}
+	for _, name := range cfg.Buses {
+		b := *app
+		if err := b.setBus(cfg, name); err != nil {
+			return nil, fmt.Errorf("bus %s: %w", name, err)
+		}
+		app.Buses = append(app.Buses, &b)
+	}
+	for _, b := range app.Buses {
+		b.Buses = app.Buses
+	}
+	return app, nil
+}
+
+// checkBuses rejects a buses list the source cannot read.
+func checkBuses(cfg Config) error {
+	if len(cfg.Buses) == 0 {
+		return nil
+	}
+	switch cfg.Source {
+	case "socketcan", "sim", "replay":
+	default:
+		return fmt.Errorf("buses need the socketcan, sim or replay source, not %s", cfg.Source)
+	}
+	seen := map[string]bool{cfg.Iface: true}
+	for _, b := range cfg.Buses {
+		if seen[b] {
+			return fmt.Errorf("bus %s is listed twice", b)
+		}
+		seen[b] = true
+	}
+	return nil
+}
+
+// setBus gives app the state of its own bus, iface: map, store, statistics,
+// analysers and decoder.
+func (app *App) setBus(cfg Config, iface string) error {
+	paths := maps.Clone(cfg.Profiles)
+	if paths == nil {
+		paths = make(map[string]string)
+	}
+	paths["default"] = cfg.busMap(iface)
+	profiles, err := NewProfiles(paths, "default")
+	if err != nil {
+		return err
+	}
+
+	rawPolicy, err := cfg.rawPolicy()
+	if err != nil {
+		return err
+	}
+
+	deadband, err := NewDeadband(cfg.Deadband)
+	if err != nil {
+		return err
+	}
+
+	store := NewStore(iface, cfg.RawCapacity, cfg.RawBuffer.PerID, rawPolicy)
+	storeSync, err := NewStoreSync(cfg.Store, store, iface, cfg.RawCapacity)
+	if err != nil {
+		return err
+	}
+	storeSync.Restore()
+
+	app.Iface = iface
+	app.Profiles = profiles
+	app.Deadband = deadband
+	app.Store = store
+	app.StoreSync = storeSync
+	app.Conn = NewConnState(store.Touch)
+	app.Stats = NewBusStats(cfg.Bitrate)
+	app.Errors = NewErrorMonitor(100)
+	app.Unknown = NewUnknownInventory()
+	app.DecodeErrors = NewDecodeErrors()
+	app.DLC = NewDLCMonitor(cfg.Decode.SkipDLCMismatch)
+	app.Frames = NewFrameCache()
+	app.SignalStats = NewSignalStats()
+	app.E2E = NewE2EMonitor()
+	app.Heat = NewPayloadAnalyzer()
+	app.Decoder = NewDecoder(app, cfg.Decode.Workers, max(cfg.Decode.Queue, 1), cfg.Source == "sim" || cfg.Source == "replay")
+	return nil
+}
+
+// Bus returns the bus named name, or the first bus for "".
+func (app *App) Bus(name string) (*App, bool) {
+	if name == "" {
+		return app.Buses[0], true
+	}
+	for _, b := range app.Buses {
+		if b.Iface == name {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// BusNames lists the buses in order.
+func (app *App) BusNames() []string {
+	names := make([]string, len(app.Buses))
+	for i, b := range app.Buses {
+		names[i] = b.Iface
+	}
+	return names
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LoadARXML converts the CAN frames of an AUTOSAR 4 system description
+// into frame definitions: every CAN-FRAME-TRIGGERING of every CAN cluster,
+// with the I-SIGNALs of the I-SIGNAL-I-PDUs packed into the frame. Scaling
+// comes from LINEAR (or the linear scale of SCALE_LINEAR_AND_TEXTTABLE)
+// compu methods, ranges from data constraints. Frames longer than 8 bytes,
+// multiplexed and container PDUs and float signals are skipped.
+func LoadARXML(path string) (map[uint32]FrameDef, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	root, err := parseXMLTree(f)
+	if err != nil {
+		return nil, err
+	}
+	if root.Name != "AUTOSAR" {
+		return nil, fmt.Errorf("not an ARXML file (root element %s)", root.Name)
+	}
+
+	a := &arxml{byPath: make(map[string]*xmlNode)}
+	a.index(root, "")
+
+	frames := make(map[uint32]FrameDef)
+	for _, tr := range root.All("CAN-FRAME-TRIGGERING") {
+		idText := tr.Value("IDENTIFIER")
+		id, err := strconv.ParseUint(idText, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("frame triggering %s: bad identifier %q", tr.Value("SHORT-NAME"), idText)
+		}
+		frame := a.ref(tr.Child("FRAME-REF"))
+		if frame == nil {
+			return nil, fmt.Errorf("frame triggering %s: unresolved frame %s", tr.Value("SHORT-NAME"), tr.Value("FRAME-REF"))
+		}
+		fd, err := a.frame(uint32(id), frame)
+		if err != nil {
+			return nil, fmt.Errorf("frame %s: %w", frame.Value("SHORT-NAME"), err)
+		}
+		fd.Node = a.sender(tr)
+		if fd.DLC > 8 {
+			slog.Warn("arxml: skipping frame longer than 8 bytes", "frame", fd.Name, "id", fmt.Sprintf("0x%03X", fd.ID), "length", fd.DLC)
+			continue
+		}
+		if prev, dup := frames[fd.ID]; dup {
+			if prev.Name == fd.Name {
+				continue // the same frame on another channel
+			}
+			return nil, fmt.Errorf("duplicate frame id 0x%X (%s and %s)", fd.ID, prev.Name, fd.Name)
+		}
+		frames[fd.ID] = fd
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("no CAN frames")
+	}
+	return frames, nil
+}
+
+type arxml struct {
+	byPath map[string]*xmlNode // "/Package/Element" -> element
+}
+
+// index records every element with a SHORT-NAME under its AUTOSAR path.
+func (a *arxml) index(n *xmlNode, prefix string) {
+	if name := n.Value("SHORT-NAME"); name != "" {
+		prefix += "/" + name
+		a.byPath[prefix] = n
+	}
+	for _, c := range n.Children {
+		a.index(c, prefix)
+	}
+}
+
+// ref resolves a *-REF element, nil when it is missing or dangling.
+func (a *arxml) ref(n *xmlNode) *xmlNode {
+	if n == nil {
+		return nil
+	}
+	return a.byPath[strings.TrimSpace(n.Text)]
+}
+
+// sender names the ECU instance owning the outgoing frame port of a frame
+// triggering, "" when there is none.
+func (a *arxml) sender(tr *xmlNode) string {
+	for _, ref := range tr.Child("FRAME-PORT-REFS").All("FRAME-PORT-REF") {
+		path := strings.TrimSpace(ref.Text)
+		if a.byPath[path].Value("COMMUNICATION-DIRECTION") != "OUT" {
+			continue
+		}
+		// the port sits in a connector of the ECU instance
+		for path != "" {
+			if n := a.byPath[path]; n != nil && n.Name == "ECU-INSTANCE" {
+				return n.Value("SHORT-NAME")
+			}
+			path = path[:max(strings.LastIndex(path, "/"), 0)]
+		}
+	}
+	return ""
+}
+
+func (a *arxml) frame(id uint32, frame *xmlNode) (FrameDef, error) {
+	length, _ := strconv.Atoi(frame.Value("FRAME-LENGTH"))
+	fd := FrameDef{ID: id, Name: frame.Value("SHORT-NAME"), DLC: uint8(min(length, 255))}
+	if length > 8 {
+		return fd, nil
+	}
+	for _, m := range frame.All("PDU-TO-FRAME-MAPPING") {
+		pdu := a.ref(m.Child("PDU-REF"))
+		if pdu == nil || pdu.Name != "I-SIGNAL-I-PDU" {
+			continue
+		}
+		pduStart, _ := strconv.Atoi(m.Value("START-POSITION"))
+		if p := a.cycleMs(pdu); p > 0 && fd.CycleMs == 0 {
+			fd.CycleMs = p
+		}
+		for _, sm := range pdu.All("I-SIGNAL-TO-I-PDU-MAPPING") {
+			sig := a.ref(sm.Child("I-SIGNAL-REF"))
+			if sig == nil {
+				continue // signal groups
+			}
+			def, ok, err := a.signal(fd, sig, sm, pduStart)
+			if err != nil {
+				return fd, err
+			}
+			if ok {
+				fd.Signals = append(fd.Signals, def)
+			}
+		}
+	}
+	sort.Slice(fd.Signals, func(i, j int) bool { return fd.Signals[i].StartBit < fd.Signals[j].StartBit })
+	return fd, nil
+}
+
+// cycleMs is the cyclic transmission period of a PDU in milliseconds, 0
+// when it is not sent cyclically.
+func (a *arxml) cycleMs(pdu *xmlNode) int {
+	for _, ct := range pdu.All("CYCLIC-TIMING") {
+		s, err := strconv.ParseFloat(ct.Value("TIME-PERIOD", "VALUE"), 64)
+		if err == nil && s > 0 {
+			return int(math.Round(s * 1000))
+		}
+	}
+	return 0
+}
+
+func (a *arxml) signal(fd FrameDef, sig, mapping *xmlNode, pduStart int) (def SignalDef, ok bool, err error) {
+	name := sig.Value("SHORT-NAME")
+	start, err := strconv.Atoi(mapping.Value("START-POSITION"))
+	if err != nil {
+		return def, false, fmt.Errorf("signal %s: bad start position %q", name, mapping.Value("START-POSITION"))
+	}
+	length, err := strconv.Atoi(sig.Value("LENGTH"))
+	if err != nil || length < 1 || length > 64 {
+		return def, false, fmt.Errorf("signal %s: bad length %q", name, sig.Value("LENGTH"))
+	}
+	start += pduStart
+	if start < 0 || start > 63 {
+		return def, false, fmt.Errorf("signal %s: start bit %d outside the payload", name, start)
+	}
+
+	def = SignalDef{
+		FrameID:    fd.ID,
+		FrameName:  fd.Name,
+		SignalName: name,
+		StartBit:   uint8(start),
+		BitLength:  uint8(length),
+		Endianness: EndianLittle,
+		Factor:     1,
+	}
+	// ARXML gives big endian signals by their MSB, like DBC and SignalDef.
+	if mapping.Value("PACKING-BYTE-ORDER") == "MOST-SIGNIFICANT-BYTE-FIRST" {
+		def.Endianness = EndianBig
+	}
+
+	// The network representation describes the bits on the bus; the
+	// system signal's physical props are the fallback for scaling.
+	sys := a.ref(sig.Child("SYSTEM-SIGNAL-REF"))
+	props := []*xmlNode{
+		sig.Child("NETWORK-REPRESENTATION-PROPS", "SW-DATA-DEF-PROPS-VARIANTS", "SW-DATA-DEF-PROPS-CONDITIONAL"),
+		sys.Child("PHYSICAL-PROPS", "SW-DATA-DEF-PROPS-VARIANTS", "SW-DATA-DEF-PROPS-CONDITIONAL"),
+	}
+	var compu, constr, unit *xmlNode
+	for _, p := range props {
+		if p == nil {
+			continue
+		}
+		if bt := a.ref(p.Child("BASE-TYPE-REF")); bt != nil {
+			switch bt.Value("BASE-TYPE-ENCODING") {
+			case "2C":
+				def.Signed = true
+			case "IEEE754":
+				return def, false, nil
+			}
+		}
+		if compu == nil {
+			compu = a.ref(p.Child("COMPU-METHOD-REF"))
+		}
+		if constr == nil {
+			constr = a.ref(p.Child("DATA-CONSTR-REF"))
+		}
+		if unit == nil {
+			unit = a.ref(p.Child("UNIT-REF"))
+		}
+	}
+	if compu != nil {
+		def.Factor, def.Offset = compuLinear(compu)
+		if unit == nil {
+			unit = a.ref(compu.Child("UNIT-REF"))
+		}
+	}
+	if unit != nil {
+		def.Unit = unit.Value("DISPLAY-NAME")
+		if def.Unit == "" {
+			def.Unit = unit.Value("SHORT-NAME")
+		}
+	}
+	if constr != nil {
+		def.Min, def.Max, def.HasRange = constrRange(constr, def.Factor, def.Offset)
+	}
+	if v, err := strconv.ParseFloat(sig.Value("INIT-VALUE", "NUMERICAL-VALUE-SPECIFICATION", "VALUE"), 64); err == nil {
+		def.Default = v*def.Factor + def.Offset
+	}
+	for _, desc := range []*xmlNode{sys, sig} {
+		if c := desc.Value("DESC", "L-2"); c != "" {
+			def.Comment = c
+			break
+		}
+	}
+	return def, true, nil
+}
+
+// compuLinear returns the factor and offset of a compu method: the first
+// scale with rational coefficients, identity otherwise (IDENTICAL,
+// TEXTTABLE).
+func compuLinear(compu *xmlNode) (factor, offset float64) {
+	for _, sc := range compu.Child("COMPU-INTERNAL-TO-PHYS").All("COMPU-SCALE") {
+		num := sc.Child("COMPU-RATIONAL-COEFFS", "COMPU-NUMERATOR").All("V")
+		if len(num) < 2 {
+			continue
+		}
+		o, err1 := strconv.ParseFloat(strings.TrimSpace(num[0].Text), 64)
+		f, err2 := strconv.ParseFloat(strings.TrimSpace(num[1].Text), 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		den := 1.0
+		if d := sc.Child("COMPU-RATIONAL-COEFFS", "COMPU-DENOMINATOR").All("V"); len(d) > 0 {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(d[0].Text), 64); err == nil && v != 0 {
+				den = v
+			}
+		}
+		return f / den, o / den
+	}
+	return 1, 0
+}
+
+// constrRange reads physical limits from a data constraint, or converts
+// internal (raw) limits with factor and offset.
+func constrRange(constr *xmlNode, factor, offset float64) (lo, hi float64, ok bool) {
+	rule := constr.Child("DATA-CONSTR-RULES", "DATA-CONSTR-RULE")
+	limits := func(n *xmlNode) (float64, float64, bool) {
+		l, err1 := strconv.ParseFloat(n.Value("LOWER-LIMIT"), 64)
+		u, err2 := strconv.ParseFloat(n.Value("UPPER-LIMIT"), 64)
+		return l, u, n != nil && err1 == nil && err2 == nil
+	}
+	if lo, hi, ok = limits(rule.Child("PHYS-CONSTRS")); ok {
+		return lo, hi, true
+	}
+	if lo, hi, ok = limits(rule.Child("INTERNAL-CONSTRS")); ok {
+		lo, hi = lo*factor+offset, hi*factor+offset
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		return lo, hi, true
+	}
+	return 0, 0, false
+}
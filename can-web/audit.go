@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	auditKeep         = 1000 // entries kept in memory when there is no file
+	auditDefaultLimit = 100
+)
+
+type AuditConfig struct {
+	File string `yaml:"file"` // JSON lines, appended to; empty keeps entries in memory only
+}
+
+// AuditEntry is one operator action: a frame sent, a UDS request, a
+// recording or replay change.
+type AuditEntry struct {
+	Seq    uint64          `json:"seq"`
+	TS     time.Time       `json:"ts"`
+	User   string          `json:"user"`
+	Role   string          `json:"role"`
+	Via    string          `json:"via"` // http or grpc
+	Action string          `json:"action"`
+	Params json.RawMessage `json:"params,omitempty"`
+	OK     bool            `json:"ok"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// AuditLog records who did what to the bus. Entries are appended to a file
+// that is never rewritten, and the most recent ones are kept in memory.
+type AuditLog struct {
+	path string
+
+	mu     sync.Mutex
+	f      *os.File // opened on the first entry
+	seq    uint64
+	recent []AuditEntry
+}
+
+// NewAuditLog continues the sequence numbers of an existing log at path.
+func NewAuditLog(cfg AuditConfig) (*AuditLog, error) {
+	a := &AuditLog{path: cfg.File}
+	if a.path == "" {
+		return a, nil
+	}
+	err := a.scan(func(e AuditEntry) { a.seq = e.Seq })
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("audit log %s: %w", a.path, err)
+	}
+	return a, nil
+}
+
+// Record appends an entry for action, stamped with a sequence number, the
+// time and the caller found in ctx; err is the action's outcome. A failure
+// to write is logged, not returned: the action has already happened.
+func (a *AuditLog) Record(ctx context.Context, via, action string, params json.RawMessage, err error) {
+	e := AuditEntry{TS: time.Now().UTC(), Via: via, Action: action, OK: err == nil}
+	if p, ok := PrincipalFrom(ctx); ok {
+		e.User, e.Role = p.Name, p.Role.String()
+	}
+	if len(params) > 0 && json.Valid(params) {
+		e.Params = compactJSON(params)
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.seq++
+	e.Seq = a.seq
+	a.recent = append(a.recent, e)
+	if len(a.recent) > auditKeep {
+		a.recent = a.recent[len(a.recent)-auditKeep:]
+	}
+	slog.Info("audit", "user", e.User, "action", action, "ok", e.OK)
+	if a.path == "" {
+		return
+	}
+	if a.f == nil {
+		f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			slog.Error("audit log open failed", "file", a.path, "err", err)
+			return
+		}
+		a.f = f
+	}
+	b, _ := json.Marshal(e)
+	if _, err := a.f.Write(append(b, '\n')); err != nil {
+		slog.Error("audit log write failed", "file", a.path, "err", err)
+	}
+}
+
+func compactJSON(b []byte) json.RawMessage {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return append(json.RawMessage(nil), b...)
+	}
+	return buf.Bytes()
+}
+
+// AuditQuery selects entries for /api/audit.
+type AuditQuery struct {
+	User   string
+	Action string // prefix, e.g. "uds."
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+func (q AuditQuery) match(e AuditEntry) bool {
+	return (q.User == "" || e.User == q.User) &&
+		strings.HasPrefix(e.Action, q.Action) &&
+		(q.Since.IsZero() || !e.TS.Before(q.Since)) &&
+		(q.Until.IsZero() || e.TS.Before(q.Until))
+}
+
+// Query returns the newest matching entries, newest first. With a file the
+// whole log is searched, otherwise what is kept in memory.
+func (a *AuditLog) Query(q AuditQuery) ([]AuditEntry, error) {
+	if q.Limit <= 0 {
+		q.Limit = auditDefaultLimit
+	}
+	var matched []AuditEntry
+	keep := func(e AuditEntry) {
+		if !q.match(e) {
+			return
+		}
+		matched = append(matched, e)
+		if len(matched) > 2*q.Limit {
+			matched = append(matched[:0], matched[len(matched)-q.Limit:]...)
+		}
+	}
+
+	a.mu.Lock()
+	if a.path == "" {
+		for _, e := range a.recent {
+			keep(e)
+		}
+		a.mu.Unlock()
+	} else {
+		a.mu.Unlock()
+		if err := a.scan(keep); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if len(matched) > q.Limit {
+		matched = matched[len(matched)-q.Limit:]
+	}
+	out := make([]AuditEntry, len(matched))
+	for i, e := range matched {
+		out[len(matched)-1-i] = e
+	}
+	return out, nil
+}
+
+// scan calls fn for every entry of the log file in order. Lines that do not
+// parse, such as one cut short by a crash, are skipped.
+func (a *AuditLog) scan(fn func(AuditEntry)) error {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			fn(e)
+		}
+	}
+	return sc.Err()
+}
+
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	err := a.f.Close()
+	a.f = nil
+	return err
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Role is the access level of an API user. Higher roles include lower ones.
+type Role int
+
+const (
+	RoleViewer Role = iota + 1
+	RoleOperator
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	default:
+		return "none"
+	}
+}
+
+func parseRole(s string) (Role, error) {
+	switch strings.ToLower(s) {
+	case "viewer", "read-only", "readonly":
+		return RoleViewer, nil
+	case "operator":
+		return RoleOperator, nil
+	default:
+		return 0, fmt.Errorf("unknown role %q (want viewer or operator)", s)
+	}
+}
+
+// AuthUserConfig is one API user. Either Token (bearer) or Password (HTTP
+// basic auth) must be set. Passwords may be given as "sha256:<hex>".
+type AuthUserConfig struct {
+	Name     string `yaml:"name"`
+	Role     string `yaml:"role"`
+	Token    string `yaml:"token"`
+	Password string `yaml:"password"`
+}
+
+type Principal struct {
+	Name string `json:"name"`
+	Role Role   `json:"-"`
+}
+
+type authUser struct {
+	Principal
+	token    string
+	password string
+}
+
+// Auth authenticates API requests with bearer tokens or basic auth and
+// enforces per-endpoint roles. With no users configured, read-only
+// endpoints are open and operator endpoints are refused. Service users
+// (the CONTROL_TOKEN) only guard operator endpoints: on their own they
+// leave the UI and read-only endpoints open.
+type Auth struct {
+	users       []authUser
+	interactive bool // users were configured, so viewers must log in too
+}
+
+type principalKey struct{}
+
+func NewAuth(users []AuthUserConfig, service ...AuthUserConfig) (*Auth, error) {
+	a := &Auth{interactive: len(users) > 0}
+	for _, u := range slices.Concat(users, service) {
+		role, err := parseRole(u.Role)
+		if err != nil {
+			return nil, fmt.Errorf("auth user %q: %w", u.Name, err)
+		}
+		if u.Name == "" || (u.Token == "" && u.Password == "") {
+			return nil, fmt.Errorf("auth user %q: name and token or password are required", u.Name)
+		}
+		a.users = append(a.users, authUser{
+			Principal: Principal{Name: u.Name, Role: role},
+			token:     u.Token,
+			password:  u.Password,
+		})
+	}
+	return a, nil
+}
+
+// Enabled reports whether viewers must authenticate, i.e. auth users are
+// configured. Service users alone do not enable it.
+func (a *Auth) Enabled() bool { return a.interactive }
+
+// authDenial is why check refused a request, with its HTTP status.
+type authDenial struct {
+	status int
+	msg    string
+}
+
+// check authenticates r for an endpoint that needs role.
+func (a *Auth) check(r *http.Request, role Role) (Principal, *authDenial) {
+	p, ok := a.authenticate(r)
+	switch {
+	case role <= RoleViewer && !a.interactive:
+		if !ok {
+			p = Principal{Name: "anonymous", Role: RoleViewer}
+		}
+		return p, nil
+	case len(a.users) == 0:
+		return p, &authDenial{http.StatusForbidden, "operator endpoints are disabled until auth users are configured"}
+	case !ok:
+		return p, &authDenial{http.StatusUnauthorized, "unauthorized"}
+	case p.Role < role:
+		return p, &authDenial{http.StatusForbidden, fmt.Sprintf("%s role required", role)}
+	}
+	return p, nil
+}
+
+// Require wraps h so it only runs for principals with at least role.
+func (a *Auth) Require(role Role, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, deny := a.check(r, role)
+		if deny != nil {
+			if deny.status == http.StatusUnauthorized && a.interactive {
+				w.Header().Set("WWW-Authenticate", `Basic realm="can-web"`)
+			}
+			writeError(w, deny.status, deny.msg)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
+
+func (a *Auth) authenticate(r *http.Request) (Principal, bool) {
+	if tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		for _, u := range a.users {
+			if u.token != "" && subtle.ConstantTimeCompare([]byte(tok), []byte(u.token)) == 1 {
+				return u.Principal, true
+			}
+		}
+		return Principal{}, false
+	}
+	if name, pass, ok := r.BasicAuth(); ok {
+		for _, u := range a.users {
+			if u.password != "" && u.Name == name && checkPassword(u.password, pass) {
+				return u.Principal, true
+			}
+		}
+	}
+	return Principal{}, false
+}
+
+func checkPassword(stored, given string) bool {
+	if want, ok := strings.CutPrefix(stored, "sha256:"); ok {
+		sum := sha256.Sum256([]byte(given))
+		return subtle.ConstantTimeCompare([]byte(strings.ToLower(want)), []byte(hex.EncodeToString(sum[:]))) == 1
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(given)) == 1
+}
+
+// PrincipalFrom returns the authenticated caller of a request handled
+// behind Require.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// busBackend is a frame source that reaches the bus through something
+// other than a local SocketCAN socket: a network protocol, a serial adapter
+// or a vendor driver. It receives in sessions, restarted with backoff when
+// one fails, and transmits over the same connection.
+type busBackend interface {
+	Transmitter
+	session(ctx context.Context, app *App) error
+}
+
+// backendFactory checks the configuration of a backend and creates it. It
+// does not connect yet; the first session does.
+type backendFactory func(cfg Config) (busBackend, error)
+
+var backends = make(map[string]backendFactory)
+
+// registerBackend makes a backend available as source name. Backends that
+// only build on some platforms register from their platform's file.
+func registerBackend(name string, f backendFactory) {
+	if _, dup := backends[name]; dup {
+		panic(fmt.Sprintf("backend %q registered twice", name))
+	}
+	backends[name] = f
+}
+
+// sourceNames lists every source this build supports.
+func sourceNames() string {
+	names := []string{"socketcan", "sim", "replay"}
+	for n := range backends {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BusStats tracks per-ID timing and overall bus throughput.
+type BusStats struct {
+	mu      sync.Mutex
+	bitrate int
+	started time.Time
+	ids     map[frameKey]*idStats
+
+	totalFrames uint64
+	totalBytes  uint64
+	totalBits   uint64
+	dropped     uint64
+	kernelDrops uint64
+
+	// rolling one-second window used for rate and load figures
+	winStart  time.Time
+	winFrames uint64
+	winBits   uint64
+	lastFPS   float64
+	lastBPS   float64
+}
+
+type idStats struct {
+	count  uint64
+	first  time.Time
+	last   time.Time
+	minGap time.Duration
+	maxGap time.Duration
+	// running mean / M2 of inter-arrival gaps in seconds (Welford)
+	gapN    uint64
+	gapMean float64
+	gapM2   float64
+}
+
+type IDStats struct {
+	ID            string    `json:"id"`
+	Count         uint64    `json:"count"`
+	FramesPerSec  float64   `json:"frames_per_sec"`
+	MinIntervalMs float64   `json:"min_interval_ms"`
+	AvgIntervalMs float64   `json:"avg_interval_ms"`
+	MaxIntervalMs float64   `json:"max_interval_ms"`
+	JitterMs      float64   `json:"jitter_ms"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+type BusStatsSnapshot struct {
+	Bus          string    `json:"bus"`
+	Bitrate      int       `json:"bitrate"`
+	Since        time.Time `json:"since"`
+	TotalFrames  uint64    `json:"total_frames"`
+	TotalBytes   uint64    `json:"total_bytes"`
+	Dropped      uint64    `json:"dropped_frames"` // same as Drops.Decode
+	Drops        DropStats `json:"drops"`
+	FramesPerSec float64   `json:"frames_per_sec"`
+	BitsPerSec   float64   `json:"bits_per_sec"`
+	BusLoadPct   float64   `json:"bus_load_pct"`
+	IDs          []IDStats `json:"ids"`
+}
+
+// DropStats counts what each stage of the receive path dropped because it
+// could not keep up. Kernel and Decode are frames; the others are store
+// events (signal updates and raw frames) not delivered to a consumer.
+type DropStats struct {
+	Kernel   uint64 `json:"kernel"`   // socket receive queue overflows
+	Decode   uint64 `json:"decode"`   // decoder queues full
+	History  uint64 `json:"history"`  // history samples not written
+	Sinks    uint64 `json:"sinks"`    // NATS sinks
+	Streams  uint64 `json:"streams"`  // SSE and gRPC clients
+	Internal uint64 `json:"internal"` // TX watchers and the UDS bridge
+}
+
+func NewBusStats(bitrate int) *BusStats {
+	now := time.Now()
+	return &BusStats{
+		bitrate:  bitrate,
+		started:  now,
+		ids:      make(map[frameKey]*idStats),
+		winStart: now,
+	}
+}
+
+func (b *BusStats) Observe(id uint32, dlc int, extended bool, ts time.Time) {
+	bits := uint64(frameBits(dlc, extended))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.totalFrames++
+	b.totalBytes += uint64(dlc)
+	b.totalBits += bits
+
+	if el := ts.Sub(b.winStart); el >= time.Second {
+		b.lastFPS = float64(b.winFrames) / el.Seconds()
+		b.lastBPS = float64(b.winBits) / el.Seconds()
+		b.winStart = ts
+		b.winFrames = 0
+		b.winBits = 0
+	}
+	b.winFrames++
+	b.winBits += bits
+
+	k := frameKey{id, extended}
+	st := b.ids[k]
+	if st == nil {
+		st = &idStats{first: ts}
+		b.ids[k] = st
+	} else {
+		gap := ts.Sub(st.last)
+		if st.gapN == 0 || gap < st.minGap {
+			st.minGap = gap
+		}
+		if gap > st.maxGap {
+			st.maxGap = gap
+		}
+		st.gapN++
+		x := gap.Seconds()
+		d := x - st.gapMean
+		st.gapMean += d / float64(st.gapN)
+		st.gapM2 += d * (x - st.gapMean)
+	}
+	st.count++
+	st.last = ts
+}
+
+// ObserveDrop counts a received frame that was not decoded because the
+// decoder fell behind.
+func (b *BusStats) ObserveDrop() {
+	b.mu.Lock()
+	b.dropped++
+	b.mu.Unlock()
+}
+
+// ObserveKernelDrops counts n frames the kernel dropped before they were
+// read, because the socket's receive queue was full.
+func (b *BusStats) ObserveKernelDrops(n uint64) {
+	b.mu.Lock()
+	b.kernelDrops += n
+	b.mu.Unlock()
+}
+
+func (b *BusStats) Snapshot() BusStatsSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	fps, bps := b.lastFPS, b.lastBPS
+	// If the current window is already older than a second (bus went quiet),
+	// report it instead so rates decay rather than freezing at the last value.
+	if el := time.Since(b.winStart); el >= time.Second {
+		fps = float64(b.winFrames) / el.Seconds()
+		bps = float64(b.winBits) / el.Seconds()
+	}
+
+	out := BusStatsSnapshot{
+		Bitrate:      b.bitrate,
+		Since:        b.started,
+		TotalFrames:  b.totalFrames,
+		TotalBytes:   b.totalBytes,
+		Dropped:      b.dropped,
+		Drops:        DropStats{Kernel: b.kernelDrops, Decode: b.dropped},
+		FramesPerSec: fps,
+		BitsPerSec:   bps,
+		IDs:          make([]IDStats, 0, len(b.ids)),
+	}
+	if b.bitrate > 0 {
+		out.BusLoadPct = 100 * bps / float64(b.bitrate)
+	}
+
+	keys := make([]frameKey, 0, len(b.ids))
+	for k := range b.ids {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+
+	for _, k := range keys {
+		st := b.ids[k]
+		s := IDStats{
+			ID:       k.String(),
+			Count:    st.count,
+			LastSeen: st.last,
+		}
+		if st.gapN > 0 {
+			if span := st.last.Sub(st.first).Seconds(); span > 0 {
+				s.FramesPerSec = float64(st.gapN) / span
+			}
+			s.MinIntervalMs = durMs(st.minGap)
+			s.MaxIntervalMs = durMs(st.maxGap)
+			s.AvgIntervalMs = st.gapMean * 1000
+			s.JitterMs = math.Sqrt(st.gapM2/float64(st.gapN)) * 1000
+		}
+		out.IDs = append(out.IDs, s)
+	}
+	return out
+}
+
+// frameBits estimates the on-wire length of a classic CAN data frame,
+// including EOF and interframe space but excluding stuff bits.
+func frameBits(dlc int, extended bool) int {
+	if extended {
+		return 67 + 8*dlc
+	}
+	return 47 + 8*dlc
+}
+
+func durMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// statsSnapshot is the bus statistics with the drops of every stage, not
+// only those BusStats sees itself.
+func statsSnapshot(app *App) BusStatsSnapshot {
+	snap := app.Stats.Snapshot()
+	snap.Bus = app.Iface
+	subs := app.Store.Drops()
+	snap.Drops.History = app.History.Dropped()
+	snap.Drops.Sinks = subs[subSink]
+	snap.Drops.Streams = subs[subStream]
+	snap.Drops.Internal = subs[subInternal]
+	return snap
+}
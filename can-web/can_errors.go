@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.einride.tech/can/pkg/socketcan"
+)
+
+// Controller states as reported by SocketCAN error frames.
+const (
+	BusStateActive  = "error-active"
+	BusStateWarning = "error-warning"
+	BusStatePassive = "error-passive"
+	BusStateBusOff  = "bus-off"
+)
+
+// errorClassCounters is CAN_ERR_CNT: data[6]/data[7] carry TX/RX error counters.
+const errorClassCounters socketcan.ErrorClass = 0x00000200
+
+var errorClassNames = []struct {
+	class socketcan.ErrorClass
+	name  string
+}{
+	{socketcan.ErrorClassTxTimeout, "tx-timeout"},
+	{socketcan.ErrorClassLostArbitration, "lost-arbitration"},
+	{socketcan.ErrorClassController, "controller"},
+	{socketcan.ErrorClassProtocolViolation, "protocol-violation"},
+	{socketcan.ErrorClassTransceiver, "transceiver"},
+	{socketcan.ErrorClassNoAck, "no-ack"},
+	{socketcan.ErrorClassBusOff, "bus-off"},
+	{socketcan.ErrorClassBusError, "bus-error"},
+	{socketcan.ErrorClassRestarted, "restarted"},
+}
+
+var controllerErrorNames = []struct {
+	flag socketcan.ControllerError
+	name string
+}{
+	{socketcan.ControllerErrorRxBufferOverflow, "rx-overflow"},
+	{socketcan.ControllerErrorTxBufferOverflow, "tx-overflow"},
+	{socketcan.ControllerErrorRxWarning, "rx-warning"},
+	{socketcan.ControllerErrorTxWarning, "tx-warning"},
+	{socketcan.ControllerErrorRxPassive, "rx-passive"},
+	{socketcan.ControllerErrorTxPassive, "tx-passive"},
+	{socketcan.ControllerErrorActive, "active"},
+}
+
+type BusErrorEvent struct {
+	TS      time.Time `json:"ts"`
+	Classes []string  `json:"classes"`
+	Detail  string    `json:"detail"`
+	DataHex string    `json:"data_hex"`
+	TxErr   *int      `json:"tx_err,omitempty"`
+	RxErr   *int      `json:"rx_err,omitempty"`
+}
+
+type BusErrorSnapshot struct {
+	State      string            `json:"state"`
+	StateSince time.Time         `json:"state_since"`
+	Total      uint64            `json:"total"`
+	Restarts   uint64            `json:"restarts"`
+	Counts     map[string]uint64 `json:"counts"`
+	Recent     []BusErrorEvent   `json:"recent"`
+}
+
+// ErrorMonitor tracks CAN error frames and the controller state derived
+// from them.
+type ErrorMonitor struct {
+	mu         sync.Mutex
+	state      string
+	stateSince time.Time
+	total      uint64
+	restarts   uint64
+	counts     map[string]uint64
+	recent     []BusErrorEvent
+	capacity   int
+}
+
+func NewErrorMonitor(capacity int) *ErrorMonitor {
+	return &ErrorMonitor{
+		state:      BusStateActive,
+		stateSince: time.Now(),
+		counts:     make(map[string]uint64),
+		capacity:   capacity,
+	}
+}
+
+// Observe records an error frame and returns the decoded event.
+func (m *ErrorMonitor) Observe(ef socketcan.ErrorFrame, ts time.Time) BusErrorEvent {
+	ev := decodeErrorFrame(ef, ts)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.total++
+	for _, c := range ev.Classes {
+		m.counts[c]++
+	}
+
+	state := m.state
+	switch {
+	case ef.ErrorClass&socketcan.ErrorClassBusOff != 0:
+		state = BusStateBusOff
+	case ef.ErrorClass&socketcan.ErrorClassRestarted != 0:
+		m.restarts++
+		state = BusStateActive
+	case ef.ErrorClass&socketcan.ErrorClassController != 0:
+		ce := ef.ControllerError
+		switch {
+		case ce&(socketcan.ControllerErrorRxPassive|socketcan.ControllerErrorTxPassive) != 0:
+			state = BusStatePassive
+		case ce&(socketcan.ControllerErrorRxWarning|socketcan.ControllerErrorTxWarning) != 0:
+			state = BusStateWarning
+		case ce&socketcan.ControllerErrorActive != 0:
+			state = BusStateActive
+		}
+	}
+	if state != m.state {
+		m.state = state
+		m.stateSince = ts
+	}
+
+	m.recent = append(m.recent, ev)
+	if len(m.recent) > m.capacity {
+		m.recent = m.recent[len(m.recent)-m.capacity:]
+	}
+	return ev
+}
+
+func (m *ErrorMonitor) State() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+func (m *ErrorMonitor) Snapshot() BusErrorSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counts := make(map[string]uint64, len(m.counts))
+	for k, v := range m.counts {
+		counts[k] = v
+	}
+	recent := make([]BusErrorEvent, len(m.recent))
+	copy(recent, m.recent)
+
+	return BusErrorSnapshot{
+		State:      m.state,
+		StateSince: m.stateSince,
+		Total:      m.total,
+		Restarts:   m.restarts,
+		Counts:     counts,
+		Recent:     recent,
+	}
+}
+
+func decodeErrorFrame(ef socketcan.ErrorFrame, ts time.Time) BusErrorEvent {
+	data := []byte{
+		ef.LostArbitrationBit,
+		byte(ef.ControllerError),
+		byte(ef.ProtocolError),
+		byte(ef.ProtocolViolationErrorLocation),
+		byte(ef.TransceiverError),
+		ef.ControllerSpecificInformation[0],
+		ef.ControllerSpecificInformation[1],
+		ef.ControllerSpecificInformation[2],
+	}
+
+	ev := BusErrorEvent{
+		TS:      ts,
+		DataHex: strings.ToUpper(hex.EncodeToString(data)),
+	}
+
+	var details []string
+	for _, c := range errorClassNames {
+		if ef.ErrorClass&c.class == 0 {
+			continue
+		}
+		ev.Classes = append(ev.Classes, c.name)
+		switch c.class {
+		case socketcan.ErrorClassLostArbitration:
+			details = append(details, fmt.Sprintf("arbitration lost at bit %d", ef.LostArbitrationBit))
+		case socketcan.ErrorClassController:
+			var flags []string
+			for _, f := range controllerErrorNames {
+				if ef.ControllerError&f.flag != 0 {
+					flags = append(flags, f.name)
+				}
+			}
+			if len(flags) == 0 {
+				flags = append(flags, "unspecified")
+			}
+			details = append(details, "controller "+strings.Join(flags, ","))
+		case socketcan.ErrorClassProtocolViolation:
+			details = append(details, fmt.Sprintf("protocol %s at %s", ef.ProtocolError, ef.ProtocolViolationErrorLocation))
+		case socketcan.ErrorClassTransceiver:
+			details = append(details, fmt.Sprintf("transceiver %s", ef.TransceiverError))
+		}
+	}
+	if len(ev.Classes) == 0 {
+		ev.Classes = append(ev.Classes, "unknown")
+	}
+	if ef.ErrorClass&errorClassCounters != 0 {
+		tx, rx := int(data[6]), int(data[7])
+		ev.TxErr, ev.RxErr = &tx, &rx
+		details = append(details, fmt.Sprintf("tec=%d rec=%d", tx, rx))
+	}
+
+	ev.Detail = strings.Join(details, "; ")
+	if ev.Detail == "" {
+		ev.Detail = strings.Join(ev.Classes, ", ")
+	}
+	return ev
+}
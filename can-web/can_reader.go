@@ -5,8 +5,9 @@ import (
 	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
 	"os"
 	"sort"
@@ -36,15 +37,30 @@ type SignalDef struct {
 	Signed     bool
 	Factor     float64
 	Offset     float64
+	Min        float64
+	Max        float64
+	HasRange   bool
+	Default    float64
 	Unit       string
 	Direction  string
 	Comment    string
+	MuxSwitch  bool // selects which multiplexed signals the frame carries
+	Muxed      bool // carried only when the switch's raw value is MuxValue
+	MuxValue   uint64
+	Values     map[int64]string // value table: raw value -> label
 }
 
 type FrameDef struct {
 	ID      uint32
+	Mask    uint32 // non-zero: matches every ID with the same bits under the mask
 	Name    string
+	Node    string // transmitting ECU, empty when unknown
+	DLC     uint8
+	CycleMs int
 	Signals []SignalDef
+	Mux     *SignalDef // multiplexer switch, nil for plain frames
+	Derived []DerivedDef
+	E2E     *E2EDef // nil for unprotected frames
 }
 
 type SignalValue struct {
@@ -56,6 +72,11 @@ type SignalValue struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Dir       string    `json:"direction"`
 	Comment   string    `json:"comment"`
+	Text      string    `json:"text,omitempty"` // value table label of the raw value
+	Node      string    `json:"node,omitempty"` // ECU sending the frame
+	Bus       string    `json:"bus"`
+
+	seq uint64 // store sequence of the update; not serialised
 }
 
 type RawFrame struct {
@@ -64,43 +85,247 @@ type RawFrame struct {
 	DLC       int       `json:"dlc"`
 	DataHex   string    `json:"data_hex"`
 	DataASCII string    `json:"data_ascii"`
+	Dir       string    `json:"direction"`
+	Error     string    `json:"error,omitempty"`
+	RTR       bool      `json:"rtr,omitempty"`      // remote request: dlc is the requested length, no data
+	Extended  bool      `json:"extended,omitempty"` // 29-bit ID
+	WallTS    time.Time `json:"wall_ts"`            // when user space read the frame
+	MonoNs    int64     `json:"mono_ns"`            // wall_ts on the monotonic clock, ns since the server started; see /api/clock
+	TSSource  string    `json:"ts_source"`          // what ts is: hardware, kernel, user or log (replays)
+	E2E       string    `json:"e2e,omitempty"`      // end-to-end check result of protected frames
+	Node      string    `json:"node,omitempty"`     // ECU sending the frame, from the map
+	Bus       string    `json:"bus"`
+
+	// numeric ID and payload for filtering and export, arrival order; not
+	// serialised
+	canID uint32
+	data  []byte
+	seq   uint64
+}
+
+// StoreEvent is one update delivered to Store subscribers. Exactly one of
+// Signal and Raw is set.
+type StoreEvent struct {
+	Signal *SignalValue
+	Raw    *RawFrame
 }
 
 type Store struct {
+	bus string // stamped on every signal and raw frame
+
 	mu          sync.RWMutex
 	signals     map[string]SignalValue
-	rawFrames   []RawFrame
 	rawCapacity int
+	rawPerID    int
+	rawPolicy   map[string]RawIDConfig
+	rawRings    map[string]*rawRing
+	seq         uint64 // bumped by every change; also orders raw frames
+	resetSeq    uint64 // seq of the last ResetSignals
+
+	cacheMu sync.Mutex
+	cache   *StoreSnapshot
+
+	subMu    sync.Mutex
+	subs     map[*storeSub]struct{}
+	subDrops map[string]uint64 // by subscriber kind, including cancelled ones
+}
+
+type storeSub struct {
+	ch      chan StoreEvent
+	kind    string
+	dropped uint64
+}
+
+// Subscriber kinds, the drop stages they are counted under.
+const (
+	subSink     = "sinks"
+	subStream   = "streams"
+	subInternal = "internal"
+)
+
+// RawIDConfig overrides raw buffering for one ID: Capacity frames are kept,
+// and with Every > 1 only every Nth frame is stored.
+type RawIDConfig struct {
+	Capacity int `yaml:"capacity" json:"capacity"`
+	Every    int `yaml:"every" json:"every"`
+}
+
+// rawRing is the raw frame buffer of a single ID.
+type rawRing struct {
+	frames   []RawFrame
+	capacity int
+	every    uint64
+	seen     uint64
 }
 
-func NewStore(rawCapacity int) *Store {
+// NewStore keeps up to perID raw frames for each ID (policy overrides that
+// per ID, keyed like RawFrame.ID) and reports the latest rawCapacity of
+// them in Snapshot.
+func NewStore(bus string, rawCapacity, perID int, policy map[string]RawIDConfig) *Store {
 	return &Store{
+		bus:         bus,
 		signals:     make(map[string]SignalValue),
 		rawCapacity: rawCapacity,
+		rawPerID:    perID,
+		rawPolicy:   policy,
+		rawRings:    make(map[string]*rawRing),
 	}
 }
 
-func (s *Store) UpsertSignal(v SignalValue) {
+// UpsertSignals stores the signals of one frame under a single lock.
+func (s *Store) UpsertSignals(vs []SignalValue) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	key := fmt.Sprintf("%s.%s", v.FrameName, v.Name)
-	s.signals[key] = v
+	for i := range vs {
+		v := &vs[i]
+		v.Bus = s.bus
+		s.seq++
+		v.seq = s.seq
+		s.signals[v.FrameName+"."+v.Name] = *v
+		s.publish(StoreEvent{Signal: v})
+	}
+}
+
+// ResetSignals drops all decoded signal values, e.g. after switching maps.
+func (s *Store) ResetSignals() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signals = make(map[string]SignalValue)
+	s.seq++
+	s.resetSeq = s.seq
+}
+
+// Signal returns the current value of the signal FRAME.name.
+func (s *Store) Signal(key string) (SignalValue, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.signals[key]
+	return v, ok
+}
+
+// Touch bumps the sequence number for state kept outside the store that
+// is reported with it, such as the connection state.
+func (s *Store) Touch() {
+	s.mu.Lock()
+	s.seq++
+	s.mu.Unlock()
+}
+
+// Seq returns the current sequence number.
+func (s *Store) Seq() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.seq
 }
 
+// PushRaw stores r in its ID's buffer, subject to that ID's sampling, and
+// publishes it to subscribers either way.
 func (s *Store) PushRaw(r RawFrame) {
+	r.Bus = s.bus
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.rawFrames = append(s.rawFrames, r)
-	if len(s.rawFrames) > s.rawCapacity {
-		s.rawFrames = s.rawFrames[len(s.rawFrames)-s.rawCapacity:]
+	ring := s.ringLocked(r.ID)
+	ring.seen++
+	if (ring.seen-1)%ring.every == 0 {
+		s.seq++
+		r.seq = s.seq
+		ring.push(r)
 	}
+	s.publish(StoreEvent{Raw: &r})
 }
 
+// ringLocked returns the buffer of id, creating it with id's policy. s.mu
+// must be held.
+func (s *Store) ringLocked(id string) *rawRing {
+	ring, ok := s.rawRings[id]
+	if !ok {
+		ring = &rawRing{capacity: s.rawPerID, every: 1}
+		if p, ok := s.rawPolicy[id]; ok {
+			if p.Capacity > 0 {
+				ring.capacity = p.Capacity
+			}
+			if p.Every > 1 {
+				ring.every = uint64(p.Every)
+			}
+		}
+		s.rawRings[id] = ring
+	}
+	return ring
+}
+
+func (r *rawRing) push(f RawFrame) {
+	r.frames = append(r.frames, f)
+	if len(r.frames) > r.capacity {
+		r.frames = r.frames[len(r.frames)-r.capacity:]
+	}
+}
+
+// Restore loads the signals and raw frames a backend saved in an earlier
+// run. It is called before any frame is received and publishes nothing.
+func (s *Store) Restore(st StoreState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range st.Signals {
+		s.seq++
+		v.seq, v.Bus = s.seq, s.bus
+		s.signals[v.FrameName+"."+v.Name] = v
+	}
+	for _, r := range st.Raw {
+		id, extended, err := parseCANID(r.ID)
+		if err != nil {
+			continue
+		}
+		s.seq++
+		r.seq, r.Bus = s.seq, s.bus
+		r.canID, r.Extended = id, r.Extended || extended
+		r.ID = canIDString(r.canID, r.Extended)
+		r.data, _ = hex.DecodeString(r.DataHex)
+		s.ringLocked(r.ID).push(r)
+	}
+}
+
+// rawLocked returns all buffered raw frames in arrival order. s.mu must be
+// held.
+func (s *Store) rawLocked() []RawFrame {
+	n := 0
+	for _, ring := range s.rawRings {
+		n += len(ring.frames)
+	}
+	out := make([]RawFrame, 0, n)
+	for _, ring := range s.rawRings {
+		out = append(out, ring.frames...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].seq < out[j].seq })
+	return out
+}
+
+// StoreSnapshot is the store contents at sequence number Seq. Snapshots
+// are shared between callers and must not be modified.
+type StoreSnapshot struct {
+	Seq     uint64
+	Signals []SignalValue
+	Raw     []RawFrame
+}
+
+// Snapshot returns the decoded signals and the most recent raw frames
+// across all IDs.
 func (s *Store) Snapshot() (signals []SignalValue, raw []RawFrame) {
+	snap := s.Versioned()
+	return snap.Signals, snap.Raw
+}
+
+// Versioned returns the current snapshot. It is rebuilt only when the store
+// changed since the last call, so many pollers cost one copy and sort.
+func (s *Store) Versioned() *StoreSnapshot {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	if s.cache != nil && s.cache.Seq == s.seq {
+		return s.cache
+	}
 
-	signals = make([]SignalValue, 0, len(s.signals))
+	signals := make([]SignalValue, 0, len(s.signals))
 	for _, v := range s.signals {
 		signals = append(signals, v)
 	}
@@ -111,65 +336,387 @@ func (s *Store) Snapshot() (signals []SignalValue, raw []RawFrame) {
 		return signals[i].FrameName < signals[j].FrameName
 	})
 
-	raw = make([]RawFrame, len(s.rawFrames))
-	copy(raw, s.rawFrames)
+	raw := s.rawLocked()
+	if len(raw) > s.rawCapacity {
+		raw = raw[len(raw)-s.rawCapacity:]
+	}
+	s.cache = &StoreSnapshot{Seq: s.seq, Signals: signals, Raw: raw}
+	return s.cache
+}
+
+// Delta returns the signals updated and raw frames buffered after sequence
+// number since, up to the latest rawCapacity frames. reset is set when the
+// caller's view cannot be patched (signals were cleared after since, or
+// since is from another server run); signals then holds every signal.
+func (s *Store) Delta(since uint64) (seq uint64, signals []SignalValue, raw []RawFrame, reset bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seq = s.seq
+	if since > seq || since < s.resetSeq || since == 0 {
+		since, reset = 0, true
+	}
+
+	signals = []SignalValue{}
+	for _, v := range s.signals {
+		if v.seq > since {
+			signals = append(signals, v)
+		}
+	}
+	sort.Slice(signals, func(i, j int) bool {
+		if signals[i].FrameName == signals[j].FrameName {
+			return signals[i].Name < signals[j].Name
+		}
+		return signals[i].FrameName < signals[j].FrameName
+	})
+
+	raw = []RawFrame{}
+	for _, ring := range s.rawRings {
+		// frames within a ring are in seq order
+		i := sort.Search(len(ring.frames), func(i int) bool { return ring.frames[i].seq > since })
+		raw = append(raw, ring.frames[i:]...)
+	}
+	sort.Slice(raw, func(i, j int) bool { return raw[i].seq < raw[j].seq })
+	if len(raw) > s.rawCapacity {
+		raw = raw[len(raw)-s.rawCapacity:]
+	}
 	return
 }
 
-func RunCANReader(ctx context.Context, iface string, defs map[uint32]FrameDef, store *Store) error {
-	conn, err := socketcan.DialContext(ctx, "can", iface)
-	if err != nil {
-		return fmt.Errorf("socketcan dial(%s): %w", iface, err)
+// RawBufferStat describes one ID's raw buffer.
+type RawBufferStat struct {
+	ID       string `json:"id"`
+	Seen     uint64 `json:"seen"`
+	Buffered int    `json:"buffered"`
+	Capacity int    `json:"capacity"`
+	Every    uint64 `json:"every"`
+}
+
+func (s *Store) RawBuffers() []RawBufferStat {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]RawBufferStat, 0, len(s.rawRings))
+	for id, ring := range s.rawRings {
+		out = append(out, RawBufferStat{ID: id, Seen: ring.seen, Buffered: len(ring.frames), Capacity: ring.capacity, Every: ring.every})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Subscribe returns a channel receiving every signal update and raw frame
+// from now on, and a cancel func that must be called when done. Slow
+// subscribers never block ingestion: events that do not fit in the buffer
+// are dropped and counted, see the dropped func, and added to the totals of
+// kind reported by Drops.
+func (s *Store) Subscribe(kind string, buf int) (events <-chan StoreEvent, dropped func() uint64, cancel func()) {
+	sub := &storeSub{ch: make(chan StoreEvent, buf), kind: kind}
+	s.subMu.Lock()
+	if s.subs == nil {
+		s.subs = make(map[*storeSub]struct{})
+		s.subDrops = make(map[string]uint64)
+	}
+	s.subs[sub] = struct{}{}
+	s.subMu.Unlock()
+
+	dropped = func() uint64 {
+		s.subMu.Lock()
+		defer s.subMu.Unlock()
+		return sub.dropped
+	}
+	cancel = func() {
+		s.subMu.Lock()
+		defer s.subMu.Unlock()
+		delete(s.subs, sub)
+	}
+	return sub.ch, dropped, cancel
+}
+
+func (s *Store) publish(ev StoreEvent) {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	for sub := range s.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+			sub.dropped++
+			s.subDrops[sub.kind]++
+		}
+	}
+}
+
+// Drops returns the events dropped so far for each subscriber kind.
+func (s *Store) Drops() map[string]uint64 {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	out := make(map[string]uint64, len(s.subDrops))
+	for k, n := range s.subDrops {
+		out[k] = n
 	}
-	defer conn.Close()
+	return out
+}
 
-	recv := socketcan.NewReceiver(conn)
-	log.Printf("CAN reader listening on %s", iface)
+const (
+	reconnectMinBackoff = 500 * time.Millisecond
+	reconnectMaxBackoff = 30 * time.Second
+	dropWarnEvery       = 10 * time.Second // at most one drop warning per interval
+	// a session that stayed up this long resets the backoff
+	reconnectStableAfter = 10 * time.Second
+)
+
+// RunCANReader reads frames from iface until ctx is cancelled, redialling
+// with exponential backoff whenever the socket cannot be opened or the
+// receiver fails (interface down, USB adapter unplugged). With kernelTS
+// frames are stamped with the kernel's receive time.
+func RunCANReader(ctx context.Context, app *App, kernelTS bool) error {
+	return runWithReconnect(ctx, app, func(ctx context.Context, app *App) error {
+		return runCANSession(ctx, app, kernelTS)
+	})
+}
+
+// runWithReconnect runs session until ctx is cancelled, starting it again
+// with exponential backoff whenever it fails. Sessions call app.Conn.Connected
+// once they are receiving.
+func runWithReconnect(ctx context.Context, app *App, session func(context.Context, *App) error) error {
+	backoff := reconnectMinBackoff
+	for {
+		started := time.Now()
+		err := session(ctx, app)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			err = errors.New("receiver closed")
+		}
+		app.Conn.Failed(err)
+		if time.Since(started) >= reconnectStableAfter {
+			backoff = reconnectMinBackoff
+		}
+		slog.Warn("CAN reader failed", "err", err, "retry_in", backoff)
 
-	for recv.Receive() {
 		select {
 		case <-ctx.Done():
 			return nil
-		default:
+		case <-time.After(backoff):
 		}
+		backoff = min(backoff*2, reconnectMaxBackoff)
+		app.Conn.Retrying()
+	}
+}
+
+// frameStamp is when a frame was received. TS is the kernel receive time
+// when the source provides one, else Wall, the time user space got the
+// frame. Kernel timestamps are taken in the driver and do not jitter with
+// scheduling, so cycle times and latencies are measured on TS.
+type frameStamp struct {
+	TS     time.Time
+	Wall   time.Time
+	Source string // "hardware", "kernel", "user", or "log" for replayed log times
+}
 
-		f := recv.Frame()
-		frameID := uint32(f.ID)
-		dlc := int(f.Length)
-		data := f.Data[:dlc]
+func userStamp(t time.Time) frameStamp {
+	return frameStamp{TS: t, Wall: t, Source: "user"}
+}
 
+// processFrame runs one received data frame through stats, recording, the
+// raw buffer and signal decoding. All frame sources feed this.
+func processFrame(app *App, f can.Frame, now time.Time) {
+	ingestFrame(app, f, userStamp(now), "rx")
+}
+
+// ingestFrame is processFrame for a given direction ("rx" or "tx") and
+// receive stamp. Stats and the recording are updated here, in arrival order
+// and for every frame; the rest is left to the decoder pool.
+func ingestFrame(app *App, f can.Frame, st frameStamp, dir string) {
+	n := int(f.Length)
+	if f.IsRemote {
+		n = 0 // no data field on the wire
+	}
+	// Stats decay their rates against the wall clock. Kernel stamps are on
+	// that clock, only sharper; the times of a replayed log are not.
+	ts := st.TS
+	if st.Source == "log" {
+		ts = st.Wall
+	}
+	app.Stats.Observe(uint32(f.ID), n, f.IsExtended, ts)
+	app.Recorder.WriteFrame(app.Iface, f, st.TS)
+	app.Decoder.Submit(f, st, dir)
+}
+
+// decodeFrame buffers f as a raw frame, decodes its signals into the store
+// and feeds the analysers.
+func decodeFrame(app *App, f can.Frame, st frameStamp, dir string) {
+	span := app.Telemetry.traceFrame(f, st, dir)
+	defer span.end()
+	now := st.TS
+	store := app.Store
+	frameID := uint32(f.ID)
+	dlc := int(f.Length)
+	data := f.Data[:dlc]
+	id := canIDString(frameID, f.IsExtended)
+	trace := slog.Default().Enabled(context.Background(), slog.LevelDebug)
+
+	// A remote request has no payload to decode, only the owner's reply does.
+	if f.IsRemote {
 		store.PushRaw(RawFrame{
-			TS:        time.Now(),
-			ID:        fmt.Sprintf("0x%03X", frameID),
-			DLC:       dlc,
-			DataHex:   strings.ToUpper(hex.EncodeToString(data)),
-			DataASCII: safeASCII(data),
+			TS:       now,
+			ID:       id,
+			DLC:      dlc,
+			Dir:      dir,
+			RTR:      true,
+			WallTS:   st.Wall,
+			MonoNs:   app.Clock.Mono(st.Wall),
+			TSSource: st.Source,
+			canID:    frameID,
+			Extended: f.IsExtended,
 		})
+		if app.OnFrame != nil {
+			app.OnFrame(f, nil, now)
+		}
+		return
+	}
 
-		def, ok := defs[frameID]
-		if !ok {
-			continue
+	def, ok := app.Profiles.Lookup(frameID)
+	hook := lookupDecodeHook(frameID)
+	var e2e string
+	if ok && def.E2E != nil {
+		e2e = app.E2E.Observe(&def, f.IsExtended, f.Data, dlc, now)
+		if e2e != E2EOK && e2e != E2EInitial {
+			app.Alerts.ObserveE2E(def.Name, e2e)
 		}
+	}
 
-		for _, sig := range def.Signals {
-			val := decodeSignal(f.Data, sig)
-			store.UpsertSignal(SignalValue{
-				Name:      sig.SignalName,
-				Value:     clampFinite(val),
-				Unit:      sig.Unit,
-				FrameID:   fmt.Sprintf("0x%03X", frameID),
-				FrameName: def.Name,
-				UpdatedAt: time.Now(),
-				Dir:       sig.Direction,
-				Comment:   sig.Comment,
-			})
+	app.Heat.Observe(frameID, f.IsExtended, data, now)
+	app.Frames.Observe(frameID, f.IsExtended, data, dir, now)
+	store.PushRaw(RawFrame{
+		TS:        now,
+		ID:        id,
+		DLC:       dlc,
+		DataHex:   strings.ToUpper(hex.EncodeToString(data)),
+		DataASCII: safeASCII(data),
+		Dir:       dir,
+		WallTS:    st.Wall,
+		MonoNs:    app.Clock.Mono(st.Wall),
+		TSSource:  st.Source,
+		E2E:       e2e,
+		Node:      def.Node,
+		canID:     frameID,
+		Extended:  f.IsExtended,
+		data:      append([]byte(nil), data...),
+	})
+
+	if !ok && hook == nil {
+		if trace {
+			slog.Debug("unmapped frame", "id", id, "dir", dir, "data", hex.EncodeToString(data))
+		}
+		app.Unknown.Observe(frameID, f.IsExtended, data, now)
+		fireTriggers(app, app.Triggers.ObserveFrame(app.Iface, f, nil, now), now)
+		if app.OnFrame != nil {
+			app.OnFrame(f, nil, now)
+		}
+		return
+	}
+
+	if ok && !app.DLC.Observe(frameID, f.IsExtended, &def, data, now) {
+		// Nothing is decoded from a payload the map does not describe: no
+		// signals, hooks, derived signals or signal triggers.
+		span.decoded(def.Name, 0)
+		fireTriggers(app, app.Triggers.ObserveFrame(app.Iface, f, nil, now), now)
+		if app.OnFrame != nil {
+			app.OnFrame(f, nil, now)
 		}
+		return
 	}
 
-	if err := recv.Err(); err != nil {
-		return fmt.Errorf("receiver error: %w", err)
+	present := def.Present(f.Data)
+	values := make([]SignalValue, 0, len(present))
+	for _, sig := range present {
+		if reason := signalProblem(sig, dlc); reason != "" {
+			app.DecodeErrors.Observe(frameID, f.IsExtended, def.Name, sig.SignalName, reason, data, now)
+			continue
+		}
+		val := decodeSignal(f.Data, sig)
+		if trace {
+			slog.Debug("decoded signal", "id", id, "frame", def.Name, "signal", sig.SignalName, "value", val, "unit", sig.Unit, "dir", dir)
+		}
+		app.Alerts.ObserveSignal(def.Name, sig.SignalName, val)
+		values = append(values, SignalValue{
+			Name:      sig.SignalName,
+			Value:     clampFinite(val),
+			Unit:      sig.Unit,
+			FrameID:   id,
+			FrameName: def.Name,
+			UpdatedAt: now,
+			Dir:       sig.Direction,
+			Comment:   sig.Comment,
+			Text:      sig.Values[rawSignal(f.Data, sig)],
+			Node:      def.Node,
+		})
+	}
+	name := def.Name
+	if !ok {
+		name = hook.frame // unmapped frames only get here with a hook
+	}
+	if hook != nil {
+		for _, v := range hook.run(f, name, id, dir, now) {
+			if trace {
+				slog.Debug("decoded signal", "id", id, "frame", name, "signal", v.Name, "value", v.Value, "unit", v.Unit, "dir", dir, "hook", true)
+			}
+			app.Alerts.ObserveSignal(name, v.Name, v.Value)
+			v.Node = def.Node
+			values = append(values, v)
+		}
+	}
+	publishSignals(app, values, now)
+	deriveSignals(app, values, now)
+	span.decoded(name, len(values))
+	var defp *FrameDef
+	if ok {
+		defp = &def
+	}
+	fireTriggers(app, app.Triggers.ObserveFrame(app.Iface, f, defp, now), now)
+	if app.OnFrame != nil {
+		app.OnFrame(f, defp, now)
 	}
-	return nil
+}
+
+// publishSignals hands freshly decoded values to the store and history,
+// less those the deadband holds back. Statistics see every value.
+func publishSignals(app *App, values []SignalValue, now time.Time) {
+	app.SignalStats.Observe(values)
+	app.Sessions.ObserveSignals(values)
+	published := app.Deadband.Filter(values, now)
+	for _, v := range published {
+		app.History.Record(app.Iface, v.FrameName+"."+v.Name, v.Value, now)
+	}
+	app.Store.UpsertSignals(published)
+}
+
+// fireTriggers marks fired triggers in the marker log and any recording.
+func fireTriggers(app *App, names []string, now time.Time) {
+	for _, name := range names {
+		label := "trigger " + name
+		app.Recorder.WriteMarker(label, now)
+		app.Markers.Add(label, now)
+	}
+}
+
+func processErrorFrame(app *App, ef socketcan.ErrorFrame, st frameStamp) {
+	now := st.TS
+	ev := app.Errors.Observe(ef, now)
+	fireTriggers(app, app.Triggers.ObserveError(ev.Detail, now), now)
+	app.Alerts.ObserveError(ev.Detail)
+	data, _ := hex.DecodeString(ev.DataHex)
+	app.Store.PushRaw(RawFrame{
+		TS:       now,
+		ID:       "ERR",
+		DLC:      len(ev.DataHex) / 2,
+		DataHex:  ev.DataHex,
+		Dir:      "rx",
+		Error:    ev.Detail,
+		WallTS:   st.Wall,
+		MonoNs:   app.Clock.Mono(st.Wall),
+		TSSource: st.Source,
+		data:     data,
+	})
 }
 
 func decodeSignal(d can.Data, s SignalDef) float64 {
@@ -196,6 +743,85 @@ func decodeSignal(d can.Data, s SignalDef) float64 {
 	return raw*s.Factor + s.Offset
 }
 
+// rawSignal returns the raw integer of s in d, before scaling.
+func rawSignal(d can.Data, s SignalDef) int64 {
+	switch {
+	case s.Endianness == EndianBig && s.Signed:
+		return d.SignedBitsBigEndian(s.StartBit, s.BitLength)
+	case s.Endianness == EndianBig:
+		return int64(d.UnsignedBitsBigEndian(s.StartBit, s.BitLength))
+	case s.Signed:
+		return d.SignedBitsLittleEndian(s.StartBit, s.BitLength)
+	default:
+		return int64(d.UnsignedBitsLittleEndian(s.StartBit, s.BitLength))
+	}
+}
+
+// Present returns the signals carried by payload d: all of them, or for a
+// multiplexed frame the plain ones and those selected by the switch.
+func (fd *FrameDef) Present(d can.Data) []SignalDef {
+	if fd.Mux == nil {
+		return fd.Signals
+	}
+	sel := uint64(rawSignal(d, *fd.Mux))
+	out := make([]SignalDef, 0, len(fd.Signals))
+	for _, s := range fd.Signals {
+		if !s.Muxed || s.MuxValue == sel {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// encodeSignal writes the raw representation of value into d, rounding to
+// the nearest step and saturating at the limits of the bit field.
+func encodeSignal(d *can.Data, s SignalDef, value float64) {
+	if s.Factor == 0 {
+		return
+	}
+	raw := math.Round((value - s.Offset) / s.Factor)
+	lo, hi := rawLimits(s)
+	raw = math.Max(lo, math.Min(hi, raw))
+
+	switch s.Endianness {
+	case EndianLittle:
+		if s.Signed {
+			d.SetSignedBitsLittleEndian(s.StartBit, s.BitLength, int64(raw))
+		} else {
+			d.SetUnsignedBitsLittleEndian(s.StartBit, s.BitLength, uint64(raw))
+		}
+	case EndianBig:
+		if s.Signed {
+			d.SetSignedBitsBigEndian(s.StartBit, s.BitLength, int64(raw))
+		} else {
+			d.SetUnsignedBitsBigEndian(s.StartBit, s.BitLength, uint64(raw))
+		}
+	}
+}
+
+// rawLimits returns the smallest and largest raw integer the signal's bit
+// field can hold.
+func rawLimits(s SignalDef) (lo, hi float64) {
+	if s.Signed {
+		return -math.Ldexp(1, int(s.BitLength)-1), math.Ldexp(1, int(s.BitLength)-1) - 1
+	}
+	return 0, math.Ldexp(1, int(s.BitLength)) - 1
+}
+
+// physicalRange returns the engineering value range of a signal: the map's
+// min/max when given, otherwise whatever the bit field can represent.
+func physicalRange(s SignalDef) (lo, hi float64) {
+	if s.HasRange {
+		return s.Min, s.Max
+	}
+	rlo, rhi := rawLimits(s)
+	lo, hi = rlo*s.Factor+s.Offset, rhi*s.Factor+s.Offset
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	return lo, hi
+}
+
 func clampFinite(v float64) float64 {
 	if math.IsNaN(v) || math.IsInf(v, 0) {
 		return 0
@@ -251,17 +877,58 @@ func LoadCANMap(path string) (map[uint32]FrameDef, error) {
 
 	for _, row := range records[1:] {
 		get := func(k string) string {
-			idx := h[k]
-			if idx >= len(row) {
+			idx, ok := h[k]
+			if !ok || idx >= len(row) {
 				return ""
 			}
 			return strings.TrimSpace(row[idx])
 		}
 
-		frameID, err := parseHexID(get("frame_id"))
+		frameID, mask, err := parseIDPattern(get("frame_id"))
 		if err != nil {
 			return nil, fmt.Errorf("bad frame_id: %w", err)
 		}
+		if s := get("id_mask"); s != "" {
+			m, err := parseHexID(s)
+			if err != nil || m == 0 {
+				return nil, fmt.Errorf("bad id_mask %q", s)
+			}
+			if mask == 0 {
+				mask = ^uint32(0)
+			}
+			mask &= m
+		}
+		if mask != 0 {
+			frameID &= mask
+		}
+		frameName := get("frame_name")
+		if fd, ok := frames[frameID]; ok && fd.Mask != mask {
+			return nil, fmt.Errorf("frame %s: rows disagree on the id mask", frameName)
+		}
+
+		// Rows with an expression are derived signals; their bit layout
+		// columns are ignored.
+		if src := get("expr"); src != "" {
+			e, err := CompileExpr(src)
+			if err != nil {
+				return nil, fmt.Errorf("signal %s.%s: %w", frameName, get("signal_name"), err)
+			}
+			fd := frames[frameID]
+			if fd.ID == 0 {
+				fd = FrameDef{ID: frameID, Mask: mask, Name: frameName, Node: get("node")}
+			}
+			fd.Derived = append(fd.Derived, DerivedDef{
+				FrameID:   frameID,
+				FrameName: frameName,
+				Name:      get("signal_name"),
+				Expr:      e,
+				Unit:      get("unit"),
+				Direction: strings.ToLower(get("direction")),
+				Comment:   get("comment"),
+			})
+			frames[frameID] = fd
+			continue
+		}
 
 		startBit64, err := strconv.ParseUint(get("start_bit"), 10, 8)
 		if err != nil {
@@ -284,7 +951,31 @@ func LoadCANMap(path string) (map[uint32]FrameDef, error) {
 			return nil, fmt.Errorf("bad offset: %w", err)
 		}
 
-		frameName := get("frame_name")
+		minV, hasMin, err := optFloat(get("min"))
+		if err != nil {
+			return nil, fmt.Errorf("bad min: %w", err)
+		}
+		maxV, hasMax, err := optFloat(get("max"))
+		if err != nil {
+			return nil, fmt.Errorf("bad max: %w", err)
+		}
+		defV, _, err := optFloat(get("default"))
+		if err != nil {
+			return nil, fmt.Errorf("bad default: %w", err)
+		}
+
+		dlc64, err := strconv.ParseUint(get("dlc"), 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad dlc: %w", err)
+		}
+		cycleCol := "cycle_ms"
+		if _, ok := h[cycleCol]; !ok {
+			cycleCol = "cycle_time_ms"
+		}
+		cycle, _, err := optFloat(get(cycleCol))
+		if err != nil {
+			return nil, fmt.Errorf("bad %s: %w", cycleCol, err)
+		}
 
 		def := SignalDef{
 			FrameID:    frameID,
@@ -296,27 +987,154 @@ func LoadCANMap(path string) (map[uint32]FrameDef, error) {
 			Signed:     signed,
 			Factor:     factor,
 			Offset:     offset,
+			Min:        minV,
+			Max:        maxV,
+			HasRange:   hasMin && hasMax,
+			Default:    defV,
 			Unit:       get("unit"),
 			Direction:  strings.ToLower(get("direction")),
 			Comment:    get("comment"),
 		}
+		if err := parseMux(&def, get("mux")); err != nil {
+			return nil, fmt.Errorf("signal %s.%s: %w", frameName, def.SignalName, err)
+		}
+		if def.Values, err = parseValueTable(get("value_table")); err != nil {
+			return nil, fmt.Errorf("signal %s.%s: %w", frameName, def.SignalName, err)
+		}
 
 		fd := frames[frameID]
-		if fd.ID == 0 {
-			fd = FrameDef{ID: frameID, Name: frameName}
+		if len(fd.Signals) == 0 {
+			fd.ID, fd.Mask, fd.Name, fd.DLC, fd.CycleMs = frameID, mask, frameName, uint8(dlc64), int(cycle)
+			fd.Node = get("node")
 		}
 		fd.Signals = append(fd.Signals, def)
+		if err := addE2E(&fd, def, get("counter_bits"), get("crc")); err != nil {
+			return nil, fmt.Errorf("signal %s.%s: %w", frameName, def.SignalName, err)
+		}
 		frames[frameID] = fd
 	}
 
 	for id, fd := range frames {
 		sort.Slice(fd.Signals, func(i, j int) bool { return fd.Signals[i].StartBit < fd.Signals[j].StartBit })
+		if err := setMuxSwitch(&fd); err != nil {
+			return nil, fmt.Errorf("frame %s: %w", fd.Name, err)
+		}
 		frames[id] = fd
 	}
 
 	return frames, nil
 }
 
+// parseMux reads the mux cell: M for the multiplexer switch, a number for
+// a signal carried only when the switch has that value.
+func parseMux(sig *SignalDef, s string) error {
+	switch {
+	case s == "":
+	case strings.EqualFold(s, "m"):
+		sig.MuxSwitch = true
+	default:
+		v, err := strconv.ParseUint(s, 0, 64)
+		if err != nil {
+			return fmt.Errorf("bad mux %q (want M or a switch value)", s)
+		}
+		sig.Muxed, sig.MuxValue = true, v
+	}
+	return nil
+}
+
+// parseValueTable parses "0=Off;1=On;2=Fault" into raw value labels.
+func parseValueTable(s string) (map[int64]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	out := make(map[int64]string)
+	for _, entry := range strings.Split(s, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		k, label, ok := strings.Cut(entry, "=")
+		v, err := strconv.ParseInt(strings.TrimSpace(k), 0, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("bad value_table entry %q (want value=label)", entry)
+		}
+		out[v] = strings.TrimSpace(label)
+	}
+	return out, nil
+}
+
+// setMuxSwitch points fd.Mux at the frame's multiplexer switch and checks
+// that multiplexed signals have one.
+func setMuxSwitch(fd *FrameDef) error {
+	muxed := false
+	for i := range fd.Signals {
+		s := &fd.Signals[i]
+		switch {
+		case s.MuxSwitch && fd.Mux != nil:
+			return fmt.Errorf("two multiplexer switches, %s and %s", fd.Mux.SignalName, s.SignalName)
+		case s.MuxSwitch:
+			sw := *s
+			fd.Mux = &sw
+		case s.Muxed:
+			muxed = true
+		}
+	}
+	if muxed && fd.Mux == nil {
+		return errors.New("multiplexed signals but no switch")
+	}
+	return nil
+}
+
+// addE2E records sig as the alive counter or CRC of fd when the
+// counter_bits or crc cell of its row is set.
+func addE2E(fd *FrameDef, sig SignalDef, counterBits, crc string) error {
+	if counterBits == "" && crc == "" {
+		return nil
+	}
+	if counterBits != "" && crc != "" {
+		return errors.New("a signal cannot be both counter and crc")
+	}
+	if fd.E2E == nil {
+		fd.E2E = &E2EDef{}
+	}
+	e := fd.E2E
+	if counterBits != "" {
+		n, err := strconv.ParseUint(counterBits, 10, 8)
+		if err != nil || n == 0 || n > uint64(sig.BitLength) || n > 32 {
+			return fmt.Errorf("bad counter_bits %q", counterBits)
+		}
+		if e.Counter != nil {
+			return fmt.Errorf("frame already has counter %s", e.Counter.SignalName)
+		}
+		e.Counter, e.CounterBits = &sig, uint8(n)
+		return nil
+	}
+	profile, id, hasID, err := parseCRCSpec(crc)
+	if err != nil {
+		return err
+	}
+	idx, err := crcByte(sig)
+	if err != nil {
+		return err
+	}
+	if idx >= int(fd.DLC) {
+		return fmt.Errorf("crc byte %d is beyond dlc %d", idx, fd.DLC)
+	}
+	if e.CRC != nil {
+		return fmt.Errorf("frame already has crc %s", e.CRC.SignalName)
+	}
+	e.CRC, e.Profile, e.DataID, e.HasDataID = &sig, profile, id, hasID
+	return nil
+}
+
+// optFloat parses an optional numeric cell; empty means "not given".
+func optFloat(s string) (float64, bool, error) {
+	if s == "" {
+		return 0, false, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v, err == nil, err
+}
+
 func parseHexID(s string) (uint32, error) {
 	s = strings.TrimSpace(strings.ToLower(s))
 	s = strings.TrimPrefix(s, "0x")
@@ -324,5 +1142,43 @@ func parseHexID(s string) (uint32, error) {
 	return uint32(u), err
 }
 
+// frameKey identifies a frame ID together with its format, so a standard ID
+// and the extended ID of the same value are never counted as one.
+type frameKey struct {
+	id       uint32
+	extended bool
+}
+
+func (k frameKey) String() string { return canIDString(k.id, k.extended) }
+
+// less orders keys by ID, the standard ID before the extended one.
+func (k frameKey) less(o frameKey) bool {
+	if k.id != o.id {
+		return k.id < o.id
+	}
+	return !k.extended && o.extended
+}
+
+// canIDString formats a frame ID as the API reports it: extended IDs with
+// all eight digits, so they never read like the standard ID of the same
+// value.
+func canIDString(id uint32, extended bool) string {
+	if extended {
+		return fmt.Sprintf("0x%08X", id)
+	}
+	return fmt.Sprintf("0x%03X", id)
+}
+
+// parseCANID parses an ID in the canIDString form. It is extended when
+// written with eight digits or above the 11-bit range.
+func parseCANID(s string) (uint32, bool, error) {
+	id, err := parseHexID(s)
+	if err != nil {
+		return 0, false, err
+	}
+	digits := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "0x")
+	return id, len(digits) == 8 || id > 0x7FF, nil
+}
+
 // keep json import used by other files (avoid unused if you remove later)
 var _ = json.RawMessage{}
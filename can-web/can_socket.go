@@ -0,0 +1,239 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"go.einride.tech/can"
+	"go.einride.tech/can/pkg/socketcan"
+	"golang.org/x/sys/unix"
+)
+
+const canMTU = 16 // sizeof(struct can_frame)
+
+// canReceiver reads a raw CAN socket like socketcan.Receiver, but with
+// recvmsg so that the kernel's receive timestamp comes along.
+type canReceiver struct {
+	f  *os.File
+	rc syscall.RawConn
+
+	buf   [canMTU]byte
+	oob   []byte
+	frame can.Frame
+	ef    socketcan.ErrorFrame
+	isErr bool
+	stamp frameStamp
+	drops uint32 // frames the kernel dropped because the socket queue was full
+	err   error
+}
+
+// dialCANReceiver opens iface with error frames enabled and receive queue
+// overflows reported. With kernelTS the socket asks for the controller's
+// hardware receive timestamps and the kernel's software ones, falling back
+// to SO_TIMESTAMPNS on kernels without SO_TIMESTAMPING.
+func dialCANReceiver(iface string, kernelTS bool) (*canReceiver, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", iface, err)
+	}
+	fd, err := unix.Socket(unix.AF_CAN, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.CAN_RAW)
+	if err != nil {
+		return nil, fmt.Errorf("socket: %w", err)
+	}
+	setup := func() error {
+		if err := unix.SetsockoptInt(fd, unix.SOL_CAN_RAW, unix.CAN_RAW_ERR_FILTER, unix.CAN_ERR_MASK); err != nil {
+			return fmt.Errorf("set error filter: %w", err)
+		}
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RXQ_OVFL, 1); err != nil {
+			return fmt.Errorf("enable overflow count: %w", err)
+		}
+		if kernelTS {
+			flags := unix.SOF_TIMESTAMPING_RX_SOFTWARE | unix.SOF_TIMESTAMPING_SOFTWARE |
+				unix.SOF_TIMESTAMPING_RX_HARDWARE | unix.SOF_TIMESTAMPING_RAW_HARDWARE
+			if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TIMESTAMPING, flags); err != nil {
+				if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TIMESTAMPNS, 1); err != nil {
+					return fmt.Errorf("enable timestamps: %w", err)
+				}
+			}
+		}
+		if err := unix.SetNonblock(fd, true); err != nil {
+			return fmt.Errorf("set nonblock: %w", err)
+		}
+		if err := unix.Bind(fd, &unix.SockaddrCAN{Ifindex: ifi.Index}); err != nil {
+			return fmt.Errorf("bind: %w", err)
+		}
+		return nil
+	}
+	if err := setup(); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	// non-blocking, so the runtime poller handles reads and Close
+	f := os.NewFile(uintptr(fd), "can:"+iface)
+	rc, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &canReceiver{f: f, rc: rc, oob: make([]byte, unix.CmsgSpace(3*16)+unix.CmsgSpace(4))}, nil
+}
+
+// Receive reads the next frame. It returns false once the socket is closed
+// or fails; see Err.
+func (r *canReceiver) Receive() bool {
+	for {
+		var n, oobn int
+		var rerr error
+		err := r.rc.Read(func(fd uintptr) bool {
+			n, oobn, _, _, rerr = unix.Recvmsg(int(fd), r.buf[:], r.oob, 0)
+			return rerr != unix.EAGAIN
+		})
+		if err == nil {
+			err = rerr
+		}
+		if err != nil {
+			r.err = err
+			return false
+		}
+		if n != canMTU {
+			continue
+		}
+
+		wall := time.Now()
+		r.stamp = userStamp(wall)
+		if ts, src := r.control(r.oob[:oobn]); src != "" {
+			r.stamp = frameStamp{TS: ts, Wall: wall, Source: src}
+		}
+		idFlags := binary.NativeEndian.Uint32(r.buf[0:4])
+		var data can.Data
+		copy(data[:], r.buf[8:16])
+		r.isErr = idFlags&canERRFlag != 0
+		if r.isErr {
+			r.ef = wireErrorFrame(idFlags, data)
+		} else {
+			r.frame = frameFromWire(idFlags, min(r.buf[4], 8), data[:])
+		}
+		return true
+	}
+}
+
+func (r *canReceiver) HasErrorFrame() bool              { return r.isErr }
+func (r *canReceiver) Frame() can.Frame                 { return r.frame }
+func (r *canReceiver) ErrorFrame() socketcan.ErrorFrame { return r.ef }
+func (r *canReceiver) Stamp() frameStamp                { return r.stamp }
+func (r *canReceiver) Drops() uint32                    { return r.drops }
+func (r *canReceiver) Close() error                     { return r.f.Close() }
+
+func (r *canReceiver) Err() error { return r.err }
+
+// control reads the control messages of a received frame: it returns the
+// receive timestamp and its source, "hardware" or "kernel", or "" when
+// there is none, and keeps the socket's overflow count from SO_RXQ_OVFL,
+// which the kernel only sends once it is non-zero.
+func (r *canReceiver) control(oob []byte) (time.Time, string) {
+	if len(oob) == 0 {
+		return time.Time{}, ""
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Time{}, ""
+	}
+	var ts time.Time
+	var src string
+	for _, m := range msgs {
+		if m.Header.Level != unix.SOL_SOCKET {
+			continue
+		}
+		switch m.Header.Type {
+		case unix.SO_RXQ_OVFL:
+			if len(m.Data) >= 4 {
+				r.drops = binary.NativeEndian.Uint32(m.Data)
+			}
+		case unix.SCM_TIMESTAMPNS:
+			var t unix.Timespec
+			if err := binary.Read(bytes.NewReader(m.Data), binary.NativeEndian, &t); err != nil {
+				continue
+			}
+			if t.Sec != 0 || t.Nsec != 0 {
+				ts, src = time.Unix(t.Unix()), "kernel"
+			}
+		case unix.SCM_TIMESTAMPING:
+			// three timespecs: software, deprecated, raw hardware; a zero
+			// one was not taken, e.g. by a controller without a clock
+			var t [3]unix.Timespec
+			if err := binary.Read(bytes.NewReader(m.Data), binary.NativeEndian, &t); err != nil {
+				continue
+			}
+			switch {
+			case t[2].Sec != 0 || t[2].Nsec != 0:
+				ts, src = time.Unix(t[2].Unix()), "hardware"
+			case t[0].Sec != 0 || t[0].Nsec != 0:
+				ts, src = time.Unix(t[0].Unix()), "kernel"
+			}
+		}
+	}
+	return ts, src
+}
+
+func runCANSession(ctx context.Context, app *App, kernelTS bool) error {
+	iface := app.Iface
+	recv, err := dialCANReceiver(iface, kernelTS)
+	if err != nil {
+		return fmt.Errorf("socketcan dial(%s): %w", iface, err)
+	}
+	defer recv.Close()
+
+	// Unblock Receive on shutdown.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			recv.Close()
+		case <-done:
+		}
+	}()
+
+	app.Conn.Connected()
+	slog.Info("CAN reader listening")
+
+	var drops uint32
+	var warned time.Time
+	for recv.Receive() {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		if d := recv.Drops(); d != drops {
+			app.Stats.ObserveKernelDrops(uint64(d - drops))
+			drops = d
+			if time.Since(warned) > dropWarnEvery {
+				slog.Warn("socket receive queue overflowed, frames lost", "total", d)
+				warned = time.Now()
+			}
+		}
+
+		if recv.HasErrorFrame() {
+			processErrorFrame(app, recv.ErrorFrame(), recv.Stamp())
+			continue
+		}
+		ingestFrame(app, recv.Frame(), recv.Stamp(), "rx")
+	}
+
+	if err := recv.Err(); err != nil {
+		return fmt.Errorf("receiver error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// errNoSocketCAN is returned by the SocketCAN parts on other systems; use a
+// backend such as slcan instead.
+var errNoSocketCAN = errors.New("SocketCAN is only available on Linux")
+
+func runCANSession(context.Context, *App, bool) error { return errNoSocketCAN }
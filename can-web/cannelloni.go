@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+const (
+	cannelloniVersion = 2
+	cannelloniOpData  = 0
+	cannelloniListen  = ":20000"
+
+	// Linux can_id flags, as carried on the wire
+	canEFFFlag = 0x80000000
+	canRTRFlag = 0x40000000
+	canERRFlag = 0x20000000
+	canFDFlag  = 0x80 // in the cannelloni length byte
+)
+
+// cannelloniPeer exchanges frames with a cannelloni instance over UDP. The
+// remote side runs e.g. "cannelloni -I can0 -R <this host> -r 20000 -l 20000".
+type cannelloniPeer struct {
+	listen string
+	peer   string
+
+	mu   sync.Mutex
+	conn *net.UDPConn // nil while not listening
+	to   *net.UDPAddr
+	seq  uint8
+}
+
+func init() {
+	registerBackend("cannelloni", func(cfg Config) (busBackend, error) {
+		if cfg.Remote.Addr == "" {
+			return nil, errors.New("cannelloni source needs remote.addr (CAN_REMOTE_ADDR)")
+		}
+		return newCannelloniPeer(cfg.Remote.Addr, cfg.Remote.Listen), nil
+	})
+}
+
+func newCannelloniPeer(peer, listen string) *cannelloniPeer {
+	if listen == "" {
+		listen = cannelloniListen
+	}
+	return &cannelloniPeer{peer: peer, listen: listen}
+}
+
+func (c *cannelloniPeer) session(ctx context.Context, app *App) error {
+	to, err := net.ResolveUDPAddr("udp", c.peer)
+	if err != nil {
+		return fmt.Errorf("cannelloni peer %q: %w", c.peer, err)
+	}
+	laddr, err := net.ResolveUDPAddr("udp", c.listen)
+	if err != nil {
+		return fmt.Errorf("cannelloni listen %q: %w", c.listen, err)
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return fmt.Errorf("cannelloni listen(%s): %w", c.listen, err)
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c.mu.Lock()
+	c.conn, c.to = conn, to
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+	}()
+
+	app.Conn.Connected()
+	slog.Info("cannelloni listening", "addr", conn.LocalAddr().String(), "peer", to.String())
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("cannelloni read: %w", err)
+		}
+		if !from.IP.Equal(to.IP) {
+			continue
+		}
+		now := time.Now()
+		err = parseCannelloni(buf[:n], func(idFlags uint32, f can.Frame) {
+			if idFlags&canERRFlag != 0 {
+				processErrorFrame(app, wireErrorFrame(idFlags, f.Data), userStamp(now))
+				return
+			}
+			processFrame(app, f, now)
+		})
+		if err != nil {
+			slog.Warn("cannelloni: bad packet", "from", from.String(), "err", err)
+		}
+	}
+}
+
+func (c *cannelloniPeer) Transmit(_ context.Context, f can.Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return errors.New("cannelloni not listening")
+	}
+	c.seq++
+	pkt := []byte{cannelloniVersion, cannelloniOpData, c.seq, 0, 1}
+	pkt = binary.BigEndian.AppendUint32(pkt, wireID(f))
+	pkt = append(pkt, f.Length)
+	if !f.IsRemote {
+		pkt = append(pkt, f.Data[:f.Length]...)
+	}
+	_, err := c.conn.WriteToUDP(pkt, c.to)
+	return err
+}
+
+// parseCannelloni calls fn for each classic CAN frame in a data packet:
+//
+//	version u8, op_code u8, seq_no u8, count u16 (big endian), then count
+//	times: can_id u32 (big endian, Linux flags), len u8 (0x80 = CAN FD,
+//	followed by a flags byte), len data bytes unless the frame is RTR.
+//
+// CAN FD frames are skipped.
+func parseCannelloni(b []byte, fn func(idFlags uint32, f can.Frame)) error {
+	if len(b) < 5 {
+		return errors.New("short header")
+	}
+	if b[0] != cannelloniVersion {
+		return fmt.Errorf("unsupported version %d", b[0])
+	}
+	if b[1] != cannelloniOpData {
+		return nil
+	}
+	count := int(binary.BigEndian.Uint16(b[3:5]))
+	b = b[5:]
+	for i := 0; i < count; i++ {
+		if len(b) < 5 {
+			return fmt.Errorf("frame %d truncated", i)
+		}
+		idFlags := binary.BigEndian.Uint32(b)
+		n := b[4]
+		b = b[5:]
+		fd := n&canFDFlag != 0
+		n &^= canFDFlag
+		if fd {
+			if len(b) < 1 {
+				return fmt.Errorf("frame %d truncated", i)
+			}
+			b = b[1:]
+		}
+		dataLen := int(n)
+		if idFlags&canRTRFlag != 0 {
+			dataLen = 0
+		}
+		if len(b) < dataLen {
+			return fmt.Errorf("frame %d truncated", i)
+		}
+		data := b[:dataLen]
+		b = b[dataLen:]
+		if fd || n > 8 {
+			continue
+		}
+
+		fn(idFlags, frameFromWire(idFlags, n, data))
+	}
+	return nil
+}
+
+// wireID is the Linux can_id of f.
+func wireID(f can.Frame) uint32 {
+	id := f.ID
+	if f.IsExtended {
+		id |= canEFFFlag
+	}
+	if f.IsRemote {
+		id |= canRTRFlag
+	}
+	return id
+}
+
+// frameFromWire builds a classic frame from a Linux can_id, length and
+// payload.
+func frameFromWire(idFlags uint32, n uint8, data []byte) can.Frame {
+	f := can.Frame{
+		IsExtended: idFlags&canEFFFlag != 0,
+		IsRemote:   idFlags&canRTRFlag != 0,
+		Length:     n,
+	}
+	if f.IsExtended {
+		f.ID = idFlags & can.MaxExtendedID
+	} else {
+		f.ID = idFlags & can.MaxID
+	}
+	copy(f.Data[:], data[:min(int(n), len(data))])
+	return f
+}
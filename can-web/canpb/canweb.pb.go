@@ -0,0 +1,754 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: canweb/v1/canweb.proto
+
+package canpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetStateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStateRequest) Reset() {
+	*x = GetStateRequest{}
+	mi := &file_canweb_v1_canweb_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStateRequest) ProtoMessage() {}
+
+func (x *GetStateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_canweb_v1_canweb_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStateRequest.ProtoReflect.Descriptor instead.
+func (*GetStateRequest) Descriptor() ([]byte, []int) {
+	return file_canweb_v1_canweb_proto_rawDescGZIP(), []int{0}
+}
+
+type State struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ts            *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=ts,proto3" json:"ts,omitempty"`
+	Iface         string                 `protobuf:"bytes,2,opt,name=iface,proto3" json:"iface,omitempty"`
+	Profile       string                 `protobuf:"bytes,3,opt,name=profile,proto3" json:"profile,omitempty"`
+	Conn          *ConnStatus            `protobuf:"bytes,4,opt,name=conn,proto3" json:"conn,omitempty"`
+	BusState      string                 `protobuf:"bytes,5,opt,name=bus_state,json=busState,proto3" json:"bus_state,omitempty"`
+	Signals       []*Signal              `protobuf:"bytes,6,rep,name=signals,proto3" json:"signals,omitempty"`
+	Raw           []*RawFrame            `protobuf:"bytes,7,rep,name=raw,proto3" json:"raw,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *State) Reset() {
+	*x = State{}
+	mi := &file_canweb_v1_canweb_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *State) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*State) ProtoMessage() {}
+
+func (x *State) ProtoReflect() protoreflect.Message {
+	mi := &file_canweb_v1_canweb_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use State.ProtoReflect.Descriptor instead.
+func (*State) Descriptor() ([]byte, []int) {
+	return file_canweb_v1_canweb_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *State) GetTs() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Ts
+	}
+	return nil
+}
+
+func (x *State) GetIface() string {
+	if x != nil {
+		return x.Iface
+	}
+	return ""
+}
+
+func (x *State) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+func (x *State) GetConn() *ConnStatus {
+	if x != nil {
+		return x.Conn
+	}
+	return nil
+}
+
+func (x *State) GetBusState() string {
+	if x != nil {
+		return x.BusState
+	}
+	return ""
+}
+
+func (x *State) GetSignals() []*Signal {
+	if x != nil {
+		return x.Signals
+	}
+	return nil
+}
+
+func (x *State) GetRaw() []*RawFrame {
+	if x != nil {
+		return x.Raw
+	}
+	return nil
+}
+
+type ConnStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	State         string                 `protobuf:"bytes,1,opt,name=state,proto3" json:"state,omitempty"`
+	Since         *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=since,proto3" json:"since,omitempty"`
+	DownSince     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=down_since,json=downSince,proto3" json:"down_since,omitempty"`
+	LastError     string                 `protobuf:"bytes,4,opt,name=last_error,json=lastError,proto3" json:"last_error,omitempty"`
+	Attempts      int64                  `protobuf:"varint,5,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	Connects      int64                  `protobuf:"varint,6,opt,name=connects,proto3" json:"connects,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConnStatus) Reset() {
+	*x = ConnStatus{}
+	mi := &file_canweb_v1_canweb_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConnStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConnStatus) ProtoMessage() {}
+
+func (x *ConnStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_canweb_v1_canweb_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConnStatus.ProtoReflect.Descriptor instead.
+func (*ConnStatus) Descriptor() ([]byte, []int) {
+	return file_canweb_v1_canweb_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ConnStatus) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *ConnStatus) GetSince() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Since
+	}
+	return nil
+}
+
+func (x *ConnStatus) GetDownSince() *timestamppb.Timestamp {
+	if x != nil {
+		return x.DownSince
+	}
+	return nil
+}
+
+func (x *ConnStatus) GetLastError() string {
+	if x != nil {
+		return x.LastError
+	}
+	return ""
+}
+
+func (x *ConnStatus) GetAttempts() int64 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *ConnStatus) GetConnects() int64 {
+	if x != nil {
+		return x.Connects
+	}
+	return 0
+}
+
+type Signal struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value         float64                `protobuf:"fixed64,2,opt,name=value,proto3" json:"value,omitempty"`
+	Unit          string                 `protobuf:"bytes,3,opt,name=unit,proto3" json:"unit,omitempty"`
+	FrameId       string                 `protobuf:"bytes,4,opt,name=frame_id,json=frameId,proto3" json:"frame_id,omitempty"`
+	FrameName     string                 `protobuf:"bytes,5,opt,name=frame_name,json=frameName,proto3" json:"frame_name,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	Direction     string                 `protobuf:"bytes,7,opt,name=direction,proto3" json:"direction,omitempty"`
+	Comment       string                 `protobuf:"bytes,8,opt,name=comment,proto3" json:"comment,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Signal) Reset() {
+	*x = Signal{}
+	mi := &file_canweb_v1_canweb_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Signal) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Signal) ProtoMessage() {}
+
+func (x *Signal) ProtoReflect() protoreflect.Message {
+	mi := &file_canweb_v1_canweb_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Signal.ProtoReflect.Descriptor instead.
+func (*Signal) Descriptor() ([]byte, []int) {
+	return file_canweb_v1_canweb_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Signal) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Signal) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *Signal) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *Signal) GetFrameId() string {
+	if x != nil {
+		return x.FrameId
+	}
+	return ""
+}
+
+func (x *Signal) GetFrameName() string {
+	if x != nil {
+		return x.FrameName
+	}
+	return ""
+}
+
+func (x *Signal) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *Signal) GetDirection() string {
+	if x != nil {
+		return x.Direction
+	}
+	return ""
+}
+
+func (x *Signal) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+type RawFrame struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Ts    *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=ts,proto3" json:"ts,omitempty"`
+	// "0x123", or "ERR" for error frames
+	Id            string `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	CanId         uint32 `protobuf:"varint,3,opt,name=can_id,json=canId,proto3" json:"can_id,omitempty"`
+	Dlc           uint32 `protobuf:"varint,4,opt,name=dlc,proto3" json:"dlc,omitempty"`
+	Data          []byte `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
+	Direction     string `protobuf:"bytes,6,opt,name=direction,proto3" json:"direction,omitempty"`
+	Error         string `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RawFrame) Reset() {
+	*x = RawFrame{}
+	mi := &file_canweb_v1_canweb_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RawFrame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RawFrame) ProtoMessage() {}
+
+func (x *RawFrame) ProtoReflect() protoreflect.Message {
+	mi := &file_canweb_v1_canweb_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RawFrame.ProtoReflect.Descriptor instead.
+func (*RawFrame) Descriptor() ([]byte, []int) {
+	return file_canweb_v1_canweb_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *RawFrame) GetTs() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Ts
+	}
+	return nil
+}
+
+func (x *RawFrame) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *RawFrame) GetCanId() uint32 {
+	if x != nil {
+		return x.CanId
+	}
+	return 0
+}
+
+func (x *RawFrame) GetDlc() uint32 {
+	if x != nil {
+		return x.Dlc
+	}
+	return 0
+}
+
+func (x *RawFrame) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *RawFrame) GetDirection() string {
+	if x != nil {
+		return x.Direction
+	}
+	return ""
+}
+
+func (x *RawFrame) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type StreamSignalsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// "FRAME.signal" or "signal"; empty streams all signals.
+	Signals       []string `protobuf:"bytes,1,rep,name=signals,proto3" json:"signals,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamSignalsRequest) Reset() {
+	*x = StreamSignalsRequest{}
+	mi := &file_canweb_v1_canweb_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamSignalsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamSignalsRequest) ProtoMessage() {}
+
+func (x *StreamSignalsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_canweb_v1_canweb_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamSignalsRequest.ProtoReflect.Descriptor instead.
+func (*StreamSignalsRequest) Descriptor() ([]byte, []int) {
+	return file_canweb_v1_canweb_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *StreamSignalsRequest) GetSignals() []string {
+	if x != nil {
+		return x.Signals
+	}
+	return nil
+}
+
+type StreamRawFramesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Frame IDs such as "0x123" or "ERR"; empty streams all frames.
+	Ids           []string `protobuf:"bytes,1,rep,name=ids,proto3" json:"ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamRawFramesRequest) Reset() {
+	*x = StreamRawFramesRequest{}
+	mi := &file_canweb_v1_canweb_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamRawFramesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamRawFramesRequest) ProtoMessage() {}
+
+func (x *StreamRawFramesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_canweb_v1_canweb_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamRawFramesRequest.ProtoReflect.Descriptor instead.
+func (*StreamRawFramesRequest) Descriptor() ([]byte, []int) {
+	return file_canweb_v1_canweb_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StreamRawFramesRequest) GetIds() []string {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+type SendFrameRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint32                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	Extended      bool                   `protobuf:"varint,3,opt,name=extended,proto3" json:"extended,omitempty"`
+	Remote        bool                   `protobuf:"varint,4,opt,name=remote,proto3" json:"remote,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendFrameRequest) Reset() {
+	*x = SendFrameRequest{}
+	mi := &file_canweb_v1_canweb_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendFrameRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendFrameRequest) ProtoMessage() {}
+
+func (x *SendFrameRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_canweb_v1_canweb_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendFrameRequest.ProtoReflect.Descriptor instead.
+func (*SendFrameRequest) Descriptor() ([]byte, []int) {
+	return file_canweb_v1_canweb_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SendFrameRequest) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *SendFrameRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *SendFrameRequest) GetExtended() bool {
+	if x != nil {
+		return x.Extended
+	}
+	return false
+}
+
+func (x *SendFrameRequest) GetRemote() bool {
+	if x != nil {
+		return x.Remote
+	}
+	return false
+}
+
+type SendFrameResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendFrameResponse) Reset() {
+	*x = SendFrameResponse{}
+	mi := &file_canweb_v1_canweb_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendFrameResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendFrameResponse) ProtoMessage() {}
+
+func (x *SendFrameResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_canweb_v1_canweb_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendFrameResponse.ProtoReflect.Descriptor instead.
+func (*SendFrameResponse) Descriptor() ([]byte, []int) {
+	return file_canweb_v1_canweb_proto_rawDescGZIP(), []int{8}
+}
+
+var File_canweb_v1_canweb_proto protoreflect.FileDescriptor
+
+const file_canweb_v1_canweb_proto_rawDesc = "" +
+	"\n" +
+	"\x16canweb/v1/canweb.proto\x12\tcanweb.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x11\n" +
+	"\x0fGetStateRequest\"\xff\x01\n" +
+	"\x05State\x12*\n" +
+	"\x02ts\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x02ts\x12\x14\n" +
+	"\x05iface\x18\x02 \x01(\tR\x05iface\x12\x18\n" +
+	"\aprofile\x18\x03 \x01(\tR\aprofile\x12)\n" +
+	"\x04conn\x18\x04 \x01(\v2\x15.canweb.v1.ConnStatusR\x04conn\x12\x1b\n" +
+	"\tbus_state\x18\x05 \x01(\tR\bbusState\x12+\n" +
+	"\asignals\x18\x06 \x03(\v2\x11.canweb.v1.SignalR\asignals\x12%\n" +
+	"\x03raw\x18\a \x03(\v2\x13.canweb.v1.RawFrameR\x03raw\"\xe6\x01\n" +
+	"\n" +
+	"ConnStatus\x12\x14\n" +
+	"\x05state\x18\x01 \x01(\tR\x05state\x120\n" +
+	"\x05since\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x05since\x129\n" +
+	"\n" +
+	"down_since\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tdownSince\x12\x1d\n" +
+	"\n" +
+	"last_error\x18\x04 \x01(\tR\tlastError\x12\x1a\n" +
+	"\battempts\x18\x05 \x01(\x03R\battempts\x12\x1a\n" +
+	"\bconnects\x18\x06 \x01(\x03R\bconnects\"\xf3\x01\n" +
+	"\x06Signal\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value\x12\x12\n" +
+	"\x04unit\x18\x03 \x01(\tR\x04unit\x12\x19\n" +
+	"\bframe_id\x18\x04 \x01(\tR\aframeId\x12\x1d\n" +
+	"\n" +
+	"frame_name\x18\x05 \x01(\tR\tframeName\x129\n" +
+	"\n" +
+	"updated_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12\x1c\n" +
+	"\tdirection\x18\a \x01(\tR\tdirection\x12\x18\n" +
+	"\acomment\x18\b \x01(\tR\acomment\"\xb7\x01\n" +
+	"\bRawFrame\x12*\n" +
+	"\x02ts\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x02ts\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x15\n" +
+	"\x06can_id\x18\x03 \x01(\rR\x05canId\x12\x10\n" +
+	"\x03dlc\x18\x04 \x01(\rR\x03dlc\x12\x12\n" +
+	"\x04data\x18\x05 \x01(\fR\x04data\x12\x1c\n" +
+	"\tdirection\x18\x06 \x01(\tR\tdirection\x12\x14\n" +
+	"\x05error\x18\a \x01(\tR\x05error\"0\n" +
+	"\x14StreamSignalsRequest\x12\x18\n" +
+	"\asignals\x18\x01 \x03(\tR\asignals\"*\n" +
+	"\x16StreamRawFramesRequest\x12\x10\n" +
+	"\x03ids\x18\x01 \x03(\tR\x03ids\"j\n" +
+	"\x10SendFrameRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\rR\x02id\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\x12\x1a\n" +
+	"\bextended\x18\x03 \x01(\bR\bextended\x12\x16\n" +
+	"\x06remote\x18\x04 \x01(\bR\x06remote\"\x13\n" +
+	"\x11SendFrameResponse2\x9e\x02\n" +
+	"\x06CanWeb\x128\n" +
+	"\bGetState\x12\x1a.canweb.v1.GetStateRequest\x1a\x10.canweb.v1.State\x12E\n" +
+	"\rStreamSignals\x12\x1f.canweb.v1.StreamSignalsRequest\x1a\x11.canweb.v1.Signal0\x01\x12K\n" +
+	"\x0fStreamRawFrames\x12!.canweb.v1.StreamRawFramesRequest\x1a\x13.canweb.v1.RawFrame0\x01\x12F\n" +
+	"\tSendFrame\x12\x1b.canweb.v1.SendFrameRequest\x1a\x1c.canweb.v1.SendFrameResponseB!Z\x1fexample.com/can-web/canpb;canpbb\x06proto3"
+
+var (
+	file_canweb_v1_canweb_proto_rawDescOnce sync.Once
+	file_canweb_v1_canweb_proto_rawDescData []byte
+)
+
+func file_canweb_v1_canweb_proto_rawDescGZIP() []byte {
+	file_canweb_v1_canweb_proto_rawDescOnce.Do(func() {
+		file_canweb_v1_canweb_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_canweb_v1_canweb_proto_rawDesc), len(file_canweb_v1_canweb_proto_rawDesc)))
+	})
+	return file_canweb_v1_canweb_proto_rawDescData
+}
+
+var file_canweb_v1_canweb_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_canweb_v1_canweb_proto_goTypes = []any{
+	(*GetStateRequest)(nil),        // 0: canweb.v1.GetStateRequest
+	(*State)(nil),                  // 1: canweb.v1.State
+	(*ConnStatus)(nil),             // 2: canweb.v1.ConnStatus
+	(*Signal)(nil),                 // 3: canweb.v1.Signal
+	(*RawFrame)(nil),               // 4: canweb.v1.RawFrame
+	(*StreamSignalsRequest)(nil),   // 5: canweb.v1.StreamSignalsRequest
+	(*StreamRawFramesRequest)(nil), // 6: canweb.v1.StreamRawFramesRequest
+	(*SendFrameRequest)(nil),       // 7: canweb.v1.SendFrameRequest
+	(*SendFrameResponse)(nil),      // 8: canweb.v1.SendFrameResponse
+	(*timestamppb.Timestamp)(nil),  // 9: google.protobuf.Timestamp
+}
+var file_canweb_v1_canweb_proto_depIdxs = []int32{
+	9,  // 0: canweb.v1.State.ts:type_name -> google.protobuf.Timestamp
+	2,  // 1: canweb.v1.State.conn:type_name -> canweb.v1.ConnStatus
+	3,  // 2: canweb.v1.State.signals:type_name -> canweb.v1.Signal
+	4,  // 3: canweb.v1.State.raw:type_name -> canweb.v1.RawFrame
+	9,  // 4: canweb.v1.ConnStatus.since:type_name -> google.protobuf.Timestamp
+	9,  // 5: canweb.v1.ConnStatus.down_since:type_name -> google.protobuf.Timestamp
+	9,  // 6: canweb.v1.Signal.updated_at:type_name -> google.protobuf.Timestamp
+	9,  // 7: canweb.v1.RawFrame.ts:type_name -> google.protobuf.Timestamp
+	0,  // 8: canweb.v1.CanWeb.GetState:input_type -> canweb.v1.GetStateRequest
+	5,  // 9: canweb.v1.CanWeb.StreamSignals:input_type -> canweb.v1.StreamSignalsRequest
+	6,  // 10: canweb.v1.CanWeb.StreamRawFrames:input_type -> canweb.v1.StreamRawFramesRequest
+	7,  // 11: canweb.v1.CanWeb.SendFrame:input_type -> canweb.v1.SendFrameRequest
+	1,  // 12: canweb.v1.CanWeb.GetState:output_type -> canweb.v1.State
+	3,  // 13: canweb.v1.CanWeb.StreamSignals:output_type -> canweb.v1.Signal
+	4,  // 14: canweb.v1.CanWeb.StreamRawFrames:output_type -> canweb.v1.RawFrame
+	8,  // 15: canweb.v1.CanWeb.SendFrame:output_type -> canweb.v1.SendFrameResponse
+	12, // [12:16] is the sub-list for method output_type
+	8,  // [8:12] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_canweb_v1_canweb_proto_init() }
+func file_canweb_v1_canweb_proto_init() {
+	if File_canweb_v1_canweb_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_canweb_v1_canweb_proto_rawDesc), len(file_canweb_v1_canweb_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_canweb_v1_canweb_proto_goTypes,
+		DependencyIndexes: file_canweb_v1_canweb_proto_depIdxs,
+		MessageInfos:      file_canweb_v1_canweb_proto_msgTypes,
+	}.Build()
+	File_canweb_v1_canweb_proto = out.File
+	file_canweb_v1_canweb_proto_goTypes = nil
+	file_canweb_v1_canweb_proto_depIdxs = nil
+}
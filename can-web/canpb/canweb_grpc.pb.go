@@ -0,0 +1,258 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: canweb/v1/canweb.proto
+
+package canpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CanWeb_GetState_FullMethodName        = "/canweb.v1.CanWeb/GetState"
+	CanWeb_StreamSignals_FullMethodName   = "/canweb.v1.CanWeb/StreamSignals"
+	CanWeb_StreamRawFrames_FullMethodName = "/canweb.v1.CanWeb/StreamRawFrames"
+	CanWeb_SendFrame_FullMethodName       = "/canweb.v1.CanWeb/SendFrame"
+)
+
+// CanWebClient is the client API for CanWeb service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// CanWeb mirrors the HTTP API for services that prefer gRPC. Metadata
+// "authorization: Bearer <token>" (or Basic) authenticates like the HTTP
+// API: GetState and the streams need a viewer, SendFrame an operator.
+type CanWebClient interface {
+	// GetState returns the same snapshot as GET /api/state.
+	GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*State, error)
+	// StreamSignals sends every decoded signal update.
+	StreamSignals(ctx context.Context, in *StreamSignalsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Signal], error)
+	// StreamRawFrames sends every received (and sent) raw frame.
+	StreamRawFrames(ctx context.Context, in *StreamRawFramesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RawFrame], error)
+	// SendFrame transmits one frame on the bus.
+	SendFrame(ctx context.Context, in *SendFrameRequest, opts ...grpc.CallOption) (*SendFrameResponse, error)
+}
+
+type canWebClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCanWebClient(cc grpc.ClientConnInterface) CanWebClient {
+	return &canWebClient{cc}
+}
+
+func (c *canWebClient) GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*State, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(State)
+	err := c.cc.Invoke(ctx, CanWeb_GetState_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *canWebClient) StreamSignals(ctx context.Context, in *StreamSignalsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Signal], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CanWeb_ServiceDesc.Streams[0], CanWeb_StreamSignals_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamSignalsRequest, Signal]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CanWeb_StreamSignalsClient = grpc.ServerStreamingClient[Signal]
+
+func (c *canWebClient) StreamRawFrames(ctx context.Context, in *StreamRawFramesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RawFrame], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CanWeb_ServiceDesc.Streams[1], CanWeb_StreamRawFrames_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamRawFramesRequest, RawFrame]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CanWeb_StreamRawFramesClient = grpc.ServerStreamingClient[RawFrame]
+
+func (c *canWebClient) SendFrame(ctx context.Context, in *SendFrameRequest, opts ...grpc.CallOption) (*SendFrameResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SendFrameResponse)
+	err := c.cc.Invoke(ctx, CanWeb_SendFrame_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CanWebServer is the server API for CanWeb service.
+// All implementations must embed UnimplementedCanWebServer
+// for forward compatibility.
+//
+// CanWeb mirrors the HTTP API for services that prefer gRPC. Metadata
+// "authorization: Bearer <token>" (or Basic) authenticates like the HTTP
+// API: GetState and the streams need a viewer, SendFrame an operator.
+type CanWebServer interface {
+	// GetState returns the same snapshot as GET /api/state.
+	GetState(context.Context, *GetStateRequest) (*State, error)
+	// StreamSignals sends every decoded signal update.
+	StreamSignals(*StreamSignalsRequest, grpc.ServerStreamingServer[Signal]) error
+	// StreamRawFrames sends every received (and sent) raw frame.
+	StreamRawFrames(*StreamRawFramesRequest, grpc.ServerStreamingServer[RawFrame]) error
+	// SendFrame transmits one frame on the bus.
+	SendFrame(context.Context, *SendFrameRequest) (*SendFrameResponse, error)
+	mustEmbedUnimplementedCanWebServer()
+}
+
+// UnimplementedCanWebServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCanWebServer struct{}
+
+func (UnimplementedCanWebServer) GetState(context.Context, *GetStateRequest) (*State, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetState not implemented")
+}
+func (UnimplementedCanWebServer) StreamSignals(*StreamSignalsRequest, grpc.ServerStreamingServer[Signal]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamSignals not implemented")
+}
+func (UnimplementedCanWebServer) StreamRawFrames(*StreamRawFramesRequest, grpc.ServerStreamingServer[RawFrame]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamRawFrames not implemented")
+}
+func (UnimplementedCanWebServer) SendFrame(context.Context, *SendFrameRequest) (*SendFrameResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendFrame not implemented")
+}
+func (UnimplementedCanWebServer) mustEmbedUnimplementedCanWebServer() {}
+func (UnimplementedCanWebServer) testEmbeddedByValue()                {}
+
+// UnsafeCanWebServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CanWebServer will
+// result in compilation errors.
+type UnsafeCanWebServer interface {
+	mustEmbedUnimplementedCanWebServer()
+}
+
+func RegisterCanWebServer(s grpc.ServiceRegistrar, srv CanWebServer) {
+	// If the following call pancis, it indicates UnimplementedCanWebServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CanWeb_ServiceDesc, srv)
+}
+
+func _CanWeb_GetState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CanWebServer).GetState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CanWeb_GetState_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CanWebServer).GetState(ctx, req.(*GetStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CanWeb_StreamSignals_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamSignalsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CanWebServer).StreamSignals(m, &grpc.GenericServerStream[StreamSignalsRequest, Signal]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CanWeb_StreamSignalsServer = grpc.ServerStreamingServer[Signal]
+
+func _CanWeb_StreamRawFrames_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRawFramesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CanWebServer).StreamRawFrames(m, &grpc.GenericServerStream[StreamRawFramesRequest, RawFrame]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CanWeb_StreamRawFramesServer = grpc.ServerStreamingServer[RawFrame]
+
+func _CanWeb_SendFrame_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendFrameRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CanWebServer).SendFrame(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CanWeb_SendFrame_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CanWebServer).SendFrame(ctx, req.(*SendFrameRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CanWeb_ServiceDesc is the grpc.ServiceDesc for CanWeb service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CanWeb_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "canweb.v1.CanWeb",
+	HandlerType: (*CanWebServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetState",
+			Handler:    _CanWeb_GetState_Handler,
+		},
+		{
+			MethodName: "SendFrame",
+			Handler:    _CanWeb_SendFrame_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamSignals",
+			Handler:       _CanWeb_StreamSignals_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamRawFrames",
+			Handler:       _CanWeb_StreamRawFrames_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "canweb/v1/canweb.proto",
+}
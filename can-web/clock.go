@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Clock relates frame times to a monotonic clock started with the server, so
+// captures can be correlated with other instruments even when NTP steps the
+// wall clock mid-capture.
+type Clock struct {
+	start time.Time // carries Go's monotonic reading
+
+	mu   sync.Mutex
+	sync *ClockSync
+}
+
+// ClockSync is a time synchronisation status reported from outside, e.g. by
+// a ptp4l or chrony hook calling the clock.sync action.
+type ClockSync struct {
+	Source     string    `json:"source"` // ptp, ntp, gps, ...
+	Synced     bool      `json:"synced"`
+	OffsetNs   int64     `json:"offset_ns,omitempty"` // from the reference, as the daemon reports it
+	Detail     string    `json:"detail,omitempty"`    // e.g. grandmaster ID or NTP server
+	ReportedAt time.Time `json:"reported_at"`
+}
+
+// KernelClock is the kernel's NTP discipline state from adjtimex.
+type KernelClock struct {
+	Synced     bool  `json:"synced"`
+	OffsetNs   int64 `json:"offset_ns"`
+	MaxErrorUs int64 `json:"max_error_us"`
+	EstErrorUs int64 `json:"est_error_us"`
+}
+
+type ClockStatus struct {
+	Now     time.Time `json:"now"`
+	Started time.Time `json:"started"`
+	MonoNs  int64     `json:"mono_ns"` // monotonic time since start, the clock of mono_ns in raw frames
+	// WallStepNs is how far the wall clock has moved against the monotonic
+	// clock since start: NTP steps plus slewing. Wall time of a frame minus
+	// this is on the monotonic timeline.
+	WallStepNs  int64        `json:"wall_step_ns"`
+	ClockSource string       `json:"clock_source,omitempty"` // kernel clocksource, e.g. tsc
+	Kernel      *KernelClock `json:"kernel,omitempty"`
+	Sync        *ClockSync   `json:"sync,omitempty"` // last report via clock.sync
+}
+
+func NewClock() *Clock {
+	return &Clock{start: time.Now()}
+}
+
+// Mono returns t on the monotonic clock, as time since the server started.
+// t must come from time.Now to carry a monotonic reading.
+func (c *Clock) Mono(t time.Time) int64 {
+	return int64(t.Sub(c.start))
+}
+
+func (c *Clock) Status() ClockStatus {
+	now := time.Now()
+	st := ClockStatus{
+		Now:         now,
+		Started:     c.start,
+		MonoNs:      c.Mono(now),
+		WallStepNs:  int64(now.Round(0).Sub(c.start.Round(0)) - now.Sub(c.start)),
+		ClockSource: clockSource(),
+		Kernel:      kernelClock(),
+	}
+	c.mu.Lock()
+	if c.sync != nil {
+		s := *c.sync
+		st.Sync = &s
+	}
+	c.mu.Unlock()
+	return st
+}
+
+// Report records an external synchronisation status.
+func (c *Clock) Report(s ClockSync) (ClockSync, error) {
+	if s.Source == "" {
+		return s, errors.New("source is required")
+	}
+	s.ReportedAt = time.Now()
+	c.mu.Lock()
+	c.sync = &s
+	c.mu.Unlock()
+	return s, nil
+}
+
+func registerClockActions(app *App) {
+	app.Control.Register("clock.sync", func(params json.RawMessage) (any, error) {
+		var s ClockSync
+		if err := decodeParams(params, &s); err != nil {
+			return nil, err
+		}
+		return app.Clock.Report(s)
+	})
+}
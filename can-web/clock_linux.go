@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+func clockSource() string {
+	b, err := os.ReadFile("/sys/devices/system/clocksource/clocksource0/current_clocksource")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// kernelClock reads the NTP state without changing it; nil if adjtimex is
+// not allowed.
+func kernelClock() *KernelClock {
+	var tx unix.Timex
+	state, err := unix.Adjtimex(&tx)
+	if err != nil {
+		return nil
+	}
+	k := &KernelClock{
+		Synced:     state != unix.TIME_ERROR && tx.Status&unix.STA_UNSYNC == 0,
+		OffsetNs:   int64(tx.Offset),
+		MaxErrorUs: int64(tx.Maxerror),
+		EstErrorUs: int64(tx.Esterror),
+	}
+	if tx.Status&unix.STA_NANO == 0 {
+		k.OffsetNs *= 1000 // microseconds
+	}
+	return k
+}
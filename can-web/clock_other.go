@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+func clockSource() string { return "" }
+
+func kernelClock() *KernelClock { return nil }
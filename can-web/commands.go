@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+// cmdDump decodes frames from the configured source (or a candump, ASC or
+// TRC log) and prints one line per frame to stdout.
+func cmdDump(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to YAML config file (env vars override it)")
+	raw := fs.Bool("raw", false, "print raw frames only, without decoded signals")
+	channel := fs.String("channel", "", "with a log file, decode only this interface, e.g. can1")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		return errors.New("usage: can-web dump [flags] [logfile]")
+	}
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if fs.NArg() == 1 {
+		cfg.Source = "replay"
+		cfg.Iface = "replay"
+		cfg.Replay.File = fs.Arg(0)
+		cfg.Replay.Speed = 0
+		cfg.Replay.Loop = false
+		cfg.Replay.Channel = *channel
+		cfg.Gateway.Peer = ""
+	}
+
+	// decode inline so lines come out in receive order
+	cfg.Decode.Workers = 0
+	app, err := NewApp(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to start: %w", err)
+	}
+	if app.Replay != nil {
+		app.Replay.ExitAtEnd = true
+	}
+	runSource, err := NewSource(cfg)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	var mu sync.Mutex
+	app.OnFrame = func(f can.Frame, def *FrameDef, ts time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(out, "(%d.%06d) %s %s", ts.Unix(), ts.Nanosecond()/1000, app.Iface, f.String())
+		if def != nil && !*raw {
+			fmt.Fprintf(out, "  %s", def.Name)
+			for _, sig := range def.Present(f.Data) {
+				fmt.Fprintf(out, " %s=%.10g%s", sig.SignalName, clampFinite(decodeSignal(f.Data, sig)), sig.Unit)
+				if text, ok := sig.Values[rawSignal(f.Data, sig)]; ok {
+					fmt.Fprintf(out, "(%s)", text)
+				}
+			}
+		}
+		fmt.Fprintln(out)
+		// live sources should show up promptly; file dumps can batch
+		if cfg.Source != "replay" {
+			out.Flush()
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	return runSource(ctx, app)
+}
+
+// cmdValidateMap loads a CSV, DBC, ARXML or KCD map and prints a per-frame
+// summary and the map's warnings.
+func cmdValidateMap(args []string) error {
+	fs := flag.NewFlagSet("validate-map", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the warnings as a JSON report")
+	strict := fs.Bool("strict", false, "fail when the map has warnings")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: can-web validate-map [-json] [-strict] <csv|dbc|arxml|kcd>")
+	}
+	path := fs.Arg(0)
+
+	frames, err := LoadMap(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	warnings := ValidateMap(frames)
+	failed := func() error {
+		if *strict && len(warnings) > 0 {
+			return fmt.Errorf("%s: %d warnings", path, len(warnings))
+		}
+		return nil
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(newMapReport(frames, warnings)); err != nil {
+			return err
+		}
+		return failed()
+	}
+
+	ids := make([]uint32, 0, len(frames))
+	nsig := 0
+	for id, fd := range frames {
+		ids = append(ids, id)
+		nsig += len(fd.Signals)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		fd := frames[id]
+		names := make([]string, len(fd.Signals))
+		for i, s := range fd.Signals {
+			names[i] = s.SignalName
+		}
+		idText := fmt.Sprintf("0x%03X", id)
+		if fd.Mask != 0 {
+			idText += fmt.Sprintf("/0x%X", fd.Mask)
+		}
+		node := ""
+		if fd.Node != "" {
+			node = " node=" + fd.Node
+		}
+		fmt.Printf("%s %-24s dlc=%d cycle=%dms%s  %s\n", idText, fd.Name, fd.DLC, fd.CycleMs, node, strings.Join(names, ", "))
+	}
+	for _, w := range warnings {
+		name := w.Frame
+		if w.Signal != "" {
+			name += "." + w.Signal
+		}
+		fmt.Printf("warning: %s %s: %s: %s\n", w.FrameID, name, w.Kind, w.Message)
+	}
+	if len(warnings) > 0 {
+		fmt.Printf("%s: %d warnings, %d frames, %d signals\n", path, len(warnings), len(frames), nsig)
+		return failed()
+	}
+	fmt.Printf("%s: OK, %d frames, %d signals\n", path, len(frames), nsig)
+	return nil
+}
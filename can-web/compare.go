@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	compareDefaultRateTolerance = 10 // percent
+	compareMinFrames            = 2  // an ID needs this many frames to have a rate
+	compareStaleIntervals       = 3  // a live ID silent for this many intervals is missing
+	compareMinStale             = 500 * time.Millisecond
+)
+
+// Comparison is the difference between a reference ("golden") session and
+// the current bus: frames that went missing or appeared, frame rates that
+// moved, and signals that left the reference envelope.
+type Comparison struct {
+	Reference   string  `json:"reference"`
+	Current     string  `json:"current"`      // a session ID, or "live" for the bus now
+	CurrentSecs float64 `json:"current_secs"` // how long the current side has been observed
+
+	MissingIDs    []IDComparison     `json:"missing_ids"`     // in the reference, not seen now
+	NewIDs        []IDComparison     `json:"new_ids"`         // seen now, not in the reference
+	RateChanges   []IDComparison     `json:"rate_changes"`    // rate off by more than the tolerance
+	OutOfEnvelope []SignalComparison `json:"out_of_envelope"` // values outside the reference's min and max
+	MissingSigs   []string           `json:"missing_signals"` // signals of the reference never seen now
+	OK            bool               `json:"ok"`              // none of the above
+}
+
+type IDComparison struct {
+	ID           string  `json:"id"`
+	Frame        string  `json:"frame,omitempty"`
+	RefHz        float64 `json:"ref_hz"`
+	CurHz        float64 `json:"cur_hz"`
+	DeviationPct float64 `json:"deviation_pct,omitempty"`
+}
+
+type SignalComparison struct {
+	Signal string  `json:"signal"`
+	Unit   string  `json:"unit,omitempty"`
+	RefMin float64 `json:"ref_min"`
+	RefMax float64 `json:"ref_max"`
+	CurMin float64 `json:"cur_min"`
+	CurMax float64 `json:"cur_max"`
+}
+
+// compareSide is what one side of a comparison observed.
+type compareSide struct {
+	name    string
+	secs    float64
+	counts  map[string]uint64
+	rates   map[string]float64
+	signals map[string]SignalRange
+}
+
+func sessionSide(sess Session) (compareSide, error) {
+	if sess.Stats == nil {
+		return compareSide{}, fmt.Errorf("session %q has no stats (interrupted?)", sess.ID)
+	}
+	end := time.Now()
+	if sess.EndedAt != nil {
+		end = *sess.EndedAt
+	}
+	side := compareSide{name: sess.ID, secs: end.Sub(sess.StartedAt).Seconds(), counts: sess.Stats.IDs, rates: make(map[string]float64), signals: sess.Stats.Signals}
+	for id, n := range sess.Stats.IDs {
+		if n >= compareMinFrames && side.secs > 0 {
+			side.rates[id] = float64(n) / side.secs
+		}
+	}
+	return side, nil
+}
+
+// liveSide is everything since start, or since signal stats were last reset,
+// less the IDs that went silent: those not seen for compareStaleIntervals of
+// their interval in ref, or their own interval for IDs ref does not have.
+func liveSide(app *App, ref compareSide) compareSide {
+	bus := app.Stats.Snapshot()
+	now := time.Now()
+	side := compareSide{name: "live", secs: now.Sub(bus.Since).Seconds(), counts: make(map[string]uint64), rates: make(map[string]float64), signals: make(map[string]SignalRange)}
+	for _, id := range bus.IDs {
+		every := id.AvgIntervalMs / 1000
+		if r := ref.rates[id.ID]; r > 0 {
+			every = 1 / r
+		}
+		if every > 0 && now.Sub(id.LastSeen) > max(time.Duration(compareStaleIntervals*every*float64(time.Second)), compareMinStale) {
+			continue
+		}
+		side.counts[id.ID] = id.Count
+		if id.Count >= compareMinFrames {
+			side.rates[id.ID] = id.FramesPerSec
+		}
+	}
+	for _, s := range app.SignalStats.Snapshot(nil).Signals {
+		side.signals[s.Signal] = SignalRange{Unit: s.Unit, Count: s.Count, Min: s.Min, Max: s.Max, Mean: s.Mean}
+	}
+	return side
+}
+
+// Compare lists how cur differs from ref. Rates may differ by tolerance
+// percent; marginPct widens the reference envelope by that share of its
+// span on each side.
+func Compare(ref, cur compareSide, tolerance, marginPct float64, defs map[uint32]FrameDef) Comparison {
+	c := Comparison{
+		Reference: ref.name, Current: cur.name, CurrentSecs: cur.secs,
+		MissingIDs: []IDComparison{}, NewIDs: []IDComparison{}, RateChanges: []IDComparison{},
+		OutOfEnvelope: []SignalComparison{}, MissingSigs: []string{},
+	}
+	match := newFrameMatcher(defs)
+	idCmp := func(id string) IDComparison {
+		ic := IDComparison{ID: id, RefHz: ref.rates[id], CurHz: cur.rates[id]}
+		if n, err := parseHexID(id); err == nil {
+			if fd, ok := match.Lookup(n); ok {
+				ic.Frame = fd.Name
+			}
+		}
+		return ic
+	}
+
+	for id := range ref.counts {
+		if cur.counts[id] == 0 {
+			c.MissingIDs = append(c.MissingIDs, idCmp(id))
+			continue
+		}
+		rr, cr := ref.rates[id], cur.rates[id]
+		if rr == 0 || cr == 0 {
+			continue
+		}
+		if dev := 100 * (cr - rr) / rr; math.Abs(dev) > tolerance {
+			ic := idCmp(id)
+			ic.DeviationPct = dev
+			c.RateChanges = append(c.RateChanges, ic)
+		}
+	}
+	for id := range cur.counts {
+		if ref.counts[id] == 0 {
+			c.NewIDs = append(c.NewIDs, idCmp(id))
+		}
+	}
+
+	for name, rr := range ref.signals {
+		cr, ok := cur.signals[name]
+		if !ok {
+			c.MissingSigs = append(c.MissingSigs, name)
+			continue
+		}
+		m := (rr.Max - rr.Min) * marginPct / 100
+		if cr.Min < rr.Min-m || cr.Max > rr.Max+m {
+			c.OutOfEnvelope = append(c.OutOfEnvelope, SignalComparison{
+				Signal: name, Unit: rr.Unit,
+				RefMin: rr.Min, RefMax: rr.Max,
+				CurMin: cr.Min, CurMax: cr.Max,
+			})
+		}
+	}
+
+	for _, l := range [][]IDComparison{c.MissingIDs, c.NewIDs, c.RateChanges} {
+		sort.Slice(l, func(i, j int) bool { return l[i].ID < l[j].ID })
+	}
+	sort.Slice(c.OutOfEnvelope, func(i, j int) bool { return c.OutOfEnvelope[i].Signal < c.OutOfEnvelope[j].Signal })
+	sort.Strings(c.MissingSigs)
+	c.OK = len(c.MissingIDs)+len(c.NewIDs)+len(c.RateChanges)+len(c.OutOfEnvelope)+len(c.MissingSigs) == 0
+	return c
+}
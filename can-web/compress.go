@@ -0,0 +1,197 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressMinSize is the smallest response worth compressing; smaller ones
+// only grow.
+const compressMinSize = 1024
+
+var (
+	gzipPool = sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return w
+	}}
+	brotliPool = sync.Pool{New: func() any {
+		return brotli.NewWriterLevel(io.Discard, 4) // fast enough for live JSON
+	}}
+)
+
+// compressHandler compresses text and JSON responses with brotli or gzip,
+// whichever the client prefers in Accept-Encoding. Event streams and range
+// requests are passed through unchanged.
+func compressHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		enc := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if enc == "" || r.Header.Get("Range") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, enc: enc}
+		defer cw.Close()
+		h.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks "br" or "gzip" from an Accept-Encoding header, or
+// "" for none. Ties go to brotli.
+func negotiateEncoding(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if (name != "br" && name != "gzip") || q <= 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+func compressible(contentType string) bool {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mt == "text/event-stream":
+		return false
+	case strings.HasPrefix(mt, "text/"),
+		mt == "application/json", mt == "application/javascript", mt == "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// compressWriter decides whether to compress: only for a compressible
+// content type, a body that is not already encoded, and a length of at
+// least compressMinSize. Without a Content-Length the body is held back
+// until it reaches compressMinSize or the handler finishes.
+type compressWriter struct {
+	http.ResponseWriter
+	enc     string
+	decided bool
+	status  int
+	buf     []byte         // body held back while the length is unknown
+	w       io.WriteCloser // nil when passing through
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.decided || c.status != 0 {
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	c.status = status
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+		c.decide(false)
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.decided {
+		h := c.Header()
+		ok := h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type"))
+		n, err := strconv.Atoi(h.Get("Content-Length"))
+		switch {
+		case !ok:
+			c.decide(false)
+		case err == nil:
+			c.decide(n >= compressMinSize)
+		default:
+			c.buf = append(c.buf, p...)
+			if len(c.buf) < compressMinSize {
+				return len(p), nil
+			}
+			c.decide(true)
+			if err := c.flushBuf(); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		}
+	}
+	return c.write(p)
+}
+
+func (c *compressWriter) write(p []byte) (int, error) {
+	if c.w != nil {
+		return c.w.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// flushBuf writes out the held-back body, uncompressed when it never
+// reached compressMinSize.
+func (c *compressWriter) flushBuf() error {
+	if !c.decided {
+		c.decide(false)
+	}
+	if len(c.buf) == 0 {
+		return nil
+	}
+	_, err := c.write(c.buf)
+	c.buf = nil
+	return err
+}
+
+func (c *compressWriter) decide(compress bool) {
+	c.decided = true
+	if compress {
+		h := c.Header()
+		h.Set("Content-Encoding", c.enc)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		switch c.enc {
+		case "br":
+			bw := brotliPool.Get().(*brotli.Writer)
+			bw.Reset(c.ResponseWriter)
+			c.w = bw
+		default:
+			gw := gzipPool.Get().(*gzip.Writer)
+			gw.Reset(c.ResponseWriter)
+			c.w = gw
+		}
+	}
+	if c.status != 0 {
+		c.ResponseWriter.WriteHeader(c.status)
+	}
+}
+
+func (c *compressWriter) Flush() {
+	_ = c.flushBuf()
+	if f, ok := c.w.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *compressWriter) Unwrap() http.ResponseWriter { return c.ResponseWriter }
+
+func (c *compressWriter) Close() {
+	if c.w == nil {
+		_ = c.flushBuf()
+		return
+	}
+	_ = c.w.Close()
+	switch w := c.w.(type) {
+	case *gzip.Writer:
+		gzipPool.Put(w)
+	case *brotli.Writer:
+		brotliPool.Put(w)
+	}
+	c.w = nil
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the server configuration. It is read from an optional YAML
+// file; environment variables override individual fields.
+type Config struct {
+	Source      string            `yaml:"source"`
+	Iface       string            `yaml:"iface"`
+	Buses       []string          `yaml:"buses"` // more interfaces read by this server, each a bus of its own
+	Bitrate     int               `yaml:"bitrate"`
+	Map         string            `yaml:"map"`
+	Maps        map[string]string `yaml:"maps"` // per interface, overriding map
+	Profiles    map[string]string `yaml:"profiles"`
+	RawCapacity int               `yaml:"raw_capacity"`
+	TUI         bool              `yaml:"tui"`
+	Timestamps  string            `yaml:"timestamps"` // kernel or user, socketcan only
+
+	Remote  RemoteConfig  `yaml:"remote"`
+	SLCAN   SLCANConfig   `yaml:"slcan"`
+	PCAN    PCANConfig    `yaml:"pcan"`
+	Gateway GatewayConfig `yaml:"gateway"`
+
+	Interfaces struct {
+		Manage bool `yaml:"manage"` // allow the iface.set control action
+	} `yaml:"interfaces"`
+
+	Decode struct {
+		Workers         int  `yaml:"workers"`
+		Queue           int  `yaml:"queue"`
+		SkipDLCMismatch bool `yaml:"skip_dlc_mismatch"` // leave frames whose DLC differs from the map undecoded
+	} `yaml:"decode"`
+
+	RawBuffer struct {
+		PerID int                    `yaml:"per_id"`
+		IDs   map[string]RawIDConfig `yaml:"ids"`
+	} `yaml:"raw_buffer"`
+
+	Triggers []TriggerConfig `yaml:"triggers"`
+	Alerts   AlertsConfig    `yaml:"alerts"`
+	Deadband []DeadbandRule  `yaml:"deadband"`
+	History  HistoryConfig   `yaml:"history"`
+	Sinks    []SinkConfig    `yaml:"sinks"`
+
+	HTTP HTTPConfig `yaml:"http"`
+	Log  LogConfig  `yaml:"log"`
+
+	GRPC struct {
+		Addr string `yaml:"addr"`
+	} `yaml:"grpc"`
+
+	Record struct {
+		Dir string `yaml:"dir"`
+	} `yaml:"record"`
+
+	Control struct {
+		Token string `yaml:"token"`
+	} `yaml:"control"`
+
+	Auth struct {
+		Users []AuthUserConfig `yaml:"users"`
+	} `yaml:"auth"`
+
+	Replay struct {
+		File    string  `yaml:"file"`
+		Speed   float64 `yaml:"speed"`
+		Loop    bool    `yaml:"loop"`
+		Channel string  `yaml:"channel"` // only this interface of a multi-channel log
+	} `yaml:"replay"`
+
+	UDS        UDSConfig        `yaml:"uds"`
+	Tx         TxConfig         `yaml:"tx"`
+	Generator  GeneratorConfig  `yaml:"generator"`
+	Audit      AuditConfig      `yaml:"audit"`
+	Dashboards DashboardsConfig `yaml:"dashboards"`
+	Sessions   SessionsConfig   `yaml:"sessions"`
+	Sequences  SequencesConfig  `yaml:"sequences"`
+	Store      StoreConfig      `yaml:"store"`
+	Telemetry  TelemetryConfig  `yaml:"telemetry"`
+
+	Sim struct {
+		Mode   string `yaml:"mode"`
+		Script string `yaml:"script"`
+	} `yaml:"sim"`
+}
+
+type HTTPConfig struct {
+	Addr            string   `yaml:"addr"`
+	TLSCert         string   `yaml:"tls_cert"`
+	TLSKey          string   `yaml:"tls_key"`
+	SelfSigned      bool     `yaml:"tls_self_signed"`
+	SelfSignedDir   string   `yaml:"tls_self_signed_dir"`
+	SelfSignedHosts []string `yaml:"tls_self_signed_hosts"`
+}
+
+func defaultConfig() Config {
+	var c Config
+	c.Source = "socketcan"
+	c.Iface = "vcan0"
+	c.Bitrate = 500000
+	c.Map = "can_map.csv"
+	c.RawCapacity = 200
+	c.Timestamps = "kernel"
+	c.PCAN.Channel = "usb1"
+	c.RawBuffer.PerID = 50
+	c.Decode.Workers = 4
+	c.Decode.Queue = 1024
+	c.HTTP.Addr = "127.0.0.1:8080"
+	c.HTTP.SelfSignedDir = "tls"
+	c.Record.Dir = "recordings"
+	c.Replay.Speed = 1
+	c.Sim.Mode = SimSweep
+	c.History.MaxAge = "168h"
+	c.History.MinIntervalMs = 100
+	c.Log.Level = "info"
+	c.Log.Format = "text"
+	return c
+}
+
+// LoadConfig builds the configuration from defaults, the YAML file at path
+// (if non-empty) and the environment, in that order of precedence.
+func LoadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		dec := yaml.NewDecoder(strings.NewReader(string(b)))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil {
+			return cfg, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+	if cfg.Source == "sim" && os.Getenv("CAN_IFACE") == "" {
+		cfg.Iface = "sim"
+	}
+	if cfg.Source == "slcan" && cfg.SLCAN.Device != "" && os.Getenv("CAN_IFACE") == "" {
+		cfg.Iface = filepath.Base(cfg.SLCAN.Device)
+	}
+	if cfg.Source == "pcan" && os.Getenv("CAN_IFACE") == "" {
+		cfg.Iface = cfg.PCAN.Channel
+	}
+	// One config file can serve a server per bus, each with its own map.
+	if m, ok := cfg.Maps[cfg.Iface]; ok && os.Getenv("CAN_MAP") == "" {
+		cfg.Map = m
+	}
+	return cfg, nil
+}
+
+// SourceFunc runs a frame source until ctx is cancelled or the source ends.
+type SourceFunc func(context.Context, *App) error
+
+// NewSource returns the frame source selected by the configuration.
+func NewSource(cfg Config) (SourceFunc, error) {
+	switch cfg.Source {
+	case "socketcan":
+		if runtime.GOOS != "linux" {
+			return nil, fmt.Errorf("socketcan needs Linux; on %s use slcan or pcan (this build has %s)", runtime.GOOS, sourceNames())
+		}
+		var kernelTS bool
+		switch cfg.Timestamps {
+		case "kernel":
+			kernelTS = true
+		case "user":
+		default:
+			return nil, fmt.Errorf("timestamps %q: want kernel or user", cfg.Timestamps)
+		}
+		return func(ctx context.Context, app *App) error {
+			return RunCANReader(ctx, app, kernelTS)
+		}, nil
+	case "sim":
+		var script SimScriptFile
+		if cfg.Sim.Script != "" {
+			var err error
+			if script, err = LoadSimScript(cfg.Sim.Script); err != nil {
+				return nil, err
+			}
+		}
+		return func(ctx context.Context, app *App) error {
+			return RunSimulator(ctx, app, cfg.Sim.Mode, script)
+		}, nil
+	case "replay":
+		if cfg.Replay.File == "" {
+			return nil, fmt.Errorf("replay source needs a log file")
+		}
+		return func(ctx context.Context, app *App) error {
+			return RunReplay(ctx, app, cfg.Replay.File, cfg.Replay.Channel)
+		}, nil
+	}
+	if _, ok := backends[cfg.Source]; ok {
+		return func(ctx context.Context, app *App) error {
+			bus, ok := app.Tx.(busBackend)
+			if !ok {
+				return fmt.Errorf("%s transmitter not configured", cfg.Source)
+			}
+			return runWithReconnect(ctx, app, bus.session)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown source %q (this build has %s)", cfg.Source, sourceNames())
+}
+
+func (c *Config) applyEnv() error {
+	envString(&c.Source, "CAN_SOURCE")
+	envString(&c.Iface, "CAN_IFACE")
+	envString(&c.Timestamps, "CAN_TIMESTAMPS")
+	envString(&c.HTTP.Addr, "HTTP_ADDR")
+	envString(&c.HTTP.TLSCert, "HTTP_TLS_CERT")
+	envString(&c.HTTP.TLSKey, "HTTP_TLS_KEY")
+	envString(&c.GRPC.Addr, "GRPC_ADDR")
+	envString(&c.Remote.Addr, "CAN_REMOTE_ADDR")
+	envString(&c.Remote.Listen, "CAN_REMOTE_LISTEN")
+	envString(&c.SLCAN.Device, "CAN_SLCAN_DEVICE")
+	envString(&c.PCAN.Channel, "CAN_PCAN_CHANNEL")
+	envString(&c.Gateway.Peer, "CAN_GATEWAY_PEER")
+	envString(&c.Map, "CAN_MAP")
+	envString(&c.Record.Dir, "RECORD_DIR")
+	envString(&c.Control.Token, "CONTROL_TOKEN")
+	envString(&c.Sim.Mode, "CAN_SIM_MODE")
+	envString(&c.Sim.Script, "CAN_SIM_SCRIPT")
+	envString(&c.History.Path, "HISTORY_DB")
+	envString(&c.Log.Level, "LOG_LEVEL")
+	envString(&c.Log.Format, "LOG_FORMAT")
+	if err := envBool(&c.Interfaces.Manage, "CAN_IFACE_MANAGE"); err != nil {
+		return err
+	}
+	if v := os.Getenv("CAN_BUSES"); v != "" {
+		c.Buses = nil
+		for _, b := range strings.Split(v, ",") {
+			if b = strings.TrimSpace(b); b != "" {
+				c.Buses = append(c.Buses, b)
+			}
+		}
+	}
+	if err := envBool(&c.TUI, "CAN_TUI"); err != nil {
+		return err
+	}
+	if err := envBool(&c.HTTP.SelfSigned, "HTTP_TLS_SELF_SIGNED"); err != nil {
+		return err
+	}
+	if err := envInt(&c.Bitrate, "CAN_BITRATE"); err != nil {
+		return err
+	}
+	if err := envInt(&c.RawBuffer.PerID, "CAN_RAW_PER_ID"); err != nil {
+		return err
+	}
+	if err := envInt(&c.Decode.Workers, "CAN_DECODE_WORKERS"); err != nil {
+		return err
+	}
+	if v := os.Getenv("CAN_PROFILES"); v != "" {
+		extra, err := parseProfiles(v)
+		if err != nil {
+			return fmt.Errorf("bad CAN_PROFILES: %w", err)
+		}
+		if c.Profiles == nil {
+			c.Profiles = make(map[string]string)
+		}
+		for k, p := range extra {
+			c.Profiles[k] = p
+		}
+	}
+	return nil
+}
+
+// busMap is the map file of bus: its entry in maps, else map.
+func (c *Config) busMap(bus string) string {
+	if bus != c.Iface {
+		if m, ok := c.Maps[bus]; ok {
+			return m
+		}
+	}
+	return c.Map
+}
+
+// rawPolicy normalises the raw_buffer.ids keys to the RawFrame.ID form
+// ("0x123", "0x18FEF100", "ERR").
+func (c *Config) rawPolicy() (map[string]RawIDConfig, error) {
+	out := make(map[string]RawIDConfig, len(c.RawBuffer.IDs))
+	for k, v := range c.RawBuffer.IDs {
+		if strings.EqualFold(k, "ERR") {
+			out["ERR"] = v
+			continue
+		}
+		id, extended, err := parseCANID(k)
+		if err != nil {
+			return nil, fmt.Errorf("raw_buffer.ids: bad ID %q: %w", k, err)
+		}
+		if v.Capacity < 0 || v.Every < 0 {
+			return nil, fmt.Errorf("raw_buffer.ids.%s: capacity and every must not be negative", k)
+		}
+		out[canIDString(id, extended)] = v
+	}
+	return out, nil
+}
+
+func envString(dst *string, k string) {
+	if v := os.Getenv(k); v != "" {
+		*dst = v
+	}
+}
+
+func envBool(dst *bool, k string) error {
+	v := os.Getenv(k)
+	if v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("bad %s: %w", k, err)
+	}
+	*dst = b
+	return nil
+}
+
+func envInt(dst *int, k string) error {
+	v := os.Getenv(k)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("bad %s: %w", k, err)
+	}
+	*dst = n
+	return nil
+}
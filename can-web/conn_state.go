@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Connection states of the CAN source.
+const (
+	ConnConnecting   = "connecting"
+	ConnConnected    = "connected"
+	ConnReconnecting = "reconnecting"
+	ConnDown         = "down"
+)
+
+type ConnStatus struct {
+	State     string     `json:"state"`
+	Since     time.Time  `json:"since"`
+	DownSince *time.Time `json:"down_since,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	Attempts  int        `json:"attempts"`
+	Connects  int        `json:"connects"`
+}
+
+// ConnState tracks the connection lifecycle of the CAN reader.
+type ConnState struct {
+	mu      sync.Mutex
+	st      ConnStatus
+	changed func()
+}
+
+// NewConnState calls changed, if non-nil, after every update.
+func NewConnState(changed func()) *ConnState {
+	if changed == nil {
+		changed = func() {}
+	}
+	return &ConnState{st: ConnStatus{State: ConnConnecting, Since: time.Now()}, changed: changed}
+}
+
+func (c *ConnState) set(state string) {
+	if c.st.State != state {
+		c.st.State = state
+		c.st.Since = time.Now()
+	}
+}
+
+func (c *ConnState) Connected() {
+	defer c.changed()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(ConnConnected)
+	c.st.DownSince = nil
+	c.st.Attempts = 0
+	c.st.Connects++
+}
+
+// Failed records a dial or receive error; the reader is down until the
+// next attempt.
+func (c *ConnState) Failed(err error) {
+	defer c.changed()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.st.DownSince == nil {
+		c.st.DownSince = &now
+	}
+	c.st.LastError = err.Error()
+	c.set(ConnDown)
+}
+
+func (c *ConnState) Retrying() {
+	defer c.changed()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.st.Attempts++
+	c.set(ConnReconnecting)
+}
+
+func (c *ConnState) Status() ConnStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.st
+	if st.DownSince != nil {
+		t := *st.DownSince
+		st.DownSince = &t
+	}
+	return st
+}
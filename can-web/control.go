@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ControlHandler executes one control action. params is the raw "params"
+// object of the request and may be empty.
+type ControlHandler func(params json.RawMessage) (any, error)
+
+type controlRequest struct {
+	Action string          `json:"action"`
+	Params json.RawMessage `json:"params"`
+}
+
+type controlResponse struct {
+	OK     bool   `json:"ok"`
+	Action string `json:"action,omitempty"`
+	Result any    `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ControlAPI is a single webhook-style endpoint for external test
+// orchestrators: POST {"action": "...", "params": {...}}. It is mounted
+// behind the operator role.
+type ControlAPI struct {
+	Audit *AuditLog // nil: actions are not audited
+
+	mu      sync.RWMutex
+	actions map[string]ControlHandler
+}
+
+func NewControlAPI() *ControlAPI {
+	return &ControlAPI{actions: make(map[string]ControlHandler)}
+}
+
+func (c *ControlAPI) Register(action string, h ControlHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.actions[action] = h
+}
+
+func (c *ControlAPI) Actions() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]string, 0, len(c.actions))
+	for a := range c.actions {
+		out = append(out, a)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (c *ControlAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeControl(w, http.StatusOK, controlResponse{OK: true, Result: c.Actions()})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeControl(w, http.StatusMethodNotAllowed, controlResponse{Error: "method not allowed"})
+		return
+	}
+
+	var req controlRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeControl(w, http.StatusBadRequest, controlResponse{Error: fmt.Sprintf("bad request: %v", err)})
+		return
+	}
+
+	c.mu.RLock()
+	h, ok := c.actions[req.Action]
+	c.mu.RUnlock()
+	if !ok {
+		c.audit(r, req, errors.New("unknown action"))
+		writeControl(w, http.StatusNotFound, controlResponse{Action: req.Action, Error: "unknown action"})
+		return
+	}
+
+	res, err := h(req.Params)
+	c.audit(r, req, err)
+	if err != nil {
+		writeControl(w, http.StatusBadRequest, controlResponse{Action: req.Action, Error: err.Error()})
+		return
+	}
+	writeControl(w, http.StatusOK, controlResponse{OK: true, Action: req.Action, Result: res})
+}
+
+func (c *ControlAPI) audit(r *http.Request, req controlRequest, err error) {
+	if c.Audit != nil {
+		c.Audit.Record(r.Context(), "http", req.Action, req.Params, err)
+	}
+}
+
+func writeControl(w http.ResponseWriter, status int, resp controlResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// decodeParams unmarshals optional action params into v.
+func decodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return fmt.Errorf("bad params: %w", err)
+	}
+	return nil
+}
+
+// registerControlActions wires the built-in actions to the app subsystems.
+func registerControlActions(app *App) {
+	app.Control.Register("marker", func(params json.RawMessage) (any, error) {
+		var p struct {
+			Label string `json:"label"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if p.Label == "" {
+			return nil, errors.New("label is required")
+		}
+		now := time.Now()
+		app.Recorder.WriteMarker(p.Label, now)
+		return app.Markers.Add(p.Label, now), nil
+	})
+
+	app.Control.Register("record.start", func(params json.RawMessage) (any, error) {
+		var p struct {
+			Name string `json:"name"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return app.Recorder.Start(p.Name)
+	})
+
+	app.Control.Register("record.stop", func(params json.RawMessage) (any, error) {
+		return app.Recorder.Stop()
+	})
+
+	app.Control.Register("profile.switch", func(params json.RawMessage) (any, error) {
+		var p struct {
+			Name string `json:"name"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if err := app.Profiles.Switch(p.Name); err != nil {
+			return nil, err
+		}
+		app.Store.ResetSignals()
+		app.Deadband.Reset()
+		return map[string]string{"active": app.Profiles.Active()}, nil
+	})
+
+	app.Control.Register("heatmap.reset", func(params json.RawMessage) (any, error) {
+		var p struct {
+			ID string `json:"id"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if p.ID == "" {
+			app.Heat.Reset(frameKey{}, true)
+			return map[string]string{"reset": "all"}, nil
+		}
+		id, extended, err := parseCANID(p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("bad id %q: %w", p.ID, err)
+		}
+		k := frameKey{id, extended}
+		app.Heat.Reset(k, false)
+		return map[string]string{"reset": k.String()}, nil
+	})
+
+	app.Control.Register("trigger.arm", func(params json.RawMessage) (any, error) {
+		var p TriggerConfig
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if err := app.Triggers.Arm(p); err != nil {
+			return nil, err
+		}
+		return app.Triggers.Status(), nil
+	})
+
+	app.Control.Register("trigger.disarm", func(params json.RawMessage) (any, error) {
+		var p struct {
+			Name string `json:"name"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if err := app.Triggers.Disarm(p.Name); err != nil {
+			return nil, err
+		}
+		return app.Triggers.Status(), nil
+	})
+
+	app.Control.Register("signal-stats.reset", func(params json.RawMessage) (any, error) {
+		var p struct {
+			Signals []string `json:"signals"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return map[string]int{"reset": app.SignalStats.Reset(p.Signals)}, nil
+	})
+
+	app.Control.Register("unknown.reset", func(params json.RawMessage) (any, error) {
+		app.Unknown.Reset()
+		return map[string]bool{"reset": true}, nil
+	})
+
+	app.Control.Register("decode-errors.reset", func(params json.RawMessage) (any, error) {
+		app.DecodeErrors.Reset()
+		return map[string]bool{"reset": true}, nil
+	})
+
+	app.Control.Register("dlc-mismatches.reset", func(params json.RawMessage) (any, error) {
+		app.DLC.Reset()
+		return map[string]bool{"reset": true}, nil
+	})
+}
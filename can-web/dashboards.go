@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type DashboardsConfig struct {
+	File string `yaml:"file"` // JSON, rewritten on every change; empty keeps dashboards in memory only
+}
+
+// Dashboard is a named group of signals, e.g. "Battery", shared by every
+// client of the server.
+type Dashboard struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Signals     []string  `json:"signals"`    // FRAME.signal; * and ? match, e.g. "BMS_*.cell_*"
+	UpdatedAt   time.Time `json:"updated_at"` // who changed it is in the audit log
+}
+
+// Match reports whether v belongs to the dashboard.
+func (d Dashboard) Match(v SignalValue) bool {
+	key := v.FrameName + "." + v.Name
+	for _, p := range d.Signals {
+		if m, _ := path.Match(p, key); m {
+			return true
+		}
+	}
+	return false
+}
+
+var errNoDashboard = errors.New("no such dashboard")
+
+// Dashboards holds the saved dashboards and writes them back to their file
+// after every change.
+type Dashboards struct {
+	path string
+
+	mu    sync.Mutex
+	items map[string]Dashboard
+}
+
+func NewDashboards(cfg DashboardsConfig) (*Dashboards, error) {
+	d := &Dashboards{path: cfg.File, items: make(map[string]Dashboard)}
+	if d.path == "" {
+		return d, nil
+	}
+	b, err := os.ReadFile(d.path)
+	if os.IsNotExist(err) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dashboards: %w", err)
+	}
+	var list []Dashboard
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("dashboards %s: %w", d.path, err)
+	}
+	for _, db := range list {
+		d.items[db.Name] = db
+	}
+	return d, nil
+}
+
+func (d *Dashboards) List() []Dashboard {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.listLocked()
+}
+
+func (d *Dashboards) listLocked() []Dashboard {
+	out := make([]Dashboard, 0, len(d.items))
+	for _, db := range d.items {
+		out = append(out, db)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (d *Dashboards) Get(name string) (Dashboard, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db, ok := d.items[name]
+	if !ok {
+		return db, fmt.Errorf("%w %q", errNoDashboard, name)
+	}
+	return db, nil
+}
+
+// Save creates or replaces the dashboard named db.Name.
+func (d *Dashboards) Save(db Dashboard) (Dashboard, error) {
+	db.Name = strings.TrimSpace(db.Name)
+	if db.Name == "" {
+		return db, errors.New("name is required")
+	}
+	if len(db.Signals) == 0 {
+		return db, errors.New("signals is required")
+	}
+	for _, p := range db.Signals {
+		if _, err := path.Match(p, ""); err != nil {
+			return db, fmt.Errorf("signal pattern %q: %w", p, err)
+		}
+	}
+	db.UpdatedAt = time.Now().UTC()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	prev, existed := d.items[db.Name]
+	d.items[db.Name] = db
+	if err := d.writeLocked(); err != nil {
+		if existed {
+			d.items[db.Name] = prev
+		} else {
+			delete(d.items, db.Name)
+		}
+		return db, err
+	}
+	return db, nil
+}
+
+func (d *Dashboards) Delete(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	prev, ok := d.items[name]
+	if !ok {
+		return fmt.Errorf("%w %q", errNoDashboard, name)
+	}
+	delete(d.items, name)
+	if err := d.writeLocked(); err != nil {
+		d.items[name] = prev
+		return err
+	}
+	return nil
+}
+
+// writeLocked replaces the file through a rename, so a crash leaves either
+// the old or the new dashboards.
+func (d *Dashboards) writeLocked() error {
+	if d.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(d.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), ".dashboards-*.json")
+	if err != nil {
+		return fmt.Errorf("dashboards: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("dashboards: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("dashboards: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), d.path); err != nil {
+		return fmt.Errorf("dashboards: %w", err)
+	}
+	return nil
+}
+
+func registerDashboardActions(app *App) {
+	app.Control.Register("dashboard.save", func(params json.RawMessage) (any, error) {
+		var db Dashboard
+		if err := decodeParams(params, &db); err != nil {
+			return nil, err
+		}
+		return app.Dashboards.Save(db)
+	})
+	app.Control.Register("dashboard.delete", func(params json.RawMessage) (any, error) {
+		var p struct {
+			Name string `json:"name"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if err := app.Dashboards.Delete(p.Name); err != nil {
+			return nil, err
+		}
+		return map[string]string{"deleted": p.Name}, nil
+	})
+}
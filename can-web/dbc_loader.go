@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.einride.tech/can/pkg/dbc"
+)
+
+// LoadMap loads a CAN map, picking the parser from the file extension
+// (.dbc, .arxml, .kcd, otherwise CSV).
+func LoadMap(path string) (map[uint32]FrameDef, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".dbc":
+		return LoadDBC(path)
+	case ".arxml":
+		return LoadARXML(path)
+	case ".kcd":
+		return LoadKCD(path)
+	default:
+		return LoadCANMap(path)
+	}
+}
+
+// LoadDBC converts the messages of a DBC file into frame definitions, with
+// the value descriptions (VAL_) as value tables. Simple multiplexing is
+// supported; signals of extended multiplexing (both switch and multiplexed)
+// are skipped.
+func LoadDBC(path string) (map[uint32]FrameDef, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := dbc.NewParser(path, b)
+	if err := p.Parse(); err != nil {
+		return nil, err
+	}
+
+	type sigKey struct {
+		id   dbc.MessageID
+		name dbc.Identifier
+	}
+	comments := make(map[sigKey]string)
+	values := make(map[sigKey]map[int64]string)
+	cycles := make(map[dbc.MessageID]int)
+	for _, d := range p.Defs() {
+		switch d := d.(type) {
+		case *dbc.ValueDescriptionsDef:
+			if d.ObjectType == dbc.ObjectTypeSignal {
+				vt := make(map[int64]string, len(d.ValueDescriptions))
+				for _, v := range d.ValueDescriptions {
+					vt[int64(v.Value)] = v.Description
+				}
+				values[sigKey{d.MessageID, d.SignalName}] = vt
+			}
+		case *dbc.CommentDef:
+			if d.ObjectType == dbc.ObjectTypeSignal {
+				comments[sigKey{d.MessageID, d.SignalName}] = d.Comment
+			}
+		case *dbc.AttributeValueForObjectDef:
+			if d.ObjectType == dbc.ObjectTypeMessage && d.AttributeName == "GenMsgCycleTime" {
+				cycles[d.MessageID] = int(d.IntValue)
+			}
+		}
+	}
+
+	frames := make(map[uint32]FrameDef)
+	for _, d := range p.Defs() {
+		msg, ok := d.(*dbc.MessageDef)
+		if !ok || msg.MessageID == dbc.IndependentSignalsMessageID {
+			continue
+		}
+		id := msg.MessageID.ToCAN()
+		if _, dup := frames[id]; dup {
+			return nil, fmt.Errorf("%s: duplicate message id 0x%X", path, id)
+		}
+
+		fd := FrameDef{
+			ID:      id,
+			Name:    string(msg.Name),
+			DLC:     uint8(msg.Size),
+			CycleMs: cycles[msg.MessageID],
+		}
+		if msg.Transmitter != "Vector__XXX" { // DBC's placeholder for no sender
+			fd.Node = string(msg.Transmitter)
+		}
+		for _, s := range msg.Signals {
+			if s.IsMultiplexed && s.IsMultiplexerSwitch {
+				continue
+			}
+			endian := EndianLittle
+			if s.IsBigEndian {
+				endian = EndianBig
+			}
+			fd.Signals = append(fd.Signals, SignalDef{
+				FrameID:    id,
+				FrameName:  fd.Name,
+				SignalName: string(s.Name),
+				StartBit:   uint8(s.StartBit),
+				BitLength:  uint8(s.Size),
+				Endianness: endian,
+				Signed:     s.IsSigned,
+				Factor:     s.Factor,
+				Offset:     s.Offset,
+				Min:        s.Minimum,
+				Max:        s.Maximum,
+				HasRange:   s.Minimum != 0 || s.Maximum != 0,
+				Unit:       s.Unit,
+				Comment:    comments[sigKey{msg.MessageID, s.Name}],
+				MuxSwitch:  s.IsMultiplexerSwitch,
+				Muxed:      s.IsMultiplexed,
+				MuxValue:   s.MultiplexerSwitch,
+				Values:     values[sigKey{msg.MessageID, s.Name}],
+			})
+		}
+		sort.Slice(fd.Signals, func(i, j int) bool { return fd.Signals[i].StartBit < fd.Signals[j].StartBit })
+		if err := setMuxSwitch(&fd); err != nil {
+			return nil, fmt.Errorf("message %s: %w", fd.Name, err)
+		}
+		frames[id] = fd
+	}
+	return frames, nil
+}
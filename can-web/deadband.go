@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sync"
+	"time"
+)
+
+// DeadbandRule holds back updates of noisy signals: a new value is only
+// stored, recorded in history and streamed when it differs from the last
+// published one by at least MinChange, or when IntervalMs has passed since.
+type DeadbandRule struct {
+	Signals    string  `yaml:"signals"`     // FRAME.signal; * and ? match, e.g. "IMU_ACC.*"
+	MinChange  float64 `yaml:"min_change"`  // 0: publish any change, drop repeats
+	IntervalMs int     `yaml:"interval_ms"` // publish anyway after this long; 0: never
+}
+
+type deadbandRule struct {
+	DeadbandRule
+	interval   time.Duration
+	published  uint64
+	suppressed uint64
+}
+
+type deadbandState struct {
+	value float64
+	ts    time.Time
+}
+
+// Deadband filters decoded values before they reach the store. The first
+// rule whose pattern matches a signal applies; signals matching no rule
+// pass unchanged. Alerts, signal statistics and triggers still see every
+// value.
+type Deadband struct {
+	rules []*deadbandRule
+
+	mu    sync.Mutex
+	match map[string]*deadbandRule // signal key -> rule, nil for none
+	last  map[string]deadbandState
+}
+
+func NewDeadband(rules []DeadbandRule) (*Deadband, error) {
+	d := &Deadband{match: make(map[string]*deadbandRule), last: make(map[string]deadbandState)}
+	for i, r := range rules {
+		if r.Signals == "" {
+			return nil, fmt.Errorf("deadband rule %d: signals is required", i+1)
+		}
+		if _, err := path.Match(r.Signals, ""); err != nil {
+			return nil, fmt.Errorf("deadband rule %q: %w", r.Signals, err)
+		}
+		if r.MinChange < 0 || r.IntervalMs < 0 {
+			return nil, fmt.Errorf("deadband rule %q: min_change and interval_ms must not be negative", r.Signals)
+		}
+		d.rules = append(d.rules, &deadbandRule{DeadbandRule: r, interval: time.Duration(r.IntervalMs) * time.Millisecond})
+	}
+	return d, nil
+}
+
+// Filter returns the values of vs that are due to be published. It returns
+// vs itself when nothing is held back.
+func (d *Deadband) Filter(vs []SignalValue, now time.Time) []SignalValue {
+	if len(d.rules) == 0 {
+		return vs
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var out []SignalValue
+	held := false
+	for i, v := range vs {
+		if d.pass(v.FrameName+"."+v.Name, v.Value, now) {
+			if held {
+				out = append(out, v)
+			}
+			continue
+		}
+		if !held {
+			held = true
+			out = append(make([]SignalValue, 0, len(vs)), vs[:i]...)
+		}
+	}
+	if !held {
+		return vs
+	}
+	return out
+}
+
+func (d *Deadband) pass(key string, v float64, now time.Time) bool {
+	r, ok := d.match[key]
+	if !ok {
+		for _, rule := range d.rules {
+			if m, _ := path.Match(rule.Signals, key); m {
+				r = rule
+				break
+			}
+		}
+		d.match[key] = r
+	}
+	if r == nil {
+		return true
+	}
+	last, seen := d.last[key]
+	changed := math.Abs(v - last.value)
+	if seen && (changed < r.MinChange || changed == 0) && (r.interval == 0 || now.Sub(last.ts) < r.interval) {
+		r.suppressed++
+		return false
+	}
+	d.last[key] = deadbandState{value: v, ts: now}
+	r.published++
+	return true
+}
+
+// Reset forgets the published values, e.g. after switching maps, so the
+// next value of every signal is published.
+func (d *Deadband) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	clear(d.match)
+	clear(d.last)
+}
+
+type DeadbandStatus struct {
+	Signals    string  `json:"signals"`
+	MinChange  float64 `json:"min_change"`
+	IntervalMs int     `json:"interval_ms"`
+	Matched    int     `json:"matched"` // signals seen that fall under the rule
+	Published  uint64  `json:"published"`
+	Suppressed uint64  `json:"suppressed"`
+}
+
+func (d *Deadband) Status() []DeadbandStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	matched := make(map[*deadbandRule]int)
+	for _, r := range d.match {
+		if r != nil {
+			matched[r]++
+		}
+	}
+	out := make([]DeadbandStatus, 0, len(d.rules))
+	for _, r := range d.rules {
+		out = append(out, DeadbandStatus{
+			Signals:    r.Signals,
+			MinChange:  r.MinChange,
+			IntervalMs: r.IntervalMs,
+			Matched:    matched[r],
+			Published:  r.published,
+			Suppressed: r.suppressed,
+		})
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DecodeError is a mapped signal that could not be decoded from the frames
+// received. The signal is left out of those frames instead of being
+// published as a zero.
+type DecodeError struct {
+	FrameID   string    `json:"frame_id"`
+	Frame     string    `json:"frame"`
+	Signal    string    `json:"signal"`
+	Reason    string    `json:"reason"`
+	Count     uint64    `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	LastData  string    `json:"last_data_hex"`
+}
+
+type decodeErrorKey struct {
+	frameKey
+	signal, reason string
+}
+
+// DecodeErrors counts decode errors by frame, signal and reason.
+type DecodeErrors struct {
+	mu      sync.Mutex
+	entries map[decodeErrorKey]*DecodeError
+}
+
+func NewDecodeErrors() *DecodeErrors {
+	return &DecodeErrors{entries: make(map[decodeErrorKey]*DecodeError)}
+}
+
+// Observe records that signal of frame could not be decoded from data. The
+// first occurrence of each error is logged.
+func (d *DecodeErrors) Observe(id uint32, extended bool, frame, signal, reason string, data []byte, ts time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k := decodeErrorKey{frameKey{id, extended}, signal, reason}
+	e, ok := d.entries[k]
+	if !ok {
+		e = &DecodeError{FrameID: k.String(), Frame: frame, Signal: signal, Reason: reason, FirstSeen: ts}
+		d.entries[k] = e
+		slog.Warn("signal not decoded", "id", e.FrameID, "frame", frame, "signal", signal, "reason", reason)
+	}
+	e.Count++
+	e.LastSeen = ts
+	e.LastData = strings.ToUpper(hex.EncodeToString(data))
+}
+
+// Snapshot lists the errors ordered by frame ID and signal.
+func (d *DecodeErrors) Snapshot() []DecodeError {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	keys := make([]decodeErrorKey, 0, len(d.entries))
+	for k := range d.entries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.frameKey != b.frameKey {
+			return a.frameKey.less(b.frameKey)
+		}
+		if a.signal != b.signal {
+			return a.signal < b.signal
+		}
+		return a.reason < b.reason
+	})
+	out := make([]DecodeError, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, *d.entries[k])
+	}
+	return out
+}
+
+func (d *DecodeErrors) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries = make(map[decodeErrorKey]*DecodeError)
+}
+
+// signalProblem returns why s cannot be decoded from a payload of dlc
+// bytes, or "" when it can.
+func signalProblem(s SignalDef, dlc int) string {
+	if s.Endianness != EndianLittle && s.Endianness != EndianBig {
+		return fmt.Sprintf("invalid endianness %q", s.Endianness)
+	}
+	need, ok := signalBytes(s)
+	if !ok {
+		return fmt.Sprintf("bits do not fit in a frame (start %d, length %d)", s.StartBit, s.BitLength)
+	}
+	if need > dlc {
+		return fmt.Sprintf("needs %d bytes, frame has %d", need, dlc)
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+// DecodeHook decodes a frame that start bit, length and factor cannot
+// describe (bit-stuffed or compressed payloads, vendor encodings). It
+// returns the signals to store; only Name, Value, Unit and Comment need to
+// be set. A hook is only ever called for one frame at a time and in arrival
+// order, so it may keep state between frames of its ID.
+type DecodeHook func(f can.Frame) ([]SignalValue, error)
+
+// RegisterDecodeHook attaches fn to frame id. frame names its signals when
+// the map does not define the ID; otherwise the map's frame name is used
+// and the hook's signals are added to the decoded ones. Call it from an
+// init function in a file of this package:
+//
+//	func init() {
+//		RegisterDecodeHook(0x5A0, "VENDOR_STATUS", decodeVendorStatus)
+//	}
+func RegisterDecodeHook(id uint32, frame string, fn DecodeHook) {
+	decodeHooks.mu.Lock()
+	defer decodeHooks.mu.Unlock()
+	if _, dup := decodeHooks.m[id]; dup {
+		panic(fmt.Sprintf("decode hook for 0x%03X registered twice", id))
+	}
+	decodeHooks.m[id] = &decodeHook{id: id, frame: frame, fn: fn}
+}
+
+var decodeHooks = struct {
+	mu sync.RWMutex
+	m  map[uint32]*decodeHook
+}{m: make(map[uint32]*decodeHook)}
+
+type decodeHook struct {
+	id    uint32
+	frame string
+	fn    DecodeHook
+
+	mu        sync.Mutex
+	calls     uint64
+	errors    uint64
+	lastError string
+	lastErrAt time.Time
+}
+
+// DecodeHookStatus is one registered hook and its call counters.
+type DecodeHookStatus struct {
+	ID        string     `json:"id"`
+	Frame     string     `json:"frame"`
+	Calls     uint64     `json:"calls"`
+	Errors    uint64     `json:"errors"`
+	LastError string     `json:"last_error,omitempty"`
+	LastErrAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+func lookupDecodeHook(id uint32) *decodeHook {
+	decodeHooks.mu.RLock()
+	defer decodeHooks.mu.RUnlock()
+	return decodeHooks.m[id]
+}
+
+// run calls the hook and fills in the frame fields of its signals. A hook
+// that fails or panics contributes no signals for that frame.
+func (h *decodeHook) run(f can.Frame, frame, id, dir string, now time.Time) (values []SignalValue) {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err, values = fmt.Errorf("panic: %v", r), nil
+		}
+		h.mu.Lock()
+		h.calls++
+		if err != nil {
+			h.errors++
+			h.lastError, h.lastErrAt = err.Error(), now
+		}
+		h.mu.Unlock()
+		if err != nil {
+			slog.Debug("decode hook failed", "id", id, "frame", frame, "err", err)
+		}
+	}()
+	values, err = h.fn(f)
+	if err != nil {
+		return nil
+	}
+	for i := range values {
+		values[i].FrameID = id
+		values[i].FrameName = frame
+		values[i].UpdatedAt = now
+		values[i].Value = clampFinite(values[i].Value)
+		if values[i].Dir == "" {
+			values[i].Dir = dir
+		}
+	}
+	return values
+}
+
+// DecodeHookStatuses lists the registered hooks by ID.
+func DecodeHookStatuses() []DecodeHookStatus {
+	decodeHooks.mu.RLock()
+	hooks := make([]*decodeHook, 0, len(decodeHooks.m))
+	for _, h := range decodeHooks.m {
+		hooks = append(hooks, h)
+	}
+	decodeHooks.mu.RUnlock()
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].id < hooks[j].id })
+
+	out := make([]DecodeHookStatus, 0, len(hooks))
+	for _, h := range hooks {
+		h.mu.Lock()
+		st := DecodeHookStatus{
+			ID:        fmt.Sprintf("0x%03X", h.id),
+			Frame:     h.frame,
+			Calls:     h.calls,
+			Errors:    h.errors,
+			LastError: h.lastError,
+		}
+		if !h.lastErrAt.IsZero() {
+			t := h.lastErrAt
+			st.LastErrAt = &t
+		}
+		h.mu.Unlock()
+		out = append(out, st)
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+
+	"go.einride.tech/can"
+)
+
+// DecodePreview is how the active map decodes one payload, for checking a
+// map against captured frames. Nothing is sent, stored or counted.
+type DecodePreview struct {
+	ID          string          `json:"id"`
+	DataHex     string          `json:"data_hex"`
+	DLC         int             `json:"dlc"`
+	Mapped      bool            `json:"mapped"`
+	Frame       string          `json:"frame,omitempty"`
+	Node        string          `json:"node,omitempty"`
+	MapDLC      int             `json:"map_dlc,omitempty"`      // DLC declared in the map
+	DLCMismatch bool            `json:"dlc_mismatch,omitempty"` // dlc differs from map_dlc; see /api/dlc-mismatches
+	Hook        bool            `json:"hook,omitempty"`         // a decode hook also handles this ID; it is not run here
+	Signals     []PreviewSignal `json:"signals"`
+	E2E         *PreviewE2E     `json:"e2e,omitempty"`
+}
+
+// PreviewSignal is one signal of the frame with its raw and scaled value.
+// Multiplexed signals the switch does not select are listed with Present
+// false, decoded as if they were.
+type PreviewSignal struct {
+	Name       string   `json:"name"`
+	StartBit   uint8    `json:"start_bit"`
+	BitLength  uint8    `json:"bit_length"`
+	Endianness string   `json:"endianness"`
+	Signed     bool     `json:"signed"`
+	Factor     float64  `json:"factor"`
+	Offset     float64  `json:"offset"`
+	Raw        *int64   `json:"raw,omitempty"`
+	RawHex     string   `json:"raw_hex,omitempty"`
+	Value      *float64 `json:"value,omitempty"`
+	Unit       string   `json:"unit,omitempty"`
+	Text       string   `json:"text,omitempty"` // value table label
+	Present    bool     `json:"present"`
+	OutOfRange bool     `json:"out_of_range,omitempty"` // outside the map's min and max
+	Error      string   `json:"error,omitempty"`        // why it cannot be decoded; no raw or value then
+}
+
+// PreviewE2E is the CRC and counter of a protected frame. Sequence checks
+// need the frames before, so only the CRC is judged.
+type PreviewE2E struct {
+	Counter     *uint64 `json:"counter,omitempty"`
+	CRC         *string `json:"crc,omitempty"`          // as received
+	ExpectedCRC *string `json:"expected_crc,omitempty"` // computed over the payload
+	CRCOK       *bool   `json:"crc_ok,omitempty"`
+}
+
+// PreviewDecode decodes the frame f with def, or reports it unmapped when ok
+// is false.
+func PreviewDecode(f can.Frame, def FrameDef, ok, hook bool) DecodePreview {
+	dlc := int(f.Length)
+	p := DecodePreview{
+		ID:      canIDString(f.ID, f.IsExtended),
+		DataHex: fmt.Sprintf("%X", f.Data[:dlc]),
+		DLC:     dlc,
+		Mapped:  ok,
+		Hook:    hook,
+		Signals: []PreviewSignal{},
+	}
+	if !ok {
+		return p
+	}
+	p.Frame, p.Node, p.MapDLC = def.Name, def.Node, int(def.DLC)
+	p.DLCMismatch = dlc != p.MapDLC
+
+	present := make(map[string]bool)
+	for _, s := range def.Present(f.Data) {
+		present[s.SignalName] = true
+	}
+	for _, s := range def.Signals {
+		ps := PreviewSignal{
+			Name:       s.SignalName,
+			StartBit:   s.StartBit,
+			BitLength:  s.BitLength,
+			Endianness: string(s.Endianness),
+			Signed:     s.Signed,
+			Factor:     s.Factor,
+			Offset:     s.Offset,
+			Unit:       s.Unit,
+			Present:    present[s.SignalName],
+		}
+		if ps.Error = signalProblem(s, dlc); ps.Error == "" {
+			raw, v := rawSignal(f.Data, s), clampFinite(decodeSignal(f.Data, s))
+			ps.Raw, ps.Value = &raw, &v
+			ps.RawHex = fmt.Sprintf("0x%X", uint64(raw)&(1<<s.BitLength-1))
+			ps.Text = s.Values[raw]
+			ps.OutOfRange = s.HasRange && (v < s.Min || v > s.Max)
+		}
+		p.Signals = append(p.Signals, ps)
+	}
+
+	if e := def.E2E; e != nil {
+		p.E2E = &PreviewE2E{}
+		if e.Counter != nil && signalProblem(*e.Counter, dlc) == "" {
+			c := e.counter(f.Data)
+			p.E2E.Counter = &c
+		}
+		if e.CRC != nil {
+			if idx, err := crcByte(*e.CRC); err == nil && idx < dlc {
+				got, want := fmt.Sprintf("0x%02X", f.Data[idx]), fmt.Sprintf("0x%02X", e.checksum(f.Data, dlc))
+				ok := got == want
+				p.E2E.CRC, p.E2E.ExpectedCRC, p.E2E.CRCOK = &got, &want, &ok
+			}
+		}
+	}
+	return p
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sync"
+
+	"go.einride.tech/can"
+)
+
+// Decoder fans data frames out to a pool of workers that decode them and
+// update the store. Frames are sharded by ID, so each ID is still handled
+// in arrival order.
+type Decoder struct {
+	app    *App
+	block  bool
+	queues []chan decodeJob
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type decodeJob struct {
+	f   can.Frame
+	st  frameStamp
+	dir string
+}
+
+// NewDecoder starts workers goroutines with queue frames of buffer each.
+// With no workers, frames are decoded inline by the caller. With block set
+// (replays and the simulator) a full queue makes the source wait; a live
+// bus cannot wait, so the frame is dropped and counted instead.
+func NewDecoder(app *App, workers, queue int, block bool) *Decoder {
+	d := &Decoder{app: app, block: block}
+	for range workers {
+		q := make(chan decodeJob, queue)
+		d.queues = append(d.queues, q)
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for j := range q {
+				decodeFrame(app, j.f, j.st, j.dir)
+			}
+		}()
+	}
+	return d
+}
+
+func (d *Decoder) Submit(f can.Frame, st frameStamp, dir string) {
+	if len(d.queues) == 0 {
+		decodeFrame(d.app, f, st, dir)
+		return
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		d.app.Stats.ObserveDrop()
+		return
+	}
+	q := d.queues[f.ID%uint32(len(d.queues))]
+	job := decodeJob{f: f, st: st, dir: dir}
+	if d.block {
+		q <- job
+		return
+	}
+	select {
+	case q <- job:
+	default:
+		d.app.Stats.ObserveDrop()
+	}
+}
+
+// Close decodes the frames still queued and stops the workers. Frames
+// submitted afterwards are dropped.
+func (d *Decoder) Close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, q := range d.queues {
+			close(q)
+		}
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DerivedDef is a signal computed from other signals, e.g.
+// "voltage * current". It is listed under its frame like a decoded signal.
+type DerivedDef struct {
+	FrameID   uint32
+	FrameName string
+	Name      string
+	Expr      *Expr
+	Unit      string
+	Direction string
+	Comment   string
+}
+
+type derivedSignal struct {
+	DerivedDef
+	key     string
+	node    string            // of the frame it is listed under
+	resolve map[string]string // variable name in Expr -> FRAME.signal
+}
+
+// derivedSet is the derived signals of one map in evaluation order (inputs
+// before the signals computed from them) with a reverse dependency index.
+type derivedSet struct {
+	order      []*derivedSignal
+	dependents map[string][]int // input key -> indexes into order
+}
+
+// newDerivedSet resolves the inputs of every derived signal in defs. A
+// variable is either FRAME.signal, a signal of the same frame, or a signal
+// name that is unique in the map. Derived signals may use each other but
+// not in a cycle.
+func newDerivedSet(defs map[uint32]FrameDef) (*derivedSet, error) {
+	known := make(map[string]bool)
+	byName := make(map[string][]string)
+	addKey := func(frame, name string) {
+		key := frame + "." + name
+		known[key] = true
+		byName[name] = append(byName[name], key)
+	}
+	var all []*derivedSignal
+	for _, fd := range defs {
+		for _, s := range fd.Signals {
+			addKey(fd.Name, s.SignalName)
+		}
+		for _, d := range fd.Derived {
+			addKey(fd.Name, d.Name)
+			all = append(all, &derivedSignal{DerivedDef: d, key: fd.Name + "." + d.Name, node: fd.Node})
+		}
+	}
+	if len(all) == 0 {
+		return &derivedSet{}, nil
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].key < all[j].key })
+
+	byKey := make(map[string]*derivedSignal, len(all))
+	for _, d := range all {
+		byKey[d.key] = d
+		d.resolve = make(map[string]string)
+		for _, v := range d.Expr.Vars() {
+			switch {
+			case strings.Contains(v, "."):
+				if !known[v] {
+					return nil, fmt.Errorf("derived %s: unknown signal %s", d.key, v)
+				}
+				d.resolve[v] = v
+			case known[d.FrameName+"."+v]:
+				d.resolve[v] = d.FrameName + "." + v
+			case len(byName[v]) == 1:
+				d.resolve[v] = byName[v][0]
+			case len(byName[v]) > 1:
+				return nil, fmt.Errorf("derived %s: %s is ambiguous (%s)", d.key, v, strings.Join(byName[v], ", "))
+			default:
+				return nil, fmt.Errorf("derived %s: unknown signal %s", d.key, v)
+			}
+		}
+	}
+
+	// depth-first topological sort
+	ds := &derivedSet{dependents: make(map[string][]int)}
+	state := make(map[string]int) // 1 visiting, 2 done
+	var visit func(d *derivedSignal, path []string) error
+	visit = func(d *derivedSignal, path []string) error {
+		switch state[d.key] {
+		case 1:
+			return fmt.Errorf("derived signals form a cycle: %s", strings.Join(append(path, d.key), " -> "))
+		case 2:
+			return nil
+		}
+		state[d.key] = 1
+		for _, in := range d.resolve {
+			if dep, ok := byKey[in]; ok {
+				if err := visit(dep, append(path, d.key)); err != nil {
+					return err
+				}
+			}
+		}
+		state[d.key] = 2
+		ds.order = append(ds.order, d)
+		return nil
+	}
+	for _, d := range all {
+		if err := visit(d, nil); err != nil {
+			return nil, err
+		}
+	}
+	for i, d := range ds.order {
+		for _, in := range d.resolve {
+			ds.dependents[in] = append(ds.dependents[in], i)
+		}
+	}
+	return ds, nil
+}
+
+// affected returns the derived signals to recompute after keys changed, in
+// evaluation order.
+func (ds *derivedSet) affected(keys []string) []*derivedSignal {
+	if len(ds.order) == 0 {
+		return nil
+	}
+	marked := make(map[int]bool)
+	queue := keys
+	for len(queue) > 0 {
+		k := queue[0]
+		queue = queue[1:]
+		for _, i := range ds.dependents[k] {
+			if !marked[i] {
+				marked[i] = true
+				queue = append(queue, ds.order[i].key)
+			}
+		}
+	}
+	if len(marked) == 0 {
+		return nil
+	}
+	out := make([]*derivedSignal, 0, len(marked))
+	for i, d := range ds.order {
+		if marked[i] {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// deriveSignals recomputes the derived signals that depend on updated and
+// stores them like decoded ones. Signals whose inputs have not all been
+// seen yet are skipped.
+func deriveSignals(app *App, updated []SignalValue, now time.Time) {
+	ds := app.Profiles.Derived()
+	if ds == nil || len(updated) == 0 {
+		return
+	}
+	keys := make([]string, len(updated))
+	fresh := make(map[string]float64, len(updated))
+	for i, v := range updated {
+		keys[i] = v.FrameName + "." + v.Name
+		fresh[keys[i]] = v.Value
+	}
+	todo := ds.affected(keys)
+	if len(todo) == 0 {
+		return
+	}
+
+	values := make([]SignalValue, 0, len(todo))
+	for _, d := range todo {
+		v, err := d.Expr.Eval(func(name string) (float64, bool) {
+			key := d.resolve[name]
+			if v, ok := fresh[key]; ok {
+				return v, true
+			}
+			sv, ok := app.Store.Signal(key)
+			return sv.Value, ok
+		})
+		if err != nil {
+			continue
+		}
+		v = clampFinite(v)
+		fresh[d.key] = v
+		app.Alerts.ObserveSignal(d.FrameName, d.Name, v)
+		values = append(values, SignalValue{
+			Name:      d.Name,
+			Value:     v,
+			Unit:      d.Unit,
+			FrameID:   canIDString(d.FrameID, d.FrameID > 0x7FF),
+			FrameName: d.FrameName,
+			UpdatedAt: now,
+			Dir:       d.Direction,
+			Comment:   d.Comment,
+			Node:      d.node,
+		})
+	}
+	publishSignals(app, values, now)
+}
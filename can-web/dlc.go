@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/hex"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DLCMismatch is a frame ID received with a DLC other than the one its map
+// declares, a classic sign of a map for another software version.
+type DLCMismatch struct {
+	FrameID   string         `json:"frame_id"`
+	Frame     string         `json:"frame"`
+	MapDLC    int            `json:"map_dlc"`
+	DLCs      map[int]uint64 `json:"dlcs"` // frames received per wrong DLC
+	Count     uint64         `json:"count"`
+	FirstSeen time.Time      `json:"first_seen"`
+	LastSeen  time.Time      `json:"last_seen"`
+	LastData  string         `json:"last_data_hex"`
+}
+
+// DLCReport is served by /api/dlc-mismatches.
+type DLCReport struct {
+	Skip   bool          `json:"skip"` // mismatched frames are not decoded
+	Frames []DLCMismatch `json:"frames"`
+}
+
+// DLCMonitor checks received DLCs against the map.
+type DLCMonitor struct {
+	skip bool
+
+	mu      sync.Mutex
+	entries map[frameKey]*DLCMismatch
+}
+
+func NewDLCMonitor(skip bool) *DLCMonitor {
+	return &DLCMonitor{skip: skip, entries: make(map[frameKey]*DLCMismatch)}
+}
+
+// Observe checks the payload data of frame id against def and reports
+// whether its signals should be decoded. The first mismatch per ID and DLC
+// is logged.
+func (m *DLCMonitor) Observe(id uint32, extended bool, def *FrameDef, data []byte, ts time.Time) bool {
+	dlc := len(data)
+	if dlc == int(def.DLC) {
+		return true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := frameKey{id, extended}
+	e, ok := m.entries[k]
+	if !ok {
+		e = &DLCMismatch{FrameID: k.String(), Frame: def.Name, MapDLC: int(def.DLC), DLCs: make(map[int]uint64), FirstSeen: ts}
+		m.entries[k] = e
+	}
+	if e.DLCs[dlc] == 0 {
+		slog.Warn("dlc mismatch", "id", e.FrameID, "frame", def.Name, "map_dlc", def.DLC, "dlc", dlc, "skipped", m.skip)
+	}
+	e.DLCs[dlc]++
+	e.Count++
+	e.LastSeen = ts
+	e.LastData = strings.ToUpper(hex.EncodeToString(data))
+	return !m.skip
+}
+
+// Snapshot lists the mismatched frames ordered by ID.
+func (m *DLCMonitor) Snapshot() DLCReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]frameKey, 0, len(m.entries))
+	for k := range m.entries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+	r := DLCReport{Skip: m.skip, Frames: make([]DLCMismatch, 0, len(keys))}
+	for _, k := range keys {
+		e := *m.entries[k]
+		e.DLCs = make(map[int]uint64, len(m.entries[k].DLCs))
+		for dlc, n := range m.entries[k].DLCs {
+			e.DLCs[dlc] = n
+		}
+		r.Frames = append(r.Frames, e)
+	}
+	return r
+}
+
+func (m *DLCMonitor) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[frameKey]*DLCMismatch)
+}
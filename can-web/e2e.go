@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+// E2E check results, latest per frame.
+const (
+	E2EOK             = "ok"
+	E2EInitial        = "initial" // first frame, nothing to compare the counter with
+	E2ECRCError       = "crc_error"
+	E2ERepeated       = "repeated"
+	E2EWrongSequence  = "wrong_sequence"
+	E2EInvalidCounter = "invalid_counter"
+)
+
+// E2EDef is the end-to-end protection of one frame: an alive counter, a
+// CRC byte or both, declared with the counter_bits and crc map columns.
+type E2EDef struct {
+	Counter     *SignalDef // nil without an alive counter
+	CounterBits uint8
+	CRC         *SignalDef // nil without a CRC
+	Profile     string     // crc8, crc8h2f or e2e_p1
+	DataID      uint16
+	HasDataID   bool
+}
+
+type crcAlgo struct {
+	poly, init, xorOut byte
+}
+
+// e2eProfiles are the supported CRCs. crc8 is SAE J1850 and crc8h2f the
+// AUTOSAR 0x2F polynomial; e2e_p1 is AUTOSAR E2E Profile 1 (SAE J1850
+// polynomial with the start and final XOR cancelled out, data ID low and
+// high byte first, counter 0-14).
+var e2eProfiles = map[string]crcAlgo{
+	"crc8":    {0x1D, 0xFF, 0xFF},
+	"crc8h2f": {0x2F, 0xFF, 0xFF},
+	"e2e_p1":  {0x1D, 0x00, 0x00},
+}
+
+// parseCRCSpec parses a crc column: a profile name, optionally followed by
+// ":" and a 16 bit data ID, e.g. "e2e_p1:0x0123".
+func parseCRCSpec(s string) (profile string, dataID uint16, hasID bool, err error) {
+	profile, id, hasID := strings.Cut(strings.ToLower(s), ":")
+	if _, ok := e2eProfiles[profile]; !ok {
+		return "", 0, false, fmt.Errorf("unknown crc %q (want crc8, crc8h2f or e2e_p1)", profile)
+	}
+	if hasID {
+		v, err := strconv.ParseUint(id, 0, 16)
+		if err != nil {
+			return "", 0, false, fmt.Errorf("bad data id %q", id)
+		}
+		dataID = uint16(v)
+	}
+	if profile == "e2e_p1" {
+		hasID = true
+	}
+	return profile, dataID, hasID, nil
+}
+
+// crcByte returns the payload index of an 8 bit, byte aligned CRC signal.
+func crcByte(s SignalDef) (int, error) {
+	ok := s.BitLength == 8 && (s.StartBit%8 == 0 || (s.Endianness == EndianBig && s.StartBit%8 == 7))
+	if !ok {
+		return 0, fmt.Errorf("crc signal %s must be 8 bits on a byte boundary", s.SignalName)
+	}
+	return int(s.StartBit / 8), nil
+}
+
+func crc8(a crcAlgo, crc byte, data []byte) byte {
+	for _, b := range data {
+		crc ^= b
+		for range 8 {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ a.poly
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// checksum computes the CRC over data id (when set) and the n payload
+// bytes other than the CRC byte itself.
+func (e *E2EDef) checksum(d can.Data, n int) byte {
+	a := e2eProfiles[e.Profile]
+	idx, _ := crcByte(*e.CRC)
+	crc := a.init
+	if e.HasDataID {
+		crc = crc8(a, crc, []byte{byte(e.DataID), byte(e.DataID >> 8)})
+	}
+	crc = crc8(a, crc, d[:idx])
+	if idx+1 < n {
+		crc = crc8(a, crc, d[idx+1:n])
+	}
+	return crc ^ a.xorOut
+}
+
+// counterModulus is the number of counter values before it wraps. Profile
+// 1 counters skip the all-ones value.
+func (e *E2EDef) counterModulus() uint64 {
+	m := uint64(1) << e.CounterBits
+	if e.Profile == "e2e_p1" {
+		m--
+	}
+	return m
+}
+
+func (e *E2EDef) counter(d can.Data) uint64 {
+	var raw uint64
+	if e.Counter.Endianness == EndianBig {
+		raw = d.UnsignedBitsBigEndian(e.Counter.StartBit, e.Counter.BitLength)
+	} else {
+		raw = d.UnsignedBitsLittleEndian(e.Counter.StartBit, e.Counter.BitLength)
+	}
+	return raw & (1<<e.CounterBits - 1)
+}
+
+// Protect writes the alive counter (seq modulo its range) and the CRC into
+// the first n bytes of d, so generated frames pass the receive checks.
+func (e *E2EDef) Protect(d *can.Data, n int, seq uint64) {
+	if e.Counter != nil {
+		c := seq % e.counterModulus()
+		if e.Counter.Endianness == EndianBig {
+			d.SetUnsignedBitsBigEndian(e.Counter.StartBit, e.Counter.BitLength, c)
+		} else {
+			d.SetUnsignedBitsLittleEndian(e.Counter.StartBit, e.Counter.BitLength, c)
+		}
+	}
+	if e.CRC != nil {
+		idx, _ := crcByte(*e.CRC)
+		d[idx] = e.checksum(*d, n)
+	}
+}
+
+// E2EStatus is the end-to-end check state of one protected frame.
+type E2EStatus struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	Profile        string     `json:"profile,omitempty"`
+	State          string     `json:"state"`
+	Counter        *uint64    `json:"counter,omitempty"`
+	Checked        uint64     `json:"checked"`
+	CRCErrors      uint64     `json:"crc_errors"`
+	Repeated       uint64     `json:"repeated"`
+	SequenceErrors uint64     `json:"sequence_errors"`
+	Lost           uint64     `json:"lost"` // frames skipped by counter jumps
+	InvalidCounter uint64     `json:"invalid_counter"`
+	LastViolation  *time.Time `json:"last_violation,omitempty"`
+	LastSeen       time.Time  `json:"last_seen"`
+}
+
+type e2eEntry struct {
+	E2EStatus
+	counter    uint64
+	hasCounter bool
+}
+
+// E2EMonitor checks alive counters and CRCs of protected frames as they
+// are received.
+type E2EMonitor struct {
+	mu      sync.Mutex
+	entries map[frameKey]*e2eEntry
+}
+
+func NewE2EMonitor() *E2EMonitor {
+	return &E2EMonitor{entries: make(map[frameKey]*e2eEntry)}
+}
+
+// Observe checks one frame of def and returns the result, one of the E2E
+// constants. A CRC error takes precedence over the counter.
+func (m *E2EMonitor) Observe(def *FrameDef, extended bool, d can.Data, n int, ts time.Time) string {
+	e := def.E2E
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := frameKey{def.ID, extended}
+	st, ok := m.entries[k]
+	if !ok {
+		st = &e2eEntry{}
+		m.entries[k] = st
+	}
+	st.Checked++
+	st.LastSeen = ts
+
+	state := E2EOK
+	if e.CRC != nil {
+		idx, _ := crcByte(*e.CRC)
+		if idx >= n || d[idx] != e.checksum(d, n) {
+			state = E2ECRCError
+			st.CRCErrors++
+		}
+	}
+	if e.Counter != nil && state == E2EOK {
+		c := e.counter(d)
+		mod := e.counterModulus()
+		switch {
+		case c >= mod:
+			state = E2EInvalidCounter
+			st.InvalidCounter++
+		case !st.hasCounter:
+			state = E2EInitial
+		default:
+			switch delta := (c + mod - st.counter) % mod; delta {
+			case 0:
+				state = E2ERepeated
+				st.Repeated++
+			case 1:
+			default:
+				state = E2EWrongSequence
+				st.SequenceErrors++
+				st.Lost += delta - 1
+			}
+		}
+		if c < mod {
+			st.counter, st.hasCounter = c, true
+		}
+	}
+	st.State = state
+	if state != E2EOK && state != E2EInitial {
+		t := ts
+		st.LastViolation = &t
+	}
+	return state
+}
+
+// Snapshot lists the protected frames of defs seen so far, ordered by ID.
+func (m *E2EMonitor) Snapshot(defs map[uint32]FrameDef) []E2EStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	match := newFrameMatcher(defs)
+	keys := make([]frameKey, 0, len(m.entries))
+	for k := range m.entries {
+		if def, _ := match.Lookup(k.id); def.E2E != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+
+	out := make([]E2EStatus, 0, len(keys))
+	for _, k := range keys {
+		st := m.entries[k]
+		s := st.E2EStatus
+		s.ID = k.String()
+		def, _ := match.Lookup(k.id)
+		s.Name = def.Name
+		s.Profile = def.E2E.Profile
+		if st.hasCounter {
+			c := st.counter
+			s.Counter = &c
+		}
+		out = append(out, s)
+	}
+	return out
+}
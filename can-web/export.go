@@ -0,0 +1,141 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+// exportName is the download name of an export of iface taken at now, e.g.
+// signals-can0-20240501-142233.csv.
+func exportName(kind, iface string, now time.Time, ext string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, iface)
+	return fmt.Sprintf("%s-%s-%s.%s", kind, safe, now.Format("20060102-150405"), ext)
+}
+
+var signalExportHeader = []string{"frame", "frame_id", "signal", "value", "text", "unit", "updated_at", "direction", "node", "bus"}
+
+// signalExportRow is v as the columns of signalExportHeader, the value at
+// full precision.
+func signalExportRow(v SignalValue) []string {
+	return []string{
+		v.FrameName, v.FrameID, v.Name,
+		strconv.FormatFloat(v.Value, 'g', -1, 64),
+		v.Text, v.Unit,
+		v.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		v.Dir, v.Node, v.Bus,
+	}
+}
+
+func WriteSignalsCSV(w io.Writer, signals []SignalValue) error {
+	cw := csv.NewWriter(w)
+	cw.Write(signalExportHeader)
+	for _, v := range signals {
+		cw.Write(signalExportRow(v))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteSignalsXLSX writes signals as a one-sheet workbook. Values are
+// numeric cells, everything else inline strings, so no shared string or
+// style parts are needed.
+func WriteSignalsXLSX(w io.Writer, signals []SignalValue) error {
+	z := zip.NewWriter(w)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="signals" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`</Relationships>`},
+	}
+	for _, p := range parts {
+		f, err := z.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return err
+		}
+	}
+
+	f, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	row := func(n int, cells []string, numeric int) {
+		fmt.Fprintf(&b, `<row r="%d">`, n)
+		for i, c := range cells {
+			ref := fmt.Sprintf("%c%d", 'A'+i, n)
+			if i == numeric {
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, c)
+				continue
+			}
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t>`, ref)
+			xml.EscapeText(&b, []byte(c))
+			b.WriteString(`</t></is></c>`)
+		}
+		b.WriteString(`</row>`)
+	}
+	row(1, signalExportHeader, -1)
+	for i, v := range signals {
+		numeric := 3 // value
+		if math.IsNaN(v.Value) || math.IsInf(v.Value, 0) {
+			numeric = -1
+		}
+		row(i+2, signalExportRow(v), numeric)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	if _, err := io.WriteString(f, b.String()); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// WriteRawCandump writes raw frames, oldest first, as a candump log that
+// the replay source and can-utils read back. Error frames carry no frame
+// in the buffer and are written as comments.
+func WriteRawCandump(w io.Writer, iface string, frames []RawFrame) error {
+	if _, err := fmt.Fprintf(w, "# raw buffer of %s exported %s\n", iface, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	for _, r := range frames {
+		ts := r.TS
+		if r.ID == "ERR" {
+			if _, err := fmt.Fprintf(w, "# error (%d.%06d) %s\n", ts.Unix(), ts.Nanosecond()/1000, r.Error); err != nil {
+				return err
+			}
+			continue
+		}
+		f := can.Frame{ID: r.canID, Length: uint8(r.DLC), IsExtended: r.Extended, IsRemote: r.RTR}
+		copy(f.Data[:], r.data)
+		if _, err := fmt.Fprintf(w, "(%d.%06d) %s %s\n", ts.Unix(), ts.Nanosecond()/1000, iface, f.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
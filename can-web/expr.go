@@ -0,0 +1,323 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a compiled arithmetic expression over named values, e.g.
+// "BATTERY.voltage * BATTERY.current / 1000". It supports + - * / %, unary
+// minus, comparisons and && || ! (true is 1, false 0), parentheses and the
+// functions abs, min, max, avg, sqrt, pow, round, floor and ceil.
+type Expr struct {
+	src  string
+	root exprNode
+	vars []string
+}
+
+type exprNode func(lookup func(string) (float64, bool)) (float64, error)
+
+// errMissingVar is returned by Eval when lookup does not know a variable.
+var errMissingVar = errors.New("missing value")
+
+func CompileExpr(src string) (*Expr, error) {
+	p := &exprParser{src: src, seen: make(map[string]bool)}
+	p.next()
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("expr %q: %w", src, err)
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("expr %q: unexpected %q", src, p.tok)
+	}
+	return &Expr{src: src, root: root, vars: p.vars}, nil
+}
+
+func (e *Expr) String() string { return e.src }
+
+// Vars lists the variable names used, in order of first use.
+func (e *Expr) Vars() []string { return e.vars }
+
+// Eval computes the expression. Variables unknown to lookup fail with
+// errMissingVar.
+func (e *Expr) Eval(lookup func(string) (float64, bool)) (float64, error) {
+	return e.root(lookup)
+}
+
+type exprParser struct {
+	src   string
+	pos   int
+	tok   string // "" at end of input
+	num   bool   // tok is a number
+	ident bool   // tok is an identifier
+
+	vars []string
+	seen map[string]bool
+}
+
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	p.num, p.ident = false, false
+	if p.pos >= len(p.src) {
+		p.tok = ""
+		return
+	}
+	start := p.pos
+	c := rune(p.src[p.pos])
+	switch {
+	case unicode.IsDigit(c) || c == '.':
+		for p.pos < len(p.src) {
+			b := p.src[p.pos]
+			exp := p.pos > start && p.src[p.pos-1]|0x20 == 'e'
+			if !isDigitByte(b) && b != '.' && b|0x20 != 'e' && !((b == '-' || b == '+') && exp) {
+				break
+			}
+			p.pos++
+		}
+		p.num = true
+	case unicode.IsLetter(c) || c == '_':
+		for p.pos < len(p.src) && (isIdentByte(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		p.ident = true
+	default:
+		p.pos++
+		if p.pos < len(p.src) {
+			switch two := p.src[start : p.pos+1]; two {
+			case "<=", ">=", "==", "!=", "&&", "||":
+				p.pos++
+			}
+		}
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+func isDigitByte(b byte) bool { return b >= '0' && b <= '9' }
+
+func isIdentByte(b byte) bool {
+	return b == '_' || isDigitByte(b) || (b|0x20 >= 'a' && b|0x20 <= 'z')
+}
+
+func (p *exprParser) expect(tok string) error {
+	if p.tok != tok {
+		if p.tok == "" {
+			return fmt.Errorf("expected %q at end", tok)
+		}
+		return fmt.Errorf("expected %q, got %q", tok, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+func boolf(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// binaryNode applies op to the results of l and r.
+func binaryNode(l, r exprNode, op func(a, b float64) float64) exprNode {
+	return func(lookup func(string) (float64, bool)) (float64, error) {
+		a, err := l(lookup)
+		if err != nil {
+			return 0, err
+		}
+		b, err := r(lookup)
+		if err != nil {
+			return 0, err
+		}
+		return op(a, b), nil
+	}
+}
+
+var exprBinaryOps = []map[string]func(a, b float64) float64{
+	{"||": func(a, b float64) float64 { return boolf(a != 0 || b != 0) }},
+	{"&&": func(a, b float64) float64 { return boolf(a != 0 && b != 0) }},
+	{
+		"==": func(a, b float64) float64 { return boolf(a == b) },
+		"!=": func(a, b float64) float64 { return boolf(a != b) },
+	},
+	{
+		"<":  func(a, b float64) float64 { return boolf(a < b) },
+		"<=": func(a, b float64) float64 { return boolf(a <= b) },
+		">":  func(a, b float64) float64 { return boolf(a > b) },
+		">=": func(a, b float64) float64 { return boolf(a >= b) },
+	},
+	{
+		"+": func(a, b float64) float64 { return a + b },
+		"-": func(a, b float64) float64 { return a - b },
+	},
+	{
+		"*": func(a, b float64) float64 { return a * b },
+		"/": func(a, b float64) float64 { return a / b },
+		"%": math.Mod,
+	},
+}
+
+func (p *exprParser) parseOr() (exprNode, error) { return p.parseLevel(0) }
+
+// parseLevel parses left-associative binary operators of precedence level
+// and above.
+func (p *exprParser) parseLevel(level int) (exprNode, error) {
+	if level == len(exprBinaryOps) {
+		return p.parseUnary()
+	}
+	l, err := p.parseLevel(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for !p.num && !p.ident {
+		op, ok := exprBinaryOps[level][p.tok]
+		if !ok {
+			break
+		}
+		p.next()
+		r, err := p.parseLevel(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		l = binaryNode(l, r, op)
+	}
+	return l, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if !p.num && !p.ident && (p.tok == "-" || p.tok == "!" || p.tok == "+") {
+		op := p.tok
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "+" {
+			return x, nil
+		}
+		return func(lookup func(string) (float64, bool)) (float64, error) {
+			a, err := x(lookup)
+			if op == "-" {
+				return -a, err
+			}
+			return boolf(a == 0), err
+		}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	switch {
+	case p.tok == "":
+		return nil, errors.New("unexpected end")
+	case p.num:
+		v, err := strconv.ParseFloat(p.tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", p.tok)
+		}
+		p.next()
+		return func(func(string) (float64, bool)) (float64, error) { return v, nil }, nil
+	case p.tok == "(":
+		p.next()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+	case p.ident:
+		name := p.tok
+		p.next()
+		if p.tok == "(" && !p.num && !p.ident {
+			return p.parseCall(name)
+		}
+		if strings.HasSuffix(name, ".") || strings.Contains(name, "..") {
+			return nil, fmt.Errorf("bad name %q", name)
+		}
+		if !p.seen[name] {
+			p.seen[name] = true
+			p.vars = append(p.vars, name)
+		}
+		return func(lookup func(string) (float64, bool)) (float64, error) {
+			v, ok := lookup(name)
+			if !ok {
+				return 0, fmt.Errorf("%s: %w", name, errMissingVar)
+			}
+			return v, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", p.tok)
+}
+
+// exprFuncs maps function names to their arity (-1: one or more) and body.
+var exprFuncs = map[string]struct {
+	arity int
+	fn    func(args []float64) float64
+}{
+	"abs":   {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"sqrt":  {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"round": {1, func(a []float64) float64 { return math.Round(a[0]) }},
+	"floor": {1, func(a []float64) float64 { return math.Floor(a[0]) }},
+	"ceil":  {1, func(a []float64) float64 { return math.Ceil(a[0]) }},
+	"pow":   {2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"min": {-1, func(a []float64) float64 {
+		m := a[0]
+		for _, x := range a[1:] {
+			m = math.Min(m, x)
+		}
+		return m
+	}},
+	"max": {-1, func(a []float64) float64 {
+		m := a[0]
+		for _, x := range a[1:] {
+			m = math.Max(m, x)
+		}
+		return m
+	}},
+	"avg": {-1, func(a []float64) float64 {
+		var sum float64
+		for _, x := range a {
+			sum += x
+		}
+		return sum / float64(len(a))
+	}},
+}
+
+func (p *exprParser) parseCall(name string) (exprNode, error) {
+	f, ok := exprFuncs[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+	p.next() // (
+	var args []exprNode
+	for p.tok != ")" {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		a, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+	}
+	p.next()
+	if (f.arity < 0 && len(args) == 0) || (f.arity >= 0 && len(args) != f.arity) {
+		return nil, fmt.Errorf("%s: wrong number of arguments (%d)", name, len(args))
+	}
+	return func(lookup func(string) (float64, bool)) (float64, error) {
+		vals := make([]float64, len(args))
+		for i, a := range args {
+			v, err := a(lookup)
+			if err != nil {
+				return 0, err
+			}
+			vals[i] = v
+		}
+		return f.fn(vals), nil
+	}, nil
+}
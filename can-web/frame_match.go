@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Matches reports whether the frame with ID id is described by fd: the same
+// ID, or for a masked definition the same bits under the mask.
+func (fd *FrameDef) Matches(id uint32) bool {
+	if fd.Mask == 0 {
+		return id == fd.ID
+	}
+	return id&fd.Mask == fd.ID&fd.Mask
+}
+
+// instance returns fd as the definition of the frame with ID id. A masked
+// definition gets the frame's ID, and "{node}" in its name is replaced by
+// the ID bits outside the mask in hex, so every node keeps its own signals.
+func (fd FrameDef) instance(id uint32) FrameDef {
+	if fd.Mask == 0 {
+		return fd
+	}
+	fd.ID = id
+	if strings.Contains(fd.Name, "{node}") {
+		fd.Name = strings.ReplaceAll(fd.Name, "{node}", fmt.Sprintf("%02X", id&^fd.Mask))
+	}
+	return fd
+}
+
+// frameMatcher looks up frame definitions by ID: an exact definition wins,
+// then the masked definition with the most mask bits set.
+type frameMatcher struct {
+	defs   map[uint32]FrameDef
+	masked []FrameDef
+}
+
+func newFrameMatcher(defs map[uint32]FrameDef) *frameMatcher {
+	m := &frameMatcher{defs: defs}
+	for _, fd := range defs {
+		if fd.Mask != 0 {
+			m.masked = append(m.masked, fd)
+		}
+	}
+	sort.Slice(m.masked, func(i, j int) bool {
+		a, b := bits.OnesCount32(m.masked[i].Mask), bits.OnesCount32(m.masked[j].Mask)
+		if a != b {
+			return a > b
+		}
+		return m.masked[i].ID < m.masked[j].ID
+	})
+	return m
+}
+
+func (m *frameMatcher) Lookup(id uint32) (FrameDef, bool) {
+	if fd, ok := m.defs[id]; ok && fd.Mask == 0 {
+		return fd, true
+	}
+	for _, fd := range m.masked {
+		if fd.Matches(id) {
+			return fd.instance(id), true
+		}
+	}
+	return FrameDef{}, false
+}
+
+// parseIDPattern parses a frame ID in which hex digits may be x wildcards,
+// e.g. 0x18FEF1xx. mask has the bits of the given digits and every bit
+// above them set, and is 0 when there are no wildcards.
+func parseIDPattern(s string) (id, mask uint32, err error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	s = strings.TrimPrefix(s, "0x")
+	if !strings.Contains(s, "x") {
+		id, err = parseHexID(s)
+		return id, 0, err
+	}
+	if len(s) > 8 {
+		return 0, 0, fmt.Errorf("%q: too many digits", s)
+	}
+	mask = ^uint32(0)
+	for i, c := range s {
+		shift := uint(4 * (len(s) - 1 - i))
+		if c == 'x' {
+			mask &^= 0xF << shift
+			continue
+		}
+		d, err := strconv.ParseUint(string(c), 16, 4)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%q: bad digit %q", s, c)
+		}
+		id |= uint32(d) << shift
+	}
+	if mask&0x1FFFFFFF == 0 {
+		return 0, 0, errors.New("pattern matches every ID")
+	}
+	return id, mask, nil
+}
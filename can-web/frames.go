@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FrameInfo is the latest state of one frame ID, mapped or not.
+type FrameInfo struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name,omitempty"` // frame name when mapped
+	Node           string    `json:"node,omitempty"` // sending ECU when the map names one
+	Extended       bool      `json:"extended"`
+	DLC            int       `json:"dlc"`
+	DataHex        string    `json:"data_hex"`
+	Dir            string    `json:"direction"`
+	Count          uint64    `json:"count"`
+	FramesPerSec   float64   `json:"frames_per_sec"`
+	LastIntervalMs float64   `json:"last_interval_ms"`
+	FirstSeen      time.Time `json:"first_seen"`
+	LastSeen       time.Time `json:"last_seen"`
+}
+
+type frameEntry struct {
+	data    [8]byte
+	dlc     int
+	dir     string
+	count   uint64
+	first   time.Time
+	last    time.Time
+	lastGap time.Duration
+}
+
+// FrameCache keeps the most recent payload of every ID seen, so "what is
+// this ID sending right now?" does not depend on the raw buffer or the map.
+type FrameCache struct {
+	mu      sync.Mutex
+	entries map[frameKey]*frameEntry
+}
+
+func NewFrameCache() *FrameCache {
+	return &FrameCache{entries: make(map[frameKey]*frameEntry)}
+}
+
+func (c *FrameCache) Observe(id uint32, extended bool, data []byte, dir string, ts time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := frameKey{id, extended}
+	e, ok := c.entries[k]
+	if !ok {
+		e = &frameEntry{first: ts}
+		c.entries[k] = e
+	} else {
+		e.lastGap = ts.Sub(e.last)
+	}
+	e.dlc = copy(e.data[:], data)
+	e.dir = dir
+	e.count++
+	e.last = ts
+}
+
+// Snapshot lists the IDs matching ids (all when empty) ordered by ID, named
+// from defs.
+func (c *FrameCache) Snapshot(defs map[uint32]FrameDef, ids []idRange) []FrameInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]frameKey, 0, len(c.entries))
+	for k := range c.entries {
+		if len(ids) == 0 || idInRanges(k.id, ids) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+
+	match := newFrameMatcher(defs)
+	out := make([]FrameInfo, 0, len(keys))
+	for _, k := range keys {
+		e := c.entries[k]
+		def, _ := match.Lookup(k.id)
+		fi := FrameInfo{
+			ID:             k.String(),
+			Name:           def.Name,
+			Node:           def.Node,
+			Extended:       k.extended,
+			DLC:            e.dlc,
+			DataHex:        strings.ToUpper(hex.EncodeToString(e.data[:e.dlc])),
+			Dir:            e.dir,
+			Count:          e.count,
+			LastIntervalMs: durMs(e.lastGap),
+			FirstSeen:      e.first,
+			LastSeen:       e.last,
+		}
+		if span := e.last.Sub(e.first).Seconds(); e.count > 1 && span > 0 {
+			fi.FramesPerSec = float64(e.count-1) / span
+		}
+		out = append(out, fi)
+	}
+	return out
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"go.einride.tech/can"
+	"go.einride.tech/can/pkg/socketcan"
+)
+
+// GatewayConfig forwards frames between iface (side a) and Peer (side b).
+// Rules are tried in order; the first one matching a frame's direction and
+// ID decides, otherwise Default applies.
+type GatewayConfig struct {
+	Peer    string        `yaml:"peer"`
+	Default string        `yaml:"default"` // allow (default) or deny
+	Rules   []GatewayRule `yaml:"rules"`
+}
+
+type GatewayRule struct {
+	Dir    string `yaml:"dir"`    // a2b, b2a or both (default)
+	IDs    string `yaml:"ids"`    // e.g. "0x100-0x1FF,0x7DF"; empty matches all
+	Action string `yaml:"action"` // allow (default) or deny
+	Remap  string `yaml:"remap"`  // forward under this ID instead
+}
+
+type gatewayRule struct {
+	a2b, b2a bool
+	ids      []idRange
+	allow    bool
+	remap    uint32
+	hasRemap bool
+}
+
+type GatewayDirStatus struct {
+	Dir       string     `json:"dir"`
+	Forwarded uint64     `json:"forwarded"`
+	Remapped  uint64     `json:"remapped"`
+	Denied    uint64     `json:"denied"`
+	Errors    uint64     `json:"errors"`
+	LastError string     `json:"last_error,omitempty"`
+	LastErrAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type GatewayStatus struct {
+	A    string             `json:"a"`
+	B    string             `json:"b"`
+	Up   map[string]bool    `json:"up"`
+	Dirs []GatewayDirStatus `json:"dirs"`
+}
+
+// gatewaySide is one interface of the gateway. The same socket receives
+// and transmits, so frames the gateway sends are not read back and
+// forwarded again.
+type gatewaySide struct {
+	iface string
+
+	mu sync.Mutex
+	tx *socketcan.Transmitter // nil while down
+}
+
+// Gateway is a SocketCAN bridge in the spirit of cangw. The frame source
+// keeps reading side a, so forwarded traffic is decoded like any other.
+type Gateway struct {
+	a, b  *gatewaySide
+	rules []gatewayRule
+	allow bool
+
+	mu   sync.Mutex
+	dirs map[string]*GatewayDirStatus
+}
+
+// NewGateway returns nil when no peer is configured.
+func NewGateway(cfg GatewayConfig, iface, source string) (*Gateway, error) {
+	if cfg.Peer == "" {
+		return nil, nil
+	}
+	if source != "socketcan" {
+		return nil, fmt.Errorf("gateway needs the socketcan source, not %q", source)
+	}
+	if cfg.Peer == iface {
+		return nil, fmt.Errorf("gateway peer %q is the listening interface", cfg.Peer)
+	}
+	g := &Gateway{
+		a: &gatewaySide{iface: iface},
+		b: &gatewaySide{iface: cfg.Peer},
+		dirs: map[string]*GatewayDirStatus{
+			"a2b": {Dir: "a2b"},
+			"b2a": {Dir: "b2a"},
+		},
+	}
+	var err error
+	if g.allow, err = gatewayAction(cfg.Default); err != nil {
+		return nil, fmt.Errorf("gateway default: %w", err)
+	}
+	for i, rc := range cfg.Rules {
+		var r gatewayRule
+		switch strings.ToLower(rc.Dir) {
+		case "", "both":
+			r.a2b, r.b2a = true, true
+		case "a2b":
+			r.a2b = true
+		case "b2a":
+			r.b2a = true
+		default:
+			return nil, fmt.Errorf("gateway rule %d: dir %q: want a2b, b2a or both", i, rc.Dir)
+		}
+		if rc.IDs != "" {
+			var errFrames bool
+			if r.ids, errFrames, err = parseIDList(rc.IDs); err != nil {
+				return nil, fmt.Errorf("gateway rule %d: %w", i, err)
+			}
+			if errFrames {
+				return nil, fmt.Errorf("gateway rule %d: error frames are never forwarded", i)
+			}
+		}
+		if r.allow, err = gatewayAction(rc.Action); err != nil {
+			return nil, fmt.Errorf("gateway rule %d: %w", i, err)
+		}
+		if rc.Remap != "" {
+			if r.remap, err = parseHexID(rc.Remap); err != nil || r.remap > can.MaxExtendedID {
+				return nil, fmt.Errorf("gateway rule %d: bad remap %q", i, rc.Remap)
+			}
+			r.hasRemap = true
+		}
+		g.rules = append(g.rules, r)
+	}
+	return g, nil
+}
+
+func gatewayAction(s string) (allow bool, err error) {
+	switch strings.ToLower(s) {
+	case "", "allow":
+		return true, nil
+	case "deny":
+		return false, nil
+	}
+	return false, fmt.Errorf("action %q: want allow or deny", s)
+}
+
+// route decides whether f goes from one side to the other and under which
+// ID.
+func (g *Gateway) route(dir string, f can.Frame) (out can.Frame, allow, remapped bool) {
+	for _, r := range g.rules {
+		if (dir == "a2b" && !r.a2b) || (dir == "b2a" && !r.b2a) {
+			continue
+		}
+		if len(r.ids) > 0 && !idInRanges(f.ID, r.ids) {
+			continue
+		}
+		if r.allow && r.hasRemap {
+			f.ID = r.remap
+			f.IsExtended = f.IsExtended || r.remap > can.MaxID
+			return f, true, true
+		}
+		return f, r.allow, false
+	}
+	return f, g.allow, false
+}
+
+func idInRanges(id uint32, ids []idRange) bool {
+	for _, rg := range ids {
+		if id >= rg.lo && id <= rg.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// Run forwards frames in both directions until ctx is cancelled, reopening
+// each side with backoff when it fails.
+func (g *Gateway) Run(ctx context.Context) {
+	if g == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, p := range []struct {
+		from, to *gatewaySide
+		dir      string
+	}{{g.a, g.b, "a2b"}, {g.b, g.a, "b2a"}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.runSide(ctx, p.from, p.to, p.dir)
+		}()
+	}
+	wg.Wait()
+}
+
+func (g *Gateway) runSide(ctx context.Context, from, to *gatewaySide, dir string) {
+	backoff := reconnectMinBackoff
+	for {
+		started := time.Now()
+		err := g.pump(ctx, from, to, dir)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) >= reconnectStableAfter {
+			backoff = reconnectMinBackoff
+		}
+		slog.Warn("gateway side failed", "side", from.iface, "err", err, "retry_in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, reconnectMaxBackoff)
+	}
+}
+
+func (g *Gateway) pump(ctx context.Context, from, to *gatewaySide, dir string) error {
+	conn, err := socketcan.DialContext(ctx, "can", from.iface)
+	if err != nil {
+		return fmt.Errorf("socketcan dial(%s): %w", from.iface, err)
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	from.mu.Lock()
+	from.tx = socketcan.NewTransmitter(conn)
+	from.mu.Unlock()
+	defer func() {
+		from.mu.Lock()
+		from.tx = nil
+		from.mu.Unlock()
+	}()
+	slog.Info("gateway side up", "side", from.iface, "dir", dir)
+
+	recv := socketcan.NewReceiver(conn)
+	for recv.Receive() {
+		if recv.HasErrorFrame() {
+			continue
+		}
+		out, ok, remapped := g.route(dir, recv.Frame())
+		if !ok {
+			g.count(dir, func(s *GatewayDirStatus) { s.Denied++ })
+			continue
+		}
+		err := to.transmit(ctx, out)
+		g.count(dir, func(s *GatewayDirStatus) {
+			if err != nil {
+				now := time.Now()
+				s.Errors++
+				s.LastError = err.Error()
+				s.LastErrAt = &now
+				return
+			}
+			s.Forwarded++
+			if remapped {
+				s.Remapped++
+			}
+		})
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err := recv.Err(); err != nil {
+		return err
+	}
+	return errors.New("receiver closed")
+}
+
+func (s *gatewaySide) transmit(ctx context.Context, f can.Frame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tx == nil {
+		return fmt.Errorf("%s is down", s.iface)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	return s.tx.TransmitFrame(ctx, f)
+}
+
+func (g *Gateway) count(dir string, fn func(*GatewayDirStatus)) {
+	g.mu.Lock()
+	fn(g.dirs[dir])
+	g.mu.Unlock()
+}
+
+func (g *Gateway) Status() GatewayStatus {
+	st := GatewayStatus{A: g.a.iface, B: g.b.iface, Up: map[string]bool{}}
+	for _, s := range []*gatewaySide{g.a, g.b} {
+		s.mu.Lock()
+		st.Up[s.iface] = s.tx != nil
+		s.mu.Unlock()
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, d := range []string{"a2b", "b2a"} {
+		ds := *g.dirs[d]
+		if ds.LastErrAt != nil {
+			t := *ds.LastErrAt
+			ds.LastErrAt = &t
+		}
+		st.Dirs = append(st.Dirs, ds)
+	}
+	return st
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+const (
+	generatorDefaultMaxRate = 100 // frames per second over all jobs
+	generatorDefaultSteps   = 100
+	generatorKeepFinished   = 20
+	generatorMinRate        = 0.01 // frames per second, one every 100 s
+)
+
+type GeneratorConfig struct {
+	AllowIDs  string  `yaml:"allow_ids"`   // e.g. "0x600-0x6FF,0x7DF"; empty disables the generator
+	MaxRateHz float64 `yaml:"max_rate_hz"` // over all running jobs
+}
+
+// Generator runs test-generation jobs: a signal swept across its range, or
+// a frame sent with random or incrementing bytes. Every job is held to the
+// allowed IDs and all jobs together to the maximum rate, whatever the
+// client asks for.
+type Generator struct {
+	app     *App
+	allow   []idRange
+	allowed string
+	maxRate float64
+
+	mu   sync.Mutex
+	jobs map[string]*genJob
+}
+
+func NewGenerator(app *App, cfg GeneratorConfig) (*Generator, error) {
+	g := &Generator{app: app, allowed: cfg.AllowIDs, maxRate: cfg.MaxRateHz, jobs: make(map[string]*genJob)}
+	if g.maxRate <= 0 {
+		g.maxRate = generatorDefaultMaxRate
+	}
+	if strings.TrimSpace(cfg.AllowIDs) != "" {
+		ids, errFrames, err := parseIDList(cfg.AllowIDs)
+		if err != nil {
+			return nil, fmt.Errorf("generator allow_ids: %w", err)
+		}
+		if errFrames {
+			return nil, errors.New("generator allow_ids: ERR is not an ID")
+		}
+		g.allow = ids
+	}
+	return g, nil
+}
+
+// genParams is the JSON form of a job.
+type genParams struct {
+	Name     string   `json:"name"` // default mode and ID
+	Mode     string   `json:"mode"` // sweep, random or increment
+	ID       string   `json:"id"`   // frame ID; sweep takes it from the signal's frame
+	Extended bool     `json:"extended"`
+	Data     string   `json:"data"`   // base payload, hex; default the map's signal defaults
+	Signal   string   `json:"signal"` // sweep: FRAME.signal
+	Min      *float64 `json:"min"`    // sweep range, default the signal's
+	Max      *float64 `json:"max"`
+	Steps    int      `json:"steps"` // sweep: values from min to max, default 100
+	Bytes    []int    `json:"bytes"` // random, increment: byte indexes, default all
+	RateHz   float64  `json:"rate_hz"`
+	Count    int      `json:"count"` // frames to send, 0 until stopped
+	Seed     int64    `json:"seed"`  // random: fixed seed for a repeatable run
+}
+
+type genJob struct {
+	name   string
+	mode   string
+	frame  can.Frame
+	rate   float64
+	count  int
+	next   func(i int, f *can.Frame) // fills in frame i
+	stop   context.CancelFunc
+	done   chan struct{}
+	detail string
+
+	// guarded by Generator.mu
+	state   string // running, done, stopped or failed
+	started time.Time
+	ended   time.Time
+	sent    int
+	last    can.Frame
+	err     string
+}
+
+// GenJobStatus is one job in /api/generator.
+type GenJobStatus struct {
+	Name     string     `json:"name"`
+	Mode     string     `json:"mode"`
+	ID       string     `json:"id"`
+	Detail   string     `json:"detail,omitempty"`
+	RateHz   float64    `json:"rate_hz"`
+	Count    int        `json:"count,omitempty"`
+	State    string     `json:"state"`
+	Sent     int        `json:"sent"`
+	Started  time.Time  `json:"started"`
+	Ended    *time.Time `json:"ended,omitempty"`
+	LastData string     `json:"last_data,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// GeneratorStatus is served by /api/generator.
+type GeneratorStatus struct {
+	AllowIDs  string         `json:"allow_ids"` // empty: the generator is disabled
+	MaxRateHz float64        `json:"max_rate_hz"`
+	RateHz    float64        `json:"rate_hz"` // of the running jobs
+	Jobs      []GenJobStatus `json:"jobs"`
+}
+
+// Start validates p against the limits and starts the job.
+func (g *Generator) Start(p genParams) (GenJobStatus, error) {
+	if len(g.allow) == 0 {
+		return GenJobStatus{}, errors.New("generator is disabled: generator.allow_ids is empty")
+	}
+	job, err := g.build(p)
+	if err != nil {
+		return GenJobStatus{}, err
+	}
+	id := uint32(job.frame.ID)
+	if !idInRanges(id, g.allow) {
+		return GenJobStatus{}, fmt.Errorf("id 0x%03X is not in generator.allow_ids (%s)", id, g.allowed)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if j, ok := g.jobs[job.name]; ok && j.state == "running" {
+		return GenJobStatus{}, fmt.Errorf("job %q is already running", job.name)
+	}
+	if total := g.rateLocked() + job.rate; total > g.maxRate {
+		return GenJobStatus{}, fmt.Errorf("rate %g/s would bring the generator to %g/s, max %g/s", job.rate, total, g.maxRate)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	job.stop, job.done = stop, make(chan struct{})
+	job.state, job.started = "running", time.Now()
+	g.jobs[job.name] = job
+	g.pruneLocked()
+	slog.Info("generator job started", "job", job.name, "mode", job.mode, "id", fmt.Sprintf("0x%03X", id), "rate_hz", job.rate, "count", job.count)
+	go g.run(ctx, job)
+	return job.status(), nil
+}
+
+// build turns p into a job without starting it.
+func (g *Generator) build(p genParams) (*genJob, error) {
+	if p.RateHz <= 0 {
+		return nil, errors.New("rate_hz is required")
+	}
+	if p.RateHz < generatorMinRate {
+		return nil, fmt.Errorf("rate_hz %g under the minimum of %g", p.RateHz, generatorMinRate)
+	}
+	if p.RateHz > g.maxRate {
+		return nil, fmt.Errorf("rate_hz %g over the limit of %g", p.RateHz, g.maxRate)
+	}
+	if p.Count < 0 {
+		return nil, fmt.Errorf("count %d must not be negative", p.Count)
+	}
+	job := &genJob{mode: p.Mode, rate: p.RateHz, count: p.Count}
+
+	var def FrameDef
+	var mapped bool
+	switch {
+	case p.ID != "":
+		id, err := parseHexID(p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("bad id %q: %w", p.ID, err)
+		}
+		job.frame.ID = id
+		def, mapped = g.app.Profiles.Lookup(id)
+	case p.Mode == "sweep":
+		frame, _, _ := strings.Cut(p.Signal, ".")
+		var err error
+		if def, err = g.app.Profiles.ByName(frame); err != nil {
+			return nil, fmt.Errorf("signal %q: %w", p.Signal, err)
+		}
+		job.frame.ID, mapped = def.ID, true
+	default:
+		return nil, errors.New("id is required")
+	}
+	job.frame.IsExtended = p.Extended || job.frame.ID > 0x7FF
+
+	// Base payload: as given, else the map's defaults.
+	job.frame.Length = 8
+	if mapped {
+		job.frame.Length = def.DLC
+		for _, s := range def.Signals {
+			if !s.Muxed {
+				encodeSignal(&job.frame.Data, s, s.Default)
+			}
+		}
+	}
+	if p.Data != "" {
+		data, err := hex.DecodeString(strings.Join(strings.Fields(p.Data), ""))
+		if err != nil {
+			return nil, fmt.Errorf("bad data %q: %w", p.Data, err)
+		}
+		if len(data) > 8 {
+			return nil, fmt.Errorf("data is %d bytes, max 8", len(data))
+		}
+		job.frame.Data = can.Data{}
+		job.frame.Length = uint8(copy(job.frame.Data[:], data))
+	}
+
+	switch p.Mode {
+	case "sweep":
+		if !mapped {
+			return nil, fmt.Errorf("sweep needs a mapped frame, 0x%03X is not in the map", job.frame.ID)
+		}
+		_, name, ok := strings.Cut(p.Signal, ".")
+		if !ok {
+			name = p.Signal
+		}
+		var sig *SignalDef
+		for i := range def.Signals {
+			if def.Signals[i].SignalName == name {
+				sig = &def.Signals[i]
+			}
+		}
+		if sig == nil {
+			return nil, fmt.Errorf("signal %q is not in frame %s", p.Signal, def.Name)
+		}
+		lo, hi := physicalRange(*sig)
+		if p.Min != nil {
+			lo = *p.Min
+		}
+		if p.Max != nil {
+			hi = *p.Max
+		}
+		steps := p.Steps
+		if steps == 0 {
+			steps = generatorDefaultSteps
+		}
+		if steps < 2 {
+			return nil, fmt.Errorf("steps %d: want at least 2", steps)
+		}
+		s := *sig
+		job.detail = fmt.Sprintf("%s.%s %g..%g in %d steps", def.Name, s.SignalName, lo, hi, steps)
+		// up from lo to hi and back down, repeating
+		job.next = func(i int, f *can.Frame) {
+			k := i % (2 * (steps - 1))
+			if k >= steps {
+				k = 2*(steps-1) - k
+			}
+			encodeSignal(&f.Data, s, lo+(hi-lo)*float64(k)/float64(steps-1))
+		}
+	case "random", "increment":
+		idx, err := genBytes(p.Bytes, int(job.frame.Length))
+		if err != nil {
+			return nil, err
+		}
+		job.detail = fmt.Sprintf("bytes %v", idx)
+		if p.Mode == "random" {
+			seed := p.Seed
+			if seed == 0 {
+				seed = time.Now().UnixNano()
+			}
+			rng := rand.New(rand.NewSource(seed))
+			job.next = func(_ int, f *can.Frame) {
+				for _, b := range idx {
+					f.Data[b] = byte(rng.Intn(256))
+				}
+			}
+			break
+		}
+		// the selected bytes form one big-endian counter starting at the
+		// base payload
+		job.next = func(i int, f *can.Frame) {
+			if i == 0 {
+				return
+			}
+			for k := len(idx) - 1; k >= 0; k-- {
+				if f.Data[idx[k]]++; f.Data[idx[k]] != 0 {
+					break
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("mode %q: want sweep, random or increment", p.Mode)
+	}
+
+	job.name = p.Name
+	if job.name == "" {
+		job.name = p.Mode + "-" + canIDString(job.frame.ID, job.frame.IsExtended)
+	}
+	return job, nil
+}
+
+// genBytes checks the byte indexes of a random or increment job; none
+// means every byte of the payload.
+func genBytes(bytes []int, length int) ([]int, error) {
+	if length == 0 {
+		return nil, errors.New("the payload is empty")
+	}
+	if len(bytes) == 0 {
+		idx := make([]int, length)
+		for i := range idx {
+			idx[i] = i
+		}
+		return idx, nil
+	}
+	seen := make(map[int]bool)
+	for _, b := range bytes {
+		if b < 0 || b >= length {
+			return nil, fmt.Errorf("byte %d outside the %d-byte payload", b, length)
+		}
+		if seen[b] {
+			return nil, fmt.Errorf("byte %d given twice", b)
+		}
+		seen[b] = true
+	}
+	idx := append([]int(nil), bytes...)
+	sort.Ints(idx)
+	return idx, nil
+}
+
+func (g *Generator) run(ctx context.Context, job *genJob) {
+	defer close(job.done)
+	tick := time.NewTicker(time.Duration(float64(time.Second) / max(job.rate, generatorMinRate)))
+	defer tick.Stop()
+	f := job.frame
+	state, errText := "done", ""
+loop:
+	for i := 0; job.count == 0 || i < job.count; i++ {
+		job.next(i, &f)
+		sctx, cancel := context.WithTimeout(ctx, time.Second)
+		err := g.app.SendFrame(sctx, f)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				state = "stopped"
+			} else {
+				state, errText = "failed", err.Error()
+				slog.Warn("generator job failed", "job", job.name, "err", err)
+			}
+			break
+		}
+		g.mu.Lock()
+		job.sent++
+		job.last = f
+		g.mu.Unlock()
+		if i+1 == job.count {
+			break
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			state = "stopped"
+			break loop
+		}
+	}
+	g.mu.Lock()
+	job.state, job.err, job.ended = state, errText, time.Now()
+	sent := job.sent
+	g.mu.Unlock()
+	slog.Info("generator job ended", "job", job.name, "state", state, "sent", sent)
+}
+
+// Stop stops the named job, or every job when name is empty, and returns
+// the number stopped.
+func (g *Generator) Stop(name string) (int, error) {
+	g.mu.Lock()
+	var jobs []*genJob
+	for n, j := range g.jobs {
+		if (name == "" || n == name) && j.state == "running" {
+			jobs = append(jobs, j)
+		}
+	}
+	_, known := g.jobs[name]
+	g.mu.Unlock()
+	if name != "" && !known {
+		return 0, fmt.Errorf("unknown job %q", name)
+	}
+	for _, j := range jobs {
+		j.stop()
+		<-j.done
+	}
+	return len(jobs), nil
+}
+
+// Close stops every job.
+func (g *Generator) Close() { g.Stop("") }
+
+func (g *Generator) Status() GeneratorStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := GeneratorStatus{AllowIDs: g.allowed, MaxRateHz: g.maxRate, RateHz: g.rateLocked(), Jobs: make([]GenJobStatus, 0, len(g.jobs))}
+	for _, j := range g.jobs {
+		s.Jobs = append(s.Jobs, j.status())
+	}
+	sort.Slice(s.Jobs, func(i, j int) bool { return s.Jobs[i].Started.After(s.Jobs[j].Started) })
+	return s
+}
+
+// rateLocked is the rate of the running jobs; g.mu must be held.
+func (g *Generator) rateLocked() float64 {
+	var r float64
+	for _, j := range g.jobs {
+		if j.state == "running" {
+			r += j.rate
+		}
+	}
+	return r
+}
+
+// pruneLocked forgets the oldest finished jobs beyond
+// generatorKeepFinished; g.mu must be held.
+func (g *Generator) pruneLocked() {
+	var ended []*genJob
+	for _, j := range g.jobs {
+		if j.state != "running" {
+			ended = append(ended, j)
+		}
+	}
+	if len(ended) <= generatorKeepFinished {
+		return
+	}
+	sort.Slice(ended, func(i, j int) bool { return ended[i].ended.Before(ended[j].ended) })
+	for _, j := range ended[:len(ended)-generatorKeepFinished] {
+		delete(g.jobs, j.name)
+	}
+}
+
+// status reports j; the generator's mutex must be held.
+func (j *genJob) status() GenJobStatus {
+	s := GenJobStatus{
+		Name:    j.name,
+		Mode:    j.mode,
+		ID:      canIDString(j.frame.ID, j.frame.IsExtended),
+		Detail:  j.detail,
+		RateHz:  j.rate,
+		Count:   j.count,
+		State:   j.state,
+		Sent:    j.sent,
+		Started: j.started,
+		Error:   j.err,
+	}
+	if !j.ended.IsZero() {
+		t := j.ended
+		s.Ended = &t
+	}
+	if j.sent > 0 {
+		s.LastData = strings.ToUpper(hex.EncodeToString(j.last.Data[:j.last.Length]))
+	}
+	return s
+}
+
+func registerGeneratorActions(app *App) {
+	app.Control.Register("generator.start", func(params json.RawMessage) (any, error) {
+		var p genParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return app.Generator.Start(p)
+	})
+	app.Control.Register("generator.stop", func(params json.RawMessage) (any, error) {
+		var p struct {
+			Name string `json:"name"` // empty stops every job
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		n, err := app.Generator.Stop(p.Name)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]int{"stopped": n}, nil
+	})
+}
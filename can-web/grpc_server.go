@@ -0,0 +1,254 @@
+package main
+
+//go:generate protoc -I proto --go_out=. --go_opt=module=example.com/can-web --go-grpc_out=. --go-grpc_opt=module=example.com/can-web canweb/v1/canweb.proto
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/can-web/canpb"
+	"go.einride.tech/can"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const grpcStreamBuffer = 1024
+
+// grpcRoles is the role each method needs, matching the HTTP routes.
+var grpcRoles = map[string]Role{
+	canpb.CanWeb_GetState_FullMethodName:        RoleViewer,
+	canpb.CanWeb_StreamSignals_FullMethodName:   RoleViewer,
+	canpb.CanWeb_StreamRawFrames_FullMethodName: RoleViewer,
+	canpb.CanWeb_SendFrame_FullMethodName:       RoleOperator,
+}
+
+// StartGRPCServer serves the gRPC API on addr until ctx is cancelled. It
+// uses the web server's TLS settings.
+func StartGRPCServer(ctx context.Context, addr string, hc HTTPConfig, app *App) error {
+	tlsConfig, err := serverTLSConfig(hc)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, h grpc.UnaryHandler) (any, error) {
+			ctx, err := grpcAuth(ctx, app.Auth, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return h(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, h grpc.StreamHandler) error {
+			if _, err := grpcAuth(ss.Context(), app.Auth, info.FullMethod); err != nil {
+				return err
+			}
+			return h(srv, ss)
+		}),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer(opts...)
+	canpb.RegisterCanWebServer(srv, &grpcService{app: app, done: ctx.Done()})
+
+	go func() {
+		<-ctx.Done()
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(3 * time.Second):
+			srv.Stop()
+		}
+	}()
+
+	slog.Info("gRPC server listening", "addr", addr)
+	return srv.Serve(lis)
+}
+
+// grpcAuth authenticates the "authorization" metadata with the HTTP API's
+// users and roles.
+func grpcAuth(ctx context.Context, auth *Auth, method string) (context.Context, error) {
+	role, ok := grpcRoles[method]
+	if !ok {
+		role = RoleOperator
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	r := &http.Request{Header: http.Header{}}
+	if v := md.Get("authorization"); len(v) > 0 {
+		r.Header.Set("Authorization", v[0])
+	}
+	p, deny := auth.check(r, role)
+	switch {
+	case deny == nil:
+		return context.WithValue(ctx, principalKey{}, p), nil
+	case deny.status == http.StatusUnauthorized:
+		return nil, status.Error(codes.Unauthenticated, deny.msg)
+	default:
+		return nil, status.Error(codes.PermissionDenied, strings.Replace(deny.msg, "endpoints", "methods", 1))
+	}
+}
+
+type grpcService struct {
+	canpb.UnimplementedCanWebServer
+	app  *App
+	done <-chan struct{}
+}
+
+func (s *grpcService) GetState(ctx context.Context, _ *canpb.GetStateRequest) (*canpb.State, error) {
+	app := s.app
+	signals, raw := app.Store.Snapshot()
+	cs := app.Conn.Status()
+	st := &canpb.State{
+		Ts:      timestamppb.Now(),
+		Iface:   app.Iface,
+		Profile: app.Profiles.Active(),
+		Conn: &canpb.ConnStatus{
+			State:     cs.State,
+			Since:     timestamppb.New(cs.Since),
+			LastError: cs.LastError,
+			Attempts:  int64(cs.Attempts),
+			Connects:  int64(cs.Connects),
+		},
+		BusState: app.Errors.State(),
+	}
+	if cs.DownSince != nil {
+		st.Conn.DownSince = timestamppb.New(*cs.DownSince)
+	}
+	for i := range signals {
+		st.Signals = append(st.Signals, signalPB(&signals[i]))
+	}
+	for i := range raw {
+		st.Raw = append(st.Raw, rawPB(&raw[i]))
+	}
+	return st, nil
+}
+
+func (s *grpcService) StreamSignals(req *canpb.StreamSignalsRequest, stream grpc.ServerStreamingServer[canpb.Signal]) error {
+	want := make(map[string]bool, len(req.GetSignals()))
+	for _, n := range req.GetSignals() {
+		want[n] = true
+	}
+	return s.stream(stream.Context(), func(ev StoreEvent) error {
+		v := ev.Signal
+		if v == nil || (len(want) > 0 && !want[v.Name] && !want[v.FrameName+"."+v.Name]) {
+			return nil
+		}
+		return stream.Send(signalPB(v))
+	})
+}
+
+func (s *grpcService) StreamRawFrames(req *canpb.StreamRawFramesRequest, stream grpc.ServerStreamingServer[canpb.RawFrame]) error {
+	want := make(map[string]bool, len(req.GetIds()))
+	for _, id := range req.GetIds() {
+		if strings.EqualFold(id, "ERR") {
+			want["ERR"] = true
+			continue
+		}
+		n, extended, err := parseCANID(id)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "bad id %q", id)
+		}
+		want[canIDString(n, extended)] = true
+	}
+	return s.stream(stream.Context(), func(ev StoreEvent) error {
+		r := ev.Raw
+		if r == nil || (len(want) > 0 && !want[r.ID]) {
+			return nil
+		}
+		return stream.Send(rawPB(r))
+	})
+}
+
+// stream feeds store events to send until the client goes away or the
+// server shuts down. A client that falls behind is disconnected rather
+// than silently missing events.
+func (s *grpcService) stream(ctx context.Context, send func(StoreEvent) error) error {
+	events, dropped, cancel := s.app.Store.Subscribe(subStream, grpcStreamBuffer)
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.done:
+			return status.Error(codes.Unavailable, "server shutting down")
+		case ev := <-events:
+			if n := dropped(); n > 0 {
+				return status.Errorf(codes.ResourceExhausted, "client too slow, %d events dropped", n)
+			}
+			if err := send(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *grpcService) SendFrame(ctx context.Context, req *canpb.SendFrameRequest) (*canpb.SendFrameResponse, error) {
+	if len(req.GetData()) > 8 {
+		return nil, status.Errorf(codes.InvalidArgument, "data is %d bytes, max 8", len(req.GetData()))
+	}
+	f := can.Frame{ID: req.GetId(), IsExtended: req.GetExtended(), IsRemote: req.GetRemote()}
+	f.Length = uint8(copy(f.Data[:], req.GetData()))
+	if err := f.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	err := s.app.SendFrame(ctx, f)
+	params, _ := json.Marshal(sendParams{ID: fmt.Sprintf("0x%03X", f.ID), Data: hex.EncodeToString(f.Data[:f.Length]), Extended: f.IsExtended, Remote: f.IsRemote})
+	s.app.Audit.Record(ctx, "grpc", "frame.send", params, err)
+	switch {
+	case err == nil:
+	case errors.Is(err, errTxDisarmed):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, errTxIDForbidden):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, errTxRateLimited):
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &canpb.SendFrameResponse{}, nil
+}
+
+func signalPB(v *SignalValue) *canpb.Signal {
+	return &canpb.Signal{
+		Name:      v.Name,
+		Value:     v.Value,
+		Unit:      v.Unit,
+		FrameId:   v.FrameID,
+		FrameName: v.FrameName,
+		UpdatedAt: timestamppb.New(v.UpdatedAt),
+		Direction: v.Dir,
+		Comment:   v.Comment,
+	}
+}
+
+func rawPB(r *RawFrame) *canpb.RawFrame {
+	return &canpb.RawFrame{
+		Ts:        timestamppb.New(r.TS),
+		Id:        r.ID,
+		CanId:     r.canID,
+		Dlc:       uint32(r.DLC),
+		Data:      r.data,
+		Direction: r.Dir,
+		Error:     r.Error,
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// ByteHeat is how often one payload byte, and each of its bits, changed
+// between consecutive frames. Bits are indexed LSB first, so byte i bit j is
+// DBC little-endian start bit i*8+j.
+type ByteHeat struct {
+	Index   int       `json:"index"`
+	Changes uint64    `json:"changes"`
+	Rate    float64   `json:"rate"`
+	Bits    [8]uint64 `json:"bits"`
+}
+
+type HeatMap struct {
+	ID     string     `json:"id"`
+	Since  time.Time  `json:"since"`
+	Frames uint64     `json:"frames"`
+	Bytes  []ByteHeat `json:"bytes"`
+}
+
+type heatEntry struct {
+	since   time.Time
+	frames  uint64
+	prev    [8]byte
+	prevLen int
+	maxLen  int
+	bytes   [8]uint64
+	bits    [64]uint64
+}
+
+// PayloadAnalyzer counts payload bit and byte changes per ID since the start
+// of an observation window, to locate signals inside frames.
+type PayloadAnalyzer struct {
+	mu      sync.Mutex
+	entries map[frameKey]*heatEntry
+}
+
+func NewPayloadAnalyzer() *PayloadAnalyzer {
+	return &PayloadAnalyzer{entries: make(map[frameKey]*heatEntry)}
+}
+
+func (p *PayloadAnalyzer) Observe(id uint32, extended bool, data []byte, ts time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k := frameKey{id, extended}
+	e, ok := p.entries[k]
+	if !ok {
+		e = &heatEntry{since: ts}
+		p.entries[k] = e
+	}
+	if e.frames > 0 {
+		for i := 0; i < len(data) && i < e.prevLen; i++ {
+			x := data[i] ^ e.prev[i]
+			if x == 0 {
+				continue
+			}
+			e.bytes[i]++
+			for x != 0 {
+				b := bits.TrailingZeros8(x)
+				e.bits[i*8+b]++
+				x &^= 1 << b
+			}
+		}
+	}
+	e.frames++
+	e.prevLen = copy(e.prev[:], data)
+	e.maxLen = max(e.maxLen, e.prevLen)
+}
+
+// HeatMap returns the change counts for k, or false if it has not been seen
+// since the window started.
+func (p *PayloadAnalyzer) HeatMap(k frameKey) (HeatMap, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, ok := p.entries[k]
+	if !ok {
+		return HeatMap{}, false
+	}
+	hm := HeatMap{ID: k.String(), Since: e.since, Frames: e.frames}
+	for i := 0; i < e.maxLen; i++ {
+		bh := ByteHeat{Index: i, Changes: e.bytes[i]}
+		copy(bh.Bits[:], e.bits[i*8:i*8+8])
+		if e.frames > 1 {
+			bh.Rate = float64(e.bytes[i]) / float64(e.frames-1)
+		}
+		hm.Bytes = append(hm.Bytes, bh)
+	}
+	return hm, true
+}
+
+// Reset starts a new observation window for k, or for all IDs when all is
+// set.
+func (p *PayloadAnalyzer) Reset(k frameKey, all bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if all {
+		p.entries = make(map[frameKey]*heatEntry)
+		return
+	}
+	delete(p.entries, k)
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	historyQueue       = 8192
+	historyFlushEvery  = time.Second
+	historyPruneEvery  = time.Minute
+	historyQueryMaxRow = 100000
+	historyMaxBuckets  = 1000
+)
+
+// HistoryConfig enables the SQLite signal history when Path is set.
+type HistoryConfig struct {
+	Path          string `yaml:"path"`
+	MaxAge        string `yaml:"max_age"`
+	MaxRows       int64  `yaml:"max_rows"`
+	MinIntervalMs int    `yaml:"min_interval_ms"`
+}
+
+type HistorySample struct {
+	TS    time.Time `json:"ts"`
+	Value float64   `json:"value"`
+}
+
+type historyRow struct {
+	bus    string
+	signal string
+	ts     int64 // unix ms
+	value  float64
+}
+
+// HistoryStore persists decoded signal samples to SQLite so they survive
+// restarts. Samples are thinned to one per MinIntervalMs per signal, written
+// in batches, and pruned by age and row count. A nil *HistoryStore is a
+// disabled store.
+type HistoryStore struct {
+	db          *sql.DB
+	maxAge      time.Duration
+	maxRows     int64
+	minInterval time.Duration
+	queue       chan historyRow
+
+	mu      sync.Mutex
+	last    map[string]time.Time
+	dropped uint64
+}
+
+// NewHistoryStore opens the history at cfg.Path. Samples stored before the
+// bus column existed are attributed to bus, the only one read back then.
+func NewHistoryStore(cfg HistoryConfig, bus string) (*HistoryStore, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	var maxAge time.Duration
+	if cfg.MaxAge != "" {
+		var err error
+		if maxAge, err = time.ParseDuration(cfg.MaxAge); err != nil {
+			return nil, fmt.Errorf("history max_age: %w", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", cfg.Path+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS samples (
+			ts     INTEGER NOT NULL,
+			signal TEXT    NOT NULL,
+			value  REAL    NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS samples_ts ON samples (ts);
+	`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("history %s: %w", cfg.Path, err)
+	}
+	if err := migrateHistoryBus(db, bus); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("history %s: %w", cfg.Path, err)
+	}
+
+	return &HistoryStore{
+		db:          db,
+		maxAge:      maxAge,
+		maxRows:     cfg.MaxRows,
+		minInterval: time.Duration(cfg.MinIntervalMs) * time.Millisecond,
+		queue:       make(chan historyRow, historyQueue),
+		last:        make(map[string]time.Time),
+	}, nil
+}
+
+// migrateHistoryBus adds the bus column to a history written before it
+// existed.
+func migrateHistoryBus(db *sql.DB, bus string) error {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('samples') WHERE name = 'bus'`).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := db.Exec(`ALTER TABLE samples ADD COLUMN bus TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+		if _, err := db.Exec(`UPDATE samples SET bus = ?`, bus); err != nil {
+			return err
+		}
+		if _, err := db.Exec(`DROP INDEX IF EXISTS samples_signal_ts`); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec(`CREATE INDEX IF NOT EXISTS samples_bus_signal_ts ON samples (bus, signal, ts)`)
+	return err
+}
+
+// Record queues one sample of signal ("FRAME.name") on bus. It never
+// blocks; when the writer falls behind, samples are dropped and counted.
+func (h *HistoryStore) Record(bus, signal string, v float64, ts time.Time) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := bus + "/" + signal
+	if prev, ok := h.last[key]; ok && ts.Sub(prev) < h.minInterval {
+		return
+	}
+	h.last[key] = ts
+	select {
+	case h.queue <- historyRow{bus: bus, signal: signal, ts: ts.UnixMilli(), value: v}:
+	default:
+		h.dropped++
+	}
+}
+
+// Run writes queued samples and applies retention until ctx is cancelled,
+// then flushes what is left and closes the database.
+func (h *HistoryStore) Run(ctx context.Context) {
+	if h == nil {
+		return
+	}
+	defer h.db.Close()
+
+	flush := time.NewTicker(historyFlushEvery)
+	defer flush.Stop()
+	prune := time.NewTicker(historyPruneEvery)
+	defer prune.Stop()
+
+	var batch []historyRow
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := h.insert(batch); err != nil {
+			slog.Error("history write failed", "samples", len(batch), "err", err)
+		}
+		batch = batch[:0]
+	}
+	h.prune()
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case r := <-h.queue:
+					batch = append(batch, r)
+				default:
+					write()
+					return
+				}
+			}
+		case r := <-h.queue:
+			batch = append(batch, r)
+			if len(batch) >= historyQueue {
+				write()
+			}
+		case <-flush.C:
+			write()
+		case <-prune.C:
+			h.prune()
+		}
+	}
+}
+
+func (h *HistoryStore) insert(rows []historyRow) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("INSERT INTO samples (ts, bus, signal, value) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range rows {
+		if _, err := stmt.Exec(r.ts, r.bus, r.signal, r.value); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (h *HistoryStore) prune() {
+	if h.maxAge > 0 {
+		cutoff := time.Now().Add(-h.maxAge).UnixMilli()
+		if _, err := h.db.Exec("DELETE FROM samples WHERE ts < ?", cutoff); err != nil {
+			slog.Error("history prune by age failed", "err", err)
+		}
+	}
+	if h.maxRows > 0 {
+		// rowids grow monotonically, so the newest maxRows are the top ones
+		if _, err := h.db.Exec("DELETE FROM samples WHERE rowid <= (SELECT MAX(rowid) FROM samples) - ?", h.maxRows); err != nil {
+			slog.Error("history prune by rows failed", "err", err)
+		}
+	}
+}
+
+// Query returns the samples of signal on bus within [since, until], oldest
+// first. With step > 0 samples are averaged into buckets of that width.
+func (h *HistoryStore) Query(bus, signal string, since, until time.Time, step time.Duration, limit int) ([]HistorySample, error) {
+	if limit <= 0 || limit > historyQueryMaxRow {
+		limit = historyQueryMaxRow
+	}
+	from, to := int64(0), time.Now().Add(time.Hour).UnixMilli()
+	if !since.IsZero() {
+		from = since.UnixMilli()
+	}
+	if !until.IsZero() {
+		to = until.UnixMilli()
+	}
+
+	var rows *sql.Rows
+	var err error
+	if step > 0 {
+		ms := max(step.Milliseconds(), 1)
+		rows, err = h.db.Query(`
+			SELECT (ts / ?) * ?, AVG(value) FROM samples
+			WHERE bus = ? AND signal = ? AND ts BETWEEN ? AND ?
+			GROUP BY ts / ? ORDER BY 1 LIMIT ?`, ms, ms, bus, signal, from, to, ms, limit)
+	} else {
+		// newest rows win when the limit cuts the range
+		rows, err = h.db.Query(`
+			SELECT ts, value FROM (
+				SELECT ts, value FROM samples
+				WHERE bus = ? AND signal = ? AND ts BETWEEN ? AND ?
+				ORDER BY ts DESC LIMIT ?
+			) ORDER BY ts`, bus, signal, from, to, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []HistorySample{}
+	for rows.Next() {
+		var ts int64
+		var v float64
+		if err := rows.Scan(&ts, &v); err != nil {
+			return nil, err
+		}
+		out = append(out, HistorySample{TS: time.UnixMilli(ts).UTC(), Value: v})
+	}
+	return out, rows.Err()
+}
+
+// Export writes every sample of every signal between since and until as
+// CSV, oldest first. A zero until is now.
+func (h *HistoryStore) Export(w io.Writer, since, until time.Time) error {
+	to := time.Now().Add(time.Hour).UnixMilli()
+	if !until.IsZero() {
+		to = until.UnixMilli()
+	}
+	rows, err := h.db.Query(`
+		SELECT ts, bus, signal, value FROM samples
+		WHERE ts BETWEEN ? AND ? ORDER BY ts, bus, signal`, since.UnixMilli(), to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"ts", "bus", "signal", "value"})
+	for rows.Next() {
+		var ts int64
+		var bus, signal string
+		var v float64
+		if err := rows.Scan(&ts, &bus, &signal, &v); err != nil {
+			return err
+		}
+		cw.Write([]string{time.UnixMilli(ts).UTC().Format(time.RFC3339Nano), bus, signal, strconv.FormatFloat(v, 'g', -1, 64)})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+type HistoryStatus struct {
+	Enabled bool   `json:"enabled"`
+	Rows    int64  `json:"rows"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// Dropped returns the number of samples dropped because the writer fell
+// behind.
+func (h *HistoryStore) Dropped() uint64 {
+	if h == nil {
+		return 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.dropped
+}
+
+func (h *HistoryStore) Status() HistoryStatus {
+	if h == nil {
+		return HistoryStatus{}
+	}
+	st := HistoryStatus{Enabled: true}
+	_ = h.db.QueryRow("SELECT COUNT(*) FROM samples").Scan(&st.Rows)
+	h.mu.Lock()
+	st.Dropped = h.dropped
+	h.mu.Unlock()
+	return st
+}
+
+// Histogram is the distribution of one signal's stored samples over a time
+// window. Samples below Min or above Max are counted in Underflow and
+// Overflow; Distinct counts the different values seen, which exposes
+// quantization.
+type Histogram struct {
+	Signal    string            `json:"signal"`
+	Count     int64             `json:"count"`
+	Distinct  int64             `json:"distinct"`
+	Min       float64           `json:"min"`
+	Max       float64           `json:"max"`
+	Width     float64           `json:"width"`
+	Buckets   []HistogramBucket `json:"buckets"`
+	Underflow int64             `json:"underflow"`
+	Overflow  int64             `json:"overflow"`
+}
+
+// HistogramBucket counts the samples in [Lo, Hi); the last bucket includes
+// its upper bound.
+type HistogramBucket struct {
+	Lo    float64 `json:"lo"`
+	Hi    float64 `json:"hi"`
+	Count int64   `json:"count"`
+}
+
+// Histogram sorts the samples of signal on bus between since and until
+// into n equal buckets. A nil lo or hi takes the smallest or largest sample.
+func (h *HistoryStore) Histogram(bus, signal string, since, until time.Time, n int, lo, hi *float64) (Histogram, error) {
+	from, to := int64(0), time.Now().Add(time.Hour).UnixMilli()
+	if !since.IsZero() {
+		from = since.UnixMilli()
+	}
+	if !until.IsZero() {
+		to = until.UnixMilli()
+	}
+
+	hg := Histogram{Signal: signal, Buckets: []HistogramBucket{}}
+	var vmin, vmax sql.NullFloat64
+	err := h.db.QueryRow(`
+		SELECT COUNT(*), COUNT(DISTINCT value), MIN(value), MAX(value) FROM samples
+		WHERE bus = ? AND signal = ? AND ts BETWEEN ? AND ?`, bus, signal, from, to).Scan(&hg.Count, &hg.Distinct, &vmin, &vmax)
+	if err != nil {
+		return hg, err
+	}
+	hg.Min, hg.Max = vmin.Float64, vmax.Float64
+	if lo != nil {
+		hg.Min = *lo
+	}
+	if hi != nil {
+		hg.Max = *hi
+	}
+	if hg.Max < hg.Min {
+		return hg, fmt.Errorf("max %g below min %g", hg.Max, hg.Min)
+	}
+	if hg.Count == 0 {
+		return hg, nil
+	}
+	if hg.Max == hg.Min {
+		hg.Max = hg.Min + 1 // a constant signal still gets n buckets
+	}
+
+	hg.Width = (hg.Max - hg.Min) / float64(n)
+	edge := func(i int) float64 { return hg.Min + float64(i)*hg.Width }
+	for i := range n {
+		hg.Buckets = append(hg.Buckets, HistogramBucket{Lo: edge(i), Hi: edge(i + 1)})
+	}
+	hg.Buckets[n-1].Hi = hg.Max
+
+	rows, err := h.db.Query(`
+		SELECT CASE
+			WHEN value < ? THEN -1
+			WHEN value > ? THEN ?
+			ELSE MIN(CAST((value - ?) / ? AS INTEGER), ? - 1)
+		END AS b, COUNT(*) FROM samples
+		WHERE bus = ? AND signal = ? AND ts BETWEEN ? AND ?
+		GROUP BY b`, hg.Min, hg.Max, n, hg.Min, hg.Width, n, bus, signal, from, to)
+	if err != nil {
+		return hg, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b, c int64
+		if err := rows.Scan(&b, &c); err != nil {
+			return hg, err
+		}
+		switch {
+		case b < 0:
+			hg.Underflow += c
+		case b >= int64(n):
+			hg.Overflow += c
+		default:
+			hg.Buckets[b].Count += c
+		}
+	}
+	return hg, rows.Err()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// InterfaceStatus is one CAN network interface as reported by rtnetlink.
+type InterfaceStatus struct {
+	Name        string  `json:"name"`
+	Kind        string  `json:"kind"` // can, vcan, vxcan, ...
+	Up          bool    `json:"up"`
+	OperState   string  `json:"oper_state"`
+	Listening   bool    `json:"listening"` // the interface this server reads
+	Bitrate     uint32  `json:"bitrate,omitempty"`
+	SamplePoint float64 `json:"sample_point,omitempty"`
+	State       string  `json:"state,omitempty"` // controller state, real controllers only
+	TxErrors    uint16  `json:"tx_error_counter"`
+	RxErrors    uint16  `json:"rx_error_counter"`
+	RestartMs   uint32  `json:"restart_ms,omitempty"`
+	Stats       struct {
+		RxFrames  uint64 `json:"rx_frames"`
+		TxFrames  uint64 `json:"tx_frames"`
+		RxErrors  uint64 `json:"rx_errors"`
+		TxErrors  uint64 `json:"tx_errors"`
+		RxDropped uint64 `json:"rx_dropped"`
+		TxDropped uint64 `json:"tx_dropped"`
+	} `json:"stats"`
+}
+
+// ifaceParams changes one interface. Unset fields are left alone.
+type ifaceParams struct {
+	Name      string  `json:"name"`
+	Up        *bool   `json:"up"`
+	Bitrate   uint32  `json:"bitrate"`
+	RestartMs *uint32 `json:"restart_ms"`
+}
+
+func registerInterfaceAction(app *App, manage bool) {
+	app.Control.Register("iface.set", func(params json.RawMessage) (any, error) {
+		if !manage {
+			return nil, errors.New("interface management is disabled (set interfaces.manage)")
+		}
+		var p ifaceParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if err := ConfigureInterface(p); err != nil {
+			return nil, err
+		}
+		all, err := ListInterfaces(app.Iface)
+		if err != nil {
+			return nil, err
+		}
+		for _, st := range all {
+			if st.Name == p.Name {
+				return st, nil
+			}
+		}
+		return nil, fmt.Errorf("%s disappeared", p.Name)
+	})
+}
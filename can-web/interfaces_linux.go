@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// canEncapType is how netlink names ARPHRD_CAN, for which it has no name.
+var canEncapType = fmt.Sprintf("unknown%d", unix.ARPHRD_CAN)
+
+// canControllerStates is enum can_state from linux/can/netlink.h.
+var canControllerStates = []string{BusStateActive, BusStateWarning, BusStatePassive, BusStateBusOff, "stopped", "sleeping"}
+
+// ListInterfaces returns the CAN interfaces of this host, sorted by name.
+func ListInterfaces(listening string) ([]InterfaceStatus, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, fmt.Errorf("list links: %w", err)
+	}
+	out := []InterfaceStatus{}
+	for _, l := range links {
+		a := l.Attrs()
+		if a.EncapType != canEncapType {
+			continue
+		}
+		st := InterfaceStatus{
+			Name:      a.Name,
+			Kind:      l.Type(),
+			Up:        a.Flags&unix.IFF_UP != 0,
+			OperState: a.OperState.String(),
+			Listening: a.Name == listening,
+		}
+		if s := a.Statistics; s != nil {
+			st.Stats.RxFrames, st.Stats.TxFrames = s.RxPackets, s.TxPackets
+			st.Stats.RxErrors, st.Stats.TxErrors = s.RxErrors, s.TxErrors
+			st.Stats.RxDropped, st.Stats.TxDropped = s.RxDropped, s.TxDropped
+		}
+		if c, ok := l.(*netlink.Can); ok {
+			st.Bitrate = c.BitRate
+			st.SamplePoint = float64(c.SamplePoint) / 1000
+			if int(c.State) < len(canControllerStates) {
+				st.State = canControllerStates[c.State]
+			}
+			st.TxErrors, st.RxErrors = c.TxError, c.RxError
+			st.RestartMs = c.RestartMs
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// ConfigureInterface applies p. The bit timing can only change while the
+// interface is down, so an up interface is taken down and back up around
+// it. Needs CAP_NET_ADMIN.
+func ConfigureInterface(p ifaceParams) error {
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	link, err := netlink.LinkByName(p.Name)
+	if err != nil {
+		return fmt.Errorf("interface %s: %w", p.Name, err)
+	}
+	if link.Attrs().EncapType != canEncapType {
+		return fmt.Errorf("%s is not a CAN interface", p.Name)
+	}
+	wasUp := link.Attrs().Flags&unix.IFF_UP != 0
+	up := wasUp
+	if p.Up != nil {
+		up = *p.Up
+	}
+
+	if p.Bitrate != 0 || p.RestartMs != nil {
+		if _, ok := link.(*netlink.Can); !ok {
+			return fmt.Errorf("%s (%s) has no bit timing", p.Name, link.Type())
+		}
+		if err := netlink.LinkSetDown(link); err != nil {
+			return privErr("set down", err)
+		}
+		if err := setCANParams(link.Attrs().Index, p.Bitrate, p.RestartMs); err != nil {
+			// leave the link as it was rather than down
+			if wasUp {
+				if uerr := netlink.LinkSetUp(link); uerr != nil {
+					slog.Error("restoring link state failed", "iface", p.Name, "err", uerr)
+				}
+			}
+			return privErr("set bit timing", err)
+		}
+	}
+	if up {
+		err = netlink.LinkSetUp(link)
+	} else {
+		err = netlink.LinkSetDown(link)
+	}
+	return privErr("set link state", err)
+}
+
+// setCANParams sends IFLA_LINKINFO/can with the bitrate (the kernel derives
+// the rest of the bit timing) and restart delay.
+func setCANParams(index int, bitrate uint32, restartMs *uint32) error {
+	req := nl.NewNetlinkRequest(unix.RTM_NEWLINK, unix.NLM_F_ACK)
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = int32(index)
+	req.AddData(msg)
+
+	info := nl.NewRtAttr(unix.IFLA_LINKINFO, nil)
+	info.AddRtAttr(nl.IFLA_INFO_KIND, nl.ZeroTerminated("can"))
+	data := info.AddRtAttr(nl.IFLA_INFO_DATA, nil)
+	if bitrate != 0 {
+		bt := make([]byte, 8*4) // struct can_bittiming, bitrate first
+		binary.NativeEndian.PutUint32(bt, bitrate)
+		data.AddRtAttr(nl.IFLA_CAN_BITTIMING, bt)
+	}
+	if restartMs != nil {
+		data.AddRtAttr(nl.IFLA_CAN_RESTART_MS, nl.Uint32Attr(*restartMs))
+	}
+	req.AddData(info)
+	_, err := req.Execute(unix.NETLINK_ROUTE, 0)
+	return err
+}
+
+func privErr(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES) {
+		return fmt.Errorf("%s: %w (needs CAP_NET_ADMIN)", op, err)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
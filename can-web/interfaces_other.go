@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+var errNoNetlink = errors.New("CAN interfaces are only managed on Linux (rtnetlink)")
+
+func ListInterfaces(string) ([]InterfaceStatus, error) { return nil, errNoNetlink }
+
+func ConfigureInterface(ifaceParams) error { return errNoNetlink }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LoadKCD converts the messages of a Kayak KCD file into frame
+// definitions. The messages of all buses are merged. Multiplexer switches
+// are kept and the signals of their groups skipped, as are float signals.
+func LoadKCD(path string) (map[uint32]FrameDef, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	root, err := parseXMLTree(f)
+	if err != nil {
+		return nil, err
+	}
+	if root.Name != "NetworkDefinition" {
+		return nil, fmt.Errorf("not a KCD file (root element %s)", root.Name)
+	}
+
+	nodes := make(map[string]string)
+	for _, n := range root.All("Node") {
+		nodes[n.Attr("id")] = n.Attr("name")
+	}
+
+	frames := make(map[uint32]FrameDef)
+	bus := make(map[uint32]string)
+	for _, b := range root.All("Bus") {
+		for _, m := range b.All("Message") {
+			fd, err := kcdMessage(m)
+			if err != nil {
+				return nil, fmt.Errorf("bus %s: %w", b.Attr("name"), err)
+			}
+			// the first producer is the sender
+			if ref := m.Child("Producer", "NodeRef"); ref != nil {
+				fd.Node = nodes[ref.Attr("id")]
+			}
+			if other, dup := bus[fd.ID]; dup {
+				return nil, fmt.Errorf("duplicate message id 0x%X (buses %s and %s)", fd.ID, other, b.Attr("name"))
+			}
+			frames[fd.ID], bus[fd.ID] = fd, b.Attr("name")
+		}
+	}
+	return frames, nil
+}
+
+func kcdMessage(m *xmlNode) (FrameDef, error) {
+	id, err := strconv.ParseUint(m.Attr("id"), 0, 32)
+	if err != nil {
+		return FrameDef{}, fmt.Errorf("message %s: bad id %q", m.Attr("name"), m.Attr("id"))
+	}
+	fd := FrameDef{ID: uint32(id), Name: m.Attr("name"), DLC: 8}
+	if n, err := strconv.Atoi(m.Attr("length")); err == nil { // "auto" keeps 8
+		fd.DLC = uint8(n)
+	}
+	if n, err := strconv.Atoi(m.Attr("interval")); err == nil {
+		fd.CycleMs = n
+	}
+
+	var sigs []*xmlNode
+	for _, c := range m.Children {
+		switch c.Name {
+		case "Signal", "Multiplex":
+			sigs = append(sigs, c)
+		}
+	}
+	for _, s := range sigs {
+		def, ok, err := kcdSignal(fd, s)
+		if err != nil {
+			return FrameDef{}, fmt.Errorf("message %s: %w", fd.Name, err)
+		}
+		if ok {
+			fd.Signals = append(fd.Signals, def)
+		}
+	}
+	sort.Slice(fd.Signals, func(i, j int) bool { return fd.Signals[i].StartBit < fd.Signals[j].StartBit })
+	return fd, nil
+}
+
+// kcdSignal converts a Signal or Multiplex element. ok is false for float
+// signals.
+func kcdSignal(fd FrameDef, s *xmlNode) (def SignalDef, ok bool, err error) {
+	name := s.Attr("name")
+	offset, err := strconv.Atoi(s.Attr("offset"))
+	if err != nil {
+		return def, false, fmt.Errorf("signal %s: bad offset %q", name, s.Attr("offset"))
+	}
+	length := 1
+	if l := s.Attr("length"); l != "" {
+		if length, err = strconv.Atoi(l); err != nil {
+			return def, false, fmt.Errorf("signal %s: bad length %q", name, l)
+		}
+	}
+	v := s.Child("Value")
+	switch v.Attr("type") {
+	case "single", "double":
+		return def, false, nil
+	}
+	if offset < 0 || length < 1 || offset+length > 64 {
+		return def, false, fmt.Errorf("signal %s: bits %d+%d outside the payload", name, offset, length)
+	}
+
+	def = SignalDef{
+		FrameID:    fd.ID,
+		FrameName:  fd.Name,
+		SignalName: name,
+		StartBit:   uint8(offset),
+		BitLength:  uint8(length),
+		Endianness: EndianLittle,
+		Factor:     1,
+		Comment:    strings.TrimSpace(s.Value("Notes")),
+	}
+	// KCD numbers big endian signals from the MSB of byte 0; DBC, and
+	// SignalDef, start at the signal's MSB in LSB-first byte order.
+	if s.Attr("endianess") == "big" {
+		def.Endianness = EndianBig
+		def.StartBit = uint8(8*(offset/8) + 7 - offset%8)
+	}
+
+	def.Signed = v.Attr("type") == "signed"
+	num := func(attr string, dst *float64) (bool, error) {
+		a := v.Attr(attr)
+		if a == "" {
+			return false, nil
+		}
+		f, err := strconv.ParseFloat(a, 64)
+		if err != nil {
+			return false, fmt.Errorf("signal %s: bad %s %q", name, attr, a)
+		}
+		*dst = f
+		return true, nil
+	}
+	if _, err := num("slope", &def.Factor); err != nil {
+		return def, false, err
+	}
+	if _, err := num("intercept", &def.Offset); err != nil {
+		return def, false, err
+	}
+	hasMin, err := num("min", &def.Min)
+	if err != nil {
+		return def, false, err
+	}
+	hasMax, err := num("max", &def.Max)
+	if err != nil {
+		return def, false, err
+	}
+	def.HasRange = hasMin && hasMax
+	def.Unit = v.Attr("unit")
+	return def, true, nil
+}
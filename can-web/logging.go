@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// LogConfig selects the log level (debug, info, warn, error) and format
+// (text or json). Debug adds a line per decoded signal.
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// logOut is where the default logger writes. The terminal dashboard swaps
+// it to keep log lines off the screen.
+var logOut = &swapWriter{w: os.Stderr}
+
+type swapWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *swapWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// redirect sends log output to w until the returned func is called.
+func (s *swapWriter) redirect(w io.Writer) (restore func()) {
+	s.mu.Lock()
+	prev := s.w
+	s.w = w
+	s.mu.Unlock()
+	return func() {
+		s.mu.Lock()
+		s.w = prev
+		s.mu.Unlock()
+	}
+}
+
+// setupLogging installs the default slog logger. Every record carries the
+// interface name; the standard log package is routed through it too, so
+// library output ends up in the same format.
+func setupLogging(c LogConfig, iface string) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return fmt.Errorf("log level %q: want debug, info, warn or error", c.Level)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch strings.ToLower(c.Format) {
+	case "", "text":
+		h = slog.NewTextHandler(logOut, opts)
+	case "json":
+		h = slog.NewJSONHandler(logOut, opts)
+	default:
+		return fmt.Errorf("log format %q: want text or json", c.Format)
+	}
+	slog.SetDefault(slog.New(h).With("iface", iface))
+	return nil
+}
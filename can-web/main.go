@@ -2,52 +2,255 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
+const usage = `usage: can-web [command] [flags] [args]
+
+commands:
+  serve                 run the web server (default)
+  replay <logfile>      run the web server on frames replayed from a trace file
+  dump [logfile]        decode frames to stdout without HTTP
+  validate-map <file>   load a CSV, DBC, ARXML or KCD map and report problems
+
+Run "can-web <command> -h" for the flags of a command.
+`
+
 func main() {
-	iface := getenv("CAN_IFACE", "vcan0")
-	addr := getenv("HTTP_ADDR", "127.0.0.1:8080")
-	mapPath := getenv("CAN_MAP", "can_map.csv")
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "serve":
+		err = cmdServe(args)
+	case "replay":
+		err = cmdReplay(args)
+	case "dump":
+		err = cmdDump(args)
+	case "validate-map":
+		err = cmdValidateMap(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		slog.Error(cmd+" failed", "err", err)
+		os.Exit(1)
+	}
+}
 
-	frames, err := LoadCANMap(mapPath)
+func cmdServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to YAML config file (env vars override it)")
+	fs.Parse(args)
+
+	cfg, err := LoadConfig(*configPath)
 	if err != nil {
-		log.Fatalf("failed to load can map: %v", err)
+		return fmt.Errorf("failed to load config: %w", err)
 	}
+	return serve(cfg)
+}
 
-	store := NewStore(200)
+func cmdReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	configPath := fs.String("config", "", "path to YAML config file (env vars override it)")
+	speed := fs.Float64("speed", 1, "playback speed factor (0 = as fast as possible)")
+	loop := fs.Bool("loop", false, "restart from the beginning at end of file")
+	channel := fs.String("channel", "", "replay only this interface of a multi-channel log, e.g. can1")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: can-web replay [flags] <logfile>")
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	cfg.Source = "replay"
+	cfg.Iface = "replay"
+	cfg.Replay.File = fs.Arg(0)
+	cfg.Replay.Speed = *speed
+	cfg.Replay.Loop = *loop
+	cfg.Replay.Channel = *channel
+	return serve(cfg)
+}
+
+// serve runs the frame source, the optional terminal dashboard and the web
+// server until SIGINT/SIGTERM.
+func serve(cfg Config) error {
+	if err := setupLogging(cfg.Log, cfg.Iface); err != nil {
+		return err
+	}
+	app, err := NewApp(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to start: %w", err)
+	}
+	runSource, err := NewSource(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	// Stop on Ctrl+C
+	if app.Telemetry, err = StartTelemetry(ctx, cfg.Telemetry, app); err != nil {
+		return err
+	}
+	for _, b := range app.Buses[1:] {
+		b.Telemetry = app.Telemetry
+	}
+
+	// History, sinks and alerts consume what the source decodes, so they
+	// keep running until the source has stopped and then drain their queues.
+	drainCtx, stopDrain := context.WithCancel(context.Background())
+	defer stopDrain()
+
+	// Start one frame source per bus. A replay reads every bus from the
+	// one log, so it runs on the first bus only.
+	buses := app.Buses
+	if cfg.Source == "replay" {
+		buses = buses[:1]
+	}
+	var sources sync.WaitGroup
+	for _, b := range buses {
+		sources.Add(1)
+		go func() {
+			defer sources.Done()
+			if err := runSource(ctx, b); err != nil {
+				slog.Error("CAN reader stopped", "bus", b.Iface, "err", err)
+				cancel()
+			}
+		}()
+	}
+	sourceDone := doneWhen(sources.Wait)
+
+	var consumers sync.WaitGroup
+	consumers.Add(3)
+	go func() {
+		defer consumers.Done()
+		app.Alerts.Run(drainCtx)
+	}()
 	go func() {
-		ch := make(chan os.Signal, 1)
-		signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
-		<-ch
-		cancel()
+		defer consumers.Done()
+		app.History.Run(drainCtx)
 	}()
+	go func() {
+		defer consumers.Done()
+		app.Sinks.Run(drainCtx, app.Buses)
+	}()
+	for _, b := range app.Buses {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			b.StoreSync.Run(drainCtx)
+		}()
+	}
 
-	// Start CAN reader
+	var servers sync.WaitGroup
+
+	// Optional gateway to a second interface
+	servers.Add(1)
 	go func() {
-		if err := RunCANReader(ctx, iface, frames, store); err != nil {
-			log.Printf("CAN reader stopped: %v", err)
-			cancel()
-		}
+		defer servers.Done()
+		app.Gateway.Run(ctx)
 	}()
 
+	// Optional gRPC API
+	if cfg.GRPC.Addr != "" {
+		servers.Add(1)
+		go func() {
+			defer servers.Done()
+			if err := StartGRPCServer(ctx, cfg.GRPC.Addr, cfg.HTTP, app); err != nil {
+				slog.Error("gRPC server failed", "err", err)
+				cancel()
+			}
+		}()
+	}
+
+	// Optional terminal dashboard
+	if cfg.TUI {
+		servers.Add(1)
+		go func() {
+			defer servers.Done()
+			RunTUI(ctx, app, 500*time.Millisecond)
+		}()
+	}
+
 	// Start web server (blocks)
-	if err := StartWebServer(ctx, addr, iface, store); err != nil {
-		log.Fatalf("web server error: %v", err)
+	err = StartWebServer(ctx, cfg.HTTP, app)
+
+	// Shut down in dependency order: stop receiving, decode what is queued,
+	// flush the recording, then let the consumers drain. A second signal
+	// exits immediately.
+	slog.Info("shutting down")
+	cancel()
+	app.UDS.Close()
+	app.Generator.Close()
+	app.Sequencer.Close()
+	waitShutdown("frame source", sourceDone)
+	waitShutdown("decoder", doneWhen(func() {
+		for _, b := range app.Buses {
+			b.Decoder.Close()
+		}
+	}))
+	if app.Sessions.Active() != "" {
+		if _, err := stopSession(app); err != nil {
+			slog.Error("ending session failed", "err", err)
+		}
+	}
+	if err := app.Recorder.Close(); err != nil {
+		slog.Error("closing recording failed", "err", err)
 	}
+	if err := app.Audit.Close(); err != nil {
+		slog.Error("closing audit log failed", "err", err)
+	}
+	stopDrain()
+	waitShutdown("history, sinks, alerts and store", doneWhen(consumers.Wait))
+	waitShutdown("gateway, gRPC server and dashboard", doneWhen(servers.Wait))
+	flushCtx, stopFlush := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := app.Telemetry.Shutdown(flushCtx); err != nil {
+		slog.Error("flushing telemetry failed", "err", err)
+	}
+	stopFlush()
+	if err != nil {
+		return fmt.Errorf("web server error: %w", err)
+	}
+	return nil
 }
 
-func getenv(k, def string) string {
-	if v := os.Getenv(k); v != "" {
-		return v
+// shutdownTimeout bounds each shutdown stage so one stuck goroutine cannot
+// hold up the exit.
+const shutdownTimeout = 5 * time.Second
+
+func waitShutdown(what string, done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		slog.Warn("shutdown timed out", "waiting_for", what)
 	}
-	return def
+}
+
+// doneWhen runs f in the background and closes the returned channel when
+// it returns.
+func doneWhen(f func()) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+	return done
 }
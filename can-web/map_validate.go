@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"sort"
+)
+
+// MapWarning is a problem in a CAN map that does not stop it from loading
+// but makes some signals decode to nonsense.
+type MapWarning struct {
+	FrameID string `json:"frame_id"`
+	Frame   string `json:"frame"`
+	Signal  string `json:"signal,omitempty"`
+	Kind    string `json:"kind"` // overlap, dlc, endianness, duplicate or frame_name
+	Message string `json:"message"`
+}
+
+// MapReport summarises a map and its warnings, for validate-map -json and
+// /api/map/validation.
+type MapReport struct {
+	Profile  string       `json:"profile,omitempty"`
+	Frames   int          `json:"frames"`
+	Signals  int          `json:"signals"`
+	Warnings []MapWarning `json:"warnings"`
+}
+
+func newMapReport(defs map[uint32]FrameDef, warnings []MapWarning) MapReport {
+	r := MapReport{Frames: len(defs), Warnings: warnings}
+	for _, fd := range defs {
+		r.Signals += len(fd.Signals)
+	}
+	if r.Warnings == nil {
+		r.Warnings = []MapWarning{}
+	}
+	return r
+}
+
+// ValidateMap checks every frame of defs for signals sharing bits, signals
+// reaching past the DLC, unknown byte orders, duplicate signal names and
+// rows naming the frame differently. Multiplexed signals of different switch values may share
+// bits. Warnings are ordered by frame ID.
+func ValidateMap(defs map[uint32]FrameDef) []MapWarning {
+	ids := make([]uint32, 0, len(defs))
+	for id := range defs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var out []MapWarning
+	for _, id := range ids {
+		fd := defs[id]
+		warn := func(signal, kind, format string, args ...any) {
+			out = append(out, MapWarning{
+				FrameID: canIDString(id, id > 0x7FF),
+				Frame:   fd.Name,
+				Signal:  signal,
+				Kind:    kind,
+				Message: fmt.Sprintf(format, args...),
+			})
+		}
+
+		seen := make(map[string]bool)
+		names := make(map[string]bool)
+		masks := make([]uint64, len(fd.Signals))
+		for i, s := range fd.Signals {
+			if seen[s.SignalName] {
+				warn(s.SignalName, "duplicate", "signal %s is defined more than once", s.SignalName)
+			}
+			seen[s.SignalName] = true
+			if s.FrameName != "" && s.FrameName != fd.Name && !names[s.FrameName] {
+				names[s.FrameName] = true
+				warn(s.SignalName, "frame_name", "frame is also named %s", s.FrameName)
+			}
+
+			if s.Endianness != EndianLittle && s.Endianness != EndianBig {
+				warn(s.SignalName, "endianness", "endianness %q is neither little nor big", s.Endianness)
+			}
+			m, ok := signalBits(s)
+			if !ok {
+				warn(s.SignalName, "dlc", "bits do not fit in a frame (start %d, length %d)", s.StartBit, s.BitLength)
+				continue
+			}
+			masks[i] = m
+			if need := (63-bits.LeadingZeros64(m))/8 + 1; need > int(fd.DLC) {
+				warn(s.SignalName, "dlc", "needs %d bytes, DLC is %d", need, fd.DLC)
+			}
+			for j, o := range fd.Signals[:i] {
+				if masks[j]&m == 0 || (s.Muxed && o.Muxed && s.MuxValue != o.MuxValue) {
+					continue
+				}
+				warn(s.SignalName, "overlap", "shares %d bits with %s", bits.OnesCount64(masks[j]&m), o.SignalName)
+			}
+		}
+		for _, d := range fd.Derived {
+			if seen[d.Name] {
+				warn(d.Name, "duplicate", "signal %s is defined more than once", d.Name)
+			}
+			seen[d.Name] = true
+		}
+	}
+	return out
+}
+
+// signalBits returns the payload bits of s, bit i being bit i%8 of byte
+// i/8. ok is false for an empty field or one that does not fit in 8 bytes.
+func signalBits(s SignalDef) (mask uint64, ok bool) {
+	n := int(s.BitLength)
+	if n == 0 {
+		return 0, false
+	}
+	if s.Endianness == EndianBig {
+		// Motorola: the start bit is the MSB and the field runs towards
+		// the LSB across bytes in increasing order.
+		msb := bigEndianIndex(int(s.StartBit))
+		if s.StartBit >= 64 || msb-n+1 < 0 {
+			return 0, false
+		}
+		for p := msb - n + 1; p <= msb; p++ {
+			mask |= 1 << bigEndianIndex(p)
+		}
+		return mask, true
+	}
+	if int(s.StartBit)+n > 64 {
+		return 0, false
+	}
+	if n == 64 {
+		return ^uint64(0), true
+	}
+	return (1<<n - 1) << s.StartBit, true
+}
+
+// signalBytes returns the number of payload bytes s needs, without building
+// its mask as signalBits does, as it is checked for every frame decoded.
+func signalBytes(s SignalDef) (int, bool) {
+	n := int(s.BitLength)
+	if n == 0 {
+		return 0, false
+	}
+	if s.Endianness == EndianBig {
+		lsb := bigEndianIndex(int(s.StartBit)) - n + 1
+		if s.StartBit >= 64 || lsb < 0 {
+			return 0, false
+		}
+		return bigEndianIndex(lsb)/8 + 1, true
+	}
+	if int(s.StartBit)+n > 64 {
+		return 0, false
+	}
+	return (int(s.StartBit)+n-1)/8 + 1, true
+}
+
+// bigEndianIndex maps a bit index between the byte-wise numbering and the
+// position in the payload read as one big-endian integer; it is its own
+// inverse.
+func bigEndianIndex(i int) int {
+	return (7-i/8)*8 + i%8
+}
+
+// logMapWarnings logs the warnings of a freshly loaded map.
+func logMapWarnings(source string, warnings []MapWarning) {
+	for _, w := range warnings {
+		slog.Warn("map warning", "map", source, "id", w.FrameID, "frame", w.Frame, "signal", w.Signal, "kind", w.Kind, "msg", w.Message)
+	}
+}
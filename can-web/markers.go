@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type Marker struct {
+	TS    time.Time `json:"ts"`
+	Label string    `json:"label"`
+}
+
+// MarkerLog keeps the most recent event markers injected by operators or
+// external orchestrators.
+type MarkerLog struct {
+	mu       sync.Mutex
+	items    []Marker
+	capacity int
+}
+
+func NewMarkerLog(capacity int) *MarkerLog {
+	return &MarkerLog{capacity: capacity}
+}
+
+func (m *MarkerLog) Add(label string, ts time.Time) Marker {
+	mk := Marker{TS: ts, Label: label}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items = append(m.items, mk)
+	if len(m.items) > m.capacity {
+		m.items = m.items[len(m.items)-m.capacity:]
+	}
+	return mk
+}
+
+func (m *MarkerLog) List() []Marker {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Marker, len(m.items))
+	copy(out, m.items)
+	return out
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// frameSeq calls yield for each frame of a trace in order, stopping at the
+// first error.
+type frameSeq func(yield func(LogFrame) error) error
+
+// logFileFrames reads the frames of a trace file; the file is opened anew
+// on every call.
+func logFileFrames(path string) frameSeq {
+	return func(yield func(LogFrame) error) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		parse := newTraceLineParser(path)
+		sc := bufio.NewScanner(f)
+		for n := 1; sc.Scan(); n++ {
+			lf, ok, err := parse(sc.Text())
+			if err != nil {
+				return fmt.Errorf("line %d: %w", n, err)
+			}
+			if ok {
+				if err := yield(lf); err != nil {
+					return err
+				}
+			}
+		}
+		return sc.Err()
+	}
+}
+
+func sliceFrames(frames []LogFrame) frameSeq {
+	return func(yield func(LogFrame) error) error {
+		for _, lf := range frames {
+			if err := yield(lf); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// mdfBlock is one MDF4 block. Links point at other blocks and are resolved
+// to file offsets when the file is laid out. A block with dataLen set has
+// its data written separately (DT blocks).
+type mdfBlock struct {
+	id      string
+	links   []*mdfBlock
+	data    []byte
+	dataLen uint64
+	off     uint64
+}
+
+func (b *mdfBlock) size() uint64 {
+	n := b.dataLen
+	if b.data != nil {
+		n = uint64(len(b.data))
+	}
+	return 24 + 8*uint64(len(b.links)) + n
+}
+
+func (b *mdfBlock) header() []byte {
+	out := make([]byte, 24+8*len(b.links), 24+8*len(b.links)+len(b.data))
+	copy(out, "##"+b.id)
+	binary.LittleEndian.PutUint64(out[8:], b.size())
+	binary.LittleEndian.PutUint64(out[16:], uint64(len(b.links)))
+	for i, l := range b.links {
+		if l != nil {
+			binary.LittleEndian.PutUint64(out[24+8*i:], l.off)
+		}
+	}
+	return append(out, b.data...)
+}
+
+// mdfText is a TX block: zero terminated UTF-8, padded to 8 bytes.
+func mdfText(s string) *mdfBlock {
+	n := (len(s) + 8) &^ 7
+	data := make([]byte, n)
+	copy(data, s)
+	return &mdfBlock{id: "TX", data: data}
+}
+
+func mdfMeta(xml string) *mdfBlock {
+	b := mdfText(xml)
+	b.id = "MD"
+	return b
+}
+
+// MDF4 channel constants.
+const (
+	mdfUintLE    = 0
+	mdfFloatLE   = 4
+	mdfByteArray = 10
+
+	mdfChannelFixed  = 0
+	mdfChannelMaster = 2
+	mdfSyncTime      = 1
+
+	mdfFlagBusEvent = 1 << 10 // cn_flags
+	mdfCGBusEvent   = 1 << 1  // cg_flags
+)
+
+type mdfChannel struct {
+	name, unit, comment string
+	dataType            byte
+	master              bool
+	byteOff             uint32
+	bitOff              byte
+	bits                uint32
+	flags               uint32
+	children            []mdfChannel // composition
+}
+
+func (c mdfChannel) block() *mdfBlock {
+	data := make([]byte, 72)
+	data[0] = mdfChannelFixed
+	if c.master {
+		data[0], data[1] = mdfChannelMaster, mdfSyncTime
+	}
+	data[2] = c.dataType
+	data[3] = c.bitOff
+	binary.LittleEndian.PutUint32(data[4:], c.byteOff)
+	binary.LittleEndian.PutUint32(data[8:], c.bits)
+	binary.LittleEndian.PutUint32(data[12:], c.flags)
+	// cn_cn_next, cn_composition, cn_tx_name, cn_si_source,
+	// cn_cc_conversion, cn_data, cn_md_unit, cn_md_comment
+	b := &mdfBlock{id: "CN", links: make([]*mdfBlock, 8), data: data}
+	b.links[2] = mdfText(c.name)
+	if c.unit != "" {
+		b.links[6] = mdfText(c.unit)
+	}
+	if c.comment != "" {
+		b.links[7] = mdfText(c.comment)
+	}
+	b.links[1] = mdfChannelList(c.children)
+	return b
+}
+
+// mdfChannelList chains channels through cn_cn_next and returns the first.
+func mdfChannelList(chs []mdfChannel) *mdfBlock {
+	var first, prev *mdfBlock
+	for _, c := range chs {
+		b := c.block()
+		if prev == nil {
+			first = b
+		} else {
+			prev.links[0] = b
+		}
+		prev = b
+	}
+	return first
+}
+
+// mdfGroup is one data group with a single channel group of fixed size
+// records.
+type mdfGroup struct {
+	name    string
+	recSize int
+	count   uint64
+	source  *mdfBlock
+	flags   uint16
+	chans   []mdfChannel
+	dt      *mdfBlock
+	w       *bufio.Writer
+}
+
+func (g *mdfGroup) blocks() *mdfBlock {
+	cg := make([]byte, 32)
+	binary.LittleEndian.PutUint64(cg[8:], g.count)
+	binary.LittleEndian.PutUint16(cg[16:], g.flags)
+	binary.LittleEndian.PutUint16(cg[18:], '.')
+	binary.LittleEndian.PutUint32(cg[24:], uint32(g.recSize))
+	// cg_cg_next, cg_cn_first, cg_tx_acq_name, cg_si_acq_source,
+	// cg_sr_first, cg_md_comment
+	cgb := &mdfBlock{id: "CG", links: []*mdfBlock{nil, mdfChannelList(g.chans), mdfText(g.name), g.source, nil, nil}, data: cg}
+	g.dt = &mdfBlock{id: "DT", dataLen: g.count * uint64(g.recSize)}
+	// dg_dg_next, dg_cg_first, dg_data, dg_md_comment
+	return &mdfBlock{id: "DG", links: []*mdfBlock{nil, cgb, g.dt, nil}, data: make([]byte, 8)}
+}
+
+// canDataFrameChannels is the ASAM bus logging layout of a CAN data frame
+// record: Timestamp, then CAN_DataFrame with its members.
+var canDataFrameChannels = []mdfChannel{
+	{name: "Timestamp", unit: "s", dataType: mdfFloatLE, master: true, bits: 64},
+	{name: "CAN_DataFrame", dataType: mdfByteArray, byteOff: 8, bits: 128, flags: mdfFlagBusEvent, children: []mdfChannel{
+		{name: "CAN_DataFrame.BusChannel", dataType: mdfUintLE, byteOff: 8, bits: 8, flags: mdfFlagBusEvent},
+		{name: "CAN_DataFrame.ID", dataType: mdfUintLE, byteOff: 9, bits: 29, flags: mdfFlagBusEvent},
+		{name: "CAN_DataFrame.IDE", dataType: mdfUintLE, byteOff: 12, bitOff: 7, bits: 1, flags: mdfFlagBusEvent},
+		{name: "CAN_DataFrame.DLC", dataType: mdfUintLE, byteOff: 13, bits: 4, flags: mdfFlagBusEvent},
+		{name: "CAN_DataFrame.DataLength", dataType: mdfUintLE, byteOff: 14, bits: 8, flags: mdfFlagBusEvent},
+		{name: "CAN_DataFrame.DataBytes", dataType: mdfByteArray, byteOff: 16, bits: 64, flags: mdfFlagBusEvent},
+	}},
+}
+
+// WriteMF4 writes frames as an ASAM MDF 4.10 file: the raw data frames as
+// a CAN_DataFrame bus logging group, plus one group per mapped frame ID
+// with its signals decoded by defs as float64 channels. Time is seconds
+// since the first frame, whose wall time is the file's start time. frames
+// is read twice. Remote frames are left out.
+func WriteMF4(w io.WriterAt, frames frameSeq, defs map[uint32]FrameDef) error {
+	match := newFrameMatcher(defs)
+
+	// first pass: record counts per group and the start time
+	var start time.Time
+	var raw uint64
+	counts := make(map[uint32]uint64)
+	buses := make(map[string]byte)
+	err := frames(func(lf LogFrame) error {
+		if lf.Frame.IsRemote {
+			return nil
+		}
+		if raw == 0 {
+			start = lf.TS
+		}
+		raw++
+		if _, ok := buses[lf.Iface]; !ok {
+			buses[lf.Iface] = byte(len(buses) + 1)
+		}
+		if def, ok := match.Lookup(lf.Frame.ID); ok && len(def.Signals) > 0 {
+			counts[lf.Frame.ID]++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if raw == 0 {
+		return errors.New("no data frames to export")
+	}
+
+	si := make([]byte, 8)
+	si[0], si[1] = 2, 2 // BUS, CAN
+	rawGroup := &mdfGroup{
+		name:    "CAN_DataFrame",
+		recSize: 24,
+		count:   raw,
+		flags:   mdfCGBusEvent,
+		source:  &mdfBlock{id: "SI", links: []*mdfBlock{mdfText("CAN"), nil, nil}, data: si},
+		chans:   canDataFrameChannels,
+	}
+	groups := []*mdfGroup{rawGroup}
+	byID := make(map[uint32]*mdfGroup)
+	ids := make([]uint32, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		def, _ := match.Lookup(id)
+		g := &mdfGroup{name: def.Name, recSize: 8 * (1 + len(def.Signals)), count: counts[id]}
+		g.chans = append(g.chans, mdfChannel{name: "t", unit: "s", dataType: mdfFloatLE, master: true, bits: 64})
+		for i, s := range def.Signals {
+			g.chans = append(g.chans, mdfChannel{name: s.SignalName, unit: s.Unit, comment: s.Comment, dataType: mdfFloatLE, byteOff: uint32(8 * (i + 1)), bits: 64})
+		}
+		groups = append(groups, g)
+		byID[id] = g
+	}
+
+	// layout: ID block, metadata, then the DT blocks
+	hd := make([]byte, 32)
+	binary.LittleEndian.PutUint64(hd, uint64(start.UnixNano()))
+	fh := make([]byte, 16)
+	binary.LittleEndian.PutUint64(fh, uint64(time.Now().UnixNano()))
+	fhComment := mdfMeta("<FHcomment><TX>exported from a can-web recording</TX><tool_id>can-web</tool_id><tool_vendor>can-web</tool_vendor><tool_version>1</tool_version></FHcomment>")
+	// hd_dg_first, hd_fh_first, hd_ch_tree, hd_at_first, hd_ev_first,
+	// hd_md_comment
+	hdb := &mdfBlock{id: "HD", links: []*mdfBlock{nil, {id: "FH", links: []*mdfBlock{nil, fhComment}, data: fh}, nil, nil, nil, nil}, data: hd}
+	var prev *mdfBlock
+	for _, g := range groups {
+		dg := g.blocks()
+		if prev == nil {
+			hdb.links[0] = dg
+		} else {
+			prev.links[0] = dg
+		}
+		prev = dg
+	}
+
+	var meta, dts []*mdfBlock
+	var collect func(b *mdfBlock)
+	seen := make(map[*mdfBlock]bool)
+	collect = func(b *mdfBlock) {
+		if b == nil || seen[b] {
+			return
+		}
+		seen[b] = true
+		if b.id == "DT" {
+			dts = append(dts, b)
+		} else {
+			meta = append(meta, b)
+		}
+		for _, l := range b.links {
+			collect(l)
+		}
+	}
+	collect(hdb)
+	off := uint64(64)
+	for _, b := range append(meta, dts...) {
+		b.off = off
+		off += b.size()
+	}
+
+	id := make([]byte, 64)
+	copy(id, "MDF     4.10    can-web ")
+	binary.LittleEndian.PutUint16(id[28:], 410)
+	if _, err := w.WriteAt(id, 0); err != nil {
+		return err
+	}
+	for _, b := range append(meta, dts...) {
+		if _, err := w.WriteAt(b.header(), int64(b.off)); err != nil {
+			return err
+		}
+	}
+
+	// second pass: records
+	for _, g := range groups {
+		g.w = bufio.NewWriterSize(io.NewOffsetWriter(w, int64(g.dt.off)+24), 64<<10)
+	}
+	recSize := 0
+	for _, g := range groups {
+		recSize = max(recSize, g.recSize)
+	}
+	rec := make([]byte, recSize)
+	err = frames(func(lf LogFrame) error {
+		f := lf.Frame
+		if f.IsRemote {
+			return nil
+		}
+		t := math.Float64bits(lf.TS.Sub(start).Seconds())
+
+		r := rec[:24]
+		clear(r)
+		binary.LittleEndian.PutUint64(r, t)
+		r[8] = buses[lf.Iface]
+		binary.LittleEndian.PutUint32(r[9:], f.ID)
+		if f.IsExtended {
+			r[12] |= 0x80
+		}
+		r[13], r[14] = f.Length, f.Length
+		copy(r[16:], f.Data[:f.Length])
+		if _, err := rawGroup.w.Write(r); err != nil {
+			return err
+		}
+
+		g, ok := byID[f.ID]
+		if !ok {
+			return nil
+		}
+		def, _ := match.Lookup(f.ID)
+		sigs := def.Signals
+		r = rec[:g.recSize]
+		binary.LittleEndian.PutUint64(r, t)
+		for i, s := range sigs {
+			v := math.NaN() // multiplexed signal the switch did not select
+			if !s.Muxed || s.MuxValue == uint64(rawSignal(f.Data, *def.Mux)) {
+				v = clampFinite(decodeSignal(f.Data, s))
+			}
+			binary.LittleEndian.PutUint64(r[8*(i+1):], math.Float64bits(v))
+		}
+		_, err := g.w.Write(r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if err := g.w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
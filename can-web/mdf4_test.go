@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+// A frame with more signals than fit the raw group's record must still be
+// exported, one float64 per signal after the time channel.
+func TestWriteMF4ManySignals(t *testing.T) {
+	const nsig = 80
+	def := FrameDef{ID: 0x123, Name: "WIDE", DLC: 8}
+	for i := range nsig {
+		def.Signals = append(def.Signals, SignalDef{
+			FrameID: 0x123, FrameName: "WIDE", SignalName: "s" + string(rune('A'+i/26)) + string(rune('a'+i%26)),
+			StartBit: uint8(i % 64), BitLength: 1, Endianness: EndianLittle, Factor: 1,
+		})
+	}
+	start := time.Unix(1700000000, 0)
+	frames := []LogFrame{
+		{TS: start, Iface: "can0", Frame: can.Frame{ID: 0x123, Length: 8, Data: can.Data{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}}},
+		{TS: start.Add(time.Second), Iface: "can0", Frame: can.Frame{ID: 0x123, Length: 8, Data: can.Data{0x01}}},
+	}
+
+	path := filepath.Join(t.TempDir(), "wide.mf4")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := WriteMF4(f, sliceFrames(frames), map[uint32]FrameDef{0x123: def}); err != nil {
+		t.Fatalf("WriteMF4: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Find the signal group's data block by its length: a 24-byte header and
+	// one record per frame.
+	recSize := 8 * (1 + nsig)
+	var last []byte
+	for i := 0; i+24 <= len(b); i += 8 {
+		if string(b[i:i+4]) == "##DT" && binary.LittleEndian.Uint64(b[i+8:]) == uint64(24+2*recSize) {
+			last = b[i+24+recSize : i+24+2*recSize]
+			break
+		}
+	}
+	if last == nil {
+		t.Fatalf("no data block with two %d-byte records", recSize)
+	}
+	if ts := math.Float64frombits(binary.LittleEndian.Uint64(last)); ts != 1 {
+		t.Errorf("last record time = %g, want 1", ts)
+	}
+	for i := range nsig {
+		want := 0.0
+		if i%64 == 0 {
+			want = 1
+		}
+		if got := math.Float64frombits(binary.LittleEndian.Uint64(last[8*(i+1):])); got != want {
+			t.Errorf("signal %d = %g, want %g", i, got, want)
+		}
+	}
+}
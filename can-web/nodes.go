@@ -0,0 +1,113 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// nodeDefaultTimeout is how long a node whose frames have no cycle time
+// may stay quiet before it is reported stale.
+const nodeDefaultTimeout = time.Second
+
+// NodeStatus is the liveness of one ECU, from the frames the map says it
+// sends.
+type NodeStatus struct {
+	Node         string     `json:"node"`
+	State        string     `json:"state"`   // alive, stale or silent (never seen)
+	Defined      int        `json:"defined"` // frame definitions sent by the node
+	Frames       int        `json:"frames"`  // distinct IDs received from it
+	Count        uint64     `json:"count"`
+	FramesPerSec float64    `json:"frames_per_sec"`
+	LastSeen     *time.Time `json:"last_seen,omitempty"`
+	AgeMs        *float64   `json:"age_ms,omitempty"`
+	Late         []string   `json:"late,omitempty"` // cyclic frames not seen for 3 cycles
+}
+
+// Nodes summarises the received frames per sending node of defs. A node is
+// stale once its last frame is older than three times its shortest cycle
+// time, or nodeDefaultTimeout when none of its frames is cyclic.
+func (c *FrameCache) Nodes(defs map[uint32]FrameDef, now time.Time) []NodeStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	byNode := make(map[string]*NodeStatus)
+	timeout := make(map[string]time.Duration)
+	for _, fd := range defs {
+		if fd.Node == "" {
+			continue
+		}
+		ns, ok := byNode[fd.Node]
+		if !ok {
+			ns = &NodeStatus{Node: fd.Node}
+			byNode[fd.Node] = ns
+		}
+		ns.Defined++
+		if fd.CycleMs > 0 {
+			t := 3 * time.Duration(fd.CycleMs) * time.Millisecond
+			if cur, ok := timeout[fd.Node]; !ok || t < cur {
+				timeout[fd.Node] = t
+			}
+		}
+	}
+
+	// last frame per definition, keyed like defs
+	lastByDef := make(map[uint32]time.Time)
+	match := newFrameMatcher(defs)
+	for k, e := range c.entries {
+		id := k.id
+		fd, ok := match.Lookup(id)
+		if !ok || fd.Node == "" {
+			continue
+		}
+		key := id
+		if fd.Mask != 0 {
+			key = id & fd.Mask
+		}
+		if e.last.After(lastByDef[key]) {
+			lastByDef[key] = e.last
+		}
+
+		ns := byNode[fd.Node]
+		ns.Frames++
+		ns.Count += e.count
+		if span := e.last.Sub(e.first).Seconds(); e.count > 1 && span > 0 {
+			ns.FramesPerSec += float64(e.count-1) / span
+		}
+		if ns.LastSeen == nil || e.last.After(*ns.LastSeen) {
+			t := e.last
+			ns.LastSeen = &t
+		}
+	}
+
+	for key, fd := range defs {
+		if fd.Node == "" || fd.CycleMs <= 0 {
+			continue
+		}
+		if now.Sub(lastByDef[key]) > 3*time.Duration(fd.CycleMs)*time.Millisecond {
+			byNode[fd.Node].Late = append(byNode[fd.Node].Late, fd.Name)
+		}
+	}
+
+	out := make([]NodeStatus, 0, len(byNode))
+	for name, ns := range byNode {
+		sort.Strings(ns.Late)
+		if ns.LastSeen == nil {
+			ns.State = "silent"
+		} else {
+			age := now.Sub(*ns.LastSeen)
+			ms := durMs(age)
+			ns.AgeMs = &ms
+			limit, ok := timeout[name]
+			if !ok {
+				limit = nodeDefaultTimeout
+			}
+			ns.State = "alive"
+			if age > limit {
+				ns.State = "stale"
+			}
+		}
+		out = append(out, *ns)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Node < out[j].Node })
+	return out
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiDoc describes a route for the OpenAPI document. Request and Response
+// are zero values of the body types; their schemas are derived from the
+// struct definitions, so the handlers and the document share one source.
+type apiDoc struct {
+	Methods  []string // default GET
+	Summary  string
+	Params   []apiParam
+	Request  any
+	Response any
+	Produces string // response media type, default application/json
+}
+
+// apiParam is a query parameter. Path parameters come from the pattern.
+type apiParam struct {
+	Name string
+	Desc string
+}
+
+type apiRoute struct {
+	path string
+	role Role
+	doc  apiDoc
+}
+
+// apiSpec collects routes as they are registered and renders them as an
+// OpenAPI 3 document.
+type apiSpec struct {
+	title   string
+	version string
+
+	mu     sync.Mutex
+	routes []apiRoute
+}
+
+func newAPISpec(title, version string) *apiSpec {
+	return &apiSpec{title: title, version: version}
+}
+
+func (s *apiSpec) add(pattern string, role Role, doc apiDoc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = append(s.routes, apiRoute{path: pattern, role: role, doc: doc})
+}
+
+var pathParamRe = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// Document renders the OpenAPI document.
+func (s *apiSpec) Document() map[string]any {
+	s.mu.Lock()
+	routes := append([]apiRoute(nil), s.routes...)
+	s.mu.Unlock()
+
+	g := &schemaGen{defs: map[string]any{}}
+	errorRef := g.schema(reflect.TypeOf(apiError{}))
+	paths := map[string]any{}
+	for _, rt := range routes {
+		item, _ := paths[rt.path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[rt.path] = item
+		}
+
+		var params []any
+		for _, m := range pathParamRe.FindAllStringSubmatch(rt.path, -1) {
+			params = append(params, map[string]any{
+				"name": m[1], "in": "path", "required": true,
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, p := range rt.doc.Params {
+			params = append(params, map[string]any{
+				"name": p.Name, "in": "query", "description": p.Desc,
+				"schema": map[string]any{"type": "string"},
+			})
+		}
+
+		produces := rt.doc.Produces
+		if produces == "" {
+			produces = "application/json"
+		}
+		ok := map[string]any{"description": "OK"}
+		switch {
+		case rt.doc.Response != nil:
+			ok["content"] = map[string]any{produces: map[string]any{"schema": g.schema(reflect.TypeOf(rt.doc.Response))}}
+		case produces != "application/json":
+			ok["content"] = map[string]any{produces: map[string]any{"schema": map[string]any{"type": "string"}}}
+		}
+		errResp := map[string]any{
+			"description": "Error",
+			"content":     map[string]any{"application/json": map[string]any{"schema": errorRef}},
+		}
+
+		methods := rt.doc.Methods
+		if len(methods) == 0 {
+			methods = []string{http.MethodGet}
+		}
+		for _, m := range methods {
+			op := map[string]any{
+				"summary":     rt.doc.Summary,
+				"description": "Requires the " + rt.role.String() + " role.",
+				"responses": map[string]any{
+					"200":     ok,
+					"default": errResp,
+				},
+			}
+			if params != nil {
+				op["parameters"] = params
+			}
+			if rt.doc.Request != nil && m != http.MethodGet {
+				op["requestBody"] = map[string]any{
+					"required": true,
+					"content":  map[string]any{"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(rt.doc.Request))}},
+				}
+			}
+			item[strings.ToLower(m)] = op
+		}
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]any{"title": s.title, "version": s.version},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": g.defs,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+				"basic":  map[string]any{"type": "http", "scheme": "basic"},
+			},
+		},
+		"security": []any{map[string]any{"bearer": []string{}}, map[string]any{"basic": []string{}}},
+	}
+}
+
+func (s *apiSpec) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(s.Document())
+}
+
+// apiError is the body of every error response, see writeError.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// schemaGen derives JSON schemas from Go types the way encoding/json
+// marshals them. Named structs go into components/schemas.
+type schemaGen struct {
+	defs map[string]any
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage(nil))
+)
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawJSONType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Interface:
+		return map[string]any{}
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		s := map[string]any{"type": "array", "items": g.schema(t.Elem())}
+		if t.Kind() == reflect.Array {
+			s["minItems"], s["maxItems"] = t.Len(), t.Len()
+		}
+		return s
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		ref := map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = map[string]any{} // placeholder for recursive types
+			g.defs[t.Name()] = g.object(t)
+		}
+		return ref
+	}
+	return map[string]any{}
+}
+
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	g.fields(t, props, &required)
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+func (g *schemaGen) fields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, props, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
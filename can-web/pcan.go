@@ -0,0 +1,9 @@
+package main
+
+// PCANConfig configures the pcan source: a PEAK-System adapter driven
+// through the PCAN-Basic library, on Windows. The CAN bitrate is the
+// bitrate setting.
+type PCANConfig struct {
+	Channel    string `yaml:"channel"`     // usb1-usb16 or pci1-pci8, default usb1
+	ListenOnly bool   `yaml:"listen_only"` // the adapter neither ACKs nor sends
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"go.einride.tech/can"
+	"golang.org/x/sys/windows"
+)
+
+// PCAN-Basic API constants, from PCANBasic.h.
+const (
+	pcanErrorOK        = 0x00000
+	pcanErrorBusLight  = 0x00004
+	pcanErrorBusHeavy  = 0x00008
+	pcanErrorBusOff    = 0x00010
+	pcanErrorQRcvEmpty = 0x00020
+	pcanErrorQOverrun  = 0x00040
+
+	pcanMsgStandard = 0x00
+	pcanMsgRTR      = 0x01
+	pcanMsgExtended = 0x02
+	pcanMsgErrFrame = 0x40
+	pcanMsgStatus   = 0x80
+
+	pcanReceiveEvent = 0x03
+	pcanListenOnly   = 0x08
+	pcanParamOn      = 0x01
+)
+
+// pcanChannels are the channel handles of the plug-and-play buses.
+var pcanChannels = map[string]uint16{
+	"usb1": 0x51, "usb2": 0x52, "usb3": 0x53, "usb4": 0x54,
+	"usb5": 0x55, "usb6": 0x56, "usb7": 0x57, "usb8": 0x58,
+	"usb9": 0x509, "usb10": 0x50A, "usb11": 0x50B, "usb12": 0x50C,
+	"usb13": 0x50D, "usb14": 0x50E, "usb15": 0x50F, "usb16": 0x510,
+	"pci1": 0x41, "pci2": 0x42, "pci3": 0x43, "pci4": 0x44,
+	"pci5": 0x45, "pci6": 0x46, "pci7": 0x47, "pci8": 0x48,
+}
+
+// pcanBitrates are the BTR0/BTR1 values of the standard bitrates.
+var pcanBitrates = map[int]uint16{
+	1000000: 0x0014, 800000: 0x0016, 500000: 0x001C, 250000: 0x011C,
+	125000: 0x031C, 100000: 0x432F, 50000: 0x472F, 20000: 0x532F, 10000: 0x672F,
+}
+
+var (
+	pcanDLL          = windows.NewLazyDLL("PCANBasic.dll")
+	pcanInitialize   = pcanDLL.NewProc("CAN_Initialize")
+	pcanUninitialize = pcanDLL.NewProc("CAN_Uninitialize")
+	pcanRead         = pcanDLL.NewProc("CAN_Read")
+	pcanWrite        = pcanDLL.NewProc("CAN_Write")
+	pcanSetValue     = pcanDLL.NewProc("CAN_SetValue")
+	pcanGetErrorText = pcanDLL.NewProc("CAN_GetErrorText")
+)
+
+// pcanMsg is TPCANMsg.
+type pcanMsg struct {
+	ID      uint32
+	MsgType byte
+	Len     byte
+	Data    [8]byte
+}
+
+type pcanStatus uint32
+
+func (s pcanStatus) Error() string {
+	var buf [256]byte
+	r, _, _ := pcanGetErrorText.Call(uintptr(s), 0x09, uintptr(unsafe.Pointer(&buf[0])))
+	if r != pcanErrorOK {
+		return fmt.Sprintf("PCAN error 0x%05X", uint32(s))
+	}
+	return windows.ByteSliceToString(buf[:])
+}
+
+// pcanBus reads frames from a PCAN channel and sends frames through it.
+type pcanBus struct {
+	cfg     PCANConfig
+	channel uint16
+	btr     uint16
+	bitrate int
+
+	mu   sync.Mutex
+	open bool
+	app  *App
+}
+
+func init() {
+	registerBackend("pcan", func(cfg Config) (busBackend, error) {
+		return newPCANBus(cfg.PCAN, cfg.Bitrate)
+	})
+}
+
+func newPCANBus(cfg PCANConfig, bitrate int) (*pcanBus, error) {
+	b := &pcanBus{cfg: cfg, bitrate: bitrate}
+	var ok bool
+	if b.channel, ok = pcanChannels[strings.ToLower(cfg.Channel)]; !ok {
+		n, err := strconv.ParseUint(cfg.Channel, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("pcan: unknown channel %q (want usb1-usb16, pci1-pci8 or a channel handle)", cfg.Channel)
+		}
+		b.channel = uint16(n)
+	}
+	if b.btr, ok = pcanBitrates[bitrate]; !ok {
+		return nil, fmt.Errorf("pcan: bitrate %d not supported", bitrate)
+	}
+	if err := pcanDLL.Load(); err != nil {
+		return nil, fmt.Errorf("pcan: %w (install the PCAN-Basic driver package)", err)
+	}
+	return b, nil
+}
+
+func (b *pcanBus) session(ctx context.Context, app *App) error {
+	if b.cfg.ListenOnly {
+		// Has to be set before the channel is initialized.
+		on := uint32(pcanParamOn)
+		pcanSetValue.Call(uintptr(b.channel), pcanListenOnly, uintptr(unsafe.Pointer(&on)), unsafe.Sizeof(on))
+	}
+	if r, _, _ := pcanInitialize.Call(uintptr(b.channel), uintptr(b.btr), 0, 0, 0); r != pcanErrorOK {
+		return fmt.Errorf("pcan initialize %s: %w", b.cfg.Channel, pcanStatus(r))
+	}
+	defer pcanUninitialize.Call(uintptr(b.channel))
+
+	ev, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		return fmt.Errorf("pcan: %w", err)
+	}
+	defer windows.CloseHandle(ev)
+	h := uintptr(ev)
+	if r, _, _ := pcanSetValue.Call(uintptr(b.channel), pcanReceiveEvent, uintptr(unsafe.Pointer(&h)), unsafe.Sizeof(h)); r != pcanErrorOK {
+		return fmt.Errorf("pcan receive event: %w", pcanStatus(r))
+	}
+
+	b.mu.Lock()
+	b.open, b.app = true, app
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.open = false
+		b.mu.Unlock()
+	}()
+
+	app.Conn.Connected()
+	slog.Info("pcan connected", "channel", b.cfg.Channel, "bitrate", b.bitrate, "listen_only", b.cfg.ListenOnly)
+	var warned pcanStatus
+	for ctx.Err() == nil {
+		var m pcanMsg
+		r, _, _ := pcanRead.Call(uintptr(b.channel), uintptr(unsafe.Pointer(&m)), 0)
+		switch st := pcanStatus(r); {
+		case st == pcanErrorQRcvEmpty:
+			windows.WaitForSingleObject(ev, 100)
+			continue
+		case st&pcanErrorBusOff != 0:
+			return errors.New("pcan: bus off")
+		case st&(pcanErrorBusLight|pcanErrorBusHeavy|pcanErrorQOverrun) != 0:
+			if st != warned {
+				slog.Warn("pcan: bus status", "status", st.Error())
+				warned = st
+			}
+			continue
+		case st != pcanErrorOK:
+			return fmt.Errorf("pcan read: %w", st)
+		}
+		if m.MsgType&(pcanMsgStatus|pcanMsgErrFrame) != 0 || m.Len > 8 {
+			continue
+		}
+		f := can.Frame{
+			ID:         m.ID,
+			Length:     m.Len,
+			IsExtended: m.MsgType&pcanMsgExtended != 0,
+			IsRemote:   m.MsgType&pcanMsgRTR != 0,
+		}
+		if !f.IsRemote {
+			f.Data = m.Data
+		}
+		processFrame(app, f, time.Now())
+	}
+	return nil
+}
+
+// Transmit sends f on the channel. PCAN-Basic does not report frames the
+// channel sent, so f is fed back into the frame path as tx.
+func (b *pcanBus) Transmit(_ context.Context, f can.Frame) error {
+	if b.cfg.ListenOnly {
+		return errors.New("pcan channel is open in listen-only mode")
+	}
+	m := pcanMsg{ID: f.ID, MsgType: pcanMsgStandard, Len: f.Length}
+	if f.IsExtended {
+		m.MsgType |= pcanMsgExtended
+	}
+	if f.IsRemote {
+		m.MsgType |= pcanMsgRTR
+	} else {
+		m.Data = f.Data
+	}
+	b.mu.Lock()
+	if !b.open {
+		b.mu.Unlock()
+		return errors.New("pcan channel not connected")
+	}
+	r, _, _ := pcanWrite.Call(uintptr(b.channel), uintptr(unsafe.Pointer(&m)))
+	app := b.app
+	b.mu.Unlock()
+	if r != pcanErrorOK {
+		return fmt.Errorf("pcan write: %w", pcanStatus(r))
+	}
+	ingestFrame(app, f, userStamp(time.Now()), "tx")
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Profiles holds the selectable vehicle profiles (one CAN map each) and the
+// frame definitions of the profile currently used for decoding.
+type Profiles struct {
+	mu       sync.RWMutex
+	paths    map[string]string
+	active   string
+	defs     map[uint32]FrameDef
+	matcher  *frameMatcher
+	derived  *derivedSet
+	warnings []MapWarning
+}
+
+func NewProfiles(paths map[string]string, active string) (*Profiles, error) {
+	p := &Profiles{paths: paths}
+	if err := p.Switch(active); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Defs returns the frame definitions of the active profile. The returned
+// map is never modified in place and may be used without locking.
+func (p *Profiles) Defs() map[uint32]FrameDef {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.defs
+}
+
+// ByName returns the frame of the active profile named name. Masked frames
+// and names used by more than one frame need their ID instead.
+func (p *Profiles) ByName(name string) (FrameDef, error) {
+	var def FrameDef
+	n := 0
+	for _, fd := range p.Defs() {
+		if fd.Name == name && fd.Mask == 0 {
+			def = fd
+			n++
+		}
+	}
+	switch n {
+	case 0:
+		return def, fmt.Errorf("no frame %q in the map (masked frames need an id)", name)
+	case 1:
+		return def, nil
+	}
+	return def, fmt.Errorf("%d frames in the map are named %q; use an id", n, name)
+}
+
+// Lookup returns the definition of the frame with ID id in the active
+// profile, matching masked definitions too.
+func (p *Profiles) Lookup(id uint32) (FrameDef, bool) {
+	p.mu.RLock()
+	m := p.matcher
+	p.mu.RUnlock()
+	return m.Lookup(id)
+}
+
+// Warnings returns the validation warnings of the active profile's map.
+func (p *Profiles) Warnings() []MapWarning {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.warnings
+}
+
+// Derived returns the derived signals of the active profile.
+func (p *Profiles) Derived() *derivedSet {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.derived
+}
+
+func (p *Profiles) Active() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.active
+}
+
+func (p *Profiles) Names() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	names := make([]string, 0, len(p.paths))
+	for n := range p.paths {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Switch loads the named profile's map and makes it active. The previous
+// profile stays active if loading fails.
+func (p *Profiles) Switch(name string) error {
+	p.mu.RLock()
+	path, ok := p.paths[name]
+	p.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+
+	defs, err := LoadMap(path)
+	if err != nil {
+		return fmt.Errorf("profile %s: %w", name, err)
+	}
+	derived, err := newDerivedSet(defs)
+	if err != nil {
+		return fmt.Errorf("profile %s: %w", name, err)
+	}
+	warnings := ValidateMap(defs)
+	logMapWarnings(path, warnings)
+
+	p.mu.Lock()
+	p.active = name
+	p.defs = defs
+	p.matcher = newFrameMatcher(defs)
+	p.derived = derived
+	p.warnings = warnings
+	p.mu.Unlock()
+	return nil
+}
+
+// parseProfiles parses "name=path,name=path" into a profile table.
+func parseProfiles(s string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, path, ok := strings.Cut(part, "=")
+		name, path = strings.TrimSpace(name), strings.TrimSpace(path)
+		if !ok || name == "" || path == "" {
+			return nil, fmt.Errorf("bad profile entry %q (want name=path)", part)
+		}
+		out[name] = path
+	}
+	return out, nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	rawQueryDefaultLimit = 100
+	rawQueryMaxLimit     = 10000
+)
+
+// RawQuery filters the raw frame buffer. Zero values match everything.
+type RawQuery struct {
+	IDs     []idRange // any of; empty matches all IDs
+	Errors  bool      // "ERR" given in the ID list
+	Mask    uint32
+	MaskID  uint32
+	HasMask bool
+	Dir     string
+	Since   time.Time
+	Until   time.Time
+	Payload []payloadByte
+	Offset  int
+	Limit   int
+}
+
+type idRange struct{ lo, hi uint32 }
+
+// payloadByte is one position of a payload pattern; wildcard positions
+// match any byte.
+type payloadByte struct {
+	val      byte
+	wildcard bool
+}
+
+type RawPage struct {
+	Total  int        `json:"total"`
+	Offset int        `json:"offset"`
+	Limit  int        `json:"limit"`
+	Frames []RawFrame `json:"frames"`
+}
+
+// parseIDList parses "0x123,0x200-0x2FF,ERR"; errFrames reports whether
+// ERR was listed.
+func parseIDList(s string) (ids []idRange, errFrames bool, err error) {
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if strings.EqualFold(part, "ERR") {
+			errFrames = true
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		a, err := parseHexID(lo)
+		if err != nil {
+			return nil, false, fmt.Errorf("id %q: %w", part, err)
+		}
+		b := a
+		if isRange {
+			if b, err = parseHexID(hi); err != nil {
+				return nil, false, fmt.Errorf("id %q: %w", part, err)
+			}
+			if b < a {
+				return nil, false, fmt.Errorf("id %q: empty range", part)
+			}
+		}
+		ids = append(ids, idRange{a, b})
+	}
+	return ids, errFrames, nil
+}
+
+// parseRawQuery reads the /api/raw query string:
+//
+//	id=0x123,0x200-0x2FF,ERR   IDs, ranges, and error frames
+//	mask=0x120:0x7F0           (id & 0x7F0) == 0x120, like candump filters
+//	dir=rx|tx
+//	since=, until=             RFC 3339 or unix seconds
+//	last=30s                   shorthand for since=now-30s
+//	data=DE??BE                payload prefix; ?? or .. matches any byte
+//	offset=, limit=            pagination, newest frame first
+func parseRawQuery(v url.Values, now time.Time) (RawQuery, error) {
+	q := RawQuery{Limit: rawQueryDefaultLimit}
+
+	if s := v.Get("id"); s != "" {
+		var err error
+		if q.IDs, q.Errors, err = parseIDList(s); err != nil {
+			return q, err
+		}
+	}
+
+	if s := v.Get("mask"); s != "" {
+		id, mask, ok := strings.Cut(s, ":")
+		if !ok {
+			return q, fmt.Errorf("mask %q: want <id>:<mask>", s)
+		}
+		var err error
+		if q.MaskID, err = parseHexID(id); err != nil {
+			return q, fmt.Errorf("mask %q: %w", s, err)
+		}
+		if q.Mask, err = parseHexID(mask); err != nil {
+			return q, fmt.Errorf("mask %q: %w", s, err)
+		}
+		q.MaskID &= q.Mask
+		q.HasMask = true
+	}
+
+	switch q.Dir = strings.ToLower(v.Get("dir")); q.Dir {
+	case "", "rx", "tx":
+	default:
+		return q, fmt.Errorf("dir %q: want rx or tx", q.Dir)
+	}
+
+	var err error
+	if q.Since, err = parseQueryTime(v.Get("since")); err != nil {
+		return q, fmt.Errorf("since: %w", err)
+	}
+	if q.Until, err = parseQueryTime(v.Get("until")); err != nil {
+		return q, fmt.Errorf("until: %w", err)
+	}
+	if s := v.Get("last"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return q, fmt.Errorf("last: %w", err)
+		}
+		q.Since = now.Add(-d)
+	}
+
+	if s := v.Get("data"); s != "" {
+		if q.Payload, err = parsePayloadPattern(s); err != nil {
+			return q, fmt.Errorf("data %q: %w", s, err)
+		}
+	}
+
+	if s := v.Get("offset"); s != "" {
+		if q.Offset, err = strconv.Atoi(s); err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("offset %q: want a non-negative integer", s)
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit <= 0 {
+			return q, fmt.Errorf("limit %q: want a positive integer", s)
+		}
+		q.Limit = min(q.Limit, rawQueryMaxLimit)
+	}
+	return q, nil
+}
+
+func parseQueryTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	sec, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q: want RFC 3339 or unix seconds", s)
+	}
+	return time.Unix(0, int64(sec*1e9)), nil
+}
+
+func parsePayloadPattern(s string) ([]payloadByte, error) {
+	s = strings.Join(strings.Fields(s), "")
+	if len(s)%2 != 0 {
+		return nil, errors.New("odd number of hex digits")
+	}
+	out := make([]payloadByte, 0, len(s)/2)
+	for i := 0; i < len(s); i += 2 {
+		pair := s[i : i+2]
+		if pair == "??" || pair == ".." || strings.EqualFold(pair, "xx") {
+			out = append(out, payloadByte{wildcard: true})
+			continue
+		}
+		b, err := strconv.ParseUint(pair, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad byte %q", pair)
+		}
+		out = append(out, payloadByte{val: byte(b)})
+	}
+	return out, nil
+}
+
+func (q RawQuery) Match(r RawFrame) bool {
+	isErr := r.ID == "ERR"
+	if len(q.IDs) > 0 || q.Errors {
+		ok := isErr && q.Errors
+		for _, rg := range q.IDs {
+			if !isErr && r.canID >= rg.lo && r.canID <= rg.hi {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if q.HasMask && (isErr || r.canID&q.Mask != q.MaskID) {
+		return false
+	}
+	if q.Dir != "" && r.Dir != q.Dir {
+		return false
+	}
+	if !q.Since.IsZero() && r.TS.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && r.TS.After(q.Until) {
+		return false
+	}
+	if len(q.Payload) > len(r.data) {
+		return false
+	}
+	for i, p := range q.Payload {
+		if !p.wildcard && r.data[i] != p.val {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryRaw returns the page of buffered raw frames matching q, newest first.
+func (s *Store) QueryRaw(q RawQuery) RawPage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	raw := s.rawLocked()
+	page := RawPage{Offset: q.Offset, Limit: q.Limit, Frames: []RawFrame{}}
+	for i := len(raw) - 1; i >= 0; i-- {
+		r := raw[i]
+		if !q.Match(r) {
+			continue
+		}
+		if page.Total >= q.Offset && len(page.Frames) < q.Limit {
+			page.Frames = append(page.Frames, r)
+		}
+		page.Total++
+	}
+	return page
+}
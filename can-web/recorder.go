@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+type RecordingStatus struct {
+	Active  bool      `json:"active"`
+	Name    string    `json:"name,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Started time.Time `json:"started,omitempty"`
+	Frames  uint64    `json:"frames"`
+}
+
+// Recorder writes received frames to a candump-compatible log file
+// ("(sec.usec) iface ID#DATA").
+type Recorder struct {
+	mu      sync.Mutex
+	dir     string
+	f       *os.File
+	w       *bufio.Writer
+	name    string
+	path    string
+	started time.Time
+	frames  uint64
+}
+
+var recordingNameRe = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+func NewRecorder(dir string) *Recorder {
+	return &Recorder{dir: dir}
+}
+
+func (r *Recorder) Start(name string) (RecordingStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f != nil {
+		return r.statusLocked(), fmt.Errorf("recording %q already active", r.name)
+	}
+
+	now := time.Now()
+	name = recordingNameRe.ReplaceAllString(name, "_")
+	if name == "" {
+		name = "candump-" + now.Format("2006-01-02_150405")
+	}
+
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return RecordingStatus{}, err
+	}
+	path := filepath.Join(r.dir, name+".log")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return RecordingStatus{}, err
+	}
+
+	r.f = f
+	r.w = bufio.NewWriter(f)
+	r.name = name
+	r.path = path
+	r.started = now
+	r.frames = 0
+	return r.statusLocked(), nil
+}
+
+func (r *Recorder) Stop() (RecordingStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return r.statusLocked(), fmt.Errorf("no active recording")
+	}
+	st := r.statusLocked()
+	st.Active = false
+
+	err := r.w.Flush()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	r.f = nil
+	r.w = nil
+	return st, err
+}
+
+// Close flushes and closes the active recording, if any. It is called on
+// shutdown so a recording is never left truncated.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	active := r.f != nil
+	r.mu.Unlock()
+	if !active {
+		return nil
+	}
+	_, err := r.Stop()
+	return err
+}
+
+// WriteFrame adds a frame received on bus to the active recording, if any.
+func (r *Recorder) WriteFrame(bus string, f can.Frame, ts time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return
+	}
+	fmt.Fprintf(r.w, "(%d.%06d) %s %s\n", ts.Unix(), ts.Nanosecond()/1000, bus, f.String())
+	r.frames++
+}
+
+// WriteMarker adds a comment line to the active recording, if any.
+func (r *Recorder) WriteMarker(label string, ts time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return
+	}
+	fmt.Fprintf(r.w, "# marker (%d.%06d) %s\n", ts.Unix(), ts.Nanosecond()/1000, label)
+}
+
+// RecordingFile is one finished or active recording in the recording
+// directory.
+type RecordingFile struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Active   bool      `json:"active"`
+}
+
+// List returns the recordings in the recording directory, newest first.
+func (r *Recorder) List() ([]RecordingFile, error) {
+	r.mu.Lock()
+	active := r.path
+	if r.f == nil {
+		active = ""
+	}
+	r.mu.Unlock()
+
+	entries, err := os.ReadDir(r.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []RecordingFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := []RecordingFile{}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".log")
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, RecordingFile{
+			Name:     name,
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+			Active:   filepath.Join(r.dir, e.Name()) == active,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Modified.After(out[j].Modified) })
+	return out, nil
+}
+
+// File returns the path of a finished recording. The active recording is
+// refused since its tail is still buffered.
+func (r *Recorder) File(name string) (string, error) {
+	if name == "" || recordingNameRe.MatchString(name) {
+		return "", fmt.Errorf("bad recording name %q", name)
+	}
+	path := filepath.Join(r.dir, name+".log")
+	r.mu.Lock()
+	active := r.f != nil && r.path == path
+	r.mu.Unlock()
+	if active {
+		return "", fmt.Errorf("recording %q is still active", name)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("recording %q not found", name)
+	}
+	return path, nil
+}
+
+func (r *Recorder) Status() RecordingStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.statusLocked()
+}
+
+func (r *Recorder) statusLocked() RecordingStatus {
+	if r.f == nil {
+		return RecordingStatus{}
+	}
+	return RecordingStatus{
+		Active:  true,
+		Name:    r.name,
+		Path:    r.path,
+		Started: r.started,
+		Frames:  r.frames,
+	}
+}
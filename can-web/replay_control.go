@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Replay speed limits for the control API. A replay started with speed 0
+// (as fast as possible) can be slowed down but not set back to 0.
+const (
+	replayMinSpeed = 0.1
+	replayMaxSpeed = 100
+)
+
+var errUnknownReplayAction = errors.New("unknown replay action")
+
+// ReplayControl lets the web API pause, seek, loop and change the speed of
+// a running replay. Times are log times, the timestamps in the file.
+type ReplayControl struct {
+	// ExitAtEnd makes the replay return at end of file instead of waiting
+	// for a seek, as dump needs.
+	ExitAtEnd bool
+
+	mu       sync.Mutex
+	changed  chan struct{} // closed and replaced on every change
+	file     string
+	start    time.Time // first and last frame of the file
+	end      time.Time
+	total    int
+	speed    float64
+	loop     bool
+	paused   bool
+	finished bool
+	played   uint64
+	pos      time.Time // last frame played, or the seek target
+	read     time.Time // last frame read from the file
+	target   time.Time // pending seek, zero when none
+	rewind   bool      // the seek target is behind the read position
+	wall     time.Time // wall clock time at which log time anchor is due
+	anchor   time.Time
+}
+
+// ReplayStatus is the state reported by /api/replay.
+type ReplayStatus struct {
+	File     string    `json:"file"`
+	State    string    `json:"state"` // playing, paused or finished
+	Speed    float64   `json:"speed"` // 0 = as fast as possible
+	Loop     bool      `json:"loop"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration float64   `json:"duration_s"`
+	Position time.Time `json:"position"`
+	Offset   float64   `json:"offset_s"` // position - start
+	Frames   int       `json:"frames"`   // in the file (channel)
+	Played   uint64    `json:"played"`
+}
+
+// replayParams are the params of the replay actions; each action reads its
+// own fields.
+type replayParams struct {
+	T       string   `json:"t,omitempty"`        // seek: RFC 3339 or unix seconds
+	OffsetS *float64 `json:"offset_s,omitempty"` // seek: seconds from the first frame
+	Speed   float64  `json:"speed,omitempty"`
+	Loop    bool     `json:"loop,omitempty"`
+}
+
+func NewReplayControl(speed float64, loop bool) *ReplayControl {
+	return &ReplayControl{changed: make(chan struct{}), speed: max(speed, 0), loop: loop}
+}
+
+// notify wakes a waiting replay. Caller holds mu.
+func (rc *ReplayControl) notify() {
+	close(rc.changed)
+	rc.changed = make(chan struct{})
+}
+
+// clock is the current log time of the playback. Caller holds mu.
+func (rc *ReplayControl) clock() time.Time {
+	if rc.paused || rc.finished || rc.speed <= 0 || rc.anchor.IsZero() {
+		return rc.pos
+	}
+	return rc.anchor.Add(time.Duration(float64(time.Since(rc.wall)) * rc.speed))
+}
+
+func (rc *ReplayControl) Status() ReplayStatus {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	st := ReplayStatus{
+		File:     rc.file,
+		State:    "playing",
+		Speed:    rc.speed,
+		Loop:     rc.loop,
+		Start:    rc.start,
+		End:      rc.end,
+		Duration: rc.end.Sub(rc.start).Seconds(),
+		Position: rc.pos,
+		Frames:   rc.total,
+		Played:   rc.played,
+	}
+	switch {
+	case rc.finished:
+		st.State = "finished"
+	case rc.paused:
+		st.State = "paused"
+	}
+	if !rc.pos.IsZero() {
+		st.Offset = rc.pos.Sub(rc.start).Seconds()
+	}
+	return st
+}
+
+// Action runs one replay action: pause, resume, seek, speed or loop.
+func (rc *ReplayControl) Action(name string, params json.RawMessage) (ReplayStatus, error) {
+	var p replayParams
+	if err := decodeParams(params, &p); err != nil {
+		return ReplayStatus{}, err
+	}
+	if err := rc.apply(name, p); err != nil {
+		return ReplayStatus{}, err
+	}
+	return rc.Status(), nil
+}
+
+func (rc *ReplayControl) apply(name string, p replayParams) error {
+	var target time.Time
+	if name == "seek" {
+		var err error
+		if target, err = rc.seekTarget(p); err != nil {
+			return err
+		}
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	switch name {
+	case "pause":
+		if !rc.paused {
+			rc.pos = rc.clock()
+			rc.paused = true
+		}
+	case "resume":
+		if rc.paused {
+			rc.paused = false
+			rc.anchor, rc.wall = rc.pos, time.Now()
+		}
+	case "speed":
+		if p.Speed < replayMinSpeed || p.Speed > replayMaxSpeed {
+			return fmt.Errorf("speed %g: want %g to %g", p.Speed, float64(replayMinSpeed), float64(replayMaxSpeed))
+		}
+		if !rc.anchor.IsZero() {
+			rc.anchor, rc.wall = rc.clock(), time.Now()
+		}
+		rc.speed = p.Speed
+	case "loop":
+		rc.loop = p.Loop
+		rc.finished = rc.finished && !p.Loop
+	case "seek":
+		if rc.start.IsZero() {
+			return errors.New("replay has not started")
+		}
+		rc.rewind = rc.finished || target.Before(rc.read)
+		rc.target, rc.pos = target, target
+		rc.finished = false
+	default:
+		return errUnknownReplayAction
+	}
+	rc.notify()
+	return nil
+}
+
+// seekTarget resolves the t or offset_s param to a log time in the file.
+func (rc *ReplayControl) seekTarget(p replayParams) (time.Time, error) {
+	rc.mu.Lock()
+	start, end := rc.start, rc.end
+	rc.mu.Unlock()
+
+	var t time.Time
+	switch {
+	case p.OffsetS != nil:
+		t = start.Add(time.Duration(*p.OffsetS * float64(time.Second)))
+	case p.T != "":
+		var err error
+		if t, err = parseQueryTime(p.T); err != nil {
+			return t, fmt.Errorf("t %w", err)
+		}
+	default:
+		return t, errors.New("seek needs t or offset_s")
+	}
+	if t.Before(start) || t.After(end) {
+		return t, fmt.Errorf("%s is outside the log (%s to %s)",
+			t.Format(time.RFC3339Nano), start.Format(time.RFC3339Nano), end.Format(time.RFC3339Nano))
+	}
+	return t, nil
+}
+
+// replayStep tells the replay loop what to do with the frame it has read.
+type replayStep int
+
+const (
+	replayPlay   replayStep = iota
+	replaySkip              // before the seek target
+	replayRewind            // the seek target is behind: reopen the file
+	replayStop              // ctx done
+)
+
+// wait blocks until the frame at log time ts is due.
+func (rc *ReplayControl) wait(ctx context.Context, ts time.Time) replayStep {
+	for {
+		rc.mu.Lock()
+		rc.read = ts
+		if rc.rewind {
+			rc.rewind = false
+			rc.mu.Unlock()
+			return replayRewind
+		}
+		if !rc.target.IsZero() {
+			if ts.Before(rc.target) {
+				rc.mu.Unlock()
+				return replaySkip
+			}
+			rc.anchor, rc.wall = rc.target, time.Now()
+			rc.target = time.Time{}
+		}
+		if rc.anchor.IsZero() {
+			rc.anchor, rc.wall = ts, time.Now()
+		}
+		var d time.Duration
+		if !rc.paused && rc.speed > 0 {
+			d = time.Until(rc.wall.Add(time.Duration(float64(ts.Sub(rc.anchor)) / rc.speed)))
+		}
+		paused, changed := rc.paused, rc.changed
+		rc.mu.Unlock()
+
+		if !paused && d <= 0 {
+			return replayPlay
+		}
+		var due <-chan time.Time
+		if !paused {
+			due = time.After(d)
+		}
+		select {
+		case <-ctx.Done():
+			return replayStop
+		case <-due:
+			return replayPlay
+		case <-changed:
+		}
+	}
+}
+
+// fastest reports whether frames are played as fast as possible.
+func (rc *ReplayControl) fastest() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.speed <= 0
+}
+
+// playedFrame records the frame at log time ts as played.
+func (rc *ReplayControl) playedFrame(ts time.Time) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.pos = ts
+	rc.played++
+}
+
+// atEnd is called at end of file. It reports whether to play the file
+// again: when looping, or after a seek. Without ExitAtEnd it waits for one.
+func (rc *ReplayControl) atEnd(ctx context.Context) bool {
+	for {
+		rc.mu.Lock()
+		if rc.loop || rc.rewind {
+			if !rc.rewind {
+				rc.anchor = time.Time{} // start over at the first frame
+			}
+			rc.rewind, rc.finished = false, false
+			rc.mu.Unlock()
+			return true
+		}
+		rc.finished = true
+		changed := rc.changed
+		rc.mu.Unlock()
+
+		if rc.ExitAtEnd {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
+
+// scan reads the file once to find its time span before playback starts.
+func (rc *ReplayControl) scan(path, channel string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var first, last time.Time
+	n := 0
+	parse := newTraceLineParser(path)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		lf, ok, err := parse(sc.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if !ok || (channel != "" && lf.Iface != channel) {
+			continue
+		}
+		if n == 0 {
+			first = lf.TS
+		}
+		last = lf.TS
+		n++
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.file, rc.start, rc.end, rc.total = path, first, last, n
+	return nil
+}
+
+// registerReplayActions exposes the replay actions as replay.<action>
+// control actions when the source is a replay.
+func registerReplayActions(app *App) {
+	if app.Replay == nil {
+		return
+	}
+	for _, name := range []string{"pause", "resume", "seek", "speed", "loop"} {
+		app.Control.Register("replay."+name, func(params json.RawMessage) (any, error) {
+			return app.Replay.Action(name, params)
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const seedKeyCommandTimeout = 5 * time.Second
+
+// SeedKeyFunc computes the SecurityAccess key for a seed. level is the odd
+// requestSeed sub-function; ecu is the request ID of the ECU, for
+// algorithms that differ per ECU.
+type SeedKeyFunc func(ecu uint32, level byte, seed []byte) ([]byte, error)
+
+// RegisterSeedKey makes fn available as seed-key algorithm name. OEM
+// algorithms are usually confidential, so none are built in; add a file to
+// this package that registers yours and rebuild:
+//
+//	func init() {
+//		RegisterSeedKey("bench-xor", func(ecu uint32, level byte, seed []byte) ([]byte, error) {
+//			...
+//		})
+//	}
+func RegisterSeedKey(name string, fn SeedKeyFunc) {
+	seedKeys.mu.Lock()
+	defer seedKeys.mu.Unlock()
+	if name == "command" {
+		panic("seed-key algorithm name \"command\" is reserved")
+	}
+	if _, dup := seedKeys.m[name]; dup {
+		panic(fmt.Sprintf("seed-key algorithm %q registered twice", name))
+	}
+	seedKeys.m[name] = fn
+}
+
+var seedKeys = struct {
+	mu sync.RWMutex
+	m  map[string]SeedKeyFunc
+}{m: make(map[string]SeedKeyFunc)}
+
+func lookupSeedKey(name string) SeedKeyFunc {
+	seedKeys.mu.RLock()
+	defer seedKeys.mu.RUnlock()
+	return seedKeys.m[name]
+}
+
+func seedKeyNames() []string {
+	seedKeys.mu.RLock()
+	defer seedKeys.mu.RUnlock()
+	names := make([]string, 0, len(seedKeys.m))
+	for n := range seedKeys.m {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commandSeedKey runs the configured seed-key program as
+// "<command> <level> <seed hex>" with UDS_ECU set to the request ID, and
+// reads the key as hex from its output.
+func commandSeedKey(ctx context.Context, command string, ecu uint32, level byte, seed []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, seedKeyCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command, strconv.Itoa(int(level)), hex.EncodeToString(seed))
+	cmd.Env = append(os.Environ(), fmt.Sprintf("UDS_ECU=0x%03X", ecu))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("seed-key command: %w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("seed-key command: %w", err)
+	}
+	key, err := hex.DecodeString(strings.Join(strings.Fields(string(out)), ""))
+	if err != nil {
+		return nil, fmt.Errorf("seed-key command printed %q, want hex: %w", strings.TrimSpace(string(out)), err)
+	}
+	return key, nil
+}
+
+// securityAccessParams asks for one security level to be unlocked.
+type securityAccessParams struct {
+	TxID      string `json:"tx_id"`
+	RxID      string `json:"rx_id"`
+	Level     int    `json:"level"`     // odd requestSeed sub-function, default 1
+	Algorithm string `json:"algorithm"` // default uds.algorithm
+}
+
+type SecurityAccessResult struct {
+	ECU             string `json:"ecu"`
+	Level           int    `json:"level"`
+	Seed            string `json:"seed"`
+	AlreadyUnlocked bool   `json:"already_unlocked,omitempty"` // the ECU sent an all-zero seed
+}
+
+// SecurityAccess unlocks level on t: it requests a seed, computes the key
+// with the named algorithm and sends it. Protected services such as
+// RoutineControl and WriteMemoryByAddress can then be sent with Request
+// until the session changes or the ECU resets.
+func (c *UDSClient) SecurityAccess(ctx context.Context, t udsTarget, level int, algorithm string) (*SecurityAccessResult, error) {
+	if level == 0 {
+		level = 1
+	}
+	if level < 1 || level > 0x7D || level%2 == 0 {
+		return nil, fmt.Errorf("level %d: want an odd requestSeed level 1-0x7D", level)
+	}
+	if algorithm == "" {
+		algorithm = c.algo
+	}
+	var keyFn SeedKeyFunc
+	switch {
+	case algorithm == "":
+		return nil, errors.New("no seed-key algorithm given and uds.algorithm is not set")
+	case algorithm == "command":
+		if c.command == "" {
+			return nil, errors.New("uds.seed_key_command is not set")
+		}
+		keyFn = func(ecu uint32, level byte, seed []byte) ([]byte, error) {
+			return commandSeedKey(ctx, c.command, ecu, level, seed)
+		}
+	default:
+		if keyFn = lookupSeedKey(algorithm); keyFn == nil {
+			return nil, fmt.Errorf("unknown seed-key algorithm %q", algorithm)
+		}
+	}
+
+	resp, err := c.Request(ctx, t, []byte{0x27, byte(level)}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("request seed: %w", err)
+	}
+	if len(resp) < 2 || resp[1] != byte(level) {
+		return nil, fmt.Errorf("request seed: unexpected response %X", resp)
+	}
+	seed := resp[2:]
+	res := &SecurityAccessResult{ECU: t.String(), Level: level, Seed: hex.EncodeToString(seed)}
+	if len(bytes.Trim(seed, "\x00")) == 0 {
+		res.AlreadyUnlocked = true
+		c.observe(t, []byte{0x27, byte(level + 1)}, nil, nil)
+		return res, nil
+	}
+
+	key, err := keyFn(t.tx, byte(level), seed)
+	if err != nil {
+		return nil, fmt.Errorf("compute key (%s): %w", algorithm, err)
+	}
+	if _, err := c.Request(ctx, t, append([]byte{0x27, byte(level + 1)}, key...), 0); err != nil {
+		return nil, fmt.Errorf("send key: %w", err)
+	}
+	return res, nil
+}
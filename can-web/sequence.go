@@ -0,0 +1,538 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.einride.tech/can"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	sequenceDefaultWait  = 5 * time.Second
+	sequenceKeepFinished = 20
+)
+
+type SequencesConfig struct {
+	Dir string `yaml:"dir"` // scripts, name.yaml or name.json, run by name
+}
+
+// Sequence is a test script: its steps run in order, Repeat times, and the
+// run stops at the first failed step unless ContinueOnFail is set.
+type Sequence struct {
+	Name           string    `yaml:"name" json:"name"`
+	Repeat         int       `yaml:"repeat" json:"repeat"` // default 1
+	ContinueOnFail bool      `yaml:"continue_on_fail" json:"continue_on_fail"`
+	Steps          []SeqStep `yaml:"steps" json:"steps"`
+}
+
+// SeqStep is one step of a sequence; exactly one action is set.
+type SeqStep struct {
+	Name    string   `yaml:"name" json:"name,omitempty"`
+	Send    *SeqSend `yaml:"send" json:"send,omitempty"`
+	Wait    *SeqWait `yaml:"wait" json:"wait,omitempty"`
+	Assert  string   `yaml:"assert" json:"assert,omitempty"` // expression over FRAME.signal that must hold now
+	SleepMs int      `yaml:"sleep_ms" json:"sleep_ms,omitempty"`
+	Marker  string   `yaml:"marker" json:"marker,omitempty"`
+}
+
+// SeqSend is a frame to send: raw with ID and Data, or a mapped frame by
+// name with some signals set and the map's defaults for the others.
+type SeqSend struct {
+	ID       string             `yaml:"id" json:"id,omitempty"`
+	Data     string             `yaml:"data" json:"data,omitempty"`
+	Extended bool               `yaml:"extended" json:"extended,omitempty"`
+	Frame    string             `yaml:"frame" json:"frame,omitempty"`
+	Signals  map[string]float64 `yaml:"signals" json:"signals,omitempty"`
+}
+
+// SeqWait waits until an expression over FRAME.signal holds.
+type SeqWait struct {
+	Until     string `yaml:"until" json:"until"`
+	TimeoutMs int    `yaml:"timeout_ms" json:"timeout_ms,omitempty"` // default 5000
+	Fresh     bool   `yaml:"fresh" json:"fresh,omitempty"`           // only values received after the step began
+}
+
+// SeqStepResult is the outcome of one step of one iteration.
+type SeqStepResult struct {
+	Iteration  int                `json:"iteration"`
+	Step       int                `json:"step"`
+	Name       string             `json:"name"`
+	OK         bool               `json:"ok"`
+	Error      string             `json:"error,omitempty"`
+	Values     map[string]float64 `json:"values,omitempty"` // signals of the condition when it was decided
+	Started    time.Time          `json:"started"`
+	DurationMs float64            `json:"duration_ms"`
+}
+
+// SeqRunStatus is one run in /api/sequences.
+type SeqRunStatus struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	State     string          `json:"state"` // running, passed, failed or stopped
+	Iteration int             `json:"iteration"`
+	Repeat    int             `json:"repeat"`
+	Passed    int             `json:"passed"` // steps
+	Failed    int             `json:"failed"`
+	Started   time.Time       `json:"started"`
+	Ended     *time.Time      `json:"ended,omitempty"`
+	Results   []SeqStepResult `json:"results,omitempty"`
+}
+
+// SequencesStatus is served by /api/sequences.
+type SequencesStatus struct {
+	Scripts []string       `json:"scripts"` // in sequences.dir
+	Runs    []SeqRunStatus `json:"runs"`    // newest first, without step results
+}
+
+// seqStep is a step ready to run.
+type seqStep struct {
+	name  string
+	frame *can.Frame
+	cond  *Expr
+	wait  time.Duration
+	fresh bool
+	sleep time.Duration
+	label string
+}
+
+type seqRun struct {
+	seq   Sequence
+	steps []seqStep
+	stop  context.CancelFunc
+	done  chan struct{}
+
+	// guarded by Sequencer.mu
+	status SeqRunStatus
+}
+
+// Sequencer runs test sequences, one at a time. Frames go through the TX
+// interlocks like any other.
+type Sequencer struct {
+	app *App
+	dir string
+
+	mu   sync.Mutex
+	runs map[string]*seqRun
+	n    int
+}
+
+func NewSequencer(app *App, cfg SequencesConfig) *Sequencer {
+	return &Sequencer{app: app, dir: cfg.Dir, runs: make(map[string]*seqRun)}
+}
+
+// Load reads the script name from the sequences directory.
+func (s *Sequencer) Load(name string) (Sequence, error) {
+	var seq Sequence
+	if s.dir == "" {
+		return seq, errors.New("no sequences.dir configured")
+	}
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return seq, fmt.Errorf("bad script name %q", name)
+	}
+	var b []byte
+	var err error
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		if b, err = os.ReadFile(filepath.Join(s.dir, name+ext)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return seq, fmt.Errorf("script %q not found", name)
+	}
+	if err := yaml.Unmarshal(b, &seq); err != nil {
+		return seq, fmt.Errorf("script %q: %w", name, err)
+	}
+	if seq.Name == "" {
+		seq.Name = name
+	}
+	return seq, nil
+}
+
+// Scripts lists the scripts in the sequences directory.
+func (s *Sequencer) Scripts() []string {
+	out := []string{}
+	if s.dir == "" {
+		return out
+	}
+	entries, _ := os.ReadDir(s.dir)
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if !e.IsDir() && (ext == ".yaml" || ext == ".yml" || ext == ".json") {
+			out = append(out, strings.TrimSuffix(e.Name(), ext))
+		}
+	}
+	return out
+}
+
+// prepare checks every step and compiles it, so a script with a typo fails
+// before anything is sent.
+func (s *Sequencer) prepare(seq Sequence) ([]seqStep, error) {
+	if len(seq.Steps) == 0 {
+		return nil, errors.New("steps is required")
+	}
+	out := make([]seqStep, len(seq.Steps))
+	for i, st := range seq.Steps {
+		p := &out[i]
+		actions := 0
+		if st.Send != nil {
+			actions++
+			f, err := s.frame(*st.Send)
+			if err != nil {
+				return nil, fmt.Errorf("step %d: send: %w", i+1, err)
+			}
+			p.frame, p.name = &f, "send "+f.String()
+		}
+		if st.Wait != nil {
+			actions++
+			cond, err := CompileExpr(st.Wait.Until)
+			if err != nil {
+				return nil, fmt.Errorf("step %d: wait: %w", i+1, err)
+			}
+			p.cond, p.fresh, p.wait, p.name = cond, st.Wait.Fresh, sequenceDefaultWait, "wait "+st.Wait.Until
+			if st.Wait.TimeoutMs > 0 {
+				p.wait = time.Duration(st.Wait.TimeoutMs) * time.Millisecond
+			}
+		}
+		if st.Assert != "" {
+			actions++
+			cond, err := CompileExpr(st.Assert)
+			if err != nil {
+				return nil, fmt.Errorf("step %d: assert: %w", i+1, err)
+			}
+			p.cond, p.name = cond, "assert "+st.Assert
+		}
+		if st.SleepMs > 0 {
+			actions++
+			p.sleep, p.name = time.Duration(st.SleepMs)*time.Millisecond, fmt.Sprintf("sleep %dms", st.SleepMs)
+		}
+		if st.Marker != "" {
+			actions++
+			p.label, p.name = st.Marker, "marker "+st.Marker
+		}
+		if actions != 1 {
+			return nil, fmt.Errorf("step %d: want exactly one of send, wait, assert, sleep_ms and marker, got %d", i+1, actions)
+		}
+		if st.Name != "" {
+			p.name = st.Name
+		}
+	}
+	return out, nil
+}
+
+func (s *Sequencer) frame(p SeqSend) (can.Frame, error) {
+	if p.Frame == "" {
+		return sendParams{ID: p.ID, Data: p.Data, Extended: p.Extended}.frame()
+	}
+	var f can.Frame
+	def, err := s.app.Profiles.ByName(p.Frame)
+	if err != nil {
+		return f, err
+	}
+	f.ID, f.Length = def.ID, def.DLC
+	f.IsExtended = p.Extended || def.ID > 0x7FF
+	set := make(map[string]bool, len(p.Signals))
+	for _, sig := range def.Signals {
+		v, ok := p.Signals[sig.SignalName]
+		if !ok {
+			if sig.Muxed {
+				continue
+			}
+			v = sig.Default
+		}
+		set[sig.SignalName] = true
+		encodeSignal(&f.Data, sig, v)
+	}
+	for name := range p.Signals {
+		if !set[name] {
+			return f, fmt.Errorf("frame %s has no signal %q", p.Frame, name)
+		}
+	}
+	return f, nil
+}
+
+// Start validates seq and runs it in the background.
+func (s *Sequencer) Start(seq Sequence) (SeqRunStatus, error) {
+	if seq.Repeat <= 0 {
+		seq.Repeat = 1
+	}
+	if seq.Name == "" {
+		seq.Name = "inline"
+	}
+	steps, err := s.prepare(seq)
+	if err != nil {
+		return SeqRunStatus{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.runs {
+		if r.status.State == "running" {
+			return SeqRunStatus{}, fmt.Errorf("sequence %s (%s) is running", r.status.ID, r.status.Name)
+		}
+	}
+	s.n++
+	ctx, stop := context.WithCancel(context.Background())
+	run := &seqRun{seq: seq, steps: steps, stop: stop, done: make(chan struct{})}
+	run.status = SeqRunStatus{
+		ID:      fmt.Sprintf("%s-%d", time.Now().Format("20060102-150405"), s.n),
+		Name:    seq.Name,
+		State:   "running",
+		Repeat:  seq.Repeat,
+		Started: time.Now(),
+		Results: []SeqStepResult{},
+	}
+	s.runs[run.status.ID] = run
+	s.pruneLocked()
+	s.mark("sequence "+seq.Name+" started", run.status.Started)
+	slog.Info("sequence started", "run", run.status.ID, "name", seq.Name, "steps", len(steps), "repeat", seq.Repeat)
+	go s.run(ctx, run)
+	return run.status, nil
+}
+
+func (s *Sequencer) mark(label string, now time.Time) {
+	s.app.Recorder.WriteMarker(label, now)
+	s.app.Markers.Add(label, now)
+}
+
+func (s *Sequencer) run(ctx context.Context, run *seqRun) {
+	defer close(run.done)
+	state := "passed"
+loop:
+	for it := 1; it <= run.seq.Repeat; it++ {
+		s.mu.Lock()
+		run.status.Iteration = it
+		s.mu.Unlock()
+		for i, st := range run.steps {
+			res := SeqStepResult{Iteration: it, Step: i + 1, Name: st.name, Started: time.Now()}
+			res.Values, res.Error = s.step(ctx, st)
+			res.OK = res.Error == ""
+			res.DurationMs = float64(time.Since(res.Started).Microseconds()) / 1000
+			if ctx.Err() != nil {
+				state = "stopped"
+				break loop
+			}
+			s.mu.Lock()
+			run.status.Results = append(run.status.Results, res)
+			if res.OK {
+				run.status.Passed++
+			} else {
+				run.status.Failed++
+			}
+			s.mu.Unlock()
+			if !res.OK {
+				slog.Warn("sequence step failed", "run", run.status.ID, "iteration", it, "step", i+1, "name", st.name, "err", res.Error)
+				state = "failed"
+				if !run.seq.ContinueOnFail {
+					break loop
+				}
+			}
+		}
+	}
+	now := time.Now()
+	s.mu.Lock()
+	run.status.State, run.status.Ended = state, &now
+	passed, failed := run.status.Passed, run.status.Failed
+	s.mu.Unlock()
+	s.mark("sequence "+run.seq.Name+" "+state, now)
+	slog.Info("sequence ended", "run", run.status.ID, "state", state, "passed", passed, "failed", failed)
+}
+
+// step runs one step and returns the values its condition saw and why it
+// failed, or "".
+func (s *Sequencer) step(ctx context.Context, st seqStep) (map[string]float64, string) {
+	switch {
+	case st.frame != nil:
+		sctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		if err := s.app.SendFrame(sctx, *st.frame); err != nil {
+			return nil, err.Error()
+		}
+	case st.sleep > 0:
+		select {
+		case <-time.After(st.sleep):
+		case <-ctx.Done():
+		}
+	case st.label != "":
+		s.mark(st.label, time.Now())
+	case st.wait > 0:
+		return s.wait(ctx, st)
+	case st.cond != nil:
+		ok, values, err := s.eval(st.cond, 0)
+		if err != nil {
+			return values, err.Error()
+		}
+		if !ok {
+			return values, "assertion failed"
+		}
+		return values, ""
+	}
+	return nil, ""
+}
+
+// wait re-evaluates the condition on every signal update until it holds or
+// the timeout passes.
+func (s *Sequencer) wait(ctx context.Context, st seqStep) (map[string]float64, string) {
+	// Store sequence numbers rather than timestamps tell fresh values from
+	// old ones, since replays stamp values with the log's times.
+	var after uint64
+	if st.fresh {
+		after = s.app.Store.Seq()
+	}
+	events, _, cancel := s.app.Store.Subscribe(subInternal, 256)
+	defer cancel()
+	timeout := time.NewTimer(st.wait)
+	defer timeout.Stop()
+	for {
+		ok, values, err := s.eval(st.cond, after)
+		if ok {
+			return values, ""
+		}
+		select {
+		case <-events:
+		case <-timeout.C:
+			if err != nil {
+				return values, fmt.Sprintf("condition not met within %s: %v", st.wait, err)
+			}
+			return values, fmt.Sprintf("condition not met within %s", st.wait)
+		case <-ctx.Done():
+			return values, "stopped"
+		}
+	}
+}
+
+// eval evaluates cond over the current signal values, only those stored
+// after store sequence after when it is set.
+func (s *Sequencer) eval(cond *Expr, after uint64) (bool, map[string]float64, error) {
+	values := make(map[string]float64)
+	v, err := cond.Eval(func(name string) (float64, bool) {
+		sv, ok := s.app.Store.Signal(name)
+		if !ok || sv.seq <= after {
+			return 0, false
+		}
+		values[name] = sv.Value
+		return sv.Value, true
+	})
+	if errors.Is(err, errMissingVar) {
+		err = fmt.Errorf("no value for %s", strings.Join(missingVars(cond, values), ", "))
+	}
+	return err == nil && v != 0, values, err
+}
+
+func missingVars(cond *Expr, have map[string]float64) []string {
+	var out []string
+	for _, name := range cond.Vars() {
+		if _, ok := have[name]; !ok {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// Stop stops the run id, or the running one when id is empty.
+func (s *Sequencer) Stop(id string) (SeqRunStatus, error) {
+	s.mu.Lock()
+	var run *seqRun
+	for rid, r := range s.runs {
+		if (id == "" && r.status.State == "running") || rid == id {
+			run = r
+		}
+	}
+	s.mu.Unlock()
+	if run == nil {
+		if id == "" {
+			return SeqRunStatus{}, errors.New("no sequence is running")
+		}
+		return SeqRunStatus{}, fmt.Errorf("unknown run %q", id)
+	}
+	run.stop()
+	<-run.done
+	return s.Get(run.status.ID)
+}
+
+// Close stops the running sequence, if any.
+func (s *Sequencer) Close() { s.Stop("") }
+
+func (s *Sequencer) Get(id string) (SeqRunStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	if !ok {
+		return SeqRunStatus{}, fmt.Errorf("unknown run %q", id)
+	}
+	st := run.status
+	st.Results = append([]SeqStepResult{}, run.status.Results...)
+	return st, nil
+}
+
+func (s *Sequencer) Status() SequencesStatus {
+	out := SequencesStatus{Scripts: s.Scripts(), Runs: []SeqRunStatus{}}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.runs {
+		st := r.status
+		st.Results = nil
+		out.Runs = append(out.Runs, st)
+	}
+	sort.Slice(out.Runs, func(i, j int) bool { return out.Runs[i].Started.After(out.Runs[j].Started) })
+	return out
+}
+
+// pruneLocked forgets the oldest finished runs beyond sequenceKeepFinished;
+// s.mu must be held.
+func (s *Sequencer) pruneLocked() {
+	var ended []*seqRun
+	for _, r := range s.runs {
+		if r.status.State != "running" {
+			ended = append(ended, r)
+		}
+	}
+	if len(ended) <= sequenceKeepFinished {
+		return
+	}
+	sort.Slice(ended, func(i, j int) bool { return ended[i].status.Ended.Before(*ended[j].status.Ended) })
+	for _, r := range ended[:len(ended)-sequenceKeepFinished] {
+		delete(s.runs, r.status.ID)
+	}
+}
+
+func registerSequenceActions(app *App) {
+	app.Control.Register("sequence.run", func(params json.RawMessage) (any, error) {
+		var p struct {
+			Script string `json:"script"` // name in sequences.dir; else the sequence is given inline
+			Sequence
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		seq := p.Sequence
+		if p.Script != "" {
+			var err error
+			if seq, err = app.Sequencer.Load(p.Script); err != nil {
+				return nil, err
+			}
+			if p.Repeat > 0 {
+				seq.Repeat = p.Repeat
+			}
+		}
+		return app.Sequencer.Start(seq)
+	})
+	app.Control.Register("sequence.stop", func(params json.RawMessage) (any, error) {
+		var p struct {
+			ID string `json:"id"` // empty stops the running sequence
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return app.Sequencer.Stop(p.ID)
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// serialBaudSupported accepts any rate: BSD termios takes the speed as a
+// number and the driver rejects what it cannot do when the port is opened.
+func serialBaudSupported(baud int) bool { return baud > 0 }
+
+// openSerial opens dev (a /dev/cu.* device) as a raw 8N1 serial line.
+func openSerial(dev string, baud int) (serialPort, error) {
+	f, err := os.OpenFile(dev, os.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	var terr error
+	err = rc.Control(func(fd uintptr) {
+		t, err := unix.IoctlGetTermios(int(fd), unix.TIOCGETA)
+		if err != nil {
+			terr = err
+			return
+		}
+		t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON | unix.IXOFF
+		t.Oflag &^= unix.OPOST
+		t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		t.Cflag &^= unix.CSIZE | unix.PARENB | unix.CSTOPB | unix.CRTSCTS
+		t.Cflag |= unix.CS8 | unix.CREAD | unix.CLOCAL
+		t.Ispeed, t.Ospeed = uint64(baud), uint64(baud)
+		t.Cc[unix.VMIN], t.Cc[unix.VTIME] = 1, 0
+		terr = unix.IoctlSetTermios(int(fd), unix.TIOCSETA, t)
+	})
+	if err == nil {
+		err = terr
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("configure %s: %w", dev, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import "errors"
+
+func serialBaudSupported(baud int) bool { return baud > 0 }
+
+func openSerial(string, int) (serialPort, error) {
+	return nil, errors.New("serial ports are not supported on this platform")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	dcbBinary     = 0x1
+	dcbDTREnable  = 0x1 << 4
+	dcbRTSEnable  = 0x1 << 12
+	commPollMs    = 100 // longest a read waits before checking deadline and close
+	commNoTimeout = ^uint32(0)
+)
+
+func serialBaudSupported(baud int) bool { return baud > 0 }
+
+// comPort is a COM port opened for synchronous I/O. Reads return after at
+// most commPollMs without data, which is how deadlines and Close take
+// effect.
+type comPort struct {
+	h      windows.Handle
+	closed atomic.Bool
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+// openSerial opens dev (COM3, or \\.\COM12) as a raw 8N1 serial line.
+func openSerial(dev string, baud int) (serialPort, error) {
+	path := dev
+	if !strings.HasPrefix(path, `\\.\`) {
+		path = `\\.\` + path
+	}
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := windows.CreateFile(p, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	dcb := windows.DCB{
+		BaudRate: uint32(baud),
+		Flags:    dcbBinary | dcbDTREnable | dcbRTSEnable,
+		ByteSize: 8,
+	}
+	dcb.DCBlength = uint32(unsafe.Sizeof(dcb))
+	timeouts := windows.CommTimeouts{
+		ReadIntervalTimeout:        commNoTimeout,
+		ReadTotalTimeoutMultiplier: commNoTimeout,
+		ReadTotalTimeoutConstant:   commPollMs,
+		WriteTotalTimeoutConstant:  1000,
+	}
+	if err := windows.SetCommState(h, &dcb); err != nil {
+		windows.CloseHandle(h)
+		return nil, fmt.Errorf("configure %s: %w", dev, err)
+	}
+	if err := windows.SetCommTimeouts(h, &timeouts); err != nil {
+		windows.CloseHandle(h)
+		return nil, fmt.Errorf("configure %s: %w", dev, err)
+	}
+	return &comPort{h: h}, nil
+}
+
+func (c *comPort) Read(b []byte) (int, error) {
+	for {
+		if c.closed.Load() {
+			return 0, os.ErrClosed
+		}
+		var n uint32
+		if err := windows.ReadFile(c.h, b, &n, nil); err != nil {
+			return 0, err
+		}
+		if n > 0 {
+			return int(n), nil
+		}
+		c.mu.Lock()
+		d := c.deadline
+		c.mu.Unlock()
+		if !d.IsZero() && time.Now().After(d) {
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (c *comPort) Write(b []byte) (int, error) {
+	if c.closed.Load() {
+		return 0, os.ErrClosed
+	}
+	var n uint32
+	err := windows.WriteFile(c.h, b, &n, nil)
+	return int(n), err
+}
+
+func (c *comPort) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *comPort) Close() error {
+	if c.closed.Swap(true) {
+		return os.ErrClosed
+	}
+	windows.CancelIoEx(c.h, nil)
+	return windows.CloseHandle(c.h)
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SessionsConfig struct {
+	Dir string `yaml:"dir"` // one JSON file per session; empty keeps sessions in memory only
+}
+
+// Session is one visit or test: a stretch of time with who did it on which
+// vehicle. History, the recording, alerts and frame counts of that stretch
+// are grouped under it.
+type Session struct {
+	ID          string        `json:"id"` // start time and name, e.g. 20240501-142233-brake-test
+	Name        string        `json:"name,omitempty"`
+	VIN         string        `json:"vin,omitempty"`
+	Operator    string        `json:"operator,omitempty"`
+	Notes       string        `json:"notes,omitempty"`
+	Bus         string        `json:"bus"`
+	Profile     string        `json:"profile,omitempty"`
+	StartedAt   time.Time     `json:"started_at"`
+	EndedAt     *time.Time    `json:"ended_at,omitempty"`    // nil while active
+	Interrupted bool          `json:"interrupted,omitempty"` // the server stopped without ending it
+	Recording   string        `json:"recording,omitempty"`   // started with the session
+	Alerts      []AlertEvent  `json:"alerts,omitempty"`
+	Stats       *SessionStats `json:"stats,omitempty"` // so far while active
+}
+
+// SessionStats counts the traffic of a session.
+type SessionStats struct {
+	Frames      uint64            `json:"frames"`
+	Bytes       uint64            `json:"bytes"`
+	ErrorFrames uint64            `json:"error_frames"`
+	IDs         map[string]uint64 `json:"ids,omitempty"` // frames per ID
+
+	Signals map[string]SignalRange `json:"signals,omitempty"` // by FRAME.signal
+}
+
+// SignalRange is the envelope of one signal's values over a session.
+type SignalRange struct {
+	Unit  string  `json:"unit,omitempty"`
+	Count uint64  `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+}
+
+func (r *SignalRange) observe(v float64) {
+	if r.Count == 0 || v < r.Min {
+		r.Min = v
+	}
+	if r.Count == 0 || v > r.Max {
+		r.Max = v
+	}
+	r.Count++
+	r.Mean += (v - r.Mean) / float64(r.Count)
+}
+
+// window returns the span of the session; until is zero while it is active.
+func (s Session) window() (since, until time.Time) {
+	if s.EndedAt != nil {
+		until = *s.EndedAt
+	}
+	return s.StartedAt, until
+}
+
+// sessionCounters are the cumulative counters a session's stats are the
+// difference of.
+type sessionCounters struct {
+	frames, bytes, errors uint64
+	ids                   map[string]uint64
+}
+
+func readSessionCounters(app *App) sessionCounters {
+	st := app.Stats.Snapshot()
+	c := sessionCounters{frames: st.TotalFrames, bytes: st.TotalBytes, errors: app.Errors.Snapshot().Total, ids: make(map[string]uint64, len(st.IDs))}
+	for _, id := range st.IDs {
+		c.ids[id.ID] = id.Count
+	}
+	return c
+}
+
+func (c sessionCounters) since(base sessionCounters) *SessionStats {
+	st := &SessionStats{Frames: c.frames - base.frames, Bytes: c.bytes - base.bytes, ErrorFrames: c.errors - base.errors, IDs: make(map[string]uint64)}
+	for id, n := range c.ids {
+		if n > base.ids[id] {
+			st.IDs[id] = n - base.ids[id]
+		}
+	}
+	return st
+}
+
+var errNoSession = errors.New("no such session")
+
+// Sessions holds the active session, if any, and the past ones.
+type Sessions struct {
+	dir string
+
+	mu     sync.Mutex
+	items  map[string]*Session
+	active *Session
+	base   sessionCounters
+	ranges map[string]*SignalRange // of the active session
+}
+
+func NewSessions(cfg SessionsConfig) (*Sessions, error) {
+	s := &Sessions{dir: cfg.Dir, items: make(map[string]*Session)}
+	if s.dir == "" {
+		return s, nil
+	}
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("sessions: %w", err)
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("sessions: %w", err)
+		}
+		var sess Session
+		if err := json.Unmarshal(b, &sess); err != nil {
+			return nil, fmt.Errorf("sessions %s: %w", f, err)
+		}
+		if sess.EndedAt == nil {
+			sess.Interrupted = true
+		}
+		s.items[sess.ID] = &sess
+	}
+	return s, nil
+}
+
+func newSessionID(name string, now time.Time) string {
+	id := now.Format("20060102-150405")
+	if name = strings.Trim(recordingNameRe.ReplaceAllString(name, "_"), "_."); name != "" {
+		id += "-" + name
+	}
+	return id
+}
+
+// Start begins sess, which must have its ID and start time set.
+func (s *Sessions) Start(sess Session, base sessionCounters) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active != nil {
+		return *s.active, fmt.Errorf("session %q is active", s.active.ID)
+	}
+	if _, ok := s.items[sess.ID]; ok {
+		return sess, fmt.Errorf("session %q exists", sess.ID)
+	}
+	sess.Alerts = []AlertEvent{}
+	if err := s.writeLocked(&sess); err != nil {
+		return sess, err
+	}
+	s.items[sess.ID] = &sess
+	s.active, s.base = &sess, base
+	s.ranges = make(map[string]*SignalRange)
+	return sess, nil
+}
+
+// Stop ends the active session at end, with the traffic since it started.
+func (s *Sessions) Stop(end time.Time, now sessionCounters) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return Session{}, errors.New("no active session")
+	}
+	sess := s.active
+	sess.EndedAt = &end
+	sess.Stats = s.statsLocked(now)
+	s.active, s.ranges = nil, nil
+	return *sess, s.writeLocked(sess)
+}
+
+// Active returns the ID of the active session, or "".
+func (s *Sessions) Active() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return ""
+	}
+	return s.active.ID
+}
+
+// ObserveSignals widens the signal ranges of the active session.
+func (s *Sessions) ObserveSignals(values []SignalValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return
+	}
+	for _, v := range values {
+		key := v.FrameName + "." + v.Name
+		r := s.ranges[key]
+		if r == nil {
+			r = &SignalRange{Unit: v.Unit}
+			s.ranges[key] = r
+		}
+		r.observe(v.Value)
+	}
+}
+
+func (s *Sessions) statsLocked(now sessionCounters) *SessionStats {
+	st := now.since(s.base)
+	st.Signals = make(map[string]SignalRange, len(s.ranges))
+	for k, r := range s.ranges {
+		st.Signals[k] = *r
+	}
+	return st
+}
+
+// ObserveAlert adds ev to the active session.
+func (s *Sessions) ObserveAlert(ev AlertEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active != nil {
+		s.active.Alerts = append(s.active.Alerts, ev)
+	}
+}
+
+// List returns the sessions newest first, without their alerts, per-ID
+// counts and signal ranges.
+func (s *Sessions) List() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Session, 0, len(s.items))
+	for _, sess := range s.items {
+		c := *sess
+		c.Alerts = nil
+		if c.Stats != nil {
+			st := *c.Stats
+			st.IDs, st.Signals = nil, nil
+			c.Stats = &st
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.After(out[j].StartedAt) })
+	return out
+}
+
+// Get returns the session id; the stats of the active session are taken
+// against now.
+func (s *Sessions) Get(id string, now sessionCounters) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.items[id]
+	if !ok {
+		return Session{}, fmt.Errorf("%w %q", errNoSession, id)
+	}
+	out := *sess
+	out.Alerts = append([]AlertEvent{}, sess.Alerts...)
+	if sess == s.active {
+		out.Stats = s.statsLocked(now)
+	}
+	return out, nil
+}
+
+// Delete forgets a past session. Its recording and history are left alone.
+func (s *Sessions) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.items[id]
+	if !ok {
+		return fmt.Errorf("%w %q", errNoSession, id)
+	}
+	if sess == s.active {
+		return fmt.Errorf("session %q is active", id)
+	}
+	if s.dir != "" {
+		if err := os.Remove(filepath.Join(s.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("sessions: %w", err)
+		}
+	}
+	delete(s.items, id)
+	return nil
+}
+
+func (s *Sessions) writeLocked(sess *Session) error {
+	if s.dir == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("sessions: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, sess.ID+".json"), append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("sessions: %w", err)
+	}
+	return nil
+}
+
+type sessionStart struct {
+	Name     string `json:"name"`
+	VIN      string `json:"vin"`
+	Operator string `json:"operator"`
+	Notes    string `json:"notes"`
+	Record   bool   `json:"record"` // also start a recording named after the session
+}
+
+// startSession starts a session, its recording if asked for, and marks the
+// start in the marker log and the recording.
+func startSession(app *App, p sessionStart) (Session, error) {
+	now := time.Now()
+	sess := Session{
+		ID:        newSessionID(p.Name, now),
+		Name:      p.Name,
+		VIN:       strings.ToUpper(strings.TrimSpace(p.VIN)),
+		Operator:  p.Operator,
+		Notes:     p.Notes,
+		Bus:       app.Iface,
+		Profile:   app.Profiles.Active(),
+		StartedAt: now,
+	}
+	if id := app.Sessions.Active(); id != "" {
+		return sess, fmt.Errorf("session %q is active", id)
+	}
+	if p.Record {
+		rs, err := app.Recorder.Start(sess.ID)
+		if err != nil {
+			return sess, fmt.Errorf("recording: %w", err)
+		}
+		sess.Recording = rs.Name
+	}
+	sess, err := app.Sessions.Start(sess, readSessionCounters(app))
+	if err != nil {
+		if p.Record {
+			app.Recorder.Stop()
+		}
+		return sess, err
+	}
+	label := "session start " + sess.ID
+	app.Recorder.WriteMarker(label, now)
+	app.Markers.Add(label, now)
+	slog.Info("session started", "id", sess.ID, "vin", sess.VIN, "operator", sess.Operator)
+	return sess, nil
+}
+
+// stopSession ends the active session and the recording started with it.
+func stopSession(app *App) (Session, error) {
+	id := app.Sessions.Active()
+	if id == "" {
+		return Session{}, errors.New("no active session")
+	}
+	now := time.Now()
+	label := "session stop " + id
+	app.Recorder.WriteMarker(label, now)
+	app.Markers.Add(label, now)
+	sess, err := app.Sessions.Stop(now, readSessionCounters(app))
+	if sess.ID == "" {
+		return sess, err // ended concurrently
+	}
+	if sess.Recording != "" && app.Recorder.Status().Name == sess.Recording {
+		if _, rerr := app.Recorder.Stop(); rerr != nil {
+			err = errors.Join(err, fmt.Errorf("recording: %w", rerr))
+		}
+	}
+	slog.Info("session stopped", "id", id, "frames", sess.Stats.Frames, "alerts", len(sess.Alerts))
+	return sess, err
+}
+
+// WriteSessionZip writes a session as a zip of session.json, its recording
+// and its history samples as history.csv.
+func WriteSessionZip(w io.Writer, app *App, sess Session) error {
+	z := zip.NewWriter(w)
+	f, err := z.Create("session.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(sess); err != nil {
+		return err
+	}
+	if sess.Recording != "" {
+		if path, err := app.Recorder.File(sess.Recording); err == nil {
+			if err := zipFile(z, sess.Recording+".log", path); err != nil {
+				return err
+			}
+		}
+	}
+	if app.History != nil {
+		f, err := z.Create("history.csv")
+		if err != nil {
+			return err
+		}
+		since, until := sess.window()
+		if err := app.History.Export(f, since, until); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+func zipFile(z *zip.Writer, name, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := z.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func registerSessionActions(app *App) {
+	app.Control.Register("session.start", func(params json.RawMessage) (any, error) {
+		var p sessionStart
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return startSession(app, p)
+	})
+	app.Control.Register("session.stop", func(params json.RawMessage) (any, error) {
+		return stopSession(app)
+	})
+	app.Control.Register("session.delete", func(params json.RawMessage) (any, error) {
+		var p struct {
+			ID string `json:"id"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if err := app.Sessions.Delete(p.ID); err != nil {
+			return nil, err
+		}
+		return map[string]string{"deleted": p.ID}, nil
+	})
+}
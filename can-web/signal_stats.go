@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SignalStat summarises the values of one signal since start or the last
+// reset.
+type SignalStat struct {
+	Signal    string    `json:"signal"` // FRAME.signal
+	Unit      string    `json:"unit"`
+	Count     uint64    `json:"count"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	Mean      float64   `json:"mean"`
+	StdDev    float64   `json:"stddev"`
+	Last      float64   `json:"last"`
+	MinAt     time.Time `json:"min_at"`
+	MaxAt     time.Time `json:"max_at"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	RateHz    float64   `json:"rate_hz"` // updates per second between first and last
+}
+
+type signalStatEntry struct {
+	unit         string
+	count        uint64
+	min, max     float64
+	minAt, maxAt time.Time
+	mean, m2     float64 // Welford's running mean and sum of squared deviations
+	last         float64
+	first, seen  time.Time
+}
+
+// SignalStatsResponse is served by /api/signal-stats.
+type SignalStatsResponse struct {
+	Since   time.Time    `json:"since"` // start or last full reset
+	Signals []SignalStat `json:"signals"`
+}
+
+// SignalStats keeps running min, max, mean and update rate per signal, so
+// peaks can be read back without logging the whole run.
+type SignalStats struct {
+	mu      sync.Mutex
+	entries map[string]*signalStatEntry
+	since   time.Time
+}
+
+func NewSignalStats() *SignalStats {
+	return &SignalStats{entries: make(map[string]*signalStatEntry), since: time.Now()}
+}
+
+func (s *SignalStats) Observe(values []SignalValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range values {
+		key := v.FrameName + "." + v.Name
+		e, ok := s.entries[key]
+		if !ok {
+			e = &signalStatEntry{min: v.Value, max: v.Value, minAt: v.UpdatedAt, maxAt: v.UpdatedAt, first: v.UpdatedAt}
+			s.entries[key] = e
+		}
+		e.unit = v.Unit
+		e.count++
+		if v.Value < e.min {
+			e.min, e.minAt = v.Value, v.UpdatedAt
+		}
+		if v.Value > e.max {
+			e.max, e.maxAt = v.Value, v.UpdatedAt
+		}
+		d := v.Value - e.mean
+		e.mean += d / float64(e.count)
+		e.m2 += d * (v.Value - e.mean)
+		e.last, e.seen = v.Value, v.UpdatedAt
+	}
+}
+
+// Snapshot returns the stats ordered by signal. A non-empty names keeps
+// only those FRAME.signal keys.
+func (s *SignalStats) Snapshot(names []string) SignalStatsResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.entries))
+	if len(names) > 0 {
+		for _, n := range names {
+			if _, ok := s.entries[n]; ok {
+				keys = append(keys, n)
+			}
+		}
+	} else {
+		for k := range s.entries {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	out := make([]SignalStat, 0, len(keys))
+	for _, k := range keys {
+		e := s.entries[k]
+		st := SignalStat{
+			Signal:    k,
+			Unit:      e.unit,
+			Count:     e.count,
+			Min:       e.min,
+			Max:       e.max,
+			Mean:      e.mean,
+			StdDev:    math.Sqrt(e.m2 / float64(e.count)),
+			Last:      e.last,
+			MinAt:     e.minAt,
+			MaxAt:     e.maxAt,
+			FirstSeen: e.first,
+			LastSeen:  e.seen,
+		}
+		if span := e.seen.Sub(e.first).Seconds(); span > 0 {
+			st.RateHz = float64(e.count-1) / span
+		}
+		out = append(out, st)
+	}
+	return SignalStatsResponse{Since: s.since, Signals: out}
+}
+
+// Reset clears the stats of the given FRAME.signal keys, or of every
+// signal when names is empty. It returns the number of signals cleared.
+func (s *SignalStats) Reset(names []string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(names) == 0 {
+		n := len(s.entries)
+		s.entries = make(map[string]*signalStatEntry)
+		s.since = time.Now()
+		return n
+	}
+	n := 0
+	for _, name := range names {
+		if _, ok := s.entries[name]; ok {
+			delete(s.entries, name)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSSink publishes events to "<subject>.signal.<FRAME>.<signal>" and
+// "<subject>.raw.<ID>", so consumers can subscribe with wildcards such as
+// "can.*.signal.BATT_STATE.>".
+type NATSSink struct {
+	nc      *nats.Conn
+	subject string
+}
+
+func NewNATSSink(cfg SinkConfig) (*NATSSink, error) {
+	url := cfg.URL
+	if url == "" {
+		url = nats.DefaultURL
+	}
+	nc, err := nats.Connect(url,
+		nats.Name("can-web "+cfg.Source),
+		nats.MaxReconnects(-1),
+		nats.RetryOnFailedConnect(true),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				slog.Warn("sink disconnected", "sink", cfg.Name, "err", err)
+			}
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			slog.Info("sink connected", "sink", cfg.Name, "url", c.ConnectedUrl())
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSSink{nc: nc, subject: cfg.Subject}, nil
+}
+
+func (s *NATSSink) Publish(typ, key string, payload []byte) error {
+	tokens := strings.Split(key, ".")
+	for i, t := range tokens {
+		tokens[i] = natsToken(t)
+	}
+	return s.nc.Publish(s.subject+"."+typ+"."+strings.Join(tokens, "."), payload)
+}
+
+func (s *NATSSink) Close() error {
+	return s.nc.Drain()
+}
+
+// natsToken replaces characters that are not allowed in a subject token.
+func natsToken(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '.', '*', '>':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+const sinkBuffer = 4096
+
+// EventSink publishes decoded signals and raw frames to an external system.
+// typ is "signal" or "raw"; key is "FRAME.signal" or the frame ID.
+type EventSink interface {
+	Publish(typ, key string, payload []byte) error
+	Close() error
+}
+
+// SinkConfig configures one sink. Events selects "signal" and/or "raw"
+// (default both). Subject is the subject or topic prefix, by default
+// "can.<iface>"; Source identifies this gateway in every message and
+// defaults to the host name.
+type SinkConfig struct {
+	Name    string   `yaml:"name"`
+	Type    string   `yaml:"type"`
+	URL     string   `yaml:"url"`
+	Subject string   `yaml:"subject"`
+	Source  string   `yaml:"source"`
+	Events  []string `yaml:"events"`
+}
+
+// SinkMessage is the JSON envelope published for every event.
+type SinkMessage struct {
+	Source string `json:"source"`
+	Iface  string `json:"iface"`
+	Type   string `json:"type"`
+	Data   any    `json:"data"`
+}
+
+type SinkStatus struct {
+	Name      string     `json:"name"`
+	Type      string     `json:"type"`
+	Published uint64     `json:"published"`
+	Errors    uint64     `json:"errors"`
+	Dropped   uint64     `json:"dropped"`
+	LastError string     `json:"last_error,omitempty"`
+	LastErrAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type sinkRunner struct {
+	cfg     SinkConfig
+	sink    EventSink
+	signals bool
+	raw     bool
+
+	mu      sync.Mutex
+	status  SinkStatus
+	dropped func() uint64
+}
+
+// Sinks fans store events out to the configured event sinks.
+type Sinks struct {
+	runners []*sinkRunner
+}
+
+func NewSinks(cfgs []SinkConfig, iface string) (*Sinks, error) {
+	s := &Sinks{}
+	host, _ := os.Hostname()
+	for i, c := range cfgs {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("%s%d", c.Type, i)
+		}
+		if c.Subject == "" {
+			c.Subject = "can." + iface
+		}
+		if c.Source == "" {
+			c.Source = host
+		}
+		r := &sinkRunner{cfg: c, status: SinkStatus{Name: c.Name, Type: c.Type}}
+		if len(c.Events) == 0 {
+			r.signals, r.raw = true, true
+		}
+		for _, e := range c.Events {
+			switch e {
+			case "signal":
+				r.signals = true
+			case "raw":
+				r.raw = true
+			default:
+				return nil, fmt.Errorf("sink %s: unknown event type %q (want signal or raw)", c.Name, e)
+			}
+		}
+
+		var err error
+		switch c.Type {
+		case "nats":
+			r.sink, err = NewNATSSink(c)
+		default:
+			err = fmt.Errorf("unknown type %q (want nats)", c.Type)
+		}
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("sink %s: %w", c.Name, err)
+		}
+		s.runners = append(s.runners, r)
+	}
+	return s, nil
+}
+
+// Run publishes the store events of every bus to every sink until ctx is
+// cancelled, then closes the sinks. Each sink has its own subscription per
+// bus, so a slow sink drops its own events without holding up the others.
+func (s *Sinks) Run(ctx context.Context, buses []*App) {
+	var wg sync.WaitGroup
+	for _, r := range s.runners {
+		var counters []func() uint64
+		for _, b := range buses {
+			events, dropped, cancel := b.Store.Subscribe(subSink, sinkBuffer)
+			counters = append(counters, dropped)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer cancel()
+				r.run(ctx, events, b.Iface)
+			}()
+		}
+		r.mu.Lock()
+		r.dropped = func() uint64 {
+			var n uint64
+			for _, c := range counters {
+				n += c()
+			}
+			return n
+		}
+		r.mu.Unlock()
+	}
+	wg.Wait()
+	s.Close()
+}
+
+// run publishes events until ctx is cancelled, then publishes whatever is
+// still queued so the last frames before shutdown are not lost.
+func (r *sinkRunner) run(ctx context.Context, events <-chan StoreEvent, iface string) {
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case ev := <-events:
+					r.publish(ev, iface)
+				default:
+					return
+				}
+			}
+		case ev := <-events:
+			r.publish(ev, iface)
+		}
+	}
+}
+
+func (r *sinkRunner) publish(ev StoreEvent, iface string) {
+	msg := SinkMessage{Source: r.cfg.Source, Iface: iface}
+	var key string
+	switch {
+	case ev.Signal != nil && r.signals:
+		msg.Type, msg.Data = "signal", ev.Signal
+		key = ev.Signal.FrameName + "." + ev.Signal.Name
+	case ev.Raw != nil && r.raw:
+		msg.Type, msg.Data = "raw", ev.Raw
+		key = ev.Raw.ID
+	default:
+		return
+	}
+	b, err := json.Marshal(msg)
+	if err == nil {
+		err = r.sink.Publish(msg.Type, key, b)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		now := time.Now()
+		if r.status.LastErrAt == nil || now.Sub(*r.status.LastErrAt) > time.Minute {
+			slog.Error("sink publish failed", "sink", r.cfg.Name, "err", err)
+		}
+		r.status.Errors++
+		r.status.LastError = err.Error()
+		r.status.LastErrAt = &now
+	} else {
+		r.status.Published++
+	}
+}
+
+func (s *Sinks) Close() {
+	for _, r := range s.runners {
+		if r.sink != nil {
+			if err := r.sink.Close(); err != nil {
+				slog.Error("sink close failed", "sink", r.cfg.Name, "err", err)
+			}
+		}
+	}
+}
+
+func (s *Sinks) Status() []SinkStatus {
+	out := make([]SinkStatus, 0, len(s.runners))
+	for _, r := range s.runners {
+		r.mu.Lock()
+		st := r.status
+		if r.dropped != nil {
+			st.Dropped = r.dropped()
+		}
+		r.mu.Unlock()
+		out = append(out, st)
+	}
+	return out
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+const slcanDefaultSerialBaud = 115200
+
+// SLCANConfig configures the slcan source: a USB or serial CAN adapter
+// speaking the LAWICEL protocol, opened directly without slcand. The CAN
+// bitrate is the bitrate setting.
+type SLCANConfig struct {
+	Device     string `yaml:"device"`      // e.g. /dev/ttyACM0 or /dev/ttyUSB0
+	SerialBaud int    `yaml:"serial_baud"` // default 115200; USB CDC adapters ignore it
+	ListenOnly bool   `yaml:"listen_only"` // open with L: the adapter neither ACKs nor sends
+}
+
+// slcanBitrates are the bitrates of the S0-S8 commands.
+var slcanBitrates = []int{10000, 20000, 50000, 100000, 125000, 250000, 500000, 800000, 1000000}
+
+// slcanPort reads frames from an SLCAN adapter and sends frames through it.
+type slcanPort struct {
+	cfg     SLCANConfig
+	bitcmd  string // S0-S8, empty to keep the adapter's bitrate
+	bitrate int
+
+	mu  sync.Mutex
+	f   serialPort // nil while closed
+	app *App
+}
+
+func init() {
+	registerBackend("slcan", func(cfg Config) (busBackend, error) {
+		return newSLCANPort(cfg.SLCAN, cfg.Bitrate)
+	})
+}
+
+func newSLCANPort(cfg SLCANConfig, bitrate int) (*slcanPort, error) {
+	p := &slcanPort{cfg: cfg, bitrate: bitrate}
+	if cfg.Device == "" {
+		return nil, errors.New("slcan source needs slcan.device (CAN_SLCAN_DEVICE)")
+	}
+	if bitrate != 0 {
+		for i, b := range slcanBitrates {
+			if b == bitrate {
+				p.bitcmd = "S" + strconv.Itoa(i)
+			}
+		}
+		if p.bitcmd == "" {
+			return nil, fmt.Errorf("slcan: bitrate %d not supported (want one of %v, or 0 to keep the adapter's)", bitrate, slcanBitrates)
+		}
+	}
+	if p.cfg.SerialBaud == 0 {
+		p.cfg.SerialBaud = slcanDefaultSerialBaud
+	}
+	if !serialBaudSupported(p.cfg.SerialBaud) {
+		return nil, fmt.Errorf("slcan: serial_baud %d not supported", cfg.SerialBaud)
+	}
+	return p, nil
+}
+
+// serialPort is a serial line opened raw, 8N1. The read deadline is only
+// used during the handshake.
+type serialPort interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+}
+
+func (p *slcanPort) session(ctx context.Context, app *App) error {
+	f, err := openSerial(p.cfg.Device, p.cfg.SerialBaud)
+	if err != nil {
+		return fmt.Errorf("slcan open(%s): %w", p.cfg.Device, err)
+	}
+	defer f.Close()
+
+	// Unblock reads on shutdown.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.Close()
+		case <-done:
+		}
+	}()
+
+	// Flush any half-typed command with bare CRs and close the channel in
+	// case a previous run left it open, then drop the replies.
+	r := bufio.NewReader(f)
+	if _, err := io.WriteString(f, "\r\r\rC\r"); err != nil {
+		return fmt.Errorf("slcan write: %w", err)
+	}
+	f.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	for {
+		if _, err := r.ReadByte(); err != nil {
+			break
+		}
+	}
+	f.SetReadDeadline(time.Now().Add(remoteHandshakeWait))
+	open := "O"
+	if p.cfg.ListenOnly {
+		open = "L"
+	}
+	for _, cmd := range []string{p.bitcmd, open} {
+		if cmd == "" {
+			continue
+		}
+		if _, err := io.WriteString(f, cmd+"\r"); err != nil {
+			return err
+		}
+		if msg, err := slcanRead(r); err != nil {
+			return fmt.Errorf("slcan %s: %w", cmd, err)
+		} else if msg != "" {
+			return fmt.Errorf("slcan %s: unexpected reply %q", cmd, msg)
+		}
+	}
+	f.SetReadDeadline(time.Time{})
+
+	p.mu.Lock()
+	p.f, p.app = f, app
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.f = nil
+		p.mu.Unlock()
+		io.WriteString(f, "C\r")
+	}()
+
+	app.Conn.Connected()
+	slog.Info("slcan connected", "device", p.cfg.Device, "bitrate", p.bitrate, "listen_only", p.cfg.ListenOnly)
+	for {
+		msg, err := slcanRead(r)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, errSLCANRefused) {
+				slog.Warn("slcan: adapter refused a command")
+				continue
+			}
+			return fmt.Errorf("slcan read: %w", err)
+		}
+		if msg == "" {
+			continue
+		}
+		switch msg[0] {
+		case 't', 'T', 'r', 'R':
+			fr, err := parseSLCANFrame(msg)
+			if err != nil {
+				slog.Warn("slcan: bad frame", "msg", msg, "err", err)
+				continue
+			}
+			processFrame(app, fr, time.Now())
+		case 'z', 'Z':
+			// transmit acknowledged
+		default:
+			slog.Debug("slcan: ignored message", "msg", msg)
+		}
+	}
+}
+
+var errSLCANRefused = errors.New("refused (BEL)")
+
+// slcanRead returns the next CR-terminated message without the CR. An
+// empty message is the adapter's OK; BEL is returned as errSLCANRefused.
+func slcanRead(r *bufio.Reader) (string, error) {
+	var b []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case '\r':
+			return string(b), nil
+		case '\a':
+			return "", errSLCANRefused
+		case '\n':
+			// some adapters send CRLF
+		default:
+			b = append(b, c)
+		}
+	}
+}
+
+// parseSLCANFrame decodes tiiiLdd.., Tiiiiiiii Ldd.., riiiL and RiiiiiiiiL.
+// A trailing 4-digit timestamp (Z1) is ignored.
+func parseSLCANFrame(msg string) (can.Frame, error) {
+	var f can.Frame
+	idLen := 3
+	switch msg[0] {
+	case 'T':
+		idLen, f.IsExtended = 8, true
+	case 'r':
+		f.IsRemote = true
+	case 'R':
+		idLen, f.IsExtended, f.IsRemote = 8, true, true
+	}
+	if len(msg) < 1+idLen+1 {
+		return f, errors.New("too short")
+	}
+	id, err := strconv.ParseUint(msg[1:1+idLen], 16, 32)
+	if err != nil {
+		return f, fmt.Errorf("id: %w", err)
+	}
+	f.ID = uint32(id)
+	dlc := msg[1+idLen] - '0'
+	if dlc > 8 {
+		return f, fmt.Errorf("dlc %q", msg[1+idLen])
+	}
+	f.Length = dlc
+	if !f.IsRemote {
+		data := msg[2+idLen:]
+		if len(data) < 2*int(dlc) {
+			return f, errors.New("data shorter than dlc")
+		}
+		if _, err := hex.Decode(f.Data[:dlc], []byte(data[:2*dlc])); err != nil {
+			return f, fmt.Errorf("data: %w", err)
+		}
+	}
+	return f, f.Validate()
+}
+
+func formatSLCANFrame(f can.Frame) string {
+	var head string
+	switch {
+	case f.IsExtended && f.IsRemote:
+		head = fmt.Sprintf("R%08X", f.ID)
+	case f.IsExtended:
+		head = fmt.Sprintf("T%08X", f.ID)
+	case f.IsRemote:
+		head = fmt.Sprintf("r%03X", f.ID)
+	default:
+		head = fmt.Sprintf("t%03X", f.ID)
+	}
+	if f.IsRemote {
+		return fmt.Sprintf("%s%d\r", head, f.Length)
+	}
+	return fmt.Sprintf("%s%d%X\r", head, f.Length, f.Data[:f.Length])
+}
+
+// Transmit sends f through the adapter. Adapters do not echo what they
+// send, so the frame is fed back into the frame path as tx, as SocketCAN's
+// loopback would.
+func (p *slcanPort) Transmit(_ context.Context, f can.Frame) error {
+	if p.cfg.ListenOnly {
+		return errors.New("slcan adapter is open in listen-only mode")
+	}
+	p.mu.Lock()
+	if p.f == nil {
+		p.mu.Unlock()
+		return errors.New("slcan adapter not connected")
+	}
+	_, err := io.WriteString(p.f, formatSLCANFrame(f))
+	app := p.app
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	ingestFrame(app, f, userStamp(time.Now()), "tx")
+	return nil
+}
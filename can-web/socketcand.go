@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.einride.tech/can"
+	"go.einride.tech/can/pkg/socketcan"
+)
+
+const (
+	socketcandPort      = "29536"
+	remoteHandshakeWait = 5 * time.Second
+)
+
+// RemoteConfig configures the socketcand and cannelloni sources. The
+// remote interface is the iface setting.
+type RemoteConfig struct {
+	Addr   string `yaml:"addr"`   // socketcand server or cannelloni peer, host:port
+	Listen string `yaml:"listen"` // cannelloni only: local UDP address
+}
+
+// socketcandClient reads a remote bus from a socketcand server in raw mode
+// and sends frames over the same connection.
+type socketcandClient struct {
+	addr string
+	bus  string
+
+	mu   sync.Mutex
+	conn net.Conn // nil while disconnected
+}
+
+func init() {
+	registerBackend("socketcand", func(cfg Config) (busBackend, error) {
+		if cfg.Remote.Addr == "" {
+			return nil, errors.New("socketcand source needs remote.addr (CAN_REMOTE_ADDR)")
+		}
+		return newSocketcandClient(cfg.Remote.Addr, cfg.Iface), nil
+	})
+}
+
+func newSocketcandClient(addr, bus string) *socketcandClient {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, socketcandPort)
+	}
+	return &socketcandClient{addr: addr, bus: bus}
+}
+
+func (c *socketcandClient) session(ctx context.Context, app *App) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("socketcand dial(%s): %w", c.addr, err)
+	}
+	defer conn.Close()
+
+	// Unblock reads on shutdown.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	r := bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(remoteHandshakeWait))
+	if err := socketcandExpect(r, "hi"); err != nil {
+		return err
+	}
+	for _, cmd := range []string{"open " + c.bus, "rawmode"} {
+		if _, err := fmt.Fprintf(conn, "< %s >", cmd); err != nil {
+			return err
+		}
+		if err := socketcandExpect(r, "ok"); err != nil {
+			return fmt.Errorf("socketcand %s: %w", cmd, err)
+		}
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+	}()
+
+	app.Conn.Connected()
+	slog.Info("socketcand connected", "addr", c.addr)
+	for {
+		msg, err := socketcandRead(r)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("socketcand read: %w", err)
+		}
+		now := time.Now()
+		switch f, ef, kind, err := parseSocketcandFrame(msg); {
+		case err != nil:
+			slog.Warn("socketcand: bad message", "msg", msg, "err", err)
+		case kind == "frame":
+			processFrame(app, f, now)
+		case kind == "error":
+			processErrorFrame(app, ef, userStamp(now))
+		}
+	}
+}
+
+func (c *socketcandClient) Transmit(_ context.Context, f can.Frame) error {
+	if f.IsRemote {
+		return errors.New("socketcand cannot send remote frames")
+	}
+	id := fmt.Sprintf("%03X", f.ID)
+	if f.IsExtended {
+		id = fmt.Sprintf("%08X", f.ID)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "< send %s %d", id, f.Length)
+	for _, x := range f.Data[:f.Length] {
+		fmt.Fprintf(&b, " %02X", x)
+	}
+	b.WriteString(" >")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return errors.New("socketcand not connected")
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_, err := c.conn.Write([]byte(b.String()))
+	return err
+}
+
+// socketcandRead returns the body of the next "< ... >" message.
+func socketcandRead(r *bufio.Reader) (string, error) {
+	if _, err := r.ReadString('<'); err != nil {
+		return "", err
+	}
+	msg, err := r.ReadString('>')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimSuffix(msg, ">")), nil
+}
+
+func socketcandExpect(r *bufio.Reader, want string) error {
+	msg, err := socketcandRead(r)
+	if err != nil {
+		return err
+	}
+	if msg != want {
+		return fmt.Errorf("got %q, want %q", msg, want)
+	}
+	return nil
+}
+
+// parseSocketcandFrame parses raw mode messages:
+//
+//	frame <id> <sec.usec> <data>   data as one hex string or hex bytes
+//	error <class> <sec.usec> [data]
+//
+// An 8-digit ID is extended. kind is "" for other messages.
+func parseSocketcandFrame(msg string) (f can.Frame, ef socketcan.ErrorFrame, kind string, err error) {
+	fields := strings.Fields(msg)
+	if len(fields) == 0 || (fields[0] != "frame" && fields[0] != "error") {
+		return f, ef, "", nil
+	}
+	if len(fields) < 3 {
+		return f, ef, "", fmt.Errorf("server %s", msg)
+	}
+	if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+		// "< error text >" replies to a bad command
+		return f, ef, "", fmt.Errorf("server %s", msg)
+	}
+	kind = fields[0]
+	id, err := strconv.ParseUint(fields[1], 16, 32)
+	if err != nil {
+		return f, ef, "", fmt.Errorf("bad id: %w", err)
+	}
+	data, err := hex.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil || len(data) > 8 {
+		return f, ef, "", fmt.Errorf("bad data %q", strings.Join(fields[3:], " "))
+	}
+
+	if kind == "error" {
+		var d can.Data
+		copy(d[:], data)
+		return f, wireErrorFrame(uint32(id), d), kind, nil
+	}
+	f.ID = uint32(id)
+	f.IsExtended = len(fields[1]) == 8
+	f.Length = uint8(copy(f.Data[:], data))
+	return f, ef, kind, f.Validate()
+}
+
+// wireErrorFrame decodes a Linux CAN error frame (can_id without
+// CAN_ERR_FLAG, and data) as received by remote protocols.
+func wireErrorFrame(class uint32, d can.Data) socketcan.ErrorFrame {
+	ef := socketcan.ErrorFrame{
+		ErrorClass:                     socketcan.ErrorClass(class &^ canERRFlag),
+		LostArbitrationBit:             d[0],
+		ControllerError:                socketcan.ControllerError(d[1]),
+		ProtocolError:                  socketcan.ProtocolViolationError(d[2]),
+		ProtocolViolationErrorLocation: socketcan.ProtocolViolationErrorLocation(d[3]),
+		TransceiverError:               socketcan.TransceiverError(d[4]),
+	}
+	copy(ef.ControllerSpecificInformation[:], d[5:8])
+	return ef
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sseBuffer    = 1024
+	sseKeepalive = 15 * time.Second
+)
+
+// serveEvents streams signal updates and raw frames as Server-Sent Events.
+// Event types are "snapshot" (current signals, sent once on connect),
+// "signal", "raw" and "dropped" (subscriber fell behind; data is the total
+// number of events lost). ?types=signal,raw limits what is streamed, and
+// ?signals=, ?id= and ?max_rate= narrow it further (see eventFilter).
+func serveEvents(ctx context.Context) func(*App, http.ResponseWriter, *http.Request) {
+	return func(app *App, w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		wantSignals, wantRaw := true, true
+		if t := r.URL.Query().Get("types"); t != "" {
+			wantSignals, wantRaw = false, false
+			for _, typ := range strings.Split(t, ",") {
+				switch strings.TrimSpace(typ) {
+				case "signal":
+					wantSignals = true
+				case "raw":
+					wantRaw = true
+				default:
+					http.Error(w, fmt.Sprintf("unknown event type %q", typ), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		filter, err := parseEventFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Subscribe before taking the snapshot so no update falls in between.
+		events, dropped, cancel := app.Store.Subscribe(subStream, sseBuffer)
+		defer cancel()
+
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("Connection", "keep-alive")
+		h.Set("X-Accel-Buffering", "no") // nginx
+		w.WriteHeader(http.StatusOK)
+
+		// Ask EventSource to wait a bit before reconnecting after a restart.
+		fmt.Fprint(w, "retry: 2000\n\n")
+		if wantSignals {
+			signals, _ := app.Store.Snapshot()
+			writeSSE(w, "snapshot", filter.signals(signals))
+		}
+		flusher.Flush()
+
+		send := func(ev StoreEvent) {
+			switch {
+			case ev.Signal != nil:
+				writeSSE(w, "signal", ev.Signal)
+			case ev.Raw != nil:
+				writeSSE(w, "raw", ev.Raw)
+			}
+		}
+		keepalive := time.NewTicker(sseKeepalive)
+		defer keepalive.Stop()
+		// Updates held back by max_rate go out once their interval is over.
+		var held <-chan time.Time
+		if filter.gap > 0 {
+			t := time.NewTicker(filter.gap)
+			defer t.Stop()
+			held = t.C
+		}
+		var lost uint64
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.Context().Done():
+				return
+			case <-keepalive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+			case now := <-held:
+				if !filter.flush(now, send) {
+					continue
+				}
+			case ev := <-events:
+				// Drain whatever is queued so bursts cost one flush.
+				now := time.Now()
+				for {
+					if (ev.Signal != nil && wantSignals || ev.Raw != nil && wantRaw) && filter.admit(ev, now) {
+						send(ev)
+					}
+					if len(events) == 0 {
+						break
+					}
+					ev = <-events
+				}
+				if n := dropped(); n != lost {
+					lost = n
+					writeSSE(w, "dropped", n)
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// eventFilter narrows a stream to what a client shows:
+//
+//	signals=VEH.speed,rpm   only these signals (FRAME.signal or bare name)
+//	id=0x100-0x1FF,ERR      only raw frames, and signals of frames, with these IDs
+//	max_rate=5              at most 5 updates per second per signal and per ID;
+//	                        in between only the latest value is kept
+//
+// An empty filter lets everything through.
+type eventFilter struct {
+	names     map[string]bool
+	ids       []idRange
+	errFrames bool
+	gap       time.Duration
+
+	frameIDs map[string]bool // FrameID string -> in ids, memoised
+	last     map[string]time.Time
+	pending  map[string]StoreEvent
+}
+
+func parseEventFilter(q url.Values) (*eventFilter, error) {
+	f := &eventFilter{frameIDs: make(map[string]bool)}
+	if s := q.Get("signals"); s != "" {
+		f.names = make(map[string]bool)
+		for _, n := range strings.Split(s, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				f.names[n] = true
+			}
+		}
+	}
+	if s := q.Get("id"); s != "" {
+		var err error
+		if f.ids, f.errFrames, err = parseIDList(s); err != nil {
+			return nil, err
+		}
+	}
+	if s := q.Get("max_rate"); s != "" {
+		hz, err := strconv.ParseFloat(s, 64)
+		if err != nil || hz <= 0 || math.IsInf(hz, 0) {
+			return nil, fmt.Errorf("max_rate %q: want updates per second > 0", s)
+		}
+		f.gap = time.Duration(float64(time.Second) / hz)
+		f.last = make(map[string]time.Time)
+		f.pending = make(map[string]StoreEvent)
+	}
+	return f, nil
+}
+
+func (f *eventFilter) byID() bool { return len(f.ids) > 0 || f.errFrames }
+
+func (f *eventFilter) matchSignal(v *SignalValue) bool {
+	if f.names != nil && !f.names[v.Name] && !f.names[v.FrameName+"."+v.Name] {
+		return false
+	}
+	if !f.byID() {
+		return true
+	}
+	ok, seen := f.frameIDs[v.FrameID]
+	if !seen {
+		id, err := parseHexID(v.FrameID)
+		ok = err == nil && idInRanges(id, f.ids)
+		f.frameIDs[v.FrameID] = ok
+	}
+	return ok
+}
+
+func (f *eventFilter) matchRaw(r *RawFrame) bool {
+	if !f.byID() {
+		return true
+	}
+	if r.Error != "" {
+		return f.errFrames
+	}
+	return idInRanges(r.canID, f.ids)
+}
+
+// signals filters a snapshot.
+func (f *eventFilter) signals(vs []SignalValue) []SignalValue {
+	if f.names == nil && !f.byID() {
+		return vs
+	}
+	out := make([]SignalValue, 0, len(f.names))
+	for i := range vs {
+		if f.matchSignal(&vs[i]) {
+			out = append(out, vs[i])
+		}
+	}
+	return out
+}
+
+// admit reports whether ev should be sent now. An update that matches but
+// comes too soon after the previous one for its key is held back, replacing
+// any update already held for that key.
+func (f *eventFilter) admit(ev StoreEvent, now time.Time) bool {
+	var key string
+	switch {
+	case ev.Signal != nil:
+		if !f.matchSignal(ev.Signal) {
+			return false
+		}
+		key = "s:" + ev.Signal.FrameName + "." + ev.Signal.Name
+	case ev.Raw != nil:
+		if !f.matchRaw(ev.Raw) {
+			return false
+		}
+		key = "r:" + ev.Raw.ID
+	default:
+		return false
+	}
+	if f.gap == 0 {
+		return true
+	}
+	if now.Sub(f.last[key]) < f.gap {
+		f.pending[key] = ev
+		return false
+	}
+	f.last[key] = now
+	delete(f.pending, key)
+	return true
+}
+
+// flush sends the held updates whose interval is over and reports whether
+// it sent any.
+func (f *eventFilter) flush(now time.Time, send func(StoreEvent)) bool {
+	sent := false
+	for key, ev := range f.pending {
+		if now.Sub(f.last[key]) >= f.gap {
+			send(ev)
+			f.last[key] = now
+			delete(f.pending, key)
+			sent = true
+		}
+	}
+	return sent
+}
+
+func writeSSE(w http.ResponseWriter, event string, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+}
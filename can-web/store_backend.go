@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	storeDefaultFlush = time.Second
+	storeIOTimeout    = 5 * time.Second
+)
+
+// StoreConfig selects where the store's state is kept besides memory.
+type StoreConfig struct {
+	Backend string `yaml:"backend"`  // memory (default), sqlite or redis
+	Path    string `yaml:"path"`     // sqlite: database file
+	URL     string `yaml:"url"`      // redis: e.g. redis://localhost:6379/0
+	Prefix  string `yaml:"prefix"`   // redis: key prefix, default can-web
+	FlushMs int    `yaml:"flush_ms"` // how often changes are written, default 1000
+	Restore *bool  `yaml:"restore"`  // start from the saved state, default true
+}
+
+// StoreState is what a backend keeps of one bus: the latest value of every
+// signal and the most recent raw frames, oldest first.
+type StoreState struct {
+	Bus     string        `json:"bus"`
+	SavedAt time.Time     `json:"saved_at"`
+	Signals []SignalValue `json:"signals"`
+	Raw     []RawFrame    `json:"raw"`
+}
+
+// StoreBackend keeps the store's state outside the process, so it survives
+// restarts and can be read by other servers. The Store itself stays the
+// in-memory copy every request is served from; the backend receives its
+// changes in batches and never slows down ingestion. State is keyed by bus,
+// so servers for several buses can share one backend.
+type StoreBackend interface {
+	// Load returns the state saved for bus, empty if there is none.
+	Load(ctx context.Context, bus string) (StoreState, error)
+	// Save writes the signals updated and raw frames received since the
+	// last Save. With reset the saved state of bus is replaced rather than
+	// updated.
+	Save(ctx context.Context, bus string, signals []SignalValue, raw []RawFrame, reset bool) error
+	// Buses lists the buses with saved state.
+	Buses(ctx context.Context) ([]string, error)
+	Close() error
+}
+
+// storeBackendFactory checks the configuration of a backend and opens it.
+// rawKeep is the number of raw frames to keep per bus.
+type storeBackendFactory func(cfg StoreConfig, rawKeep int) (StoreBackend, error)
+
+var storeBackends = make(map[string]storeBackendFactory)
+
+// registerStoreBackend makes a store backend available as store.backend
+// name.
+func registerStoreBackend(name string, f storeBackendFactory) {
+	if _, dup := storeBackends[name]; dup {
+		panic(fmt.Sprintf("store backend %q registered twice", name))
+	}
+	storeBackends[name] = f
+}
+
+func storeBackendNames() string {
+	names := []string{"memory"}
+	for n := range storeBackends {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// StoreStatus is served by /api/store.
+type StoreStatus struct {
+	Backend   string     `json:"backend"`
+	FlushMs   int64      `json:"flush_ms,omitempty"`
+	Restored  int        `json:"restored"` // signals loaded at start
+	Flushes   uint64     `json:"flushes"`
+	LastFlush *time.Time `json:"last_flush,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	Buses     []string   `json:"buses,omitempty"` // with state in the backend
+}
+
+// StoreSync writes the store's changes to its backend. With the memory
+// backend it does nothing.
+type StoreSync struct {
+	store   *Store
+	bus     string
+	kind    string
+	backend StoreBackend // nil for memory
+	every   time.Duration
+	restore bool
+
+	mu        sync.Mutex
+	seq       uint64 // store sequence saved up to
+	restored  int
+	flushes   uint64
+	lastFlush time.Time
+	lastErr   string
+}
+
+func NewStoreSync(cfg StoreConfig, store *Store, bus string, rawKeep int) (*StoreSync, error) {
+	s := &StoreSync{store: store, bus: bus, kind: cfg.Backend, every: storeDefaultFlush, restore: cfg.Restore == nil || *cfg.Restore}
+	if s.kind == "" {
+		s.kind = "memory"
+	}
+	if cfg.FlushMs > 0 {
+		s.every = time.Duration(cfg.FlushMs) * time.Millisecond
+	}
+	if s.kind == "memory" {
+		return s, nil
+	}
+	f, ok := storeBackends[s.kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown store backend %q (want %s)", s.kind, storeBackendNames())
+	}
+	var err error
+	if s.backend, err = f(cfg, rawKeep); err != nil {
+		return nil, fmt.Errorf("store backend %s: %w", s.kind, err)
+	}
+	return s, nil
+}
+
+// Restore loads the state saved by an earlier run into the store. A backend
+// that cannot be reached is logged and the server starts empty.
+func (s *StoreSync) Restore() {
+	if s.backend == nil || !s.restore {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeIOTimeout)
+	defer cancel()
+	st, err := s.backend.Load(ctx, s.bus)
+	if err != nil {
+		slog.Warn("restoring store failed", "backend", s.kind, "err", err)
+		return
+	}
+	s.store.Restore(st)
+	s.mu.Lock()
+	s.restored = len(st.Signals)
+	s.mu.Unlock()
+	if len(st.Signals) > 0 || len(st.Raw) > 0 {
+		slog.Info("store restored", "backend", s.kind, "signals", len(st.Signals), "raw", len(st.Raw), "saved_at", st.SavedAt)
+	}
+}
+
+// Run writes changes every flush interval until ctx is cancelled, then
+// writes what is left and closes the backend.
+func (s *StoreSync) Run(ctx context.Context) {
+	if s.backend == nil {
+		return
+	}
+	defer s.backend.Close()
+	t := time.NewTicker(s.every)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.flush()
+		case <-ctx.Done():
+			s.flush()
+			return
+		}
+	}
+}
+
+func (s *StoreSync) flush() {
+	s.mu.Lock()
+	since := s.seq
+	s.mu.Unlock()
+	seq, signals, raw, reset := s.store.Delta(since)
+	if seq == since {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeIOTimeout)
+	defer cancel()
+	err := s.backend.Save(ctx, s.bus, signals, raw, reset)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		if s.lastErr == "" {
+			slog.Warn("store sync failed", "backend", s.kind, "err", err)
+		}
+		s.lastErr = err.Error()
+		return
+	}
+	if s.lastErr != "" {
+		slog.Info("store sync recovered", "backend", s.kind)
+	}
+	s.seq, s.lastErr = seq, ""
+	s.flushes++
+	s.lastFlush = time.Now()
+}
+
+func (s *StoreSync) Status() StoreStatus {
+	s.mu.Lock()
+	st := StoreStatus{Backend: s.kind, Restored: s.restored, Flushes: s.flushes, LastError: s.lastErr}
+	if !s.lastFlush.IsZero() {
+		t := s.lastFlush
+		st.LastFlush = &t
+	}
+	s.mu.Unlock()
+	if s.backend == nil {
+		return st
+	}
+	st.FlushMs = s.every.Milliseconds()
+	ctx, cancel := context.WithTimeout(context.Background(), storeIOTimeout)
+	defer cancel()
+	buses, err := s.backend.Buses(ctx)
+	if err != nil && st.LastError == "" {
+		st.LastError = err.Error()
+	}
+	st.Buses = buses
+	return st
+}
+
+// State returns the saved state of bus, with a zero SavedAt when there is
+// none. The memory backend only knows this server's bus.
+func (s *StoreSync) State(bus string) (StoreState, error) {
+	if s.backend == nil {
+		if bus != s.bus {
+			return StoreState{Bus: bus}, nil
+		}
+		snap := s.store.Versioned()
+		return StoreState{Bus: bus, SavedAt: time.Now(), Signals: snap.Signals, Raw: snap.Raw}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeIOTimeout)
+	defer cancel()
+	return s.backend.Load(ctx, bus)
+}
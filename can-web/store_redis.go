@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func init() {
+	registerStoreBackend("redis", func(cfg StoreConfig, rawKeep int) (StoreBackend, error) {
+		if cfg.URL == "" {
+			return nil, errors.New("redis store needs store.url")
+		}
+		opts, err := redis.ParseURL(cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		prefix := cfg.Prefix
+		if prefix == "" {
+			prefix = "can-web"
+		}
+		return &redisStore{rdb: redis.NewClient(opts), prefix: prefix, rawKeep: rawKeep}, nil
+	})
+}
+
+// redisStore keeps store state in Redis, so the servers of a gateway
+// cluster can share it: a hash "<prefix>:<bus>:signals" of FRAME.signal to
+// the signal as JSON, a list "<prefix>:<bus>:raw" of raw frames as JSON,
+// oldest first, and a hash "<prefix>:buses" of bus to the unix ms of its
+// last save. The client connects lazily and reconnects by itself.
+type redisStore struct {
+	rdb     *redis.Client
+	prefix  string
+	rawKeep int
+}
+
+func (s *redisStore) key(bus, what string) string {
+	return s.prefix + ":" + bus + ":" + what
+}
+
+func (s *redisStore) Load(ctx context.Context, bus string) (StoreState, error) {
+	st := StoreState{Bus: bus, Signals: []SignalValue{}, Raw: []RawFrame{}}
+	var saved *redis.StringCmd
+	var signals *redis.MapStringStringCmd
+	var raw *redis.StringSliceCmd
+	_, err := s.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		saved = p.HGet(ctx, s.prefix+":buses", bus)
+		signals = p.HGetAll(ctx, s.key(bus, "signals"))
+		raw = p.LRange(ctx, s.key(bus, "raw"), 0, -1)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	ms, err := saved.Int64()
+	if err != nil {
+		return st, err
+	}
+	st.SavedAt = time.UnixMilli(ms)
+
+	for _, b := range signals.Val() {
+		var v SignalValue
+		if err := json.Unmarshal([]byte(b), &v); err != nil {
+			return st, err
+		}
+		st.Signals = append(st.Signals, v)
+	}
+	sort.Slice(st.Signals, func(i, j int) bool {
+		if st.Signals[i].FrameName == st.Signals[j].FrameName {
+			return st.Signals[i].Name < st.Signals[j].Name
+		}
+		return st.Signals[i].FrameName < st.Signals[j].FrameName
+	})
+	for _, b := range raw.Val() {
+		var r RawFrame
+		if err := json.Unmarshal([]byte(b), &r); err != nil {
+			return st, err
+		}
+		st.Raw = append(st.Raw, r)
+	}
+	return st, nil
+}
+
+func (s *redisStore) Save(ctx context.Context, bus string, signals []SignalValue, raw []RawFrame, reset bool) error {
+	fields := make([]any, 0, 2*len(signals))
+	for _, v := range signals {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, v.FrameName+"."+v.Name, b)
+	}
+	frames := make([]any, 0, len(raw))
+	for _, r := range raw {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		frames = append(frames, b)
+	}
+	_, err := s.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		if reset {
+			p.Del(ctx, s.key(bus, "signals"), s.key(bus, "raw"))
+		}
+		if len(fields) > 0 {
+			p.HSet(ctx, s.key(bus, "signals"), fields...)
+		}
+		if len(frames) > 0 {
+			p.RPush(ctx, s.key(bus, "raw"), frames...)
+			p.LTrim(ctx, s.key(bus, "raw"), -int64(s.rawKeep), -1)
+		}
+		p.HSet(ctx, s.prefix+":buses", bus, strconv.FormatInt(time.Now().UnixMilli(), 10))
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) Buses(ctx context.Context) ([]string, error) {
+	buses, err := s.rdb.HKeys(ctx, s.prefix+":buses").Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(buses)
+	return buses, nil
+}
+
+func (s *redisStore) Close() error {
+	return s.rdb.Close()
+}
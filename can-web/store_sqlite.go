@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func init() {
+	registerStoreBackend("sqlite", func(cfg StoreConfig, rawKeep int) (StoreBackend, error) {
+		if cfg.Path == "" {
+			return nil, errors.New("sqlite store needs store.path")
+		}
+		return newSQLiteStore(cfg.Path, rawKeep)
+	})
+}
+
+// sqliteStore keeps store state in a SQLite database: one row per signal
+// and per raw frame, as JSON. It may share the database file of the signal
+// history, whose import registers the driver.
+type sqliteStore struct {
+	db      *sql.DB
+	rawKeep int
+}
+
+func newSQLiteStore(path string, rawKeep int) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS store_buses (
+			bus      TEXT    PRIMARY KEY,
+			saved_at INTEGER NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS store_signals (
+			bus   TEXT NOT NULL,
+			key   TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (bus, key)
+		);
+		CREATE TABLE IF NOT EXISTS store_raw (
+			id    INTEGER PRIMARY KEY AUTOINCREMENT,
+			bus   TEXT    NOT NULL,
+			frame TEXT    NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS store_raw_bus ON store_raw (bus, id);
+	`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &sqliteStore{db: db, rawKeep: rawKeep}, nil
+}
+
+func (s *sqliteStore) Load(ctx context.Context, bus string) (StoreState, error) {
+	st := StoreState{Bus: bus, Signals: []SignalValue{}, Raw: []RawFrame{}}
+	var savedAt int64
+	switch err := s.db.QueryRowContext(ctx, `SELECT saved_at FROM store_buses WHERE bus = ?`, bus).Scan(&savedAt); {
+	case errors.Is(err, sql.ErrNoRows):
+		return st, nil
+	case err != nil:
+		return st, err
+	}
+	st.SavedAt = time.UnixMilli(savedAt)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT value FROM store_signals WHERE bus = ? ORDER BY key`, bus)
+	if err != nil {
+		return st, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b []byte
+		var v SignalValue
+		if err := rows.Scan(&b); err != nil {
+			return st, err
+		}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return st, err
+		}
+		st.Signals = append(st.Signals, v)
+	}
+	if err := rows.Err(); err != nil {
+		return st, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `SELECT frame FROM store_raw WHERE bus = ? ORDER BY id`, bus)
+	if err != nil {
+		return st, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b []byte
+		var r RawFrame
+		if err := rows.Scan(&b); err != nil {
+			return st, err
+		}
+		if err := json.Unmarshal(b, &r); err != nil {
+			return st, err
+		}
+		st.Raw = append(st.Raw, r)
+	}
+	return st, rows.Err()
+}
+
+func (s *sqliteStore) Save(ctx context.Context, bus string, signals []SignalValue, raw []RawFrame, reset bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if reset {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM store_signals WHERE bus = ?`, bus); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM store_raw WHERE bus = ?`, bus); err != nil {
+			return err
+		}
+	}
+	if len(signals) > 0 {
+		stmt, err := tx.PrepareContext(ctx, `INSERT INTO store_signals (bus, key, value) VALUES (?, ?, ?)
+			ON CONFLICT (bus, key) DO UPDATE SET value = excluded.value`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, v := range signals {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			if _, err := stmt.ExecContext(ctx, bus, v.FrameName+"."+v.Name, string(b)); err != nil {
+				return err
+			}
+		}
+	}
+	if len(raw) > 0 {
+		stmt, err := tx.PrepareContext(ctx, `INSERT INTO store_raw (bus, frame) VALUES (?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, r := range raw {
+			b, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if _, err := stmt.ExecContext(ctx, bus, string(b)); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM store_raw WHERE bus = ? AND id <= (
+			SELECT id FROM store_raw WHERE bus = ? ORDER BY id DESC LIMIT 1 OFFSET ?)`, bus, bus, s.rawKeep); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO store_buses (bus, saved_at) VALUES (?, ?)
+		ON CONFLICT (bus) DO UPDATE SET saved_at = excluded.saved_at`, bus, time.Now().UnixMilli()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Buses(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT bus FROM store_buses ORDER BY bus`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var bus string
+		if err := rows.Scan(&bus); err != nil {
+			return nil, err
+		}
+		out = append(out, bus)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.einride.tech/can"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	telemetryDefaultSampleRatio = 0.001
+	telemetryDefaultInterval    = 15 * time.Second
+)
+
+// TelemetryConfig enables OpenTelemetry export over OTLP/gRPC. The standard
+// OTEL_EXPORTER_OTLP_* and OTEL_RESOURCE_ATTRIBUTES variables apply too; an
+// OTEL_EXPORTER_OTLP_ENDPOINT alone is enough to turn it on.
+type TelemetryConfig struct {
+	Endpoint         string  `yaml:"endpoint"`           // collector, e.g. otel-collector:4317 or https://host:4317
+	Insecure         bool    `yaml:"insecure"`           // plaintext gRPC to a host:port endpoint
+	ServiceName      string  `yaml:"service_name"`       // default can-web
+	FrameSampleRatio float64 `yaml:"frame_sample_ratio"` // share of frames traced through decode and store; default 0.001
+	MetricsIntervalS float64 `yaml:"metrics_interval_s"` // default 15
+}
+
+func (c TelemetryConfig) enabled() bool {
+	return c.Endpoint != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT") != ""
+}
+
+// Telemetry exports traces of HTTP requests and of sampled frames, and
+// metrics read from the bus, sink and TX counters. A nil *Telemetry is
+// valid and does nothing.
+type Telemetry struct {
+	traces  *sdktrace.TracerProvider
+	metrics *sdkmetric.MeterProvider
+	tracer  trace.Tracer
+	every   uint64 // trace one frame in every
+	frames  atomic.Uint64
+}
+
+// StartTelemetry sets up the exporters and the global providers. It returns
+// nil when telemetry is not configured.
+func StartTelemetry(ctx context.Context, cfg TelemetryConfig, app *App) (*Telemetry, error) {
+	if !cfg.enabled() {
+		return nil, nil
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "can-web"
+	}
+	ratio := cfg.FrameSampleRatio
+	if ratio == 0 {
+		ratio = telemetryDefaultSampleRatio
+	}
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("telemetry: frame_sample_ratio %g: want 0 to 1", ratio)
+	}
+	interval := telemetryDefaultInterval
+	if cfg.MetricsIntervalS > 0 {
+		interval = time.Duration(cfg.MetricsIntervalS * float64(time.Second))
+	}
+
+	var traceOpts []otlptracegrpc.Option
+	var metricOpts []otlpmetricgrpc.Option
+	switch {
+	case strings.Contains(cfg.Endpoint, "://"):
+		traceOpts = append(traceOpts, otlptracegrpc.WithEndpointURL(cfg.Endpoint))
+		metricOpts = append(metricOpts, otlpmetricgrpc.WithEndpointURL(cfg.Endpoint))
+	case cfg.Endpoint != "":
+		traceOpts = append(traceOpts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		metricOpts = append(metricOpts, otlpmetricgrpc.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.Insecure {
+		traceOpts = append(traceOpts, otlptracegrpc.WithInsecure())
+		metricOpts = append(metricOpts, otlpmetricgrpc.WithInsecure())
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			attribute.String("service.name", cfg.ServiceName),
+			attribute.String("can.bus", app.Iface),
+			attribute.String("can.source", app.Source),
+		),
+		resource.WithFromEnv(),
+	)
+	if err != nil && !errors.Is(err, resource.ErrPartialResource) {
+		return nil, fmt.Errorf("telemetry resource: %w", err)
+	}
+	traceExp, err := otlptracegrpc.New(ctx, traceOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("telemetry traces: %w", err)
+	}
+	metricExp, err := otlpmetricgrpc.New(ctx, metricOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("telemetry metrics: %w", err)
+	}
+
+	t := &Telemetry{
+		traces: sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(traceExp),
+			sdktrace.WithResource(res),
+		),
+		metrics: sdkmetric.NewMeterProvider(
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExp, sdkmetric.WithInterval(interval))),
+			sdkmetric.WithResource(res),
+		),
+		every: max(1, uint64(1/ratio+0.5)),
+	}
+	t.tracer = t.traces.Tracer("can-web")
+	otel.SetTracerProvider(t.traces)
+	otel.SetMeterProvider(t.metrics)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if err := registerMetrics(t.metrics.Meter("can-web"), app); err != nil {
+		t.Shutdown(ctx)
+		return nil, fmt.Errorf("telemetry metrics: %w", err)
+	}
+	return t, nil
+}
+
+// Shutdown flushes what is buffered and stops the exporters.
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return errors.Join(t.traces.Shutdown(ctx), t.metrics.Shutdown(ctx))
+}
+
+// frameSpan is the span of one frame from receipt to the store.
+type frameSpan struct{ span trace.Span }
+
+// traceFrame starts the span of every nth frame, from the time it was read,
+// so it includes the wait in the decode queue. It returns nil for the
+// others.
+func (t *Telemetry) traceFrame(f can.Frame, st frameStamp, dir string) *frameSpan {
+	if t == nil || t.frames.Add(1)%t.every != 0 {
+		return nil
+	}
+	_, span := t.tracer.Start(context.Background(), "can.decode",
+		trace.WithTimestamp(st.Wall),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("can.id", canIDString(f.ID, f.IsExtended)),
+			attribute.String("can.direction", dir),
+			attribute.Int("can.dlc", int(f.Length)),
+		))
+	return &frameSpan{span: span}
+}
+
+// decoded notes the frame's name in the map and the signals decoded from it.
+func (s *frameSpan) decoded(frame string, signals int) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attribute.String("can.frame", frame), attribute.Int("can.signals", signals))
+}
+
+func (s *frameSpan) end() {
+	if s != nil {
+		s.span.End()
+	}
+}
+
+// instrumentHTTP traces requests to h and records their duration, named
+// after the route pattern. It uses the global providers, so it costs
+// little when telemetry is off.
+func instrumentHTTP(pattern string, h http.Handler) http.Handler {
+	return otelhttp.NewHandler(h, pattern)
+}
+
+// registerMetrics exports the counters the server already keeps, read at
+// each collection, so the receive path does no extra work.
+func registerMetrics(m metric.Meter, app *App) error {
+	frames, err := m.Int64ObservableCounter("can.frames", metric.WithUnit("{frame}"), metric.WithDescription("Frames received and sent"))
+	if err != nil {
+		return err
+	}
+	bytes, err := m.Int64ObservableCounter("can.bytes", metric.WithUnit("By"), metric.WithDescription("Payload bytes received and sent"))
+	if err != nil {
+		return err
+	}
+	dropped, err := m.Int64ObservableCounter("can.frames.dropped", metric.WithUnit("{frame}"), metric.WithDescription("Frames and events dropped by a stage of the receive path that could not keep up, by stage"))
+	if err != nil {
+		return err
+	}
+	load, err := m.Float64ObservableGauge("can.bus.load", metric.WithUnit("%"), metric.WithDescription("Estimated bus load"))
+	if err != nil {
+		return err
+	}
+	errorFrames, err := m.Int64ObservableCounter("can.error_frames", metric.WithUnit("{frame}"), metric.WithDescription("CAN error frames"))
+	if err != nil {
+		return err
+	}
+	connected, err := m.Int64ObservableGauge("can.connected", metric.WithDescription("1 while the frame source is connected"))
+	if err != nil {
+		return err
+	}
+	sinkPublished, err := m.Int64ObservableCounter("can.sink.published", metric.WithUnit("{message}"), metric.WithDescription("Messages published by each sink"))
+	if err != nil {
+		return err
+	}
+	sinkErrors, err := m.Int64ObservableCounter("can.sink.errors", metric.WithUnit("{message}"), metric.WithDescription("Failed publishes of each sink"))
+	if err != nil {
+		return err
+	}
+	sinkDropped, err := m.Int64ObservableCounter("can.sink.dropped", metric.WithUnit("{message}"), metric.WithDescription("Events each sink could not keep up with"))
+	if err != nil {
+		return err
+	}
+	txSent, err := m.Int64ObservableCounter("can.tx.sent", metric.WithUnit("{frame}"), metric.WithDescription("Frames passed by the TX interlocks"))
+	if err != nil {
+		return err
+	}
+	txRefused, err := m.Int64ObservableCounter("can.tx.refused", metric.WithUnit("{frame}"), metric.WithDescription("Frames refused by the TX interlocks, by reason"))
+	if err != nil {
+		return err
+	}
+
+	_, err = m.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		stats := statsSnapshot(app)
+		o.ObserveInt64(frames, int64(stats.TotalFrames))
+		o.ObserveInt64(bytes, int64(stats.TotalBytes))
+		for stage, n := range map[string]uint64{
+			"kernel": stats.Drops.Kernel, "decode": stats.Drops.Decode, "history": stats.Drops.History,
+			"sinks": stats.Drops.Sinks, "streams": stats.Drops.Streams, "internal": stats.Drops.Internal,
+		} {
+			o.ObserveInt64(dropped, int64(n), metric.WithAttributes(attribute.String("stage", stage)))
+		}
+		o.ObserveFloat64(load, stats.BusLoadPct)
+		o.ObserveInt64(errorFrames, int64(app.Errors.Snapshot().Total))
+		up := int64(0)
+		if app.Conn.Status().State == "connected" {
+			up = 1
+		}
+		o.ObserveInt64(connected, up)
+		for _, s := range app.Sinks.Status() {
+			attrs := metric.WithAttributes(attribute.String("sink", s.Name), attribute.String("sink.type", s.Type))
+			o.ObserveInt64(sinkPublished, int64(s.Published), attrs)
+			o.ObserveInt64(sinkErrors, int64(s.Errors), attrs)
+			o.ObserveInt64(sinkDropped, int64(s.Dropped), attrs)
+		}
+		tx := app.TxGuard.Status()
+		o.ObserveInt64(txSent, int64(tx.Sent))
+		for reason, n := range tx.Refused {
+			o.ObserveInt64(txRefused, int64(n), metric.WithAttributes(attribute.String("reason", reason)))
+		}
+		return nil
+	}, frames, bytes, dropped, load, errorFrames, connected, sinkPublished, sinkErrors, sinkDropped, txSent, txRefused)
+	return err
+}
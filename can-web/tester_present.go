@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+const testerPresentDefaultInterval = 2 * time.Second
+
+// testerPresent keeps one ECU's non-default session alive by sending
+// TesterPresent (0x3E) periodically.
+type testerPresent struct {
+	t        udsTarget
+	interval time.Duration
+	suppress bool // send 3E 80 and expect no response
+	stop     context.CancelFunc
+	done     chan struct{}
+
+	// guarded by UDSClient.mu
+	since    time.Time
+	sent     uint64
+	failures uint64
+	lastSent time.Time
+	lastErr  string
+}
+
+// TesterPresentStatus is one running TesterPresent service.
+type TesterPresentStatus struct {
+	ECU        string     `json:"ecu"`
+	RxID       string     `json:"rx_id"`
+	IntervalMs int64      `json:"interval_ms"`
+	Suppress   bool       `json:"suppress"`
+	Since      time.Time  `json:"since"`
+	Sent       uint64     `json:"sent"`
+	Failures   uint64     `json:"failures"`
+	LastSent   *time.Time `json:"last_sent,omitempty"`
+	LastError  string     `json:"last_error,omitempty"` // of the latest request, empty once one succeeds
+}
+
+// StartTesterPresent sends TesterPresent to t every interval until stopped,
+// replacing a service already running for the ECU. With suppress the
+// positive response is suppressed, so only sending can fail.
+func (c *UDSClient) StartTesterPresent(t udsTarget, interval time.Duration, suppress bool) {
+	if interval <= 0 {
+		interval = c.tpInterval
+	}
+	c.StopTesterPresent(t)
+
+	ctx, stop := context.WithCancel(context.Background())
+	tp := &testerPresent{t: t, interval: interval, suppress: suppress, stop: stop, done: make(chan struct{}), since: time.Now()}
+	c.mu.Lock()
+	c.tp[t.tx] = tp
+	c.mu.Unlock()
+	slog.Info("tester present started", "ecu", t.String(), "interval", interval, "suppress", suppress)
+	go c.runTesterPresent(ctx, tp)
+}
+
+// StopTesterPresent stops the service for t and reports whether one was
+// running.
+func (c *UDSClient) StopTesterPresent(t udsTarget) bool {
+	c.mu.Lock()
+	tp, ok := c.tp[t.tx]
+	delete(c.tp, t.tx)
+	c.mu.Unlock()
+	if !ok {
+		return false
+	}
+	tp.stop()
+	<-tp.done
+	slog.Info("tester present stopped", "ecu", t.String())
+	return true
+}
+
+// Close stops every TesterPresent service.
+func (c *UDSClient) Close() {
+	c.mu.Lock()
+	running := make([]*testerPresent, 0, len(c.tp))
+	for _, tp := range c.tp {
+		running = append(running, tp)
+	}
+	c.mu.Unlock()
+	for _, tp := range running {
+		c.StopTesterPresent(tp.t)
+	}
+}
+
+func (c *UDSClient) runTesterPresent(ctx context.Context, tp *testerPresent) {
+	defer close(tp.done)
+	req := []byte{0x3E, 0x00}
+	if tp.suppress {
+		req[1] = 0x80
+	}
+	tick := time.NewTicker(tp.interval)
+	defer tick.Stop()
+	for {
+		_, err := c.Request(ctx, tp.t, req, min(tp.interval, c.timeout))
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.mu.Lock()
+		tp.sent++
+		tp.lastSent = time.Now()
+		failing := tp.lastErr != ""
+		if err != nil {
+			tp.failures++
+			tp.lastErr = err.Error()
+		} else {
+			tp.lastErr = ""
+		}
+		c.mu.Unlock()
+		// log transitions only, not every interval
+		if err != nil && !failing {
+			slog.Warn("tester present failed", "ecu", tp.t.String(), "err", err)
+		} else if err == nil && failing {
+			slog.Info("tester present recovered", "ecu", tp.t.String())
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// testerPresentStatus lists the running services; c.mu must be held.
+func (c *UDSClient) testerPresentStatus() []TesterPresentStatus {
+	out := make([]TesterPresentStatus, 0, len(c.tp))
+	for _, tp := range c.tp {
+		s := TesterPresentStatus{
+			ECU:        tp.t.String(),
+			RxID:       fmt.Sprintf("0x%03X", tp.t.rx),
+			IntervalMs: tp.interval.Milliseconds(),
+			Suppress:   tp.suppress,
+			Since:      tp.since,
+			Sent:       tp.sent,
+			Failures:   tp.failures,
+			LastError:  tp.lastErr,
+		}
+		if !tp.lastSent.IsZero() {
+			t := tp.lastSent
+			s.LastSent = &t
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ECU < out[j].ECU })
+	return out
+}
+
+// testerPresentParams turns the service for one ECU on or off.
+type testerPresentParams struct {
+	TxID       string `json:"tx_id"`
+	RxID       string `json:"rx_id"`
+	Enabled    *bool  `json:"enabled"` // default true
+	IntervalMs int    `json:"interval_ms"`
+	Suppress   *bool  `json:"suppress"` // default true
+}
+
+func registerTesterPresentAction(app *App) {
+	app.Control.Register("uds.tester_present", func(params json.RawMessage) (any, error) {
+		var p testerPresentParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		t, err := app.UDS.target(p.TxID, p.RxID)
+		if err != nil {
+			return nil, err
+		}
+		if p.Enabled != nil && !*p.Enabled {
+			return map[string]bool{"stopped": app.UDS.StopTesterPresent(t)}, nil
+		}
+		if p.IntervalMs < 0 {
+			return nil, fmt.Errorf("interval_ms %d must not be negative", p.IntervalMs)
+		}
+		app.UDS.StartTesterPresent(t, time.Duration(p.IntervalMs)*time.Millisecond, p.Suppress == nil || *p.Suppress)
+		return app.UDS.Status().TesterPresent, nil
+	})
+}
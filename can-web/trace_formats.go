@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+// traceLineParser turns one line of a trace file into a frame. ok is false
+// for lines without a frame (headers, comments, events). Parsers for
+// formats with headers keep state and must see the file in order.
+type traceLineParser func(line string) (lf LogFrame, ok bool, err error)
+
+// newTraceLineParser picks the parser from the file extension: .asc
+// (Vector), .trc (PEAK), otherwise candump.
+func newTraceLineParser(path string) traceLineParser {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".asc":
+		return (&ascParser{base: time.Unix(0, 0), hexIDs: true}).parse
+	case ".trc":
+		return (&trcParser{start: time.Unix(0, 0), version: "1.0"}).parse // 1.0 files have no $FILEVERSION
+	default:
+		return parseCandumpLine
+	}
+}
+
+// channelIface names the 1-based channel numbers of ASC and TRC files like
+// SocketCAN interfaces: channel 1 is can0.
+func channelIface(ch string) string {
+	n, err := strconv.Atoi(ch)
+	if err != nil || n < 1 {
+		return "can0"
+	}
+	return "can" + strconv.Itoa(n-1)
+}
+
+// parseDataBytes parses space separated hex bytes into f.
+func parseDataBytes(f *can.Frame, fields []string) error {
+	if len(fields) > can.MaxDataLength {
+		return fmt.Errorf("%d data bytes, max %d", len(fields), can.MaxDataLength)
+	}
+	for i, b := range fields {
+		v, err := strconv.ParseUint(b, 16, 8)
+		if err != nil {
+			return fmt.Errorf("bad data byte %q", b)
+		}
+		f.Data[i] = byte(v)
+	}
+	return nil
+}
+
+// ascParser reads Vector ASCII logs. Timestamps are seconds since the
+// "date" header (absolute) or since the previous line (relative); without
+// a date they count from the Unix epoch.
+type ascParser struct {
+	base     time.Time
+	hexIDs   bool
+	relative bool
+	last     float64
+}
+
+var ascDateLayouts = []string{
+	"Mon Jan 2 03:04:05.000 pm 2006",
+	"Mon Jan 2 03:04:05 pm 2006",
+	"Mon Jan 2 15:04:05.000 2006",
+	"Mon Jan 2 15:04:05 2006",
+}
+
+func (p *ascParser) parse(line string) (lf LogFrame, ok bool, err error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+		return lf, false, nil
+	}
+	switch strings.ToLower(fields[0]) {
+	case "date":
+		s := strings.Join(fields[1:], " ")
+		for _, layout := range ascDateLayouts {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				p.base = t
+				return lf, false, nil
+			}
+		}
+		return lf, false, fmt.Errorf("bad date %q", s)
+	case "base":
+		// base hex|dec  timestamps absolute|relative
+		p.hexIDs = len(fields) < 2 || fields[1] != "dec"
+		p.relative = len(fields) > 3 && fields[3] == "relative"
+		return lf, false, nil
+	}
+
+	sec, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || len(fields) < 5 {
+		return lf, false, nil // header or trigger block line
+	}
+	// "<ts> <ch> <id> Rx|Tx d <dlc> <data...>" or "... r [dlc]"; error
+	// frames, CAN FD lines and other events are skipped.
+	if _, err := strconv.Atoi(fields[1]); err != nil {
+		return lf, false, nil
+	}
+	kind := fields[4]
+	if kind != "d" && kind != "r" {
+		return lf, false, nil
+	}
+
+	if p.relative {
+		sec += p.last
+	}
+	p.last = sec
+	lf.TS = p.base.Add(time.Duration(math.Round(sec * 1e9)))
+	lf.Iface = channelIface(fields[1])
+
+	idText := fields[2]
+	if strings.HasSuffix(idText, "x") {
+		lf.Frame.IsExtended = true
+		idText = strings.TrimSuffix(idText, "x")
+	}
+	base := 16
+	if !p.hexIDs {
+		base = 10
+	}
+	id, err := strconv.ParseUint(idText, base, 29)
+	if err != nil {
+		return lf, false, fmt.Errorf("bad id %q", fields[2])
+	}
+	lf.Frame.ID = uint32(id)
+
+	var dlc uint64
+	if len(fields) > 5 {
+		if dlc, err = strconv.ParseUint(fields[5], 16, 8); err != nil {
+			return lf, false, fmt.Errorf("bad dlc %q", fields[5])
+		}
+	}
+	lf.Frame.Length = uint8(min(dlc, can.MaxDataLength))
+	if kind == "r" {
+		lf.Frame.IsRemote = true
+		return lf, true, nil
+	}
+	if len(fields) < 6+int(lf.Frame.Length) {
+		return lf, false, fmt.Errorf("dlc %d but %d data bytes", dlc, len(fields)-6)
+	}
+	return lf, true, parseDataBytes(&lf.Frame, fields[6:6+int(lf.Frame.Length)])
+}
+
+// trcParser reads PEAK trace files, versions 1.x and 2.x. Timestamps are
+// milliseconds since $STARTTIME.
+type trcParser struct {
+	start   time.Time
+	version string
+	columns string // one letter per column, as in $COLUMNS
+}
+
+// trcColumns are the fixed column layouts of the versions without
+// $COLUMNS: N number, O offset (ms), T type, B bus, I id, d direction, R
+// reserved, L length, D data.
+var trcColumns = map[string]string{
+	"1.0": "NOILD",
+	"1.1": "NOTILD",
+	"1.2": "NOBTILD",
+	"1.3": "NOBTIRLD",
+	"2.0": "NOTIdLD",
+	"2.1": "NOTBIdRLD",
+}
+
+func (p *trcParser) parse(line string) (lf LogFrame, ok bool, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return lf, false, nil
+	}
+	if strings.HasPrefix(line, ";") {
+		key, val, found := strings.Cut(strings.TrimPrefix(line, ";$"), "=")
+		if !found || !strings.HasPrefix(line, ";$") {
+			return lf, false, nil
+		}
+		switch key {
+		case "FILEVERSION":
+			p.version = val
+		case "STARTTIME":
+			days, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return lf, false, fmt.Errorf("bad start time %q", val)
+			}
+			// days since 1899-12-30 local time (OLE automation date)
+			whole := math.Floor(days)
+			p.start = time.Date(1899, 12, 30+int(whole), 0, 0, 0, 0, time.Local).
+				Add(time.Duration((days - whole) * float64(24*time.Hour)))
+		case "COLUMNS":
+			p.columns = strings.ReplaceAll(val, ",", "")
+		}
+		return lf, false, nil
+	}
+
+	cols := p.columns
+	if cols == "" {
+		if cols = trcColumns[p.version]; cols == "" {
+			if strings.HasPrefix(p.version, "2.") {
+				cols = trcColumns["2.1"]
+			} else {
+				cols = trcColumns["1.1"]
+			}
+		}
+	}
+	fields := strings.Fields(line)
+	lf.Iface = "can0"
+	remote := false
+	dataAt := -1
+	for i, c := range []byte(cols) {
+		if c == 'D' {
+			dataAt = i
+			break
+		}
+		if i >= len(fields) {
+			return lf, false, fmt.Errorf("%d columns, want %d", len(fields), len(cols))
+		}
+		v := fields[i]
+		switch c {
+		case 'O':
+			ms, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return lf, false, fmt.Errorf("bad time offset %q", v)
+			}
+			lf.TS = p.start.Add(time.Duration(math.Round(ms * 1e6)))
+		case 'T':
+			switch v {
+			case "Rx", "Tx", "DT":
+			case "RR":
+				remote = true
+			default:
+				return lf, false, nil // errors, status, CAN FD
+			}
+		case 'B':
+			lf.Iface = channelIface(v)
+		case 'I':
+			id, err := strconv.ParseUint(v, 16, 29)
+			if err != nil {
+				return lf, false, fmt.Errorf("bad id %q", v)
+			}
+			lf.Frame.ID = uint32(id)
+			lf.Frame.IsExtended = len(v) > 4
+		case 'L', 'l':
+			dlc, err := strconv.ParseUint(v, 10, 8)
+			if err != nil {
+				return lf, false, fmt.Errorf("bad length %q", v)
+			}
+			lf.Frame.Length = uint8(min(dlc, can.MaxDataLength))
+		}
+	}
+	if dataAt >= 0 && len(fields) > dataAt && fields[dataAt] == "RTR" {
+		remote = true
+	}
+	lf.Frame.IsRemote = remote
+	if remote || lf.Frame.Length == 0 {
+		return lf, true, nil
+	}
+	if dataAt < 0 || len(fields) < dataAt+int(lf.Frame.Length) {
+		return lf, false, fmt.Errorf("length %d but fewer data bytes", lf.Frame.Length)
+	}
+	return lf, true, parseDataBytes(&lf.Frame, fields[dataAt:dataAt+int(lf.Frame.Length)])
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+const (
+	maxCaptures       = 20
+	maxCaptureFrames  = 500000
+	maxTriggerPreS    = 600
+	defaultTriggerPre = 5
+)
+
+// TriggerConfig defines a capture trigger. On is "signal" (Signal compared
+// with Op and Value), "frame" (ID appears) or "error" (any error frame).
+// A capture holds PreS seconds of raw frames before the trigger fired and
+// PostS seconds after it. Triggers are one-shot unless Rearm is set.
+type TriggerConfig struct {
+	Name   string  `yaml:"name" json:"name"`
+	On     string  `yaml:"on" json:"on"`
+	Signal string  `yaml:"signal" json:"signal,omitempty"`
+	Op     string  `yaml:"op" json:"op,omitempty"`
+	Value  float64 `yaml:"value" json:"value,omitempty"`
+	ID     string  `yaml:"id" json:"id,omitempty"`
+	PreS   float64 `yaml:"pre_s" json:"pre_s"`
+	PostS  float64 `yaml:"post_s" json:"post_s"`
+	Rearm  bool    `yaml:"rearm" json:"rearm"`
+}
+
+type trigger struct {
+	cfg   TriggerConfig
+	id    uint32
+	armed bool
+	// last comparison result per matched signal, for edge detection
+	was   map[string]bool
+	fired int
+}
+
+type TriggerStatus struct {
+	TriggerConfig
+	Armed bool `json:"armed"`
+	Fired int  `json:"fired"`
+}
+
+// Capture is the raw traffic around one trigger event.
+type Capture struct {
+	ID       int       `json:"id"`
+	Trigger  string    `json:"trigger"`
+	Reason   string    `json:"reason"`
+	FiredAt  time.Time `json:"fired_at"`
+	From     time.Time `json:"from"`
+	Until    time.Time `json:"until"`
+	Frames   int       `json:"frames"`
+	Complete bool      `json:"complete"`
+
+	frames    []LogFrame
+	wallUntil time.Time
+}
+
+// Triggers watches frames for trigger conditions and keeps captures of the
+// traffic around each event. While any trigger is armed the most recent
+// frames are held in a time-bounded history to provide the pre-trigger part.
+type Triggers struct {
+	mu       sync.Mutex
+	triggers map[string]*trigger
+	history  []LogFrame // history[head:] is the live window
+	head     int
+	captures []*Capture
+	nextID   int
+}
+
+func NewTriggers() *Triggers {
+	return &Triggers{triggers: make(map[string]*trigger)}
+}
+
+// Arm adds or replaces a trigger.
+func (t *Triggers) Arm(cfg TriggerConfig) error {
+	tr := &trigger{cfg: cfg, armed: true, was: make(map[string]bool)}
+	if cfg.Name == "" {
+		return errors.New("trigger name is required")
+	}
+	switch cfg.On {
+	case "signal":
+		if cfg.Signal == "" {
+			return errors.New("signal trigger needs a signal")
+		}
+		if _, err := compare(cfg.Op, 0, 0); err != nil {
+			return err
+		}
+	case "frame":
+		id, err := parseHexID(cfg.ID)
+		if err != nil {
+			return fmt.Errorf("frame trigger: bad id %q", cfg.ID)
+		}
+		tr.id = id
+	case "error":
+	default:
+		return fmt.Errorf("unknown trigger type %q (want signal, frame or error)", cfg.On)
+	}
+	if tr.cfg.PreS == 0 && tr.cfg.PostS == 0 {
+		tr.cfg.PreS, tr.cfg.PostS = defaultTriggerPre, defaultTriggerPre
+	}
+	if tr.cfg.PreS < 0 || tr.cfg.PostS < 0 || tr.cfg.PreS > maxTriggerPreS {
+		return fmt.Errorf("pre_s must be within 0..%d and post_s must not be negative", maxTriggerPreS)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.triggers[cfg.Name] = tr
+	return nil
+}
+
+func (t *Triggers) Disarm(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.triggers[name]; !ok {
+		return fmt.Errorf("unknown trigger %q", name)
+	}
+	delete(t.triggers, name)
+	return nil
+}
+
+func compare(op string, v, ref float64) (bool, error) {
+	switch op {
+	case ">":
+		return v > ref, nil
+	case ">=":
+		return v >= ref, nil
+	case "<":
+		return v < ref, nil
+	case "<=":
+		return v <= ref, nil
+	case "==":
+		return v == ref, nil
+	case "!=":
+		return v != ref, nil
+	default:
+		return false, fmt.Errorf("unknown op %q (want >, >=, <, <=, == or !=)", op)
+	}
+}
+
+// ObserveFrame feeds one data frame received on bus; def is nil for
+// unmapped IDs. It returns the names of triggers that fired.
+func (t *Triggers) ObserveFrame(bus string, f can.Frame, def *FrameDef, ts time.Time) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.triggers) == 0 && len(t.captures) == 0 {
+		return nil
+	}
+
+	lf := LogFrame{TS: ts, Iface: bus, Frame: f}
+	t.extendCaptures(lf)
+
+	var fired []string
+	for _, tr := range t.triggers {
+		if !tr.armed {
+			continue
+		}
+		switch tr.cfg.On {
+		case "frame":
+			if uint32(f.ID) == tr.id {
+				fired = append(fired, tr.cfg.Name)
+				t.fire(tr, fmt.Sprintf("frame 0x%03X seen", tr.id), ts, lf)
+			}
+		case "signal":
+			if def == nil {
+				continue
+			}
+			for _, sig := range def.Signals {
+				key := def.Name + "." + sig.SignalName
+				if tr.cfg.Signal != sig.SignalName && tr.cfg.Signal != key {
+					continue
+				}
+				v := decodeSignal(f.Data, sig)
+				hit, _ := compare(tr.cfg.Op, v, tr.cfg.Value)
+				// fire on the edge only, so a signal that stays above the
+				// threshold does not retrigger a rearmed trigger
+				if hit && !tr.was[key] {
+					fired = append(fired, tr.cfg.Name)
+					t.fire(tr, fmt.Sprintf("%s = %g %s %g", key, v, tr.cfg.Op, tr.cfg.Value), ts, lf)
+				}
+				tr.was[key] = hit
+			}
+		}
+	}
+
+	t.history = append(t.history, lf)
+	t.trimHistory(ts)
+	return fired
+}
+
+// ObserveError feeds an error frame event and returns the names of
+// triggers that fired.
+func (t *Triggers) ObserveError(detail string, ts time.Time) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var fired []string
+	for _, tr := range t.triggers {
+		if tr.armed && tr.cfg.On == "error" {
+			fired = append(fired, tr.cfg.Name)
+			t.fire(tr, "error frame: "+detail, ts, LogFrame{})
+		}
+	}
+	return fired
+}
+
+// fire starts a capture for tr. lf is the triggering frame, or zero for
+// error events; it is not in history yet. t.mu must be held.
+func (t *Triggers) fire(tr *trigger, reason string, ts time.Time, lf LogFrame) {
+	tr.fired++
+	tr.armed = tr.cfg.Rearm
+	for _, c := range t.captures {
+		// one capture per trigger at a time
+		if !c.Complete && c.Trigger == tr.cfg.Name {
+			return
+		}
+	}
+
+	pre := time.Duration(tr.cfg.PreS * float64(time.Second))
+	post := time.Duration(tr.cfg.PostS * float64(time.Second))
+	t.nextID++
+	c := &Capture{
+		ID:        t.nextID,
+		Trigger:   tr.cfg.Name,
+		Reason:    reason,
+		FiredAt:   ts,
+		From:      ts.Add(-pre),
+		Until:     ts.Add(post),
+		wallUntil: time.Now().Add(post),
+	}
+	for _, h := range t.history[t.head:] {
+		if !h.TS.Before(c.From) {
+			c.frames = append(c.frames, h)
+		}
+	}
+	if !lf.TS.IsZero() {
+		c.frames = append(c.frames, lf)
+	}
+	c.Frames = len(c.frames)
+
+	t.captures = append(t.captures, c)
+	if len(t.captures) > maxCaptures {
+		t.captures = t.captures[len(t.captures)-maxCaptures:]
+	}
+}
+
+// extendCaptures appends lf to captures still in their post-trigger window.
+// t.mu must be held.
+func (t *Triggers) extendCaptures(lf LogFrame) {
+	for _, c := range t.captures {
+		if c.Complete {
+			continue
+		}
+		if lf.TS.After(c.Until) || len(c.frames) >= maxCaptureFrames {
+			c.Complete = true
+			continue
+		}
+		c.frames = append(c.frames, lf)
+		c.Frames = len(c.frames)
+	}
+}
+
+// trimHistory drops frames older than the longest armed pre-trigger window.
+// t.mu must be held.
+func (t *Triggers) trimHistory(now time.Time) {
+	var pre float64
+	for _, tr := range t.triggers {
+		if tr.armed {
+			pre = max(pre, tr.cfg.PreS)
+		}
+	}
+	cutoff := now.Add(-time.Duration(pre * float64(time.Second)))
+	live := t.history[t.head:]
+	i := sort.Search(len(live), func(i int) bool { return !live[i].TS.Before(cutoff) })
+	if len(live)-i > maxCaptureFrames {
+		i = len(live) - maxCaptureFrames
+	}
+	t.head += i
+	// Only compact once the dropped prefix outweighs the window, so each
+	// frame is copied a bounded number of times instead of on every call.
+	if t.head > len(t.history)/2 {
+		n := copy(t.history, t.history[t.head:])
+		clear(t.history[n:])
+		t.history = t.history[:n]
+		t.head = 0
+	}
+}
+
+// completeStale marks captures whose post window has passed in wall-clock
+// time, for buses that went quiet after the trigger. t.mu must be held.
+func (t *Triggers) completeStale() {
+	now := time.Now()
+	for _, c := range t.captures {
+		if !c.Complete && now.After(c.wallUntil) {
+			c.Complete = true
+		}
+	}
+}
+
+func (t *Triggers) Status() []TriggerStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]TriggerStatus, 0, len(t.triggers))
+	for _, tr := range t.triggers {
+		out = append(out, TriggerStatus{TriggerConfig: tr.cfg, Armed: tr.armed, Fired: tr.fired})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Captures lists the kept captures, newest first.
+func (t *Triggers) Captures() []Capture {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.completeStale()
+	out := make([]Capture, 0, len(t.captures))
+	for i := len(t.captures) - 1; i >= 0; i-- {
+		c := *t.captures[i]
+		c.frames = nil
+		out = append(out, c)
+	}
+	return out
+}
+
+// Capture returns capture id and its frames. The frames must not be
+// modified.
+func (t *Triggers) Capture(id int) (Capture, []LogFrame, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.completeStale()
+	for _, c := range t.captures {
+		if c.ID == id {
+			hdr := *c
+			hdr.frames = nil
+			return hdr, c.frames[:len(c.frames):len(c.frames)], nil
+		}
+	}
+	return Capture{}, nil, fmt.Errorf("capture %d not found", id)
+}
+
+// WriteCapture writes capture id as a candump log, with the trigger details
+// in leading comment lines.
+func (t *Triggers) WriteCapture(w io.Writer, id int) error {
+	hdr, frames, err := t.Capture(id)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# capture %d trigger %s\n", hdr.ID, hdr.Trigger)
+	fmt.Fprintf(&b, "# reason %s\n", hdr.Reason)
+	fmt.Fprintf(&b, "# fired_at %s complete %v\n", hdr.FiredAt.Format(time.RFC3339Nano), hdr.Complete)
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	for _, lf := range frames {
+		if _, err := fmt.Fprintf(w, "(%d.%06d) %s %s\n", lf.TS.Unix(), lf.TS.Nanosecond()/1000, lf.Iface, lf.Frame.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RunTUI renders a cansniffer/top style view of the store to the terminal
+// until ctx is cancelled. Log output is captured and shown in the footer so
+// it does not tear the screen.
+func RunTUI(ctx context.Context, app *App, interval time.Duration) {
+	logs := &tuiLog{max: 3}
+	defer logOut.redirect(logs)()
+
+	out := bufio.NewWriter(os.Stdout)
+	fmt.Fprint(out, "\x1b[?25l")
+	defer func() {
+		fmt.Fprint(out, "\x1b[?25h\n")
+		out.Flush()
+		for _, l := range logs.lines() {
+			fmt.Fprintln(os.Stderr, l)
+		}
+	}()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		w, h := termSize()
+		renderTUI(out, app.Iface, app.Store, app.Stats, logs, w, h)
+		out.Flush()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func renderTUI(out io.Writer, iface string, store *Store, stats *BusStats, logs *tuiLog, w, h int) {
+	signals, raw := store.Snapshot()
+	st := stats.Snapshot()
+	now := time.Now()
+
+	lastData := make(map[string]string, len(raw))
+	for _, f := range raw {
+		if f.Error == "" {
+			lastData[f.ID] = f.DataHex
+		}
+	}
+
+	lines := make([]string, 0, h)
+	lines = append(lines,
+		fmt.Sprintf("\x1b[1mCAN Dashboard\x1b[0m  %s  %s  frames %d  %.1f fps  load %.1f%%",
+			iface, now.Format("15:04:05"), st.TotalFrames, st.FramesPerSec, st.BusLoadPct),
+		"",
+	)
+
+	// Split the space between the ID table and the signal table, keeping
+	// room for the header, two section titles and the log footer.
+	body := h - len(lines) - 2 - logs.max - 1
+	if body < 2 {
+		body = 2
+	}
+	idRows := body / 2
+	sigRows := body - idRows
+
+	lines = append(lines, fmt.Sprintf("\x1b[7m%-10s %9s %8s %8s %8s  %-16s\x1b[0m", "ID", "COUNT", "FPS", "AVG ms", "JIT ms", "LAST DATA"))
+	for i, s := range st.IDs {
+		if i >= idRows {
+			break
+		}
+		data, ok := lastData[s.ID]
+		if !ok {
+			data = "--"
+		}
+		lines = append(lines, fmt.Sprintf("%-10s %9d %8.1f %8.2f %8.2f  %-16s", s.ID, s.Count, s.FramesPerSec, s.AvgIntervalMs, s.JitterMs, data))
+	}
+	for i := len(st.IDs); i < idRows; i++ {
+		lines = append(lines, "")
+	}
+
+	lines = append(lines, fmt.Sprintf("\x1b[7m%-40s %14s %-8s %8s\x1b[0m", "SIGNAL", "VALUE", "UNIT", "AGE"))
+	for i, s := range signals {
+		if i >= sigRows {
+			break
+		}
+		age := now.Sub(s.UpdatedAt).Truncate(time.Millisecond)
+		lines = append(lines, fmt.Sprintf("%-40s %14.3f %-8s %8s", s.FrameName+"."+s.Name, s.Value, s.Unit, age))
+	}
+	for i := len(signals); i < sigRows; i++ {
+		lines = append(lines, "")
+	}
+
+	lines = append(lines, "")
+	lines = append(lines, logs.lines()...)
+
+	fmt.Fprint(out, "\x1b[H\x1b[2J")
+	for i, l := range lines {
+		if i >= h {
+			break
+		}
+		fmt.Fprint(out, truncateVisible(l, w), "\r\n")
+	}
+}
+
+// truncateVisible cuts s to w printable columns, leaving ANSI escape
+// sequences intact.
+func truncateVisible(s string, w int) string {
+	var b strings.Builder
+	n := 0
+	esc := false
+	for _, r := range s {
+		switch {
+		case esc:
+			b.WriteRune(r)
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+				esc = false
+			}
+		case r == '\x1b':
+			esc = true
+			b.WriteRune(r)
+		case n < w:
+			b.WriteRune(r)
+			n++
+		}
+	}
+	return b.String()
+}
+
+// tuiLog keeps the last few log lines for the TUI footer.
+type tuiLog struct {
+	mu  sync.Mutex
+	max int
+	buf []string
+}
+
+func (l *tuiLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		l.buf = append(l.buf, line)
+	}
+	if len(l.buf) > l.max {
+		l.buf = l.buf[len(l.buf)-l.max:]
+	}
+	return len(p), nil
+}
+
+func (l *tuiLog) lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.buf...)
+}
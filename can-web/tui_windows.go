@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func termSize() (w, h int) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(os.Stdout.Fd()), &info); err != nil {
+		return 80, 24
+	}
+	w = int(info.Window.Right-info.Window.Left) + 1
+	h = int(info.Window.Bottom-info.Window.Top) + 1
+	if w <= 0 || h <= 0 {
+		return 80, 24
+	}
+	return w, h
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.einride.tech/can"
+	"go.einride.tech/can/pkg/socketcan"
+)
+
+// Transmitter puts frames on the bus.
+type Transmitter interface {
+	Transmit(ctx context.Context, f can.Frame) error
+}
+
+// NewTransmitter returns the transmitter matching the frame source: a
+// SocketCAN socket for live buses, the backend itself for backends, and a
+// loopback into the frame path for the simulator and replays so sent frames
+// still show up.
+func NewTransmitter(cfg Config, app *App) (Transmitter, error) {
+	if cfg.Source == "socketcan" {
+		return &socketTx{iface: cfg.Iface}, nil
+	}
+	if f, ok := backends[cfg.Source]; ok {
+		return f(cfg)
+	}
+	return loopbackTx{app: app}, nil
+}
+
+// socketTx keeps one transmit socket open and redials it after errors.
+type socketTx struct {
+	iface string
+
+	mu sync.Mutex
+	tx *socketcan.Transmitter
+}
+
+func (s *socketTx) Transmit(ctx context.Context, f can.Frame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tx == nil {
+		conn, err := socketcan.DialContext(ctx, "can", s.iface)
+		if err != nil {
+			return fmt.Errorf("socketcan dial(%s): %w", s.iface, err)
+		}
+		s.tx = socketcan.NewTransmitter(conn)
+	}
+	if err := s.tx.TransmitFrame(ctx, f); err != nil {
+		s.tx.Close()
+		s.tx = nil
+		return err
+	}
+	return nil
+}
+
+type loopbackTx struct{ app *App }
+
+func (l loopbackTx) Transmit(_ context.Context, f can.Frame) error {
+	ingestFrame(l.app, f, userStamp(time.Now()), "tx")
+	return nil
+}
+
+// SendFrame validates f and transmits it if the TX interlocks let it pass.
+func (app *App) SendFrame(ctx context.Context, f can.Frame) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	if err := app.TxGuard.Check(f); err != nil {
+		return err
+	}
+	return app.Tx.Transmit(ctx, f)
+}
+
+// sendParams is the JSON form of a frame to send.
+type sendParams struct {
+	ID       string `json:"id"`
+	Data     string `json:"data"`
+	Extended bool   `json:"extended"`
+	Remote   bool   `json:"remote"`
+	DLC      *int   `json:"dlc,omitempty"` // remote frames only
+}
+
+func (p sendParams) frame() (can.Frame, error) {
+	var f can.Frame
+	if p.ID == "" {
+		return f, errors.New("id is required")
+	}
+	id, err := parseHexID(p.ID)
+	if err != nil {
+		return f, fmt.Errorf("bad id %q: %w", p.ID, err)
+	}
+	data, err := hex.DecodeString(strings.Join(strings.Fields(p.Data), ""))
+	if err != nil {
+		return f, fmt.Errorf("bad data %q: %w", p.Data, err)
+	}
+	if len(data) > 8 {
+		return f, fmt.Errorf("data is %d bytes, max 8", len(data))
+	}
+	f.ID = id
+	f.IsExtended = p.Extended
+	f.IsRemote = p.Remote
+	f.Length = uint8(copy(f.Data[:], data))
+	if p.DLC != nil {
+		if *p.DLC < 0 || *p.DLC > 8 {
+			return f, fmt.Errorf("dlc %d out of range 0-8", *p.DLC)
+		}
+		if p.Remote {
+			f.Length = uint8(*p.DLC)
+		}
+	}
+	return f, nil
+}
+
+func registerSendAction(app *App) {
+	app.Control.Register("frame.send", func(params json.RawMessage) (any, error) {
+		var p sendParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		f, err := p.frame()
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := app.SendFrame(ctx, f); err != nil {
+			return nil, err
+		}
+		return map[string]string{"sent": f.String()}, nil
+	})
+
+	app.Control.Register("frame.request", func(params json.RawMessage) (any, error) {
+		var p rtrParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return app.RequestFrame(p)
+	})
+}
+
+const defaultRTRTimeout = 500 * time.Millisecond
+
+// rtrParams asks for a remote frame to be sent and the reply awaited.
+type rtrParams struct {
+	ID        string `json:"id"`
+	Extended  bool   `json:"extended"`
+	DLC       *int   `json:"dlc"` // requested length, default 8
+	TimeoutMs int    `json:"timeout_ms"`
+}
+
+type RTRResult struct {
+	Request   string    `json:"request"`
+	Response  *RawFrame `json:"response"`
+	LatencyMs float64   `json:"latency_ms"`
+}
+
+// RequestFrame sends a remote frame and waits for the first received data
+// frame with the same ID. Nodes that only answer remote requests can be
+// read this way.
+func (app *App) RequestFrame(p rtrParams) (*RTRResult, error) {
+	if p.ID == "" {
+		return nil, errors.New("id is required")
+	}
+	id, err := parseHexID(p.ID)
+	if err != nil {
+		return nil, fmt.Errorf("bad id %q: %w", p.ID, err)
+	}
+	dlc := 8
+	if p.DLC != nil {
+		dlc = *p.DLC
+	}
+	if dlc < 0 || dlc > 8 {
+		return nil, fmt.Errorf("dlc %d out of range 0-8", dlc)
+	}
+	timeout := defaultRTRTimeout
+	if p.TimeoutMs > 0 {
+		timeout = time.Duration(p.TimeoutMs) * time.Millisecond
+	}
+	f := can.Frame{ID: id, IsExtended: p.Extended, IsRemote: true, Length: uint8(dlc)}
+
+	// Subscribe first so a fast reply is not missed.
+	events, _, cancel := app.Store.Subscribe(subInternal, 256)
+	defer cancel()
+	ctx, stop := context.WithTimeout(context.Background(), timeout)
+	defer stop()
+	sent := time.Now()
+	if err := app.SendFrame(ctx, f); err != nil {
+		return nil, err
+	}
+	res := &RTRResult{Request: f.String()}
+	for {
+		select {
+		case ev := <-events:
+			r := ev.Raw
+			if r == nil || r.RTR || r.Error != "" || r.Dir != "rx" || r.canID != id || r.Extended != p.Extended {
+				continue
+			}
+			res.Response = r
+			res.LatencyMs = float64(r.WallTS.Sub(sent).Microseconds()) / 1000
+			return res, nil
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no reply to %s within %s", f.String(), timeout)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"go.einride.tech/can"
+)
+
+// TxFrame is a frame the map marks for transmission, with what a transmit
+// panel needs to encode it.
+type TxFrame struct {
+	ID          string     `json:"id"`
+	Mask        string     `json:"mask,omitempty"` // masked definitions: pick an ID under the mask
+	Name        string     `json:"name"`
+	Node        string     `json:"node,omitempty"`
+	Extended    bool       `json:"extended"`
+	DLC         int        `json:"dlc"`
+	CycleMs     int        `json:"cycle_ms,omitempty"`
+	DefaultData string     `json:"default_data"` // every signal at its default, hex
+	Signals     []TxSignal `json:"signals"`
+}
+
+type TxSignal struct {
+	Name       string            `json:"name"`
+	Unit       string            `json:"unit"`
+	StartBit   int               `json:"start_bit"`
+	BitLength  int               `json:"bit_length"`
+	Endianness Endianness        `json:"endianness"`
+	Signed     bool              `json:"signed"`
+	Factor     float64           `json:"factor"`
+	Offset     float64           `json:"offset"`
+	Min        float64           `json:"min"` // encodable range: the map's, else the bit field's
+	Max        float64           `json:"max"`
+	Default    float64           `json:"default"`
+	Comment    string            `json:"comment,omitempty"`
+	MuxSwitch  bool              `json:"mux_switch,omitempty"`
+	MuxValue   *uint64           `json:"mux_value,omitempty"` // set for multiplexed signals
+	Values     map[string]string `json:"values,omitempty"`    // raw value -> label
+}
+
+// TxCatalog lists the frames of defs with at least one tx signal, ordered by
+// ID, with only their tx signals. Derived signals are computed, not sent, and
+// are left out.
+func TxCatalog(defs map[uint32]FrameDef) []TxFrame {
+	out := []TxFrame{}
+	for _, fd := range defs {
+		var sigs []TxSignal
+		var data can.Data
+		for _, s := range fd.Signals {
+			if s.Direction != "tx" {
+				continue
+			}
+			lo, hi := physicalRange(s)
+			ts := TxSignal{
+				Name:       s.SignalName,
+				Unit:       s.Unit,
+				StartBit:   int(s.StartBit),
+				BitLength:  int(s.BitLength),
+				Endianness: s.Endianness,
+				Signed:     s.Signed,
+				Factor:     s.Factor,
+				Offset:     s.Offset,
+				Min:        lo,
+				Max:        hi,
+				Default:    s.Default,
+				Comment:    s.Comment,
+				MuxSwitch:  s.MuxSwitch,
+			}
+			if s.Muxed {
+				v := s.MuxValue
+				ts.MuxValue = &v
+			}
+			if len(s.Values) > 0 {
+				ts.Values = make(map[string]string, len(s.Values))
+				for raw, label := range s.Values {
+					ts.Values[strconv.FormatInt(raw, 10)] = label
+				}
+			}
+			sigs = append(sigs, ts)
+			if !s.Muxed {
+				encodeSignal(&data, s, s.Default)
+			}
+		}
+		if len(sigs) == 0 {
+			continue
+		}
+		for _, s := range fd.Present(data) {
+			if s.Muxed && s.Direction == "tx" {
+				encodeSignal(&data, s, s.Default)
+			}
+		}
+		tf := TxFrame{
+			ID:          canIDString(fd.ID, fd.ID > 0x7FF),
+			Name:        fd.Name,
+			Node:        fd.Node,
+			Extended:    fd.ID > 0x7FF,
+			DLC:         int(fd.DLC),
+			CycleMs:     fd.CycleMs,
+			DefaultData: hex.EncodeToString(data[:min(int(fd.DLC), len(data))]),
+			Signals:     sigs,
+		}
+		if fd.Mask != 0 {
+			tf.Mask = fmt.Sprintf("0x%X", fd.Mask)
+		}
+		out = append(out, tf)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, _ := parseHexID(out[i].ID)
+		b, _ := parseHexID(out[j].ID)
+		return a < b
+	})
+	return out
+}
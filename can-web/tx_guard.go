@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+type TxConfig struct {
+	Armed     *bool              `yaml:"armed"`       // default: armed for sim and replay, disarmed on a real bus
+	AllowIDs  string             `yaml:"allow_ids"`   // e.g. "0x600-0x6FF,0x7E0"; empty allows any ID
+	MaxRateHz float64            `yaml:"max_rate_hz"` // all frames together; 0: no limit
+	IDRateHz  float64            `yaml:"id_rate_hz"`  // per ID; 0: no limit
+	IDRates   map[string]float64 `yaml:"id_rates"`    // per-ID overrides of id_rate_hz
+	Burst     float64            `yaml:"burst"`       // frames that may go back to back; default one second's worth
+}
+
+var (
+	errTxDisarmed    = errors.New("tx is disarmed")
+	errTxIDForbidden = errors.New("id not allowed")
+	errTxRateLimited = errors.New("tx rate limit exceeded")
+)
+
+// tokenBucket allows rate frames per second on average and up to burst at
+// once.
+type tokenBucket struct {
+	rate, burst float64
+	tokens      float64
+	last        time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	if burst < 1 {
+		burst = max(1, math.Ceil(rate))
+	}
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+}
+
+// TxGuard sits in front of every transmission, whichever client or
+// subsystem asks for it: nothing is sent while disarmed, IDs outside the
+// allow list are refused, and frames over the rate limits are dropped
+// rather than queued.
+type TxGuard struct {
+	allow   []idRange
+	allowed string
+	maxRate float64
+	idRate  float64
+	idRates map[uint32]float64
+	burst   float64
+
+	mu       sync.Mutex
+	armed    bool
+	changed  time.Time
+	global   *tokenBucket
+	perID    map[uint32]*tokenBucket
+	sent     uint64
+	refused  map[string]uint64
+	lastDeny string
+}
+
+func NewTxGuard(cfg TxConfig, source string) (*TxGuard, error) {
+	g := &TxGuard{
+		allowed: cfg.AllowIDs,
+		maxRate: cfg.MaxRateHz,
+		idRate:  cfg.IDRateHz,
+		idRates: make(map[uint32]float64),
+		burst:   cfg.Burst,
+		changed: time.Now(),
+		perID:   make(map[uint32]*tokenBucket),
+		refused: make(map[string]uint64),
+	}
+	if g.maxRate < 0 || g.idRate < 0 || g.burst < 0 {
+		return nil, errors.New("tx: rates and burst must not be negative")
+	}
+	g.armed = source == "sim" || source == "replay"
+	if cfg.Armed != nil {
+		g.armed = *cfg.Armed
+	}
+	if strings.TrimSpace(cfg.AllowIDs) != "" {
+		ids, errFrames, err := parseIDList(cfg.AllowIDs)
+		if err != nil {
+			return nil, fmt.Errorf("tx allow_ids: %w", err)
+		}
+		if errFrames {
+			return nil, errors.New("tx allow_ids: ERR is not an ID")
+		}
+		g.allow = ids
+	}
+	for s, rate := range cfg.IDRates {
+		id, err := parseHexID(s)
+		if err != nil {
+			return nil, fmt.Errorf("tx id_rates: bad id %q: %w", s, err)
+		}
+		if rate < 0 {
+			return nil, fmt.Errorf("tx id_rates %s: rate must not be negative", s)
+		}
+		g.idRates[id] = rate
+	}
+	if g.maxRate > 0 {
+		g.global = newTokenBucket(g.maxRate, g.burst)
+	}
+	if !g.armed {
+		slog.Info("tx disarmed until tx.arm", "source", source)
+	}
+	return g, nil
+}
+
+// Check decides whether f may go out now and, if so, counts it against the
+// rate limits.
+func (g *TxGuard) Check(f can.Frame) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.checkLocked(f, time.Now()); err != nil {
+		var reason string
+		switch {
+		case errors.Is(err, errTxDisarmed):
+			reason = "disarmed"
+		case errors.Is(err, errTxIDForbidden):
+			reason = "id"
+		default:
+			reason = "rate"
+		}
+		g.refused[reason]++
+		g.lastDeny = err.Error()
+		return err
+	}
+	g.sent++
+	return nil
+}
+
+func (g *TxGuard) checkLocked(f can.Frame, now time.Time) error {
+	if !g.armed {
+		return errTxDisarmed
+	}
+	if len(g.allow) > 0 && !idInRanges(f.ID, g.allow) {
+		return fmt.Errorf("%w: %s is not in tx.allow_ids (%s)", errTxIDForbidden, canIDString(f.ID, f.IsExtended), g.allowed)
+	}
+	per := g.bucketLocked(f.ID)
+	if g.global != nil {
+		g.global.refill(now)
+	}
+	if per != nil {
+		per.refill(now)
+	}
+	if g.global != nil && g.global.tokens < 1 {
+		return fmt.Errorf("%w: over %g frames/s in total", errTxRateLimited, g.maxRate)
+	}
+	if per != nil && per.tokens < 1 {
+		return fmt.Errorf("%w: over %g frames/s for %s", errTxRateLimited, per.rate, canIDString(f.ID, f.IsExtended))
+	}
+	if g.global != nil {
+		g.global.tokens--
+	}
+	if per != nil {
+		per.tokens--
+	}
+	return nil
+}
+
+// bucketLocked returns the rate limiter of id, or nil when it has none.
+func (g *TxGuard) bucketLocked(id uint32) *tokenBucket {
+	if b, ok := g.perID[id]; ok {
+		return b
+	}
+	rate, ok := g.idRates[id]
+	if !ok {
+		rate = g.idRate
+	}
+	if rate <= 0 {
+		return nil
+	}
+	b := newTokenBucket(rate, g.burst)
+	g.perID[id] = b
+	return b
+}
+
+// SetArmed arms or disarms transmission and reports whether that changed
+// anything.
+func (g *TxGuard) SetArmed(armed bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.armed == armed {
+		return false
+	}
+	g.armed = armed
+	g.changed = time.Now()
+	if armed {
+		slog.Warn("tx armed")
+	} else {
+		slog.Info("tx disarmed")
+	}
+	return true
+}
+
+// TxGuardStatus is the state of the transmit interlocks.
+type TxGuardStatus struct {
+	Armed     bool               `json:"armed"`
+	Since     time.Time          `json:"since"`
+	AllowIDs  string             `json:"allow_ids"` // empty: any ID
+	MaxRateHz float64            `json:"max_rate_hz"`
+	IDRateHz  float64            `json:"id_rate_hz"`
+	IDRates   map[string]float64 `json:"id_rates,omitempty"`
+	Sent      uint64             `json:"sent"`
+	Refused   map[string]uint64  `json:"refused"` // by reason: disarmed, id, rate
+	LastError string             `json:"last_error,omitempty"`
+}
+
+func (g *TxGuard) Status() TxGuardStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := TxGuardStatus{
+		Armed:     g.armed,
+		Since:     g.changed,
+		AllowIDs:  g.allowed,
+		MaxRateHz: g.maxRate,
+		IDRateHz:  g.idRate,
+		Sent:      g.sent,
+		Refused:   map[string]uint64{"disarmed": g.refused["disarmed"], "id": g.refused["id"], "rate": g.refused["rate"]},
+		LastError: g.lastDeny,
+	}
+	if len(g.idRates) > 0 {
+		s.IDRates = make(map[string]float64, len(g.idRates))
+		for id, rate := range g.idRates {
+			s.IDRates[fmt.Sprintf("0x%03X", id)] = rate
+		}
+	}
+	return s
+}
+
+func registerTxGuardActions(app *App) {
+	arm := func(armed bool) ControlHandler {
+		return func(json.RawMessage) (any, error) {
+			app.TxGuard.SetArmed(armed)
+			return app.TxGuard.Status(), nil
+		}
+	}
+	app.Control.Register("tx.arm", arm(true))
+	app.Control.Register("tx.disarm", arm(false))
+}
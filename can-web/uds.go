@@ -0,0 +1,538 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.einride.tech/can"
+)
+
+// UDS (ISO 14229) requests go over ISO-TP (ISO 15765-2) with normal
+// addressing: one request ID and one response ID per ECU.
+
+const (
+	udsDefaultTimeout = time.Second     // P2 client: first response
+	udsPendingTimeout = 5 * time.Second // P2* client: after "response pending"
+	isotpFrameTimeout = time.Second     // N_Bs / N_Cr: between frames of one message
+	isotpMaxLen       = 4095
+	isotpMaxWait      = 10 // flow control WAIT frames accepted in a row
+
+	udsNegativeResponse = 0x7F
+	nrcResponsePending  = 0x78
+)
+
+type UDSConfig struct {
+	TxID            string `yaml:"tx_id"` // default request ID, e.g. 0x7E0
+	RxID            string `yaml:"rx_id"` // default response ID, e.g. 0x7E8
+	TimeoutMs       int    `yaml:"timeout_ms"`
+	Padding         *int   `yaml:"padding"`           // fill byte for short frames, default 0xCC; -1 sends short frames
+	Algorithm       string `yaml:"algorithm"`         // default seed-key algorithm
+	SeedKeyCommand  string `yaml:"seed_key_command"`  // external seed-key program, the "command" algorithm
+	TesterPresentMs int    `yaml:"tester_present_ms"` // default TesterPresent interval
+}
+
+// udsTarget is the addressing of one ECU.
+type udsTarget struct {
+	tx, rx   uint32
+	extended bool
+}
+
+func (t udsTarget) String() string { return fmt.Sprintf("0x%03X", t.tx) }
+
+// udsECUState is what the client knows about an ECU from its own requests.
+type udsECUState struct {
+	rx       uint32
+	session  byte
+	security byte // unlocked level, 0 when locked
+	unlocked time.Time
+	last     time.Time
+	lastNRC  byte
+}
+
+// UDSClient sends diagnostic requests and keeps track of the session and
+// security level it has put each ECU in. Requests to one ECU are
+// serialised: ISO-TP cannot tell two messages to the same response ID
+// apart.
+type UDSClient struct {
+	app     *App
+	def     udsTarget
+	timeout time.Duration
+	padding int
+	algo    string
+	command string
+
+	tpInterval time.Duration
+
+	mu   sync.Mutex
+	busy map[uint32]*sync.Mutex // per response ID
+	ecus map[uint32]*udsECUState
+	tp   map[uint32]*testerPresent
+}
+
+func NewUDSClient(app *App, cfg UDSConfig) (*UDSClient, error) {
+	c := &UDSClient{
+		app:     app,
+		def:     udsTarget{tx: 0x7E0, rx: 0x7E8},
+		timeout: udsDefaultTimeout,
+		padding: 0xCC,
+		algo:    cfg.Algorithm,
+		command: cfg.SeedKeyCommand,
+		busy:    make(map[uint32]*sync.Mutex),
+		ecus:    make(map[uint32]*udsECUState),
+		tp:      make(map[uint32]*testerPresent),
+
+		tpInterval: testerPresentDefaultInterval,
+	}
+	var err error
+	if cfg.TxID != "" {
+		if c.def.tx, err = parseHexID(cfg.TxID); err != nil {
+			return nil, fmt.Errorf("uds tx_id: %w", err)
+		}
+	}
+	if cfg.RxID != "" {
+		if c.def.rx, err = parseHexID(cfg.RxID); err != nil {
+			return nil, fmt.Errorf("uds rx_id: %w", err)
+		}
+	}
+	c.def.extended = c.def.tx > 0x7FF || c.def.rx > 0x7FF
+	if cfg.TimeoutMs > 0 {
+		c.timeout = time.Duration(cfg.TimeoutMs) * time.Millisecond
+	}
+	if cfg.TesterPresentMs > 0 {
+		c.tpInterval = time.Duration(cfg.TesterPresentMs) * time.Millisecond
+	}
+	if cfg.Padding != nil {
+		if *cfg.Padding < -1 || *cfg.Padding > 0xFF {
+			return nil, fmt.Errorf("uds padding %d: want a byte or -1", *cfg.Padding)
+		}
+		c.padding = *cfg.Padding
+	}
+	if c.algo == "command" && c.command == "" {
+		return nil, errors.New("uds algorithm command needs seed_key_command")
+	}
+	if c.algo != "" && c.algo != "command" && lookupSeedKey(c.algo) == nil {
+		return nil, fmt.Errorf("uds algorithm %q is not registered", c.algo)
+	}
+	return c, nil
+}
+
+// NRCError is a negative response from an ECU.
+type NRCError struct {
+	SID, NRC byte
+}
+
+func (e *NRCError) Error() string {
+	return fmt.Sprintf("negative response to 0x%02X: %s", e.SID, e.name())
+}
+
+var nrcNames = map[byte]string{
+	0x10: "generalReject",
+	0x11: "serviceNotSupported",
+	0x12: "subFunctionNotSupported",
+	0x13: "incorrectMessageLengthOrInvalidFormat",
+	0x14: "responseTooLong",
+	0x21: "busyRepeatRequest",
+	0x22: "conditionsNotCorrect",
+	0x24: "requestSequenceError",
+	0x25: "noResponseFromSubnetComponent",
+	0x26: "failurePreventsExecutionOfRequestedAction",
+	0x31: "requestOutOfRange",
+	0x33: "securityAccessDenied",
+	0x35: "invalidKey",
+	0x36: "exceedNumberOfAttempts",
+	0x37: "requiredTimeDelayNotExpired",
+	0x70: "uploadDownloadNotAccepted",
+	0x71: "transferDataSuspended",
+	0x72: "generalProgrammingFailure",
+	0x73: "wrongBlockSequenceCounter",
+	0x78: "requestCorrectlyReceivedResponsePending",
+	0x7E: "subFunctionNotSupportedInActiveSession",
+	0x7F: "serviceNotSupportedInActiveSession",
+}
+
+// udsSubFunction lists the services whose first parameter byte is a
+// sub-function that may carry the suppress-positive-response bit.
+var udsSubFunction = map[byte]bool{0x10: true, 0x11: true, 0x27: true, 0x28: true, 0x31: true, 0x3E: true, 0x85: true}
+
+// Request sends req to t and returns the positive response. A request with
+// the suppress-positive-response bit set returns nil as soon as it is
+// sent. Negative responses are returned as *NRCError, except "response
+// pending", which extends the wait.
+func (c *UDSClient) Request(ctx context.Context, t udsTarget, req []byte, timeout time.Duration) ([]byte, error) {
+	if len(req) == 0 {
+		return nil, errors.New("empty request")
+	}
+	if timeout <= 0 {
+		timeout = c.timeout
+	}
+	c.mu.Lock()
+	busy, ok := c.busy[t.rx]
+	if !ok {
+		busy = new(sync.Mutex)
+		c.busy[t.rx] = busy
+	}
+	c.mu.Unlock()
+	busy.Lock()
+	defer busy.Unlock()
+
+	// Subscribe first so a fast reply is not missed.
+	events, _, cancel := c.app.Store.Subscribe(subInternal, 256)
+	defer cancel()
+	link := &isotpLink{app: c.app, t: t, padding: c.padding, events: events}
+	if err := link.send(ctx, req); err != nil {
+		return nil, err
+	}
+	sid := req[0]
+	if len(req) > 1 && udsSubFunction[sid] && req[1]&0x80 != 0 {
+		c.observe(t, req, nil, nil)
+		return nil, nil
+	}
+	for {
+		resp, err := link.recv(ctx, timeout)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(resp) >= 3 && resp[0] == udsNegativeResponse && resp[1] == sid:
+			if resp[2] == nrcResponsePending {
+				timeout = udsPendingTimeout
+				continue
+			}
+			nrc := &NRCError{SID: sid, NRC: resp[2]}
+			c.observe(t, req, nil, nrc)
+			return nil, nrc
+		case resp[0] == sid+0x40:
+			c.observe(t, req, resp, nil)
+			return resp, nil
+		}
+		// a late answer to an earlier request; keep waiting for ours
+	}
+}
+
+// observe updates the known state of t after a request.
+func (c *UDSClient) observe(t udsTarget, req, resp []byte, nrc *NRCError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.ecus[t.tx]
+	if !ok {
+		st = &udsECUState{session: 1}
+		c.ecus[t.tx] = st
+	}
+	st.rx = t.rx
+	st.last = time.Now()
+	if nrc != nil {
+		st.lastNRC = nrc.NRC
+		return
+	}
+	st.lastNRC = 0
+	if len(req) < 2 {
+		return
+	}
+	sub := req[1] &^ 0x80
+	switch req[0] {
+	case 0x10: // DiagnosticSessionControl: a new session relocks the ECU
+		st.session, st.security = sub, 0
+	case 0x11: // ECUReset
+		st.session, st.security = 1, 0
+	case 0x27: // SecurityAccess sendKey
+		if sub%2 == 0 && sub > 0 {
+			st.security, st.unlocked = sub-1, st.last
+		}
+	}
+}
+
+// target returns the default ECU with the IDs given in hex overriding it.
+func (c *UDSClient) target(tx, rx string) (udsTarget, error) {
+	t := c.def
+	var err error
+	if tx != "" {
+		if t.tx, err = parseHexID(tx); err != nil {
+			return t, fmt.Errorf("bad tx_id %q: %w", tx, err)
+		}
+		if rx == "" {
+			t.rx = t.tx + 8 // the usual 0x7E0/0x7E8 pairing
+		}
+	}
+	if rx != "" {
+		if t.rx, err = parseHexID(rx); err != nil {
+			return t, fmt.Errorf("bad rx_id %q: %w", rx, err)
+		}
+	}
+	t.extended = t.tx > 0x7FF || t.rx > 0x7FF
+	return t, nil
+}
+
+// UDSECUStatus is what the client has done to one ECU.
+type UDSECUStatus struct {
+	TxID          string     `json:"tx_id"`
+	RxID          string     `json:"rx_id"`
+	Session       int        `json:"session"`        // 1 default, 2 programming, 3 extended
+	SecurityLevel int        `json:"security_level"` // unlocked level, 0 when locked
+	UnlockedAt    *time.Time `json:"unlocked_at,omitempty"`
+	LastRequest   time.Time  `json:"last_request"`
+	LastNRC       string     `json:"last_nrc,omitempty"`
+}
+
+// UDSStatus is served by /api/uds.
+type UDSStatus struct {
+	TxID       string         `json:"tx_id"` // default addressing
+	RxID       string         `json:"rx_id"`
+	Algorithm  string         `json:"algorithm,omitempty"` // default seed-key algorithm
+	Algorithms []string       `json:"algorithms"`          // registered, plus "command" when configured
+	ECUs       []UDSECUStatus `json:"ecus"`
+
+	TesterPresent []TesterPresentStatus `json:"tester_present"`
+}
+
+func (c *UDSClient) Status() UDSStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := UDSStatus{
+		TxID:       fmt.Sprintf("0x%03X", c.def.tx),
+		RxID:       fmt.Sprintf("0x%03X", c.def.rx),
+		Algorithm:  c.algo,
+		Algorithms: seedKeyNames(),
+		ECUs:       make([]UDSECUStatus, 0, len(c.ecus)),
+	}
+	if c.command != "" {
+		s.Algorithms = append(s.Algorithms, "command")
+	}
+	for tx, st := range c.ecus {
+		e := UDSECUStatus{
+			TxID:          fmt.Sprintf("0x%03X", tx),
+			RxID:          fmt.Sprintf("0x%03X", st.rx),
+			Session:       int(st.session),
+			SecurityLevel: int(st.security),
+			LastRequest:   st.last,
+		}
+		if st.security != 0 {
+			t := st.unlocked
+			e.UnlockedAt = &t
+		}
+		if st.lastNRC != 0 {
+			e.LastNRC = (&NRCError{NRC: st.lastNRC}).name()
+		}
+		s.ECUs = append(s.ECUs, e)
+	}
+	sort.Slice(s.ECUs, func(i, j int) bool { return s.ECUs[i].TxID < s.ECUs[j].TxID })
+	s.TesterPresent = c.testerPresentStatus()
+	return s
+}
+
+// name is the NRC in hex with its ISO 14229 name when known.
+func (e *NRCError) name() string {
+	if n := nrcNames[e.NRC]; n != "" {
+		return fmt.Sprintf("0x%02X %s", e.NRC, n)
+	}
+	return fmt.Sprintf("0x%02X", e.NRC)
+}
+
+// isotpLink carries one request and its response over ISO-TP.
+type isotpLink struct {
+	app     *App
+	t       udsTarget
+	padding int
+	events  <-chan StoreEvent
+}
+
+func (l *isotpLink) write(ctx context.Context, b []byte) error {
+	f := can.Frame{ID: l.t.tx, IsExtended: l.t.extended}
+	n := copy(f.Data[:], b)
+	if l.padding >= 0 {
+		for ; n < 8; n++ {
+			f.Data[n] = byte(l.padding)
+		}
+	}
+	f.Length = uint8(n)
+	return l.app.SendFrame(ctx, f)
+}
+
+// read returns the payload of the next frame from the ECU.
+func (l *isotpLink) read(ctx context.Context, timeout time.Duration) ([]byte, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case ev := <-l.events:
+			r := ev.Raw
+			if r == nil || r.RTR || r.Error != "" || r.Dir != "rx" || r.canID != l.t.rx || len(r.data) == 0 {
+				continue
+			}
+			return r.data, nil
+		case <-timer.C:
+			return nil, fmt.Errorf("no response from %s within %s", l.t, timeout)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (l *isotpLink) send(ctx context.Context, msg []byte) error {
+	if len(msg) > isotpMaxLen {
+		return fmt.Errorf("request is %d bytes, max %d", len(msg), isotpMaxLen)
+	}
+	if len(msg) <= 7 {
+		return l.write(ctx, append([]byte{byte(len(msg))}, msg...))
+	}
+	if err := l.write(ctx, append([]byte{0x10 | byte(len(msg)>>8), byte(len(msg))}, msg[:6]...)); err != nil {
+		return err
+	}
+	rest, sn := msg[6:], byte(1)
+	for len(rest) > 0 {
+		bs, stmin, err := l.flowControl(ctx)
+		if err != nil {
+			return err
+		}
+		for i := 0; len(rest) > 0 && (bs == 0 || i < bs); i++ {
+			if i > 0 {
+				time.Sleep(stmin)
+			}
+			n := min(7, len(rest))
+			if err := l.write(ctx, append([]byte{0x20 | sn&0x0F}, rest[:n]...)); err != nil {
+				return err
+			}
+			rest, sn = rest[n:], sn+1
+		}
+	}
+	return nil
+}
+
+// flowControl waits for the ECU's clear-to-send and returns its block size
+// and separation time.
+func (l *isotpLink) flowControl(ctx context.Context) (bs int, stmin time.Duration, err error) {
+	for wait := 0; ; {
+		b, err := l.read(ctx, isotpFrameTimeout)
+		if err != nil {
+			return 0, 0, fmt.Errorf("flow control: %w", err)
+		}
+		if b[0]>>4 != 3 || len(b) < 3 {
+			continue
+		}
+		switch b[0] & 0x0F {
+		case 0:
+			return int(b[1]), isotpSTmin(b[2]), nil
+		case 1:
+			if wait++; wait > isotpMaxWait {
+				return 0, 0, errors.New("flow control: too many wait frames")
+			}
+		default:
+			return 0, 0, errors.New("flow control: receiver overflow")
+		}
+	}
+}
+
+func isotpSTmin(b byte) time.Duration {
+	switch {
+	case b <= 0x7F:
+		return time.Duration(b) * time.Millisecond
+	case b >= 0xF1 && b <= 0xF9:
+		return time.Duration(b-0xF0) * 100 * time.Microsecond
+	}
+	return 127 * time.Millisecond
+}
+
+// recv reads one message, sending a flow control frame that lets the ECU
+// send the rest of a long message without pause.
+func (l *isotpLink) recv(ctx context.Context, timeout time.Duration) ([]byte, error) {
+	for {
+		b, err := l.read(ctx, timeout)
+		if err != nil {
+			return nil, err
+		}
+		switch b[0] >> 4 {
+		case 0:
+			n := int(b[0] & 0x0F)
+			if n == 0 || n > len(b)-1 {
+				continue
+			}
+			return b[1 : 1+n], nil
+		case 1:
+			if len(b) < 8 {
+				continue
+			}
+			n := int(b[0]&0x0F)<<8 | int(b[1])
+			switch {
+			case n == 0:
+				// ISO 15765-2:2016 escape: a 32-bit length follows, for
+				// messages over 4095 bytes that UDS on classic CAN does not use
+				return nil, errors.New("first frame with a 32-bit length is not supported")
+			case n <= 7:
+				// anything this short must come as a single frame
+				return nil, fmt.Errorf("first frame with length %d, want over 7", n)
+			}
+			msg := append(make([]byte, 0, n), b[2:]...)
+			if err := l.write(ctx, []byte{0x30, 0, 0}); err != nil {
+				return nil, err
+			}
+			for sn := byte(1); len(msg) < n; sn++ {
+				b, err := l.read(ctx, isotpFrameTimeout)
+				if err != nil {
+					return nil, fmt.Errorf("consecutive frame: %w", err)
+				}
+				if b[0]>>4 != 2 {
+					continue
+				}
+				if b[0]&0x0F != sn&0x0F {
+					return nil, fmt.Errorf("consecutive frame %d out of sequence, want %d", b[0]&0x0F, sn&0x0F)
+				}
+				msg = append(msg, b[1:min(len(b), 1+n-len(msg))]...)
+			}
+			return msg, nil
+		}
+	}
+}
+
+// udsRequestParams is the JSON form of a raw UDS request.
+type udsRequestParams struct {
+	TxID      string `json:"tx_id"`
+	RxID      string `json:"rx_id"`
+	Data      string `json:"data"` // hex, service ID first
+	TimeoutMs int    `json:"timeout_ms"`
+}
+
+type UDSResult struct {
+	ECU      string `json:"ecu"`
+	Request  string `json:"request"`
+	Response string `json:"response,omitempty"` // hex; empty when suppressed
+}
+
+func registerUDSActions(app *App) {
+	app.Control.Register("uds.request", func(params json.RawMessage) (any, error) {
+		var p udsRequestParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		t, err := app.UDS.target(p.TxID, p.RxID)
+		if err != nil {
+			return nil, err
+		}
+		req, err := hex.DecodeString(strings.Join(strings.Fields(p.Data), ""))
+		if err != nil {
+			return nil, fmt.Errorf("bad data %q: %w", p.Data, err)
+		}
+		resp, err := app.UDS.Request(context.Background(), t, req, time.Duration(p.TimeoutMs)*time.Millisecond)
+		if err != nil {
+			return nil, err
+		}
+		return UDSResult{ECU: t.String(), Request: hex.EncodeToString(req), Response: hex.EncodeToString(resp)}, nil
+	})
+
+	app.Control.Register("uds.security_access", func(params json.RawMessage) (any, error) {
+		var p securityAccessParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		t, err := app.UDS.target(p.TxID, p.RxID)
+		if err != nil {
+			return nil, err
+		}
+		return app.UDS.SecurityAccess(context.Background(), t, p.Level, p.Algorithm)
+	})
+}
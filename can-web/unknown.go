@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UnknownFrame summarises one CAN ID that has no definition in the active
+// map. ChangeMask has a bit set for every payload bit that has differed
+// between two consecutive frames.
+type UnknownFrame struct {
+	ID         string    `json:"id"`
+	Extended   bool      `json:"extended"`
+	Count      uint64    `json:"count"`
+	DLCs       []int     `json:"dlcs"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	LastData   string    `json:"last_data_hex"`
+	Changes    uint64    `json:"changes"`
+	ChangeMask string    `json:"change_mask"`
+}
+
+type unknownEntry struct {
+	count      uint64
+	dlcs       map[int]bool
+	first      time.Time
+	last       time.Time
+	data       [8]byte
+	dlc        int
+	changes    uint64
+	changeMask [8]byte
+}
+
+// UnknownInventory tracks frame IDs seen on the bus without a FrameDef, for
+// reverse engineering unmapped traffic.
+type UnknownInventory struct {
+	mu      sync.Mutex
+	entries map[frameKey]*unknownEntry
+}
+
+func NewUnknownInventory() *UnknownInventory {
+	return &UnknownInventory{entries: make(map[frameKey]*unknownEntry)}
+}
+
+func (u *UnknownInventory) Observe(id uint32, extended bool, data []byte, ts time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	k := frameKey{id, extended}
+	e, ok := u.entries[k]
+	if !ok {
+		e = &unknownEntry{dlcs: make(map[int]bool), first: ts}
+		u.entries[k] = e
+	} else {
+		changed := len(data) != e.dlc
+		for i := range data {
+			if x := data[i] ^ e.data[i]; x != 0 && i < e.dlc {
+				e.changeMask[i] |= x
+				changed = true
+			}
+		}
+		if changed {
+			e.changes++
+		}
+	}
+	e.count++
+	e.last = ts
+	e.dlcs[len(data)] = true
+	e.dlc = copy(e.data[:], data)
+}
+
+// Snapshot lists the unknown IDs ordered by ID, leaving out IDs that are
+// defined in defs (the map may have changed since they were first seen).
+func (u *UnknownInventory) Snapshot(defs map[uint32]FrameDef) []UnknownFrame {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	match := newFrameMatcher(defs)
+	keys := make([]frameKey, 0, len(u.entries))
+	for k := range u.entries {
+		if _, mapped := match.Lookup(k.id); !mapped {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+
+	out := make([]UnknownFrame, 0, len(keys))
+	for _, k := range keys {
+		e := u.entries[k]
+		dlcs := make([]int, 0, len(e.dlcs))
+		for d := range e.dlcs {
+			dlcs = append(dlcs, d)
+		}
+		sort.Ints(dlcs)
+		out = append(out, UnknownFrame{
+			ID:         k.String(),
+			Extended:   k.extended,
+			Count:      e.count,
+			DLCs:       dlcs,
+			FirstSeen:  e.first,
+			LastSeen:   e.last,
+			LastData:   strings.ToUpper(hex.EncodeToString(e.data[:e.dlc])),
+			Changes:    e.changes,
+			ChangeMask: strings.ToUpper(hex.EncodeToString(e.changeMask[:dlcs[len(dlcs)-1]])),
+		})
+	}
+	return out
+}
+
+func (u *UnknownInventory) Reset() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.entries = make(map[frameKey]*unknownEntry)
+}
@@ -8,11 +8,35 @@ function fmtTime(ts) {
   return d.toLocaleTimeString();
 }
 
+async function loadDashboards() {
+  const res = await fetch("/api/dashboards");
+  if (!res.ok) return;
+  const sel = el("dashboard");
+  const current = sel.value;
+  sel.innerHTML = '<option value="">All signals</option>';
+  for (const d of await res.json()) {
+    const opt = document.createElement("option");
+    opt.value = d.name;
+    opt.textContent = d.name;
+    opt.title = d.description || "";
+    sel.appendChild(opt);
+  }
+  sel.value = current;
+}
+
 async function fetchState() {
-  const res = await fetch("/api/state");
+  const dashboard = el("dashboard").value;
+  const res = await fetch(dashboard ? `/api/state?dashboard=${encodeURIComponent(dashboard)}` : "/api/state");
   if (!res.ok) return;
   const data = await res.json();
 
+  // Connection problems take precedence over the controller state.
+  const state = data.conn.state === "connected" ? data.bus_state : data.conn.state;
+  const bs = el("busState");
+  bs.textContent = state;
+  bs.title = data.conn.last_error || "";
+  bs.className = `pill ${state}`;
+
   // Signals
   const stBody = el("signalsTable").querySelector("tbody");
   stBody.innerHTML = "";
@@ -35,12 +59,14 @@ async function fetchState() {
   rtBody.innerHTML = "";
   for (const f of data.raw.slice().reverse()) {
     const tr = document.createElement("tr");
+    if (f.error) tr.classList.add("err");
+    if (f.rtr) tr.classList.add("rtr");
     tr.innerHTML = `
       <td class="mono">${fmtTime(f.ts)}</td>
       <td class="mono">${f.id}</td>
       <td class="mono">${f.dlc}</td>
-      <td class="mono">${f.data_hex}</td>
-      <td class="mono">${f.data_ascii}</td>
+      <td class="mono">${f.rtr ? '<span class="pill rtr">RTR</span>' : f.data_hex}</td>
+      <td class="mono">${f.error || f.data_ascii}</td>
     `;
     rtBody.appendChild(tr);
   }
@@ -57,6 +83,10 @@ window.addEventListener("load", () => {
     startPolling();
   });
 
+  el("dashboard").addEventListener("focus", loadDashboards);
+  el("dashboard").addEventListener("change", fetchState);
+
+  loadDashboards();
   startPolling();
   fetchState();
 });
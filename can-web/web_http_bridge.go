@@ -1,38 +1,917 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"net/url"
+	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
-func StartWebServer(ctx context.Context, addr string, iface string, store *Store) error {
+// BusInfo describes a bus read by this server. The name selects the bus
+// with ?bus= on the per-bus views.
+type BusInfo struct {
+	Name         string     `json:"name"`
+	Source       string     `json:"source"`
+	Profile      string     `json:"profile"`
+	Bitrate      int        `json:"bitrate"`
+	FramesPerSec float64    `json:"frames_per_sec"`
+	BusLoadPct   float64    `json:"bus_load_pct"`
+	Conn         ConnStatus `json:"conn"`
+	BusState     string     `json:"bus_state"`
+}
+
+type StateResponse struct {
+	Seq      uint64        `json:"seq"`
+	TS       time.Time     `json:"ts"`
+	Iface    string        `json:"iface"`
+	Profile  string        `json:"profile"`
+	Conn     ConnStatus    `json:"conn"`
+	BusState string        `json:"bus_state"`
+	Signals  []SignalValue `json:"signals"`
+	Raw      []RawFrame    `json:"raw"`
+}
+
+// StateDelta is the change in /api/state since seq Since. With Reset set
+// the client must replace its signal list rather than merge into it.
+type StateDelta struct {
+	Seq      uint64        `json:"seq"`
+	Since    uint64        `json:"since"`
+	Reset    bool          `json:"reset"`
+	TS       time.Time     `json:"ts"`
+	Profile  string        `json:"profile"`
+	Conn     ConnStatus    `json:"conn"`
+	BusState string        `json:"bus_state"`
+	Signals  []SignalValue `json:"signals"`
+	Raw      []RawFrame    `json:"raw"`
+}
+
+// storeEpoch tells ETags of different server runs apart, since the store
+// sequence restarts at zero.
+var storeEpoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// notModified reports whether the client already has the state at seq,
+// going by If-None-Match or ?since_seq=.
+func notModified(r *http.Request, etag string, seq uint64) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, t := range strings.Split(inm, ",") {
+			if t = strings.TrimSpace(t); t == etag || t == "*" {
+				return true
+			}
+		}
+	}
+	if v := r.URL.Query().Get("since_seq"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		return err == nil && n == seq
+	}
+	return false
+}
+
+type ProfilesResponse struct {
+	Active   string   `json:"active"`
+	Profiles []string `json:"profiles"`
+}
+
+type WhoAmIResponse struct {
+	Name        string `json:"name"`
+	Role        string `json:"role"`
+	AuthEnabled bool   `json:"auth_enabled"`
+}
+
+// serveMF4 converts frames to MDF4 in a temporary file and sends it.
+func serveMF4(w http.ResponseWriter, r *http.Request, name string, frames frameSeq, defs map[uint32]FrameDef) {
+	f, err := os.CreateTemp("", "can-web-*.mf4")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if err := WriteMF4(f, frames, defs); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "mdf4 export: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+	http.ServeContent(w, r, name, time.Time{}, f)
+}
+
+func StartWebServer(ctx context.Context, hc HTTPConfig, app *App) error {
+	tlsConfig, err := serverTLSConfig(hc)
+	if err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+
 	mux := http.NewServeMux()
 
+	// Every route declares the role it needs and documents itself in the
+	// OpenAPI document served at /api/openapi.json.
+	spec := newAPISpec("can-web", "1")
+	view := func(pattern string, doc apiDoc, h http.HandlerFunc) {
+		spec.add(pattern, RoleViewer, doc)
+		mux.Handle(pattern, instrumentHTTP(pattern, app.Auth.Require(RoleViewer, h)))
+	}
+	// busView serves a view of one bus's data: the bus named by ?bus=, or
+	// the first bus without it.
+	busView := func(pattern string, doc apiDoc, h func(app *App, w http.ResponseWriter, r *http.Request)) {
+		doc.Params = append(doc.Params, apiParam{"bus", "interface name as in /api/buses; default the first bus"})
+		view(pattern, doc, func(w http.ResponseWriter, r *http.Request) {
+			b, ok := app.Bus(r.URL.Query().Get("bus"))
+			if !ok {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("unknown bus %q (buses: %s)", r.URL.Query().Get("bus"), strings.Join(app.BusNames(), ", ")))
+				return
+			}
+			h(b, w, r)
+		})
+	}
+	operate := func(pattern string, doc apiDoc, h http.Handler) {
+		spec.add(pattern, RoleOperator, doc)
+		mux.Handle(pattern, instrumentHTTP(pattern, app.Auth.Require(RoleOperator, h)))
+	}
+
 	// Static UI
 	webDir := filepath.Join(".", "web")
-	mux.Handle("/", http.FileServer(http.Dir(webDir)))
+	mux.Handle("/", app.Auth.Require(RoleViewer, http.FileServer(http.Dir(webDir))))
+
+	// onDashboard narrows signals to the dashboard named by ?dashboard=, if
+	// any. It answers 404 and returns false when there is no such dashboard.
+	onDashboard := func(w http.ResponseWriter, r *http.Request, signals []SignalValue) ([]SignalValue, bool) {
+		name := r.URL.Query().Get("dashboard")
+		if name == "" {
+			return signals, true
+		}
+		db, err := app.Dashboards.Get(name)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return nil, false
+		}
+		out := []SignalValue{}
+		for _, v := range signals {
+			if db.Match(v) {
+				out = append(out, v)
+			}
+		}
+		return out, true
+	}
 
 	// API endpoint
-	mux.HandleFunc("/api/state", func(w http.ResponseWriter, r *http.Request) {
-		signals, raw := store.Snapshot()
-		resp := map[string]any{
-			"ts":      time.Now().UTC(),
-			"iface":   iface,
-			"signals": signals,
-			"raw":     raw,
+	busView("/api/state", apiDoc{Summary: "Current signals, recent raw frames and connection state", Response: StateResponse{}, Params: []apiParam{
+		{"since_seq", "reply 304 Not Modified if seq is unchanged"},
+		{"node", "only the signals and raw frames of this sending ECU"},
+		{"dashboard", "only the signals of this dashboard"},
+	}}, func(app *App, w http.ResponseWriter, r *http.Request) {
+		snap := app.Store.Versioned()
+		etag := fmt.Sprintf(`W/"%s-%d"`, storeEpoch, snap.Seq)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if notModified(r, etag, snap.Seq) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		resp := StateResponse{
+			Seq:      snap.Seq,
+			TS:       time.Now().UTC(),
+			Iface:    app.Iface,
+			Profile:  app.Profiles.Active(),
+			Conn:     app.Conn.Status(),
+			BusState: app.Errors.State(),
+			Signals:  snap.Signals,
+			Raw:      snap.Raw,
+		}
+		if node := r.URL.Query().Get("node"); node != "" {
+			resp.Signals, resp.Raw = []SignalValue{}, []RawFrame{}
+			for _, v := range snap.Signals {
+				if v.Node == node {
+					resp.Signals = append(resp.Signals, v)
+				}
+			}
+			for _, f := range snap.Raw {
+				if f.Node == node {
+					resp.Raw = append(resp.Raw, f)
+				}
+			}
+		}
+		var ok bool
+		if resp.Signals, ok = onDashboard(w, r, resp.Signals); !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	busView("/api/state/delta", apiDoc{Summary: "Signals and raw frames changed since a seq from /api/state or an earlier delta", Response: StateDelta{}, Params: []apiParam{
+		{"since", "seq the client is at"},
+	}}, func(app *App, w http.ResponseWriter, r *http.Request) {
+		var since uint64
+		if v := r.URL.Query().Get("since"); v != "" {
+			var err error
+			if since, err = strconv.ParseUint(v, 10, 64); err != nil {
+				writeError(w, http.StatusBadRequest, "since: want a seq number")
+				return
+			}
+		}
+		seq, signals, raw, reset := app.Store.Delta(since)
+		resp := StateDelta{
+			Seq:      seq,
+			Since:    since,
+			Reset:    reset,
+			TS:       time.Now().UTC(),
+			Profile:  app.Profiles.Active(),
+			Conn:     app.Conn.Status(),
+			BusState: app.Errors.State(),
+			Signals:  signals,
+			Raw:      raw,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	busView("/api/raw", apiDoc{Summary: "Query the raw frame buffer, newest first", Response: RawPage{}, Params: []apiParam{
+		{"id", "IDs and ranges, e.g. 0x123,0x200-0x2FF,ERR"},
+		{"mask", "id:mask filter, e.g. 0x120:0x7F0"},
+		{"dir", "rx or tx"},
+		{"since", "RFC 3339 or unix seconds"},
+		{"until", "RFC 3339 or unix seconds"},
+		{"last", "duration, shorthand for since=now-last"},
+		{"data", "payload prefix; ?? matches any byte"},
+		{"offset", "pagination offset"},
+		{"limit", "page size"},
+	}}, func(app *App, w http.ResponseWriter, r *http.Request) {
+		q, err := parseRawQuery(r.URL.Query(), time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Store.QueryRaw(q))
+	})
+
+	view("/api/raw/buffers", apiDoc{Summary: "Per-ID raw buffer fill and policy", Response: []RawBufferStat{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Store.RawBuffers())
+	})
+
+	view("/api/store", apiDoc{Summary: "The store backend, its last flush and the buses it holds state for", Response: StoreStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.StoreSync.Status())
+	})
+
+	view("/api/store/{bus}", apiDoc{Summary: "Signals and raw frames the store backend holds for a bus, possibly another server's", Response: StoreState{}}, func(w http.ResponseWriter, r *http.Request) {
+		st, err := app.StoreSync.State(r.PathValue("bus"))
+		switch {
+		case err != nil:
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		case st.SavedAt.IsZero():
+			writeError(w, http.StatusNotFound, fmt.Sprintf("no state for bus %q", r.PathValue("bus")))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(st)
+	})
+
+	exportSignals := func(ext, contentType string, write func(io.Writer, []SignalValue) error) func(*App, http.ResponseWriter, *http.Request) {
+		return func(app *App, w http.ResponseWriter, r *http.Request) {
+			signals, _ := app.Store.Snapshot()
+			if node := r.URL.Query().Get("node"); node != "" {
+				var own []SignalValue
+				for _, v := range signals {
+					if v.Node == node {
+						own = append(own, v)
+					}
+				}
+				signals = own
+			}
+			signals, ok := onDashboard(w, r, signals)
+			if !ok {
+				return
+			}
+			var buf bytes.Buffer
+			if err := write(&buf, signals); err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportName("signals", app.Iface, time.Now(), ext)))
+			_, _ = buf.WriteTo(w)
+		}
+	}
+	signalParams := []apiParam{{"node", "only the signals of this sending ECU"}, {"dashboard", "only the signals of this dashboard"}}
+	busView("/api/export/signals.csv", apiDoc{Summary: "Download the decoded signal table as CSV", Produces: "text/csv", Params: signalParams},
+		exportSignals("csv", "text/csv; charset=utf-8", WriteSignalsCSV))
+	busView("/api/export/signals.xlsx", apiDoc{Summary: "Download the decoded signal table as an Excel workbook", Produces: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Params: signalParams},
+		exportSignals("xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", WriteSignalsXLSX))
+
+	busView("/api/export/raw.log", apiDoc{Summary: "Download the raw frame buffer as a candump log, oldest first", Produces: "text/plain", Params: []apiParam{
+		{"id", "IDs and ranges, e.g. 0x123,0x200-0x2FF,ERR"},
+		{"mask", "id:mask filter, e.g. 0x120:0x7F0"},
+		{"dir", "rx or tx"},
+		{"since", "RFC 3339 or unix seconds"},
+		{"until", "RFC 3339 or unix seconds"},
+		{"last", "duration, shorthand for since=now-last"},
+		{"data", "payload prefix; ?? matches any byte"},
+	}}, func(app *App, w http.ResponseWriter, r *http.Request) {
+		q, err := parseRawQuery(r.URL.Query(), time.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		q.Offset, q.Limit = 0, math.MaxInt
+		frames := app.Store.QueryRaw(q).Frames
+		slices.Reverse(frames)
+		var buf bytes.Buffer
+		if err := WriteRawCandump(&buf, app.Iface, frames); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportName("raw", app.Iface, time.Now(), "log")))
+		_, _ = buf.WriteTo(w)
+	})
+
+	busView("/api/frames", apiDoc{Summary: "Latest payload, count and rate of every frame ID seen", Response: []FrameInfo{}, Params: []apiParam{
+		{"id", "IDs and ranges, e.g. 0x123,0x200-0x2FF"},
+	}}, func(app *App, w http.ResponseWriter, r *http.Request) {
+		var ids []idRange
+		if s := r.URL.Query().Get("id"); s != "" {
+			var err error
+			if ids, _, err = parseIDList(s); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Frames.Snapshot(app.Profiles.Defs(), ids))
+	})
+
+	view("/api/nodes", apiDoc{Summary: "Liveness of every sending ECU named in the map", Response: []NodeStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Frames.Nodes(app.Profiles.Defs(), time.Now()))
+	})
+
+	view("/api/tx-catalog", apiDoc{Summary: "Frames and signals the map marks tx, with encodable ranges and defaults", Response: []TxFrame{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(TxCatalog(app.Profiles.Defs()))
+	})
+
+	view("/api/e2e", apiDoc{Summary: "Alive counter and CRC check state of protected frames", Response: []E2EStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.E2E.Snapshot(app.Profiles.Defs()))
+	})
+
+	view("/api/decoders", apiDoc{Summary: "Registered decode hooks with call and error counts", Response: []DecodeHookStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(DecodeHookStatuses())
+	})
+
+	busView("/api/signal-stats", apiDoc{Summary: "Min, max, mean and update rate per signal since start or the last reset", Response: SignalStatsResponse{}, Params: []apiParam{
+		{"signal", "comma-separated FRAME.signal names, default all"},
+	}}, func(app *App, w http.ResponseWriter, r *http.Request) {
+		var names []string
+		if s := r.URL.Query().Get("signal"); s != "" {
+			names = strings.Split(s, ",")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.SignalStats.Snapshot(names))
+	})
+
+	view("/api/unknown", apiDoc{Summary: "Frame IDs seen on the bus but missing from the map", Response: []UnknownFrame{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Unknown.Snapshot(app.Profiles.Defs()))
+	})
+
+	view("/api/clock", apiDoc{Summary: "Server clock: monotonic time, wall clock steps, kernel NTP state and the last reported sync status", Response: ClockStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Clock.Status())
+	})
+
+	view("/api/decode-errors", apiDoc{Summary: "Mapped signals that could not be decoded from the frames received, with the reason", Response: []DecodeError{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.DecodeErrors.Snapshot())
+	})
+
+	view("/api/dlc-mismatches", apiDoc{Summary: "Frame IDs received with a DLC other than the map's, with the DLCs seen", Response: DLCReport{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.DLC.Snapshot())
+	})
+
+	view("/api/heatmap", apiDoc{Summary: "Byte and bit change counts for one ID", Response: HeatMap{}, Params: []apiParam{{"id", "frame ID, e.g. 0x123"}}}, func(w http.ResponseWriter, r *http.Request) {
+		id, extended, err := parseCANID(r.URL.Query().Get("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "id query parameter required, e.g. ?id=0x123")
+			return
+		}
+		k := frameKey{id, extended}
+		hm, ok := app.Heat.HeatMap(k)
+		if !ok {
+			writeError(w, http.StatusNotFound, k.String()+" not seen in the current window")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(hm)
+	})
+
+	view("/api/alerts", apiDoc{Summary: "Alert rule states and recent transitions", Response: AlertsSnapshot{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Alerts.Snapshot())
+	})
+
+	view("/api/deadband", apiDoc{Summary: "Deadband rules with published and suppressed update counts", Response: []DeadbandStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Deadband.Status())
+	})
+
+	busView("/api/history", apiDoc{Summary: "Stored samples per signal, or store status without ?signal", Response: map[string][]HistorySample{}, Params: []apiParam{
+		{"signal", "comma-separated FRAME.signal names"},
+		{"since", "RFC 3339 or unix seconds"},
+		{"until", "RFC 3339 or unix seconds"},
+		{"last", "duration, shorthand for since=now-last"},
+		{"session", "session ID, shorthand for its start and end"},
+		{"step", "downsampling bucket, e.g. 1s"},
+		{"limit", "max samples per signal"},
+	}}, func(app *App, w http.ResponseWriter, r *http.Request) {
+		if app.History == nil {
+			writeError(w, http.StatusNotFound, "history is disabled (set history.path or HISTORY_DB)")
+			return
+		}
+		q := r.URL.Query()
+		if q.Get("signal") == "" {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(app.History.Status())
+			return
+		}
+		since, until, err := historyWindow(app, q)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var step time.Duration
+		if s := q.Get("step"); s != "" {
+			if step, err = time.ParseDuration(s); err != nil {
+				writeError(w, http.StatusBadRequest, "step: "+err.Error())
+				return
+			}
+		}
+		limit, _ := strconv.Atoi(q.Get("limit"))
+
+		resp := make(map[string][]HistorySample)
+		for _, sig := range strings.Split(q.Get("signal"), ",") {
+			samples, err := app.History.Query(app.Iface, sig, since, until, step, limit)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			resp[sig] = samples
 		}
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(resp)
 	})
 
+	busView("/api/history/histogram", apiDoc{Summary: "Distribution of one signal's stored samples over a time window", Response: Histogram{}, Params: []apiParam{
+		{"signal", "FRAME.signal name"},
+		{"since", "RFC 3339 or unix seconds"},
+		{"until", "RFC 3339 or unix seconds"},
+		{"last", "duration, shorthand for since=now-last"},
+		{"session", "session ID, shorthand for its start and end"},
+		{"buckets", "bucket count, default 20, max 1000"},
+		{"min", "lower bound of the first bucket, default the smallest sample"},
+		{"max", "upper bound of the last bucket, default the largest sample"},
+	}}, func(app *App, w http.ResponseWriter, r *http.Request) {
+		if app.History == nil {
+			writeError(w, http.StatusNotFound, "history is disabled (set history.path or HISTORY_DB)")
+			return
+		}
+		q := r.URL.Query()
+		if q.Get("signal") == "" {
+			writeError(w, http.StatusBadRequest, "signal is required")
+			return
+		}
+		since, until, err := historyWindow(app, q)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		buckets := 20
+		if s := q.Get("buckets"); s != "" {
+			if buckets, err = strconv.Atoi(s); err != nil || buckets < 1 || buckets > historyMaxBuckets {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("buckets %q: want 1 to %d", s, historyMaxBuckets))
+				return
+			}
+		}
+		var bounds [2]*float64
+		for i, name := range []string{"min", "max"} {
+			if s := q.Get(name); s != "" {
+				v, err := strconv.ParseFloat(s, 64)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, fmt.Sprintf("%s %q: want a number", name, s))
+					return
+				}
+				bounds[i] = &v
+			}
+		}
+		hg, err := app.History.Histogram(app.Iface, q.Get("signal"), since, until, buckets, bounds[0], bounds[1])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(hg)
+	})
+
+	view("/api/buses", apiDoc{Summary: "Every bus this server reads, with its source, map and state", Response: []BusInfo{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		buses := make([]BusInfo, 0, len(app.Buses))
+		for _, b := range app.Buses {
+			stats := b.Stats.Snapshot()
+			buses = append(buses, BusInfo{
+				Name:         b.Iface,
+				Source:       b.Source,
+				Profile:      b.Profiles.Active(),
+				Bitrate:      stats.Bitrate,
+				FramesPerSec: stats.FramesPerSec,
+				BusLoadPct:   stats.BusLoadPct,
+				Conn:         b.Conn.Status(),
+				BusState:     b.Errors.State(),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(buses)
+	})
+
+	view("/api/interfaces", apiDoc{Summary: "CAN interfaces of this host with state, bitrate and error counters", Response: []InterfaceStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		ifaces, err := ListInterfaces(app.Iface)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ifaces)
+	})
+
+	view("/api/gateway", apiDoc{Summary: "Gateway forwarding counters per direction", Response: GatewayStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		if app.Gateway == nil {
+			writeError(w, http.StatusNotFound, "gateway is disabled (set gateway.peer or CAN_GATEWAY_PEER)")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Gateway.Status())
+	})
+
+	view("/api/sinks", apiDoc{Summary: "Event sink counters", Response: []SinkStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Sinks.Status())
+	})
+
+	view("/api/triggers", apiDoc{Summary: "Armed triggers", Response: []TriggerStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Triggers.Status())
+	})
+
+	view("/api/captures", apiDoc{Summary: "Trigger capture windows", Response: []Capture{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Triggers.Captures())
+	})
+
+	view("/api/captures/{id}", apiDoc{Summary: "Download a capture in candump format, or as MDF4 with an .mf4 suffix", Produces: "text/plain"}, func(w http.ResponseWriter, r *http.Request) {
+		name, mf4 := strings.CutSuffix(r.PathValue("id"), ".mf4")
+		id, err := strconv.Atoi(strings.TrimSuffix(name, ".log"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "bad capture id")
+			return
+		}
+		if mf4 {
+			_, frames, err := app.Triggers.Capture(id)
+			if err != nil {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			serveMF4(w, r, fmt.Sprintf("capture-%d.mf4", id), sliceFrames(frames), app.Profiles.Defs())
+			return
+		}
+		var buf bytes.Buffer
+		if err := app.Triggers.WriteCapture(&buf, id); err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="capture-%d.log"`, id))
+		_, _ = buf.WriteTo(w)
+	})
+
+	busView("/api/events", apiDoc{Summary: "Server-Sent Events stream of signals and raw frames", Produces: "text/event-stream", Params: []apiParam{
+		{"types", "comma-separated: snapshot, signal, raw"},
+		{"signals", "comma-separated FRAME.signal or signal names"},
+		{"id", "IDs and ranges of raw frames and of the frames signals come from, e.g. 0x100-0x1FF,ERR"},
+		{"max_rate", "max updates per second per signal and per ID; the latest value is sent when the interval is over"},
+	}}, serveEvents(ctx))
+
+	busView("/api/stats", apiDoc{Summary: "Bus load, frame rates and drops per stage", Response: BusStatsSnapshot{}}, func(app *App, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(statsSnapshot(app))
+	})
+
+	busView("/api/errors", apiDoc{Summary: "Error frames and controller state", Response: BusErrorSnapshot{}}, func(app *App, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Errors.Snapshot())
+	})
+
+	view("/api/recording", apiDoc{Summary: "Recorder status", Response: RecordingStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Recorder.Status())
+	})
+
+	view("/api/recordings", apiDoc{Summary: "Recordings in the recording directory", Response: []RecordingFile{}}, func(w http.ResponseWriter, r *http.Request) {
+		list, err := app.Recorder.List()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	})
+
+	view("/api/recordings/{file}", apiDoc{Summary: "Download a finished recording: name.log as candump, name.mf4 as MDF4 with decoded signals", Produces: "application/octet-stream"}, func(w http.ResponseWriter, r *http.Request) {
+		file := r.PathValue("file")
+		name, mf4 := strings.CutSuffix(file, ".mf4")
+		name = strings.TrimSuffix(name, ".log")
+		path, err := app.Recorder.File(name)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if mf4 {
+			serveMF4(w, r, name+".mf4", logFileFrames(path), app.Profiles.Defs())
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.log"`, name))
+		http.ServeFile(w, r, path)
+	})
+
+	view("/api/replay", apiDoc{Summary: "Replay position, speed and state", Response: ReplayStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		if app.Replay == nil {
+			writeError(w, http.StatusNotFound, "not replaying")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Replay.Status())
+	})
+
+	operate("/api/replay/{action}", apiDoc{
+		Methods:  []string{http.MethodPost},
+		Summary:  "Pause, resume, seek, change the speed of or loop the replay",
+		Request:  replayParams{},
+		Response: ReplayStatus{},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if app.Replay == nil {
+			writeError(w, http.StatusNotFound, "not replaying")
+			return
+		}
+		params, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<16))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		st, err := app.Replay.Action(r.PathValue("action"), params)
+		app.Audit.Record(r.Context(), "http", "replay."+r.PathValue("action"), params, err)
+		if errors.Is(err, errUnknownReplayAction) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(st)
+	}))
+
+	view("/api/dashboards", apiDoc{Summary: "Saved dashboards (named signal groups)", Response: []Dashboard{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Dashboards.List())
+	})
+
+	view("/api/dashboards/{name}", apiDoc{Summary: "One dashboard", Response: Dashboard{}}, func(w http.ResponseWriter, r *http.Request) {
+		db, err := app.Dashboards.Get(r.PathValue("name"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(db)
+	})
+
+	view("/api/sessions", apiDoc{Summary: "Sessions, newest first, without their alerts and per-ID counts", Response: []Session{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Sessions.List())
+	})
+
+	view("/api/sessions/{id}", apiDoc{Summary: "One session with its alerts and frame counts, so far if it is active", Response: Session{}}, func(w http.ResponseWriter, r *http.Request) {
+		sess, err := app.Sessions.Get(r.PathValue("id"), readSessionCounters(app))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(sess)
+	})
+
+	view("/api/sessions/{id}/export", apiDoc{Summary: "A session as a zip of session.json, its recording and its history as CSV", Produces: "application/zip"}, func(w http.ResponseWriter, r *http.Request) {
+		sess, err := app.Sessions.Get(r.PathValue("id"), readSessionCounters(app))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="session-%s.zip"`, sess.ID))
+		if err := WriteSessionZip(w, app, sess); err != nil {
+			slog.Warn("session export failed", "id", sess.ID, "err", err)
+		}
+	})
+
+	view("/api/compare", apiDoc{Summary: "Compare frame rates and signal ranges against a reference session", Response: Comparison{}, Params: []apiParam{
+		{"reference", "ID of the known-good session"},
+		{"against", "session to check, or live for the bus now; default the active session, else live"},
+		{"rate_tolerance_pct", "allowed frame rate deviation, default 10"},
+		{"margin_pct", "widens the reference signal envelope by this share of its span, default 0"},
+	}}, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		now := readSessionCounters(app)
+		ref, err := app.Sessions.Get(q.Get("reference"), now)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "reference: "+err.Error())
+			return
+		}
+		refSide, err := sessionSide(ref)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		tolerance, margin := float64(compareDefaultRateTolerance), 0.0
+		for _, p := range []struct {
+			name string
+			v    *float64
+		}{{"rate_tolerance_pct", &tolerance}, {"margin_pct", &margin}} {
+			if s := q.Get(p.name); s != "" {
+				if *p.v, err = strconv.ParseFloat(s, 64); err != nil || *p.v < 0 {
+					writeError(w, http.StatusBadRequest, "bad "+p.name)
+					return
+				}
+			}
+		}
+		id := cmp.Or(q.Get("against"), app.Sessions.Active())
+		if id == ref.ID {
+			writeError(w, http.StatusBadRequest, "against is the reference session")
+			return
+		}
+		cur := liveSide(app, refSide)
+		if id != "" && id != "live" {
+			sess, err := app.Sessions.Get(id, now)
+			if err != nil {
+				writeError(w, http.StatusNotFound, "against: "+err.Error())
+				return
+			}
+			if cur, err = sessionSide(sess); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Compare(refSide, cur, tolerance, margin, app.Profiles.Defs()))
+	})
+
+	view("/api/markers", apiDoc{Summary: "Markers added via the control API and triggers", Response: []Marker{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Markers.List())
+	})
+
+	view("/api/profiles", apiDoc{Summary: "Active and available CAN map profiles", Response: ProfilesResponse{}}, func(w http.ResponseWriter, r *http.Request) {
+		resp := ProfilesResponse{Active: app.Profiles.Active(), Profiles: app.Profiles.Names()}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	view("/api/map/validation", apiDoc{Summary: "Overlapping, oversized and duplicate signals in the active profile's map", Response: MapReport{}}, func(w http.ResponseWriter, r *http.Request) {
+		resp := newMapReport(app.Profiles.Defs(), app.Profiles.Warnings())
+		resp.Profile = app.Profiles.Active()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	busView("/api/decode-preview", apiDoc{Summary: "How the active map decodes a payload: every signal's raw and scaled value; nothing is sent or stored", Response: DecodePreview{}, Params: []apiParam{
+		{"id", "frame ID in hex, e.g. 0x100"},
+		{"data", "payload in hex, up to 8 bytes"},
+	}}, func(app *App, w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		f, err := sendParams{ID: q.Get("id"), Data: q.Get("data")}.frame()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		def, ok := app.Profiles.Lookup(uint32(f.ID))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(PreviewDecode(f, def, ok, lookupDecodeHook(uint32(f.ID)) != nil))
+	})
+
+	view("/api/uds", apiDoc{Summary: "Diagnostic session and security level of each ECU addressed, and the seed-key algorithms", Response: UDSStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.UDS.Status())
+	})
+
+	view("/api/tx", apiDoc{Summary: "TX armed state, allow list, rate limits and sent and refused counts", Response: TxGuardStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.TxGuard.Status())
+	})
+
+	view("/api/generator", apiDoc{Summary: "Sweep, random and increment jobs and the generator's limits", Response: GeneratorStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Generator.Status())
+	})
+
+	view("/api/sequences", apiDoc{Summary: "Sequence runs, newest first, without step results, and the scripts available", Response: SequencesStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(app.Sequencer.Status())
+	})
+
+	view("/api/sequences/{id}", apiDoc{Summary: "One sequence run with the result of every step so far", Response: SeqRunStatus{}}, func(w http.ResponseWriter, r *http.Request) {
+		st, err := app.Sequencer.Get(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(st)
+	})
+
+	view("/api/audit", apiDoc{Summary: "Operator actions, newest first", Response: []AuditEntry{}, Params: []apiParam{
+		{"user", "only this user's actions"},
+		{"action", "action name prefix, e.g. uds. or frame.send"},
+		{"since", "RFC 3339 or unix seconds"},
+		{"until", "RFC 3339 or unix seconds"},
+		{"last", "duration before now, e.g. 1h (overrides since)"},
+		{"session", "session ID, shorthand for its start and end"},
+		{"limit", "max entries (default 100)"},
+	}}, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		aq := AuditQuery{User: q.Get("user"), Action: q.Get("action")}
+		var err error
+		if aq.Since, aq.Until, err = historyWindow(app, q); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if s := q.Get("limit"); s != "" {
+			if aq.Limit, err = strconv.Atoi(s); err != nil || aq.Limit < 1 {
+				writeError(w, http.StatusBadRequest, "bad limit")
+				return
+			}
+		}
+		entries, err := app.Audit.Query(aq)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(entries)
+	})
+
+	view("/api/whoami", apiDoc{Summary: "The authenticated principal", Response: WhoAmIResponse{}}, func(w http.ResponseWriter, r *http.Request) {
+		p, _ := PrincipalFrom(r.Context())
+		resp := WhoAmIResponse{Name: p.Name, Role: p.Role.String(), AuthEnabled: app.Auth.Enabled()}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+
+	// Orchestrator webhook
+	operate("/api/control", apiDoc{
+		Methods:  []string{http.MethodGet, http.MethodPost},
+		Summary:  "List actions (GET) or run one (POST)",
+		Request:  controlRequest{},
+		Response: controlResponse{},
+	}, app.Control)
+
+	view("/api/openapi.json", apiDoc{Summary: "This document"}, spec.ServeHTTP)
+
 	srv := &http.Server{
-		Addr:              addr,
-		Handler:           mux,
+		Addr:              hc.Addr,
+		Handler:           compressHandler(mux),
+		TLSConfig:         tlsConfig,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
@@ -44,10 +923,48 @@ func StartWebServer(ctx context.Context, addr string, iface string, store *Store
 		_ = srv.Shutdown(shutdownCtx)
 	}()
 
-	log.Printf("Web: http://%s", addr)
-	err := srv.ListenAndServe()
+	if !app.Auth.Enabled() {
+		slog.Warn("no auth users configured; read-only API and UI are unauthenticated")
+	}
+	if tlsConfig != nil {
+		slog.Info("web server listening", "url", "https://"+hc.Addr)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		slog.Info("web server listening", "url", "http://"+hc.Addr)
+		err = srv.ListenAndServe()
+	}
 	if errors.Is(err, http.ErrServerClosed) {
 		return nil
 	}
 	return err
 }
+
+// historyWindow reads the since, until and last query parameters of the
+// history endpoints.
+func historyWindow(app *App, q url.Values) (since, until time.Time, err error) {
+	if id := q.Get("session"); id != "" {
+		sess, err := app.Sessions.Get(id, sessionCounters{})
+		if err != nil {
+			return since, until, err
+		}
+		since, until = sess.window()
+	}
+	if s := q.Get("since"); s != "" {
+		if since, err = parseQueryTime(s); err != nil {
+			return since, until, fmt.Errorf("since: %w", err)
+		}
+	}
+	if s := q.Get("until"); s != "" {
+		if until, err = parseQueryTime(s); err != nil {
+			return since, until, fmt.Errorf("until: %w", err)
+		}
+	}
+	if d := q.Get("last"); d != "" {
+		dur, err := time.ParseDuration(d)
+		if err != nil {
+			return since, until, fmt.Errorf("last: %w", err)
+		}
+		since = time.Now().Add(-dur)
+	}
+	return since, until, nil
+}
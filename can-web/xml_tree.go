@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// xmlNode is a namespace-free element tree, enough to walk the database
+// formats that come as XML (ARXML, KCD) without mirroring their schemas in
+// structs.
+type xmlNode struct {
+	Name     string
+	Attrs    map[string]string
+	Text     string
+	Parent   *xmlNode
+	Children []*xmlNode
+}
+
+func parseXMLTree(r io.Reader) (*xmlNode, error) {
+	d := xml.NewDecoder(r)
+	var root, cur *xmlNode
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{Name: t.Name.Local, Parent: cur}
+			if len(t.Attr) > 0 {
+				n.Attrs = make(map[string]string, len(t.Attr))
+				for _, a := range t.Attr {
+					n.Attrs[a.Name.Local] = a.Value
+				}
+			}
+			if cur == nil {
+				if root != nil {
+					return nil, errors.New("more than one root element")
+				}
+				root = n
+			} else {
+				cur.Children = append(cur.Children, n)
+			}
+			cur = n
+		case xml.EndElement:
+			cur = cur.Parent
+		case xml.CharData:
+			if cur != nil {
+				cur.Text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("no root element")
+	}
+	return root, nil
+}
+
+// Child returns the first child called name, following further names down
+// the tree, or nil.
+func (n *xmlNode) Child(names ...string) *xmlNode {
+	for _, name := range names {
+		if n == nil {
+			return nil
+		}
+		var next *xmlNode
+		for _, c := range n.Children {
+			if c.Name == name {
+				next = c
+				break
+			}
+		}
+		n = next
+	}
+	return n
+}
+
+// All returns the descendants called name in document order, without
+// descending into matches.
+func (n *xmlNode) All(name string) []*xmlNode {
+	var out []*xmlNode
+	var walk func(*xmlNode)
+	walk = func(n *xmlNode) {
+		for _, c := range n.Children {
+			if c.Name == name {
+				out = append(out, c)
+			} else {
+				walk(c)
+			}
+		}
+	}
+	if n != nil {
+		walk(n)
+	}
+	return out
+}
+
+// Value returns the trimmed text of the child at names, "" when missing.
+func (n *xmlNode) Value(names ...string) string {
+	if c := n.Child(names...); c != nil {
+		return strings.TrimSpace(c.Text)
+	}
+	return ""
+}
+
+func (n *xmlNode) Attr(name string) string {
+	if n == nil {
+		return ""
+	}
+	return n.Attrs[name]
+}